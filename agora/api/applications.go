@@ -9,8 +9,10 @@ import (
 	"github.com/astaxie/beego/validation"
 	"github.com/julienschmidt/httprouter"
 	"github.com/reverb/exeggutor/agora/api/model"
+	"github.com/reverb/exeggutor/events"
 	"github.com/reverb/exeggutor/protocol"
 	app_store "github.com/reverb/exeggutor/store/apps"
+	"github.com/reverb/go-mesos/mesos"
 )
 
 // ApplicationsController has the context for the applications resource
@@ -134,7 +136,9 @@ func (a *ApplicationsController) Save(rw http.ResponseWriter, req *http.Request,
 	}
 
 	for _, protoApp := range a.appConverter.ToAppManifest(&app) {
-		a.AppStore.Save(&protoApp)
+		if err := a.AppStore.SaveAs(&protoApp, author(req)); err == nil {
+			a.apiContext.Events.Publish(events.ForApp(events.AppSaved, &protoApp))
+		}
 	}
 
 	rw.WriteHeader(http.StatusOK)
@@ -144,17 +148,23 @@ func (a *ApplicationsController) Save(rw http.ResponseWriter, req *http.Request,
 // Delete deletes a definition from this service
 func (a *ApplicationsController) Delete(rw http.ResponseWriter, req *http.Request, pathParams httprouter.Params) {
 	pparam := pathParams.ByName("name")
+	app, _ := a.AppStore.Get(pparam)
 	err := a.AppStore.Delete(pparam)
 	if err != nil {
 		rw.WriteHeader(http.StatusInternalServerError)
 		rw.Write([]byte(fmt.Sprintf(`{"message":"Unkown error, %v", "type": "error"}`, err)))
 		return
 	}
+	if app != nil {
+		a.apiContext.Events.Publish(events.ForApp(events.AppDeleted, app))
+	}
 	rw.WriteHeader(http.StatusNoContent)
 }
 
 // Deploy takes this application and schedules it for deploy
 // or for upgrade.
+// With ?strategy=rolling the instances of the versions that are deployed get replaced in batches,
+// batch_size, max_surge, max_unavailable and on_failure (pause or rollback) configure the rollout.
 func (a *ApplicationsController) Deploy(rw http.ResponseWriter, req *http.Request, pathParams httprouter.Params) {
 	pparam := pathParams.ByName("name")
 	log.Debug("Received a request to deploy app [%s]", pparam)
@@ -168,10 +178,117 @@ func (a *ApplicationsController) Deploy(rw http.ResponseWriter, req *http.Reques
 		notFound(rw, "App", pparam)
 		return
 	}
+	a.deploy(rw, req, data)
+}
 
-	a.apiContext.Framework.SubmitApp([]protocol.Application{*data})
+// deploy submits the app or starts a rolling deployment for it when the request asks for one
+func (a *ApplicationsController) deploy(rw http.ResponseWriter, req *http.Request, data *protocol.Application) {
+	if req.URL.Query().Get("strategy") == "rolling" {
+		strategy, err := readRolloutStrategy(req)
+		if err != nil {
+			badRequest(rw, err)
+			return
+		}
+		rollout, err := a.apiContext.Framework.StartRollout(data, strategy)
+		if err != nil {
+			deployError(rw, err)
+			return
+		}
+		if rollout != nil {
+			rw.WriteHeader(http.StatusAccepted)
+			renderJSON(rw, rollout)
+			return
+		}
+	} else if err := a.apiContext.Framework.SubmitApp([]protocol.Application{*data}); err != nil {
+		deployError(rw, err)
+		return
+	}
 
 	rw.WriteHeader(http.StatusAccepted)
 	d, _ := json.Marshal(a.appConverter.FromAppManifest(data))
 	rw.Write(d)
 }
+
+// taskIDs renders the ids of the tasks an operation affected
+func taskIDs(rw http.ResponseWriter, status int, taskIDs []*mesos.TaskID) {
+	ids := []string{}
+	for _, taskID := range taskIDs {
+		ids = append(ids, taskID.GetValue())
+	}
+	rw.WriteHeader(status)
+	renderJSON(rw, map[string]interface{}{"tasks": ids})
+}
+
+// Stop deactivates the component and stops its tasks, with ?all=true all the components of its application are stopped.
+// It renders the ids of the tasks that are being stopped.
+func (a *ApplicationsController) Stop(rw http.ResponseWriter, req *http.Request, pathParams httprouter.Params) {
+	app := a.currentApp(rw, pathParams)
+	if app == nil {
+		return
+	}
+	var stopped []*mesos.TaskID
+	var err error
+	if req.URL.Query().Get("all") == "true" {
+		stopped, err = a.apiContext.Framework.StopApp(app.GetAppName())
+	} else {
+		stopped, err = a.apiContext.Framework.StopComponent(app.GetAppName(), app.GetName())
+	}
+	if err != nil {
+		unknownErrorWithMessage(rw, err)
+		return
+	}
+	taskIDs(rw, http.StatusAccepted, stopped)
+}
+
+// Scale sets the number of instances of the active version of the component to the instances in the request body,
+// it renders the ids of the tasks that are being stopped to get there
+func (a *ApplicationsController) Scale(rw http.ResponseWriter, req *http.Request, pathParams httprouter.Params) {
+	var body struct {
+		Instances *int32 `json:"instances"`
+	}
+	if err := readJSON(req, &body); err != nil || body.Instances == nil {
+		invalidJSON(rw)
+		return
+	}
+	if *body.Instances < 0 {
+		badRequest(rw, fmt.Errorf("the number of instances can't be negative but was %d", *body.Instances))
+		return
+	}
+	app := a.currentApp(rw, pathParams)
+	if app == nil {
+		return
+	}
+	active, err := a.AppStore.Find(func(other *protocol.Application) bool {
+		return other.GetAppName() == app.GetAppName() && other.GetName() == app.GetName() && other.GetActive()
+	})
+	if err != nil {
+		unknownErrorWithMessage(rw, err)
+		return
+	}
+	if active == nil {
+		notFound(rw, "Active version of", app.GetAppName()+"/"+app.GetName())
+		return
+	}
+	stopped, err := a.apiContext.Framework.ScaleComponent(app.GetAppName(), app.GetName(), *body.Instances)
+	if err != nil {
+		badRequest(rw, err)
+		return
+	}
+	taskIDs(rw, http.StatusAccepted, stopped)
+}
+
+// ListTasks lists the deployed tasks of every version of the component with their host and ports,
+// the status and host query parameters filter them
+func (a *ApplicationsController) ListTasks(rw http.ResponseWriter, req *http.Request, pathParams httprouter.Params) {
+	filter, err := readTaskFilter(req)
+	if err != nil {
+		badRequest(rw, err)
+		return
+	}
+	app := a.currentApp(rw, pathParams)
+	if app == nil {
+		return
+	}
+	filter.AppName, filter.Component = app.GetAppName(), app.GetName()
+	renderTasks(rw, a.apiContext, filter)
+}
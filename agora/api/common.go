@@ -7,8 +7,10 @@ import (
 
 	"github.com/op/go-logging"
 	"github.com/reverb/exeggutor"
+	"github.com/reverb/exeggutor/events"
 	"github.com/reverb/exeggutor/scheduler"
 	app_store "github.com/reverb/exeggutor/store/apps"
+	"github.com/reverb/exeggutor/tasks"
 )
 
 const (
@@ -23,6 +25,8 @@ type APIContext struct {
 	Framework *scheduler.Framework
 	Config    *exeggutor.Config
 	AppStore  app_store.AppStore
+	// Events the stream the changes made through the api are published on, it can be nil
+	Events *events.Stream
 }
 
 func renderJSON(rw http.ResponseWriter, data interface{}) {
@@ -64,3 +68,23 @@ func notFound(rw http.ResponseWriter, name, id string) {
 	}
 	rw.Write([]byte(fmt.Sprintf(`{"message":"Couldn't find %s for key '%s'.", "type": "error"}`, name, id)))
 }
+
+func badRequest(rw http.ResponseWriter, err error) {
+	rw.WriteHeader(http.StatusBadRequest)
+	rw.Write([]byte(fmt.Sprintf(`{"message":"%v", "type": "error"}`, err)))
+}
+
+// quotaExceeded explains which quota kept an app from being deployed
+func quotaExceeded(rw http.ResponseWriter, err *tasks.QuotaExceededError) {
+	rw.WriteHeader(http.StatusForbidden)
+	renderJSON(rw, map[string]interface{}{"message": err.Error(), "type": "error", "quota": err})
+}
+
+// deployError renders the error that kept an app from being deployed
+func deployError(rw http.ResponseWriter, err error) {
+	if quotaErr, ok := err.(*tasks.QuotaExceededError); ok {
+		quotaExceeded(rw, quotaErr)
+		return
+	}
+	unknownErrorWithMessage(rw, err)
+}
@@ -0,0 +1,38 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/reverb/exeggutor/tasks"
+)
+
+// CrashLoopsController contains the context for the api calls about failing components
+type CrashLoopsController struct {
+	context *APIContext
+}
+
+// NewCrashLoopsController creates a new instance of a crash loops controller
+func NewCrashLoopsController(context *APIContext) *CrashLoopsController {
+	return &CrashLoopsController{context: context}
+}
+
+// ListAll lists the components that failed recently, crash looping components have crash_looping set
+func (c *CrashLoopsController) ListAll(rw http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	crashLoops := c.context.Framework.CrashLoops()
+	if crashLoops == nil {
+		crashLoops = []tasks.CrashLoop{}
+	}
+	rw.WriteHeader(http.StatusOK)
+	renderJSON(rw, crashLoops)
+}
+
+// Clear forgets the failures of a component so it gets deployed again
+func (c *CrashLoopsController) Clear(rw http.ResponseWriter, req *http.Request, pathParams httprouter.Params) {
+	app, component := pathParams.ByName("app"), pathParams.ByName("component")
+	if !c.context.Framework.ClearCrashLoop(app, component) {
+		notFound(rw, "Crash loop", app+"/"+component)
+		return
+	}
+	rw.WriteHeader(http.StatusNoContent)
+}
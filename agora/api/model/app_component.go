@@ -1,6 +1,8 @@
 package model
 
 import (
+	"regexp"
+	"strconv"
 	"strings"
 	"time"
 
@@ -66,6 +68,15 @@ type AppComponent struct {
 
 	// SLA the sla for this application if there is any
 	SLA *AppSLA `json:"sla"`
+
+	// Constraints limit the slaves instances of this component can be placed on
+	Constraints []Constraint `json:"constraints,omitempty"`
+
+	// PriorityClass how urgently instances of this component are deployed (low, normal, high, critical)
+	PriorityClass string `json:"priority_class,omitempty"`
+
+	// Team the team that owns this component, the quota of the team applies to it
+	Team string `json:"team,omitempty" valid:"AlphaDash"`
 }
 
 // Valid validates this struct
@@ -86,6 +97,51 @@ func (a AppComponent) Valid(v *validation.Validation) {
 	default:
 		v.SetError("component_type", a.ComponentType+" is not supported as component type.")
 	}
+
+	if a.DiskSpace < 0 {
+		v.SetError("disk_space", "Disk space can't be negative")
+	}
+
+	switch strings.ToUpper(a.PriorityClass) {
+	case "", "LOW", "NORMAL", "HIGH", "CRITICAL":
+	default:
+		v.SetError("priority_class", "Priority class must be one of 'low', 'normal', 'high' or 'critical'")
+	}
+
+	for _, c := range a.Constraints {
+		c.Valid(v)
+	}
+}
+
+// Constraint a placement constraint, it compares an attribute of the slaves with the operator.
+// The hostname attribute is the host name of a slave.
+type Constraint struct {
+	// Attribute the slave attribute to compare
+	Attribute string `json:"attribute"`
+	// Operator one of UNIQUE, LIKE, UNLIKE, GROUP_BY or MAX_PER
+	Operator string `json:"operator"`
+	// Value the regular expression for LIKE and UNLIKE, the maximum for MAX_PER
+	Value string `json:"value,omitempty"`
+}
+
+// Valid validates a constraint
+func (c Constraint) Valid(v *validation.Validation) {
+	if c.Attribute == "" {
+		v.SetError("constraints", "A constraint needs an attribute")
+	}
+	switch strings.ToUpper(c.Operator) {
+	case "UNIQUE", "GROUP_BY":
+	case "LIKE", "UNLIKE":
+		if _, err := regexp.Compile(c.Value); err != nil {
+			v.SetError("constraints", "The value of a "+c.Operator+" constraint must be a regular expression")
+		}
+	case "MAX_PER":
+		if n, err := strconv.Atoi(c.Value); err != nil || n < 1 {
+			v.SetError("constraints", "The value of a MAX_PER constraint must be a positive number")
+		}
+	default:
+		v.SetError("constraints", "Operator must be one of 'unique', 'like', 'unlike', 'group_by' or 'max_per'")
+	}
 }
 
 // AppSLA an application SLA describes how to check for health of a service
@@ -97,6 +153,10 @@ type AppSLA struct {
 	MaxInstances int `json:"max_instances" valid:"Min(1)"`
 	// HealthCheck the health check strategy to use
 	HealthCheck *HealthCheck `json:"healthcheck" valid:"Required"`
+	// UnhealthyAt the number of health checks that have to fail in a row before an instance is unhealthy, defaults to 1
+	UnhealthyAt int `json:"unhealthy_at,omitempty" valid:"Min(0)"`
+	// HealthyAt the number of health checks that have to succeed in a row before an unhealthy instance is healthy again, defaults to 1
+	HealthyAt int `json:"healthy_at,omitempty" valid:"Min(0)"`
 }
 
 // Valid validates an AppSLA
@@ -108,7 +168,7 @@ func (s AppSLA) Valid(v *validation.Validation) {
 
 // HealthCheck describes the health check that is configured for an application
 type HealthCheck struct {
-	// Mode the mode for this health check (TCP, HTTP, METRICS)
+	// Mode the mode for this health check (TCP, HTTP, METRICS, COMMAND)
 	Mode string `json:"mode" valid:"Required"`
 	// Rampup the rampup for this metric
 	Rampup time.Duration `json:"rampup" valid:"Required"`
@@ -120,6 +180,14 @@ type HealthCheck struct {
 	Path string `json:"path"`
 	// Scheme the scheme for the health check, defaults to http
 	Scheme string `json:"scheme"`
+	// NonCriticalChecks the named checks of a METRICS health check that only make an instance degraded when they fail
+	NonCriticalChecks []string `json:"non_critical_checks,omitempty"`
+	// IgnoreNonCritical ignores the failing non-critical checks instead of reporting the instance as degraded
+	IgnoreNonCritical bool `json:"ignore_non_critical,omitempty"`
+	// Command the executable a COMMAND health check runs
+	Command string `json:"command,omitempty"`
+	// Arguments the arguments a COMMAND health check runs the executable with
+	Arguments []string `json:"arguments,omitempty"`
 }
 
 func (h HealthCheck) Valid(v *validation.Validation) {
@@ -144,8 +212,11 @@ func (h HealthCheck) Valid(v *validation.Validation) {
 		v.SetError("interval", "An interval can at most be 5 minutes.")
 	}
 
-	if h.Mode != "TCP" && h.Mode != "HTTP" && h.Mode != "METRICS" {
-		v.SetError("mode", "Mode must be one of 'tcp', 'http' or 'metrics'")
+	if h.Mode != "TCP" && h.Mode != "HTTP" && h.Mode != "METRICS" && h.Mode != "COMMAND" {
+		v.SetError("mode", "Mode must be one of 'tcp', 'http', 'metrics' or 'command'")
+	}
+	if h.Mode == "COMMAND" && h.Command == "" {
+		v.SetError("command", "A command health check needs a command to run")
 	}
 
 }
@@ -86,6 +86,20 @@ func (mj *AppComponent) MarshalJSONBuf(buf *bytes.Buffer) error {
 	}
 	buf.WriteString(`"component_type":`)
 	ffjson_WriteJsonString(buf, mj.ComponentType)
+	if len(mj.Constraints) != 0 {
+		if first == true {
+			first = false
+		} else {
+			buf.WriteString(`,`)
+		}
+		buf.WriteString(`"constraints":`)
+		/* Falling back. type=[]model.Constraint kind=slice */
+		obj, err = json.Marshal(mj.Constraints)
+		if err != nil {
+			return err
+		}
+		buf.Write(obj)
+	}
 	if first == true {
 		first = false
 	} else {
@@ -147,6 +161,24 @@ func (mj *AppComponent) MarshalJSONBuf(buf *bytes.Buffer) error {
 		return err
 	}
 	buf.Write(obj)
+	if len(mj.PriorityClass) != 0 {
+		if first == true {
+			first = false
+		} else {
+			buf.WriteString(`,`)
+		}
+		buf.WriteString(`"priority_class":`)
+		ffjson_WriteJsonString(buf, mj.PriorityClass)
+	}
+	if len(mj.Team) != 0 {
+		if first == true {
+			first = false
+		} else {
+			buf.WriteString(`,`)
+		}
+		buf.WriteString(`"team":`)
+		ffjson_WriteJsonString(buf, mj.Team)
+	}
 	if first == true {
 		first = false
 	} else {
@@ -41,12 +41,16 @@ func (a *ApplicationsConverter) FromAppManifest(application *protocol.Applicatio
 		var hc *HealthCheck
 		if h != nil {
 			hc = &HealthCheck{
-				Mode:     h.GetMode().String(),
-				Rampup:   time.Duration(h.GetRampUp()),
-				Interval: time.Duration(h.GetIntervalMillis()),
-				Timeout:  time.Duration(h.GetTimeout()),
-				Path:     h.GetPath(),
-				Scheme:   h.GetScheme(),
+				Mode:              h.GetMode().String(),
+				Rampup:            time.Duration(h.GetRampUp()),
+				Interval:          time.Duration(h.GetIntervalMillis()),
+				Timeout:           time.Duration(h.GetTimeout()),
+				Path:              h.GetPath(),
+				Scheme:            h.GetScheme(),
+				NonCriticalChecks: h.GetNonCriticalChecks(),
+				IgnoreNonCritical: h.GetIgnoreNonCritical(),
+				Command:           h.GetCommand(),
+				Arguments:         h.GetArguments(),
 			}
 		}
 
@@ -54,9 +58,25 @@ func (a *ApplicationsConverter) FromAppManifest(application *protocol.Applicatio
 			MinInstances: int(s.GetMinInstances()),
 			MaxInstances: int(s.GetMaxInstances()),
 			HealthCheck:  hc,
+			UnhealthyAt:  int(s.GetUnhealthyAt()),
+			HealthyAt:    int(s.GetHealthyAt()),
 		}
 	}
 
+	var constraints []Constraint
+	for _, c := range application.GetConstraints() {
+		constraints = append(constraints, Constraint{
+			Attribute: c.GetAttribute(),
+			Operator:  c.GetOperator().String(),
+			Value:     c.GetValue(),
+		})
+	}
+
+	var priorityClass string
+	if application.PriorityClass != nil {
+		priorityClass = strings.ToLower(application.GetPriorityClass().String())
+	}
+
 	return App{
 		Name: application.GetAppName(),
 		Components: map[string]AppComponent{
@@ -73,6 +93,9 @@ func (a *ApplicationsConverter) FromAppManifest(application *protocol.Applicatio
 				ComponentType: strings.ToLower(application.GetComponentType().String()),
 				Active:        application.GetActive(),
 				SLA:           sla,
+				Constraints:   constraints,
+				PriorityClass: priorityClass,
+				Team:          application.GetTeam(),
 			},
 		},
 	}
@@ -119,14 +142,46 @@ func (a *ApplicationsConverter) ToAppManifest(app *App) (cmps []protocol.Applica
 					Path:           proto.String(h.Path),
 					Scheme:         proto.String(h.Scheme),
 				}
+				if mode == protocol.HealthCheckMode_METRICS {
+					hc.NonCriticalChecks = h.NonCriticalChecks
+					hc.IgnoreNonCritical = proto.Bool(h.IgnoreNonCritical)
+				}
+				if mode == protocol.HealthCheckMode_COMMAND {
+					hc.Command = proto.String(h.Command)
+					hc.Arguments = h.Arguments
+				}
 			}
 			sla = &protocol.ApplicationSLA{
 				MinInstances: proto.Int32(int32(s.MinInstances)),
 				MaxInstances: proto.Int32(int32(s.MaxInstances)),
 				HealthCheck:  hc,
+				UnhealthyAt:  proto.Int32(1),
+			}
+			if s.UnhealthyAt > 0 {
+				sla.UnhealthyAt = proto.Int32(int32(s.UnhealthyAt))
+			}
+			if s.HealthyAt > 0 {
+				sla.HealthyAt = proto.Int32(int32(s.HealthyAt))
 			}
 		}
 
+		var constraints []*protocol.PlacementConstraint
+		for _, c := range comp.Constraints {
+			constraint := &protocol.PlacementConstraint{
+				Attribute: proto.String(c.Attribute),
+				Operator:  protocol.ConstraintOperator(protocol.ConstraintOperator_value[strings.ToUpper(c.Operator)]).Enum(),
+			}
+			if c.Value != "" {
+				constraint.Value = proto.String(c.Value)
+			}
+			constraints = append(constraints, constraint)
+		}
+
+		var priorityClass *protocol.PriorityClass
+		if comp.PriorityClass != "" {
+			priorityClass = protocol.PriorityClass(protocol.PriorityClass_value[strings.ToUpper(comp.PriorityClass)]).Enum()
+		}
+
 		appID := strings.Join([]string{app.Name, comp.Name, comp.Version}, "-")
 		dist := protocol.Distribution_DOCKER.Enum()
 		compType := protocol.ComponentType(protocol.ComponentType_value[strings.ToUpper(comp.ComponentType)])
@@ -137,7 +192,7 @@ func (a *ApplicationsConverter) ToAppManifest(app *App) (cmps []protocol.Applica
 			Name:          proto.String(comp.Name),
 			Cpus:          proto.Float32(float32(comp.Cpus)),
 			Mem:           proto.Float32(float32(comp.Mem)),
-			DiskSpace:     proto.Int64(0),
+			DiskSpace:     proto.Int64(int64(comp.DiskSpace)),
 			DistUrl:       proto.String(distURL),
 			Command:       proto.String(comp.Command),
 			Env:           env,
@@ -151,6 +206,11 @@ func (a *ApplicationsConverter) ToAppManifest(app *App) (cmps []protocol.Applica
 			AppName:       proto.String(app.Name),
 			Active:        proto.Bool(comp.Active),
 			Sla:           sla,
+			Constraints:   constraints,
+			PriorityClass: priorityClass,
+		}
+		if comp.Team != "" {
+			cmp.Team = proto.String(comp.Team)
 		}
 		cmps = append(cmps, cmp)
 	}
@@ -0,0 +1,50 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/reverb/exeggutor/tasks"
+)
+
+// QueueController contains the context for the api calls about the task queue
+type QueueController struct {
+	context *APIContext
+}
+
+// NewQueueController creates a new instance of a queue controller
+func NewQueueController(context *APIContext) *QueueController {
+	return &QueueController{context: context}
+}
+
+// ListAll lists the queued items in the order they would be placed,
+// every item shows the last offers it was checked against and why they didn't fit
+func (q *QueueController) ListAll(rw http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	rw.WriteHeader(http.StatusOK)
+	renderJSON(rw, q.context.Framework.QueuedItems())
+}
+
+// Cancel removes the queued items of a component, or only the one with the id in the path.
+// The items of a component with an SLA would be queued again, cancelling those is a conflict.
+func (q *QueueController) Cancel(rw http.ResponseWriter, req *http.Request, pathParams httprouter.Params) {
+	app, component, id := pathParams.ByName("app"), pathParams.ByName("component"), pathParams.ByName("id")
+	cancelled, err := q.context.Framework.CancelQueued(app, component, id)
+	if managedErr, ok := err.(*tasks.ManagedBySLAError); ok {
+		rw.WriteHeader(http.StatusConflict)
+		renderJSON(rw, map[string]interface{}{"message": managedErr.Error(), "type": "error"})
+		return
+	}
+	if err != nil {
+		unknownErrorWithMessage(rw, err)
+		return
+	}
+	if cancelled == 0 {
+		name := app + "/" + component
+		if id != "" {
+			name += "/" + id
+		}
+		notFound(rw, "Queued item", name)
+		return
+	}
+	rw.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,139 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"code.google.com/p/goprotobuf/proto"
+	"github.com/julienschmidt/httprouter"
+	"github.com/reverb/exeggutor/protocol"
+	"github.com/reverb/exeggutor/tasks"
+)
+
+// QuotasController contains the context for the api calls about resource quotas
+type QuotasController struct {
+	context *APIContext
+}
+
+// NewQuotasController creates a new instance of a quotas controller
+func NewQuotasController(context *APIContext) *QuotasController {
+	return &QuotasController{context: context}
+}
+
+// quotaScope reads the scope path parameter, rendering an error when it isn't app or team
+func quotaScope(rw http.ResponseWriter, pathParams httprouter.Params) (protocol.QuotaScope, bool) {
+	value := pathParams.ByName("scope")
+	scope, ok := protocol.QuotaScope_value[strings.ToUpper(value)]
+	if !ok {
+		badRequest(rw, fmt.Errorf("the scope of a quota should be app or team but was '%s'", value))
+		return protocol.QuotaScope_APP, false
+	}
+	return protocol.QuotaScope(scope), true
+}
+
+// ListAll lists all the quotas with the resources that are claimed against them
+func (q *QuotasController) ListAll(rw http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	quotas, err := q.context.AppStore.Quotas().List()
+	if err != nil {
+		unknownErrorWithMessage(rw, err)
+		return
+	}
+	result := []tasks.QuotaUsage{}
+	for _, quota := range quotas {
+		usage, err := q.context.Framework.QuotaUsage(quota)
+		if err != nil {
+			unknownErrorWithMessage(rw, err)
+			return
+		}
+		result = append(result, usage)
+	}
+	rw.WriteHeader(http.StatusOK)
+	renderJSON(rw, result)
+}
+
+// ShowOne shows a single quota with the resources that are claimed against it
+func (q *QuotasController) ShowOne(rw http.ResponseWriter, req *http.Request, pathParams httprouter.Params) {
+	scope, ok := quotaScope(rw, pathParams)
+	if !ok {
+		return
+	}
+	name := pathParams.ByName("name")
+	quota, err := q.context.AppStore.Quotas().Get(scope, name)
+	if err != nil {
+		unknownErrorWithMessage(rw, err)
+		return
+	}
+	if quota == nil {
+		notFound(rw, "Quota", name)
+		return
+	}
+	usage, err := q.context.Framework.QuotaUsage(quota)
+	if err != nil {
+		unknownErrorWithMessage(rw, err)
+		return
+	}
+	rw.WriteHeader(http.StatusOK)
+	renderJSON(rw, usage)
+}
+
+// Save creates or replaces the quota of an app or team with the limits in the request body,
+// a limit of 0 leaves that resource unlimited
+func (q *QuotasController) Save(rw http.ResponseWriter, req *http.Request, pathParams httprouter.Params) {
+	scope, ok := quotaScope(rw, pathParams)
+	if !ok {
+		return
+	}
+	var limits tasks.Resources
+	if err := readJSON(req, &limits); err != nil {
+		invalidJSON(rw)
+		return
+	}
+	if limits.Cpus < 0 || limits.Mem < 0 || limits.DiskSpace < 0 || limits.Instances < 0 {
+		badRequest(rw, fmt.Errorf("the limits of a quota can't be negative"))
+		return
+	}
+
+	quota := &protocol.ResourceQuota{
+		Scope:     scope.Enum(),
+		Name:      proto.String(pathParams.ByName("name")),
+		Cpus:      proto.Float32(float32(limits.Cpus)),
+		Mem:       proto.Float32(float32(limits.Mem)),
+		DiskSpace: proto.Int64(limits.DiskSpace),
+		Instances: proto.Int32(limits.Instances),
+	}
+	if err := q.context.AppStore.Quotas().Save(quota); err != nil {
+		unknownErrorWithMessage(rw, err)
+		return
+	}
+	usage, err := q.context.Framework.QuotaUsage(quota)
+	if err != nil {
+		unknownErrorWithMessage(rw, err)
+		return
+	}
+	rw.WriteHeader(http.StatusOK)
+	renderJSON(rw, usage)
+}
+
+// Delete removes the quota of an app or team
+func (q *QuotasController) Delete(rw http.ResponseWriter, req *http.Request, pathParams httprouter.Params) {
+	scope, ok := quotaScope(rw, pathParams)
+	if !ok {
+		return
+	}
+	name := pathParams.ByName("name")
+	quota, err := q.context.AppStore.Quotas().Get(scope, name)
+	if err != nil {
+		unknownErrorWithMessage(rw, err)
+		return
+	}
+	if quota == nil {
+		notFound(rw, "Quota", name)
+		return
+	}
+	if err := q.context.AppStore.Quotas().Delete(scope, name); err != nil {
+		unknownErrorWithMessage(rw, err)
+		return
+	}
+	rw.WriteHeader(http.StatusNoContent)
+}
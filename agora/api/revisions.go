@@ -0,0 +1,255 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+
+	"code.google.com/p/goprotobuf/proto"
+	"github.com/julienschmidt/httprouter"
+	"github.com/reverb/exeggutor/agora/api/model"
+	"github.com/reverb/exeggutor/events"
+	"github.com/reverb/exeggutor/protocol"
+)
+
+// AuthorHeader the request header that names who is changing an app
+const AuthorHeader = "X-Author"
+
+func author(req *http.Request) string {
+	return req.Header.Get(AuthorHeader)
+}
+
+type appRevision struct {
+	Revision int32      `json:"revision"`
+	SavedAt  int64      `json:"saved_at"`
+	Author   string     `json:"author,omitempty"`
+	App      *model.App `json:"app"`
+}
+
+type fieldChange struct {
+	Field string      `json:"field"`
+	From  interface{} `json:"from"`
+	To    interface{} `json:"to"`
+}
+
+func (a *ApplicationsController) toRevision(revision *protocol.ApplicationRevision) appRevision {
+	app := a.appConverter.FromAppManifest(revision.GetApp())
+	return appRevision{
+		Revision: revision.GetRevision(),
+		SavedAt:  revision.GetSavedAt(),
+		Author:   revision.GetAuthor(),
+		App:      &app,
+	}
+}
+
+// currentApp looks up the app for the name path parameter, rendering an error when that fails
+func (a *ApplicationsController) currentApp(rw http.ResponseWriter, pathParams httprouter.Params) *protocol.Application {
+	pparam := pathParams.ByName("name")
+	data, err := a.AppStore.Get(pparam)
+	if err != nil {
+		unknownErrorWithMessage(rw, err)
+		return nil
+	}
+	if data == nil {
+		notFound(rw, "App", pparam)
+		return nil
+	}
+	return data
+}
+
+// revision looks up a revision of the app, rendering an error when that fails
+func (a *ApplicationsController) revision(rw http.ResponseWriter, app *protocol.Application, value string) *protocol.ApplicationRevision {
+	number, err := strconv.Atoi(value)
+	if err != nil {
+		badRequest(rw, fmt.Errorf("the revision should be a number but was '%s'", value))
+		return nil
+	}
+	revision, err := a.AppStore.Revision(app.GetAppName(), app.GetName(), int32(number))
+	if err != nil {
+		unknownErrorWithMessage(rw, err)
+		return nil
+	}
+	if revision == nil {
+		notFound(rw, "Revision", value)
+		return nil
+	}
+	return revision
+}
+
+// ListRevisions lists all the saved manifests of an app, oldest first
+func (a *ApplicationsController) ListRevisions(rw http.ResponseWriter, req *http.Request, pathParams httprouter.Params) {
+	app := a.currentApp(rw, pathParams)
+	if app == nil {
+		return
+	}
+	revisions, err := a.AppStore.Revisions(app.GetAppName(), app.GetName())
+	if err != nil {
+		unknownErrorWithMessage(rw, err)
+		return
+	}
+	result := []appRevision{}
+	for _, revision := range revisions {
+		result = append(result, a.toRevision(revision))
+	}
+	rw.WriteHeader(http.StatusOK)
+	renderJSON(rw, result)
+}
+
+// ShowRevision shows a single saved manifest of an app
+func (a *ApplicationsController) ShowRevision(rw http.ResponseWriter, req *http.Request, pathParams httprouter.Params) {
+	app := a.currentApp(rw, pathParams)
+	if app == nil {
+		return
+	}
+	revision := a.revision(rw, app, pathParams.ByName("revision"))
+	if revision == nil {
+		return
+	}
+	rw.WriteHeader(http.StatusOK)
+	renderJSON(rw, a.toRevision(revision))
+}
+
+// DiffRevisions shows the fields that changed between the from and to revisions of an app
+func (a *ApplicationsController) DiffRevisions(rw http.ResponseWriter, req *http.Request, pathParams httprouter.Params) {
+	app := a.currentApp(rw, pathParams)
+	if app == nil {
+		return
+	}
+	from := a.revision(rw, app, req.URL.Query().Get("from"))
+	if from == nil {
+		return
+	}
+	to := a.revision(rw, app, req.URL.Query().Get("to"))
+	if to == nil {
+		return
+	}
+	changes, err := a.diff(from.GetApp(), to.GetApp())
+	if err != nil {
+		unknownErrorWithMessage(rw, err)
+		return
+	}
+	rw.WriteHeader(http.StatusOK)
+	renderJSON(rw, changes)
+}
+
+// Rollback saves the requested revision as the current manifest of the app and deploys it.
+// It takes the same parameters as Deploy, without a rolling strategy the other versions of the component are deactivated.
+// The running tasks are replaced right away unless they're rolled out, a revision of the same version as the
+// current manifest can't be rolled out because its instances have the same app id as the ones it replaces.
+func (a *ApplicationsController) Rollback(rw http.ResponseWriter, req *http.Request, pathParams httprouter.Params) {
+	app := a.currentApp(rw, pathParams)
+	if app == nil {
+		return
+	}
+	revision := a.revision(rw, app, req.URL.Query().Get("revision"))
+	if revision == nil {
+		return
+	}
+	log.Notice("Rolling %s back to revision %d", app.GetId(), revision.GetRevision())
+
+	target := revision.GetApp()
+	target.Active = proto.Bool(true)
+	if err := a.AppStore.SaveAs(target, author(req)); err != nil {
+		unknownErrorWithMessage(rw, err)
+		return
+	}
+	a.apiContext.Events.Publish(events.ForApp(events.AppSaved, target))
+
+	rolling := req.URL.Query().Get("strategy") == "rolling" && target.GetId() != app.GetId()
+	if !rolling {
+		others, err := a.AppStore.Filter(func(other *protocol.Application) bool {
+			return other.GetAppName() == target.GetAppName() &&
+				other.GetName() == target.GetName() &&
+				other.GetId() != target.GetId() &&
+				other.GetActive()
+		})
+		if err != nil {
+			unknownErrorWithMessage(rw, err)
+			return
+		}
+		for _, other := range others {
+			other.Active = proto.Bool(false)
+			if err := a.AppStore.SaveAs(other, author(req)); err != nil {
+				unknownErrorWithMessage(rw, err)
+				return
+			}
+			a.apiContext.Events.Publish(events.ForApp(events.AppSaved, other))
+		}
+	}
+
+	if rolling {
+		a.deploy(rw, req, target)
+		return
+	}
+	if _, err := a.apiContext.Framework.ReplaceComponent(target); err != nil {
+		deployError(rw, err)
+		return
+	}
+	rw.WriteHeader(http.StatusAccepted)
+	d, _ := json.Marshal(a.appConverter.FromAppManifest(target))
+	rw.Write(d)
+}
+
+// diff compares the api representation of two manifests field by field
+func (a *ApplicationsController) diff(from, to *protocol.Application) ([]fieldChange, error) {
+	fromFields, err := a.flatten(from)
+	if err != nil {
+		return nil, err
+	}
+	toFields, err := a.flatten(to)
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for name := range fromFields {
+		names = append(names, name)
+	}
+	for name := range toFields {
+		if _, ok := fromFields[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	changes := []fieldChange{}
+	for _, name := range names {
+		if !reflect.DeepEqual(fromFields[name], toFields[name]) {
+			changes = append(changes, fieldChange{Field: name, From: fromFields[name], To: toFields[name]})
+		}
+	}
+	return changes, nil
+}
+
+func (a *ApplicationsController) flatten(app *protocol.Application) (map[string]interface{}, error) {
+	converted := a.appConverter.FromAppManifest(app)
+	data, err := json.Marshal(&converted)
+	if err != nil {
+		return nil, err
+	}
+	var tree map[string]interface{}
+	if err := json.Unmarshal(data, &tree); err != nil {
+		return nil, err
+	}
+	fields := make(map[string]interface{})
+	flattenInto(fields, "", tree)
+	return fields, nil
+}
+
+func flattenInto(fields map[string]interface{}, prefix string, value interface{}) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, child := range v {
+			name := key
+			if prefix != "" {
+				name = prefix + "." + key
+			}
+			flattenInto(fields, name, child)
+		}
+	default:
+		fields[prefix] = v
+	}
+}
@@ -0,0 +1,101 @@
+package api
+
+import (
+	"encoding/json"
+	"testing"
+
+	"code.google.com/p/goprotobuf/proto"
+
+	"github.com/reverb/exeggutor/agora/api/model"
+	"github.com/reverb/exeggutor/store"
+	app_store "github.com/reverb/exeggutor/store/apps"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestRevisionsApi(t *testing.T) {
+
+	Convey("RevisionsApi", t, func() {
+		context := &APIContext{
+			Config:   testAppConfig(),
+			AppStore: app_store.NewWithStore(store.NewEmptyInMemoryStore()),
+		}
+		context.AppStore.Start()
+		controller := NewApplicationsController(context)
+		converter := model.New(context.Config)
+		server := NewTestHTTP()
+		server.Mount("GET", "/applications/:name/revisions", controller.ListRevisions)
+		server.Mount("GET", "/applications/:name/revisions/:revision", controller.ShowRevision)
+		server.Mount("GET", "/applications/:name/diff", controller.DiffRevisions)
+
+		Reset(func() {
+			context.AppStore.Stop()
+		})
+
+		ex := testApp("revised-service", "revised", context)
+		first := converter.ToAppManifest(&ex)[0]
+		context.AppStore.SaveAs(&first, "alice")
+		second := converter.ToAppManifest(&ex)[0]
+		second.Mem = proto.Float32(2)
+		context.AppStore.SaveAs(&second, "bob")
+
+		Convey("List the revisions of an application", func() {
+			Convey("returns 200 and the revisions oldest first", func() {
+				server.Get("/applications/" + first.GetId() + "/revisions")
+				So(response.Code, ShouldEqual, 200)
+
+				var revisions []appRevision
+				So(json.Unmarshal(response.Body.Bytes(), &revisions), ShouldBeNil)
+				So(revisions, ShouldHaveLength, 2)
+				So(revisions[0].Revision, ShouldEqual, 1)
+				So(revisions[0].Author, ShouldEqual, "alice")
+				So(revisions[1].Revision, ShouldEqual, 2)
+				So(revisions[1].Author, ShouldEqual, "bob")
+				So(revisions[1].App.Components["revised"].Mem, ShouldEqual, 2)
+			})
+
+			Convey("returns 404 for an unknown application", func() {
+				server.Get("/applications/unknown/revisions")
+				So(response.Code, ShouldEqual, 404)
+			})
+		})
+
+		Convey("Get a single revision", func() {
+			Convey("returns 200 and the revision", func() {
+				server.Get("/applications/" + first.GetId() + "/revisions/1")
+				So(response.Code, ShouldEqual, 200)
+
+				var revision appRevision
+				So(json.Unmarshal(response.Body.Bytes(), &revision), ShouldBeNil)
+				So(revision.Author, ShouldEqual, "alice")
+				So(revision.App.Components["revised"].Mem, ShouldEqual, 1)
+			})
+
+			Convey("returns 404 for an unknown revision", func() {
+				server.Get("/applications/" + first.GetId() + "/revisions/3")
+				So(response.Code, ShouldEqual, 404)
+			})
+
+			Convey("returns 400 when the revision isn't a number", func() {
+				server.Get("/applications/" + first.GetId() + "/revisions/latest")
+				So(response.Code, ShouldEqual, 400)
+			})
+		})
+
+		Convey("Diff two revisions", func() {
+			Convey("returns 200 and the changed fields", func() {
+				server.Get("/applications/" + first.GetId() + "/diff?from=1&to=2")
+				So(response.Code, ShouldEqual, 200)
+
+				var changes []fieldChange
+				So(json.Unmarshal(response.Body.Bytes(), &changes), ShouldBeNil)
+				So(changes, ShouldResemble, []fieldChange{{Field: "components.revised.mem", From: float64(1), To: float64(2)}})
+			})
+
+			Convey("returns an empty list for the same revision", func() {
+				server.Get("/applications/" + first.GetId() + "/diff?from=2&to=2")
+				So(response.Code, ShouldEqual, 200)
+				So(response.Body.String(), ShouldEqual, "[]\n")
+			})
+		})
+	})
+}
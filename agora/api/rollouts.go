@@ -0,0 +1,95 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/reverb/exeggutor/tasks"
+)
+
+// RolloutsController contains the context for the rolling deployment api calls
+type RolloutsController struct {
+	context *APIContext
+}
+
+// NewRolloutsController creates a new instance of a rollouts controller
+func NewRolloutsController(context *APIContext) *RolloutsController {
+	return &RolloutsController{context: context}
+}
+
+func readRolloutStrategy(req *http.Request) (tasks.RolloutStrategy, error) {
+	query := req.URL.Query()
+	strategy := tasks.RolloutStrategy{}
+	for name, field := range map[string]*int{
+		"batch_size":      &strategy.BatchSize,
+		"max_surge":       &strategy.MaxSurge,
+		"max_unavailable": &strategy.MaxUnavailable,
+	} {
+		value := query.Get(name)
+		if value == "" {
+			continue
+		}
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			return strategy, fmt.Errorf("%s should be a positive number but was '%s'", name, value)
+		}
+		*field = n
+	}
+	switch query.Get("on_failure") {
+	case "", "pause":
+	case "rollback":
+		strategy.RollbackOnFailure = true
+	default:
+		return strategy, fmt.Errorf("on_failure should be pause or rollback but was '%s'", query.Get("on_failure"))
+	}
+	return strategy, nil
+}
+
+// ListAll lists all the rolling deployments
+func (r *RolloutsController) ListAll(rw http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	rollouts := r.context.Framework.Rollouts()
+	if rollouts == nil {
+		rollouts = []*tasks.Rollout{}
+	}
+	rw.WriteHeader(http.StatusOK)
+	renderJSON(rw, rollouts)
+}
+
+// ShowOne shows the progress of a single rolling deployment
+func (r *RolloutsController) ShowOne(rw http.ResponseWriter, req *http.Request, pathParams httprouter.Params) {
+	id := pathParams.ByName("id")
+	rollout, ok := r.context.Framework.Rollout(id)
+	if !ok {
+		notFound(rw, "Rollout", id)
+		return
+	}
+	rw.WriteHeader(http.StatusOK)
+	renderJSON(rw, rollout)
+}
+
+// Resume continues a paused rolling deployment
+func (r *RolloutsController) Resume(rw http.ResponseWriter, req *http.Request, pathParams httprouter.Params) {
+	r.change(rw, pathParams.ByName("id"), r.context.Framework.ResumeRollout)
+}
+
+// RollBack rolls a rolling deployment back to the version it was replacing
+func (r *RolloutsController) RollBack(rw http.ResponseWriter, req *http.Request, pathParams httprouter.Params) {
+	r.change(rw, pathParams.ByName("id"), r.context.Framework.RollBack)
+}
+
+func (r *RolloutsController) change(rw http.ResponseWriter, id string, action func(string) (*tasks.Rollout, error)) {
+	if _, ok := r.context.Framework.Rollout(id); !ok {
+		notFound(rw, "Rollout", id)
+		return
+	}
+	rollout, err := action(id)
+	if err != nil {
+		rw.WriteHeader(http.StatusConflict)
+		rw.Write([]byte(fmt.Sprintf(`{"message":"%v", "type": "error"}`, err)))
+		return
+	}
+	rw.WriteHeader(http.StatusAccepted)
+	renderJSON(rw, rollout)
+}
@@ -0,0 +1,89 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/reverb/exeggutor/protocol"
+	"github.com/reverb/exeggutor/tasks"
+	"github.com/reverb/go-mesos/mesos"
+)
+
+// TasksController contains the context for the api calls about single tasks
+type TasksController struct {
+	context *APIContext
+}
+
+// NewTasksController creates a new instance of a tasks controller
+func NewTasksController(context *APIContext) *TasksController {
+	return &TasksController{context: context}
+}
+
+// readTaskFilter reads the status, host and component query parameters,
+// status can have several comma separated values
+func readTaskFilter(req *http.Request) (tasks.TaskFilter, error) {
+	query := req.URL.Query()
+	filter := tasks.TaskFilter{
+		AppName:   query.Get("app"),
+		Component: query.Get("component"),
+		Host:      query.Get("host"),
+	}
+	if query.Get("status") == "" {
+		return filter, nil
+	}
+	for _, value := range strings.Split(query.Get("status"), ",") {
+		status, ok := protocol.AppStatus_value[strings.ToUpper(strings.TrimSpace(value))]
+		if !ok {
+			return filter, fmt.Errorf("'%s' is not a known task status", value)
+		}
+		filter.Statuses = append(filter.Statuses, protocol.AppStatus(status))
+	}
+	return filter, nil
+}
+
+// renderTasks renders the deployed tasks that match the filter
+func renderTasks(rw http.ResponseWriter, context *APIContext, filter tasks.TaskFilter) {
+	deployed, err := context.Framework.ListTasks(filter)
+	if err != nil {
+		unknownErrorWithMessage(rw, err)
+		return
+	}
+	rw.WriteHeader(http.StatusOK)
+	renderJSON(rw, deployed)
+}
+
+// ListAll lists the deployed tasks with their host and ports,
+// the status, host, app and component query parameters filter them
+func (t *TasksController) ListAll(rw http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	filter, err := readTaskFilter(req)
+	if err != nil {
+		badRequest(rw, err)
+		return
+	}
+	renderTasks(rw, t.context, filter)
+}
+
+// Kill stops a single task, the SLA monitor deploys another instance when the component needs one
+func (t *TasksController) Kill(rw http.ResponseWriter, req *http.Request, pathParams httprouter.Params) {
+	t.kill(rw, pathParams.ByName("id"), false)
+}
+
+// Replace stops a single task and queues another instance of its component right away
+func (t *TasksController) Replace(rw http.ResponseWriter, req *http.Request, pathParams httprouter.Params) {
+	t.kill(rw, pathParams.ByName("id"), true)
+}
+
+func (t *TasksController) kill(rw http.ResponseWriter, id string, replace bool) {
+	taskID, err := t.context.Framework.KillTask(id, replace)
+	if err != nil {
+		unknownErrorWithMessage(rw, err)
+		return
+	}
+	if taskID == nil {
+		notFound(rw, "Task", id)
+		return
+	}
+	taskIDs(rw, http.StatusAccepted, []*mesos.TaskID{taskID})
+}
@@ -4,13 +4,14 @@ import (
 	"encoding/json"
 	"fmt"
 	stdlog "log"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
 	"strconv"
 	"strings"
+	"sync"
 
-	"github.com/antage/eventsource"
 	"github.com/codegangsta/negroni"
 	"github.com/imdario/mergo"
 	"github.com/jessevdk/go-flags"
@@ -19,11 +20,15 @@ import (
 	"github.com/reverb/exeggutor"
 	"github.com/reverb/exeggutor/agora/api"
 	app_mw "github.com/reverb/exeggutor/agora/middlewares"
+	"github.com/reverb/exeggutor/bus"
+	"github.com/reverb/exeggutor/events"
 	"github.com/reverb/exeggutor/scheduler"
+	"github.com/reverb/exeggutor/state"
 	app_store "github.com/reverb/exeggutor/store/apps"
 	"github.com/reverb/exeggutor/tasks"
 	"github.com/reverb/go-utils/flake"
 	"github.com/reverb/go-utils/http/middlewares"
+	"github.com/reverb/go-utils/rvb_zk"
 	"github.com/robfig/cron"
 )
 
@@ -44,8 +49,10 @@ func main() {
 
 	appContext := new(exeggutor.AppContext)
 
-	es := eventsource.New(nil, nil)
-	appContext.EventSource = &es
+	es := events.NewStream(config.EventReplay)
+	appContext.EventSource = es
+	appContext.Bus = bus.New()
+	appContext.Bus.Start()
 	appContext.Cron = cron.New()
 	appContext.Config = context.Config
 	appContext.IDGenerator = flake.NewFlake()
@@ -54,18 +61,35 @@ func main() {
 	if err != nil {
 		log.Fatalf("Couldn't initialize app database at %s/apps, because %v", config.DataDirectory, err)
 	}
-	appStore.Start()
 
 	mgr, err := tasks.NewDefaultTaskManager(appContext, appStore)
 	if err != nil {
 		log.Fatalf("Couldn't initialize the task manager because:%v", err)
 	}
-	mgr.Start()
 
-	framework := scheduler.NewFramework(appContext, mgr)
-	err = framework.Start()
-	if err != nil {
-		log.Fatalf("Couldn't initialize the exeggutor scheduler framework because:%v", err)
+	var framework *scheduler.Framework
+	var latch *state.LeaderLatch
+	var curator *rvb_zk.Curator
+	var sched *scheduling
+	if config.HighAvailable {
+		curator, err = rvb_zk.NewCuratorFromURI(config.ZookeeperURL)
+		if err != nil {
+			log.Fatalf("Couldn't connect to zookeeper because:%v", err)
+		}
+		// a standby only finds the state of the previous leader when they share the data directory
+		if err := state.VerifySharedStorage(curator.RootNode+"/storage", config.DataDirectory, curator); err != nil {
+			log.Fatalf("Can't run highly available without shared storage, because:%v", err)
+		}
+		framework = scheduler.NewFrameworkWithCurator(appContext, mgr, curator)
+		sched = newScheduling(appStore, mgr, framework)
+		latch = state.NewLeaderLatch(curator.RootNode+"/leader", advertisedAddress(), curator)
+		if err := latch.Start(); err != nil {
+			log.Fatalf("Couldn't join the leader election because:%v", err)
+		}
+	} else {
+		framework = scheduler.NewFramework(appContext, mgr)
+		sched = newScheduling(appStore, mgr, framework)
+		sched.start()
 	}
 
 	// appStore, err := app_store.NewWithStore(store.NewEmptyInMemoryStore())
@@ -75,9 +99,15 @@ func main() {
 
 	context.Framework = framework
 	context.AppStore = appStore
+	context.Events = es
 
 	applicationsController := api.NewApplicationsController(&context)
 	mesosController := api.NewMesosController(&context)
+	rolloutsController := api.NewRolloutsController(&context)
+	crashLoopsController := api.NewCrashLoopsController(&context)
+	quotasController := api.NewQuotasController(&context)
+	queueController := api.NewQueueController(&context)
+	tasksController := api.NewTasksController(&context)
 
 	router := httprouter.New()
 	router.GET("/favicon.ico", func(rw http.ResponseWriter, req *http.Request, _ httprouter.Params) {
@@ -89,7 +119,30 @@ func main() {
 	router.PUT("/api/applications/:name", applicationsController.Save)
 	router.DELETE("/api/applications/:name", applicationsController.Delete)
 	router.POST("/api/applications/:name/deploy", applicationsController.Deploy)
+	router.GET("/api/applications/:name/revisions", applicationsController.ListRevisions)
+	router.GET("/api/applications/:name/revisions/:revision", applicationsController.ShowRevision)
+	router.GET("/api/applications/:name/diff", applicationsController.DiffRevisions)
+	router.POST("/api/applications/:name/rollback", applicationsController.Rollback)
+	router.POST("/api/applications/:name/stop", applicationsController.Stop)
+	router.PUT("/api/applications/:name/instances", applicationsController.Scale)
+	router.GET("/api/applications/:name/tasks", applicationsController.ListTasks)
+	router.GET("/api/tasks", tasksController.ListAll)
+	router.POST("/api/tasks/:id/kill", tasksController.Kill)
+	router.POST("/api/tasks/:id/replace", tasksController.Replace)
 	router.GET("/api/mesos/fwid", mesosController.ShowFrameworkID)
+	router.GET("/api/rollouts", rolloutsController.ListAll)
+	router.GET("/api/rollouts/:id", rolloutsController.ShowOne)
+	router.POST("/api/rollouts/:id/resume", rolloutsController.Resume)
+	router.POST("/api/rollouts/:id/rollback", rolloutsController.RollBack)
+	router.GET("/api/crashloops", crashLoopsController.ListAll)
+	router.DELETE("/api/crashloops/:app/:component", crashLoopsController.Clear)
+	router.GET("/api/quotas", quotasController.ListAll)
+	router.GET("/api/quotas/:scope/:name", quotasController.ShowOne)
+	router.PUT("/api/quotas/:scope/:name", quotasController.Save)
+	router.DELETE("/api/quotas/:scope/:name", quotasController.Delete)
+	router.GET("/api/queue", queueController.ListAll)
+	router.DELETE("/api/queue/:app/:component", queueController.Cancel)
+	router.DELETE("/api/queue/:app/:component/:id", queueController.Cancel)
 
 	log.Info("serving static files from: %v", config.StaticFiles)
 	staticFS := http.Dir(config.StaticFiles)
@@ -98,6 +151,10 @@ func main() {
 
 	n := negroni.New()
 
+	// the events are only published on the leader, so a standby proxies the event stream too
+	if latch != nil {
+		n.Use(app_mw.NewLeaderProxy(latch))
+	}
 	n.Use(app_mw.NewEventSource(es))
 	n.Use(app_mw.NewJSONOnlyAPI())
 	n.Use(middlewares.NewRecovery())
@@ -106,17 +163,115 @@ func main() {
 	n.Use(negroni.NewStatic(staticFS))
 	n.UseHandler(router)
 
-	trapExit(func() {
-		mgr.Stop()
-		es.Close()
-		framework.Stop()
-		appStore.Stop()
-	})
-
 	addr := fmt.Sprintf("%s:%v", config.Interface, config.Port)
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		log.Fatalf("Couldn't listen for web requests at %s, because %v", addr, err)
+	}
+
+	// shutdown stops accepting requests before the scheduler and the stores are stopped,
+	// whoever asked for the shutdown exits the process when it's done
+	var once sync.Once
+	closing := make(chan bool)
+	shutdown := func() {
+		once.Do(func() {
+			close(closing)
+			listener.Close()
+			sched.stop()
+			es.Close()
+			appContext.Bus.Stop()
+			if latch != nil {
+				latch.Stop()
+				curator.Close()
+			}
+		})
+	}
+	trapExit(shutdown)
+	if latch != nil {
+		go followLeadership(latch, sched, shutdown)
+	}
+
 	log.Notice("Starting server at %s.", addr)
 	// http.ListenAndServeTLS(addr, "star_helloreverb_com.cer", "helloreverb.key", n)
-	http.ListenAndServe(addr, n)
+	err = http.Serve(listener, n)
+	select {
+	case <-closing:
+		// the shutdown closed the listener, it exits the process when it's done
+		select {}
+	default:
+		log.Critical("Stopped serving web requests, because %v", err)
+		shutdown()
+		os.Exit(1)
+	}
+}
+
+// scheduling runs the scheduler and opens the stores it needs, in a highly available setup
+// a standby leaves the stores in the shared data directory to the leader until it's elected
+type scheduling struct {
+	lock      *sync.Mutex
+	running   bool
+	appStore  app_store.AppStore
+	mgr       tasks.TaskManager
+	framework *scheduler.Framework
+}
+
+func newScheduling(appStore app_store.AppStore, mgr tasks.TaskManager, framework *scheduler.Framework) *scheduling {
+	return &scheduling{lock: &sync.Mutex{}, appStore: appStore, mgr: mgr, framework: framework}
+}
+
+func (s *scheduling) start() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if err := s.appStore.Start(); err != nil {
+		log.Fatalf("Couldn't open the app database at %s/apps, because %v", config.DataDirectory, err)
+	}
+	if err := s.mgr.Start(); err != nil {
+		log.Fatalf("Couldn't start the task manager because:%v", err)
+	}
+	if err := s.framework.Start(); err != nil {
+		log.Fatalf("Couldn't initialize the exeggutor scheduler framework because:%v", err)
+	}
+	s.running = true
+}
+
+func (s *scheduling) stop() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if !s.running {
+		return
+	}
+	s.mgr.Stop()
+	s.framework.Stop()
+	s.appStore.Stop()
+	s.running = false
+}
+
+// followLeadership only runs the scheduler while this process is the leader.
+// When leadership is lost we shut down, the process supervisor restarts us as a standby.
+func followLeadership(latch *state.LeaderLatch, sched *scheduling, shutdown func()) {
+	for elected := range latch.Elected() {
+		if elected {
+			log.Notice("Elected as leader at %s, starting the scheduler", latch.Path())
+			sched.start()
+		} else {
+			log.Critical("Lost leadership at %s, shutting down so a standby can take over", latch.Path())
+			shutdown()
+			log.Notice("Stopped agora application")
+			os.Exit(1)
+		}
+	}
+}
+
+func advertisedAddress() string {
+	host := config.Hostname
+	if host == "" {
+		h, err := os.Hostname()
+		if err != nil {
+			log.Fatalf("Couldn't determine the host name, please provide one with --hostname, because %v", err)
+		}
+		host = h
+	}
+	return fmt.Sprintf("%s:%d", host, config.Port)
 }
 
 func trapExit(onClose func()) {
@@ -3,15 +3,13 @@ package middlewares
 import (
 	"net/http"
 	"strings"
-
-	"github.com/antage/eventsource"
 )
 
 type EventSourceMiddleWare struct {
-	eventSource eventsource.EventSource
+	eventSource http.Handler
 }
 
-func NewEventSource(es eventsource.EventSource) *EventSourceMiddleWare {
+func NewEventSource(es http.Handler) *EventSourceMiddleWare {
 	return &EventSourceMiddleWare{eventSource: es}
 }
 
@@ -0,0 +1,49 @@
+package middlewares
+
+import (
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// streamFlushInterval how often a proxied event stream is flushed to the client
+const streamFlushInterval = 100 * time.Millisecond
+
+// LeaderElection describes the participant in a leader election
+type LeaderElection interface {
+	IsLeader() bool
+	Leader() (string, error)
+}
+
+// LeaderProxyMiddleware proxies the api requests to the leader when this process is a standby.
+// A standby doesn't open the stores, so it proxies the read only requests too
+// instead of serving what it read from the data directory before the leader changed it.
+type LeaderProxyMiddleware struct {
+	election LeaderElection
+}
+
+// NewLeaderProxy creates a new instance of the leader proxy middleware
+func NewLeaderProxy(election LeaderElection) *LeaderProxyMiddleware {
+	return &LeaderProxyMiddleware{election: election}
+}
+
+func (l *LeaderProxyMiddleware) ServeHTTP(rw http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+	if !strings.HasPrefix(r.URL.Path, "/api") || l.election.IsLeader() {
+		next(rw, r)
+		return
+	}
+
+	leader, err := l.election.Leader()
+	if err != nil || leader == "" {
+		rw.WriteHeader(http.StatusServiceUnavailable)
+		rw.Write([]byte(`{"message":"There is no leader available to handle this request.", "type": "error"}`))
+		return
+	}
+	proxy := httputil.NewSingleHostReverseProxy(&url.URL{Scheme: "http", Host: leader})
+	if strings.HasPrefix(r.URL.Path, "/api/events") {
+		proxy.FlushInterval = streamFlushInterval
+	}
+	proxy.ServeHTTP(rw, r)
+}
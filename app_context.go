@@ -1,14 +1,16 @@
 package exeggutor
 
 import (
-	"github.com/antage/eventsource"
+	"github.com/reverb/exeggutor/bus"
+	"github.com/reverb/exeggutor/events"
 	"github.com/robfig/cron"
 )
 
 // AppContext contains the global singleton services this application uses
 // they are available in most places throughout the application
 type AppContext struct {
-	EventSource *eventsource.EventSource
+	EventSource *events.Stream
+	Bus         *bus.Bus
 	Cron        *cron.Cron
 	Config      *Config
 	IDGenerator IDGenerator
@@ -0,0 +1,207 @@
+// Package bus provides the event bus the modules of agora publish their messages on,
+// any number of subscribers can follow a topic without the producer knowing about them.
+package bus
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"github.com/op/go-logging"
+)
+
+var log = logging.MustGetLogger("exeggutor.bus")
+
+// Topic names a kind of message, every topic carries one type of message
+type Topic string
+
+// The topics the modules publish on
+const (
+	// TaskToKill carries the *mesos.TaskID of a task the task manager wants killed
+	TaskToKill Topic = "task_to_kill"
+	// HealthCheckFailed carries the check.Result of the health check that made a task unhealthy
+	HealthCheckFailed Topic = "health_check_failed"
+	// ScaleRequested carries the sla.ChangeDeployCount of an app that breaks its SLA
+	ScaleRequested Topic = "scale_requested"
+)
+
+// OverflowPolicy decides what happens to a message when the buffer of a subscriber is full
+type OverflowPolicy int
+
+const (
+	// DropNewest discards the message that doesn't fit in the buffer
+	DropNewest OverflowPolicy = iota
+	// DropOldest discards the oldest message in the buffer to make room
+	DropOldest
+	// Block makes the producer wait until the subscriber has room for the message
+	Block
+)
+
+// Subscription receives the messages of a topic until it's unsubscribed
+type Subscription struct {
+	dropped  int64 // first so it's aligned for the atomic operations
+	topic    Topic
+	messages chan interface{}
+	policy   OverflowPolicy
+	done     chan bool
+	once     *sync.Once
+	// lock keeps the channel open while messages are delivered outside the lock of the bus
+	lock   *sync.RWMutex
+	closed bool
+}
+
+// Messages returns the channel the messages of the topic arrive on,
+// it's closed when the subscription ends
+func (s *Subscription) Messages() <-chan interface{} {
+	return s.messages
+}
+
+// Dropped returns the number of messages this subscriber lost because its buffer was full
+func (s *Subscription) Dropped() int64 {
+	return atomic.LoadInt64(&s.dropped)
+}
+
+// end releases a producer that waits for this subscriber and closes the channel
+// once the deliveries that are in progress returned
+func (s *Subscription) end() {
+	s.once.Do(func() { close(s.done) })
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if !s.closed {
+		s.closed = true
+		close(s.messages)
+	}
+}
+
+func (s *Subscription) deliver(message interface{}) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	if s.closed {
+		return
+	}
+	switch s.policy {
+	case Block:
+		select {
+		case s.messages <- message:
+		case <-s.done:
+		}
+	case DropOldest:
+		for {
+			select {
+			case s.messages <- message:
+				return
+			default:
+			}
+			select {
+			case <-s.messages:
+				s.drop()
+			default:
+			}
+		}
+	default:
+		select {
+		case s.messages <- message:
+		default:
+			s.drop()
+		}
+	}
+}
+
+func (s *Subscription) drop() {
+	if atomic.AddInt64(&s.dropped, 1) == 1 {
+		log.Warning("A subscriber of %s can't keep up, it's losing messages", s.topic)
+	}
+}
+
+// Bus delivers the messages published on a topic to every subscriber of that topic.
+// Publishing on a nil bus does nothing.
+type Bus struct {
+	subscribers map[Topic][]*Subscription
+	lock        *sync.RWMutex
+	stopped     bool
+}
+
+// New creates a new event bus
+func New() *Bus {
+	return &Bus{
+		subscribers: make(map[Topic][]*Subscription),
+		lock:        &sync.RWMutex{},
+	}
+}
+
+// Start starts this event bus
+func (b *Bus) Start() error {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.stopped = false
+	return nil
+}
+
+// Stop ends all the subscriptions, messages published afterwards are discarded
+func (b *Bus) Stop() error {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.stopped = true
+	for topic, subs := range b.subscribers {
+		for _, sub := range subs {
+			sub.end()
+		}
+		delete(b.subscribers, topic)
+	}
+	return nil
+}
+
+// Subscribe starts receiving the messages of a topic, the buffer holds the messages
+// the subscriber didn't read yet and the policy decides what happens when it's full
+func (b *Bus) Subscribe(topic Topic, buffer int, policy OverflowPolicy) *Subscription {
+	if buffer < 1 {
+		buffer = 1
+	}
+	sub := &Subscription{
+		topic:    topic,
+		messages: make(chan interface{}, buffer),
+		policy:   policy,
+		done:     make(chan bool),
+		once:     &sync.Once{},
+		lock:     &sync.RWMutex{},
+	}
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if b.stopped {
+		sub.end()
+		return sub
+	}
+	b.subscribers[topic] = append(b.subscribers[topic], sub)
+	return sub
+}
+
+// Unsubscribe ends the subscription and closes its channel
+func (b *Bus) Unsubscribe(sub *Subscription) {
+	// release a producer that is blocked on this subscriber before waiting for the lock
+	sub.once.Do(func() { close(sub.done) })
+	b.lock.Lock()
+	subs := b.subscribers[sub.topic]
+	for i, s := range subs {
+		if s == sub {
+			// into a new array, producers keep delivering to the list they read
+			b.subscribers[sub.topic] = append(subs[:i:i], subs[i+1:]...)
+			break
+		}
+	}
+	b.lock.Unlock()
+	sub.end()
+}
+
+// Publish sends the message to every subscriber of the topic.
+// The subscribers are delivered to after the lock is released, so a subscriber that blocks the producer
+// doesn't keep others from subscribing or unsubscribing.
+func (b *Bus) Publish(topic Topic, message interface{}) {
+	if b == nil {
+		return
+	}
+	b.lock.RLock()
+	subs := b.subscribers[topic]
+	b.lock.RUnlock()
+	for _, sub := range subs {
+		sub.deliver(message)
+	}
+}
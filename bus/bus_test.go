@@ -0,0 +1,139 @@
+package bus
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func drain(sub *Subscription) []interface{} {
+	var result []interface{}
+	for {
+		select {
+		case msg := <-sub.Messages():
+			result = append(result, msg)
+		default:
+			return result
+		}
+	}
+}
+
+func TestEventBus(t *testing.T) {
+
+	Convey("An event bus", t, func() {
+		b := New()
+		b.Start()
+		Reset(func() {
+			b.Stop()
+		})
+
+		Convey("delivers a message to every subscriber of the topic", func() {
+			first := b.Subscribe(TaskToKill, 5, DropNewest)
+			second := b.Subscribe(TaskToKill, 5, DropNewest)
+			other := b.Subscribe(ScaleRequested, 5, DropNewest)
+
+			b.Publish(TaskToKill, "task-1")
+
+			So(drain(first), ShouldResemble, []interface{}{"task-1"})
+			So(drain(second), ShouldResemble, []interface{}{"task-1"})
+			So(drain(other), ShouldBeEmpty)
+		})
+
+		Convey("doesn't block the producer when nobody subscribed", func() {
+			So(func() { b.Publish(TaskToKill, "task-1") }, ShouldNotPanic)
+		})
+
+		Convey("drops the newest messages for a full subscriber", func() {
+			sub := b.Subscribe(TaskToKill, 2, DropNewest)
+			for _, msg := range []string{"1", "2", "3"} {
+				b.Publish(TaskToKill, msg)
+			}
+
+			So(drain(sub), ShouldResemble, []interface{}{"1", "2"})
+			So(sub.Dropped(), ShouldEqual, 1)
+		})
+
+		Convey("drops the oldest messages for a full subscriber", func() {
+			sub := b.Subscribe(TaskToKill, 2, DropOldest)
+			for _, msg := range []string{"1", "2", "3"} {
+				b.Publish(TaskToKill, msg)
+			}
+
+			So(drain(sub), ShouldResemble, []interface{}{"2", "3"})
+			So(sub.Dropped(), ShouldEqual, 1)
+		})
+
+		Convey("makes the producer wait for a blocking subscriber", func() {
+			sub := b.Subscribe(TaskToKill, 1, Block)
+			b.Publish(TaskToKill, "1")
+
+			published := make(chan bool)
+			go func() {
+				b.Publish(TaskToKill, "2")
+				published <- true
+			}()
+
+			So(<-sub.Messages(), ShouldEqual, "1")
+			select {
+			case <-published:
+			case <-time.After(time.Second):
+				t.Error("the producer was never released")
+			}
+			So(drain(sub), ShouldResemble, []interface{}{"2"})
+			So(sub.Dropped(), ShouldEqual, 0)
+		})
+
+		Convey("releases a blocked producer when the subscriber leaves", func() {
+			sub := b.Subscribe(TaskToKill, 1, Block)
+			b.Publish(TaskToKill, "1")
+
+			published := make(chan bool)
+			go func() {
+				b.Publish(TaskToKill, "2")
+				published <- true
+			}()
+			b.Unsubscribe(sub)
+
+			select {
+			case <-published:
+			case <-time.After(time.Second):
+				t.Error("the producer was never released")
+			}
+		})
+
+		Convey("lets subscribers come and go while a producer waits for a blocking subscriber", func() {
+			blocking := b.Subscribe(TaskToKill, 1, Block)
+			b.Publish(TaskToKill, "1")
+			go b.Publish(TaskToKill, "2")
+
+			left := make(chan bool)
+			go func() {
+				other := b.Subscribe(TaskToKill, 1, DropNewest)
+				b.Unsubscribe(other)
+				left <- true
+			}()
+
+			select {
+			case <-left:
+			case <-time.After(time.Second):
+				t.Error("the subscriber couldn't leave while the producer was blocked")
+			}
+			b.Unsubscribe(blocking)
+		})
+
+		Convey("closes the channel of a subscriber that leaves", func() {
+			sub := b.Subscribe(TaskToKill, 1, DropNewest)
+			b.Unsubscribe(sub)
+			b.Publish(TaskToKill, "1")
+
+			_, ok := <-sub.Messages()
+			So(ok, ShouldBeFalse)
+		})
+
+		Convey("doesn't publish when it's nil", func() {
+			var missing *Bus
+			So(func() { missing.Publish(TaskToKill, "1") }, ShouldNotPanic)
+		})
+	})
+}
@@ -9,7 +9,7 @@ import (
 // Config the main configuration object to use in the application
 type Config struct {
 	ZookeeperURL    string             `json:"zookeeper,omitempty" long:"zk" description:"The uri for zookeeper in the form of zk://localhost:2181/root"`
-	MesosMaster     string             `json:"mesos,omitempty" long:"mesos" description:"The uri for the mesos master"`
+	MesosMaster     string             `json:"mesos,omitempty" long:"mesos" description:"The uri for the mesos master, a http://host:port uri uses the v1 HTTP scheduler API instead of libmesos"`
 	DataDirectory   string             `json:"dataDirectory,omitempty" long:"data_dir" description:"The base path for storing the data" default:"./data"`
 	StaticFiles     string             `json:"staticFiles,omitempty" long:"public" description:"The directory to find the static files for this app" default:"./static/build"`
 	WorkDirectory   string             `json:"workDirectory,omitempty" long:"work_dir" description:"The directory to use when doing temporary work" default:"/tmp/agora-wrk-$RANDOM"`
@@ -17,6 +17,9 @@ type Config struct {
 	Port            int                `json:"port,omitempty" long:"port" description:"The port to listen on for web requests" default:"8000"`
 	Interface       string             `json:"interface,omitempty" long:"listen" description:"The interface to use to listen for web requests" default:"0.0.0.0"`
 	Mode            string             `json:"mode,omitempty" long:"mode" description:"The mode in which to run this application (dev, prod, stage, jenkins)" default:"development"`
+	HighAvailable   bool               `json:"highAvailable,omitempty" long:"ha" description:"Run as one of several agora processes, only the leader elected through zookeeper schedules tasks"`
+	Hostname        string             `json:"hostname,omitempty" long:"hostname" description:"The host name other agora processes use to reach this one, defaults to the host name of the machine"`
+	EventReplay     int                `json:"eventReplay,omitempty" long:"event_replay" description:"The number of events kept so clients can resume the event stream with Last-Event-ID" default:"1000"`
 	FrameworkInfo   *FrameworkConfig   `json:"framework,omitempty"`
 	DockerIndex     *DockerIndexConfig `json:"dockerIndex,omitempty"`
 	Logging         *LoggingConfig     `json:"logging,omitempty"`
@@ -61,6 +64,19 @@ type FrameworkConfig struct {
 	User                   string `json:"user,omitempty" long:"framework_user" description:"The user under which this framework should authenticate"`
 	Name                   string `json:"name,omitempty" long:"framework_name" description:"The name of this framework" default:"Agora"`
 	HealthCheckConcurrency int    `json:"healthCheckConcurrency" long:"health_check_concurrency" description:"The number of health check workers" default:"5"`
+	CommandCheckSlots      int    `json:"commandCheckSlots" long:"command_check_slots" description:"The number of command health checks that can run at the same time, a check that finds no free slot is skipped until its next interval" default:"2"`
+	FailoverTimeout        int    `json:"failoverTimeout" long:"failover_timeout" description:"The number of seconds mesos keeps the tasks running after the scheduler disconnected, so a restarted or newly elected scheduler can take them over" default:"604800"`
+	ReconcileInterval      int    `json:"reconcileInterval" long:"reconcile_interval" description:"The interval in seconds at which the task state is reconciled with mesos, 0 disables periodic reconciliation" default:"600"`
+	ScaleDownPolicy        string `json:"scaleDownPolicy,omitempty" long:"scale_down_policy" description:"Which instances are stopped first when an app has too many instances (newest, unhealthy, crowded)" default:"newest"`
+	CrashBackoff           int    `json:"crashBackoff" long:"crash_backoff" description:"The delay in seconds before a failed component is deployed again, it doubles with every failure" default:"5"`
+	CrashBackoffMax        int    `json:"crashBackoffMax" long:"crash_backoff_max" description:"The maximum delay in seconds before a failed component is deployed again" default:"300"`
+	CrashLoopThreshold     int    `json:"crashLoopThreshold" long:"crash_loop_threshold" description:"The number of failures after which a component is crash looping and isn't deployed anymore, 0 keeps retrying" default:"10"`
+	CrashResetAfter        int    `json:"crashResetAfter" long:"crash_reset_after" description:"The number of seconds without failures after which the failures of a component are forgotten" default:"600"`
+	QueueOrder             string `json:"queueOrder,omitempty" long:"queue_order" description:"How the queued deployments are ordered (size, fair, priority, aging)" default:"size"`
+	QueueAgingStep         int    `json:"queueAgingStep" long:"queue_aging_step" description:"The number of seconds a queued deployment waits before the aging order promotes it one priority class" default:"60"`
+	PreemptAfter           int    `json:"preemptAfter" long:"preempt_after" description:"The number of seconds a high or critical priority deployment waits in the queue before lower priority deployments are stopped to make room for it, 0 disables preemption" default:"120"`
+	QueueOfferHistory      int    `json:"queueOfferHistory" long:"queue_offer_history" description:"The number of offers remembered for every queued item to explain why it wasn't placed, 0 disables it" default:"5"`
+	PersistQueue           bool   `json:"persistQueue" long:"persist_queue" description:"Keep the queued deployments in the data directory so they are still queued after a restart"`
 }
 
 // LoggingConfig contains the configuration for the logging
@@ -0,0 +1,80 @@
+// Package events provides the lifecycle events of the apps and tasks agora manages
+// and the event stream clients follow at /api/events.
+package events
+
+import (
+	"time"
+
+	"github.com/op/go-logging"
+	"github.com/reverb/exeggutor/protocol"
+)
+
+var log = logging.MustGetLogger("exeggutor.events")
+
+// The types of the events that are published
+const (
+	AppSaved             = "app_saved"
+	AppDeleted           = "app_deleted"
+	DeploymentQueued     = "deployment_queued"
+	DeploymentLaunched   = "deployment_launched"
+	DeploymentRunning    = "deployment_running"
+	DeploymentFailed     = "deployment_failed"
+	DeploymentKilled     = "deployment_killed"
+	DeploymentLost       = "deployment_lost"
+	HealthCheckFailed    = "health_check_failed"
+	HealthCheckRecovered = "health_check_recovered"
+	ScaleDecision        = "scale_decision"
+)
+
+// Event something that happened to an app or one of its tasks
+type Event struct {
+	// ID the sequence number of the event, clients resume the stream after it with Last-Event-ID
+	ID   int64  `json:"id"`
+	Type string `json:"type"`
+	// Time the unix epoch in milliseconds when the event happened
+	Time      int64  `json:"time"`
+	AppID     string `json:"app_id,omitempty"`
+	AppName   string `json:"app_name,omitempty"`
+	Component string `json:"component,omitempty"`
+	TaskID    string `json:"task_id,omitempty"`
+	Host      string `json:"host,omitempty"`
+	// Data the details that are specific to the type of event
+	Data interface{} `json:"data,omitempty"`
+}
+
+// ForApp creates an event about an app
+func ForApp(eventType string, app *protocol.Application) *Event {
+	return &Event{
+		Type:      eventType,
+		Time:      time.Now().UnixNano() / 1000000,
+		AppID:     app.GetId(),
+		AppName:   app.GetAppName(),
+		Component: app.GetName(),
+	}
+}
+
+// ForDeployment creates an event about a task of an app, the app can be nil when it's unknown
+func ForDeployment(eventType string, deployment *protocol.Deployment, app *protocol.Application) *Event {
+	event := &Event{
+		Type:   eventType,
+		Time:   time.Now().UnixNano() / 1000000,
+		AppID:  deployment.GetAppId(),
+		TaskID: deployment.GetTaskId().GetValue(),
+		Host:   deployment.GetHostName(),
+	}
+	if app != nil {
+		event.AppName, event.Component = app.GetAppName(), app.GetName()
+	}
+	return event
+}
+
+// WithData adds the details of the event
+func (e *Event) WithData(data interface{}) *Event {
+	e.Data = data
+	return e
+}
+
+// concerns returns true when the event is about the app, which is either an app name or an app id
+func (e *Event) concerns(app string) bool {
+	return app == "" || e.AppName == app || e.AppID == app
+}
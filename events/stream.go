@@ -0,0 +1,205 @@
+package events
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultReplay the number of events kept for clients that resume the stream
+	DefaultReplay     = 1000
+	subscriberBacklog = 64
+)
+
+// Stream publishes events to the clients of the event stream.
+// It keeps the last events so a client that reconnects with Last-Event-ID gets the ones it missed.
+// Publishing on a nil stream does nothing.
+type Stream struct {
+	replay      []*Event
+	size        int
+	lastID      int64
+	subscribers map[*subscriber]bool
+	lock        *sync.Mutex
+	closing     chan bool
+	closed      bool
+}
+
+type subscriber struct {
+	events chan *Event
+}
+
+// NewStream creates an event stream that keeps the last size events for resuming clients.
+// The ids start from the current time, so a client that resumes with an id it got
+// from a previous process doesn't skip the events of this one.
+func NewStream(size int) *Stream {
+	if size <= 0 {
+		size = DefaultReplay
+	}
+	return &Stream{
+		size:        size,
+		lastID:      time.Now().UnixNano(),
+		subscribers: make(map[*subscriber]bool),
+		lock:        &sync.Mutex{},
+		closing:     make(chan bool),
+	}
+}
+
+// Publish numbers the event and sends it to every client,
+// a client that can't keep up is disconnected and has to resume the stream
+func (s *Stream) Publish(event *Event) {
+	if s == nil || event == nil {
+		return
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.closed {
+		return
+	}
+	s.lastID++
+	event.ID = s.lastID
+	s.replay = append(s.replay, event)
+	if len(s.replay) > s.size {
+		s.replay = s.replay[len(s.replay)-s.size:]
+	}
+	for sub := range s.subscribers {
+		select {
+		case sub.events <- event:
+		default:
+			log.Warning("Disconnecting an event stream client that fell %d events behind", subscriberBacklog)
+			delete(s.subscribers, sub)
+			close(sub.events)
+		}
+	}
+}
+
+// Since returns the events that were published after the event with the last id
+// and are about the app, an empty app returns the events about every app
+func (s *Stream) Since(lastID int64, app string) []*Event {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.since(lastID, app)
+}
+
+func (s *Stream) since(lastID int64, app string) []*Event {
+	var result []*Event
+	for _, event := range s.replay {
+		if event.ID > lastID && event.concerns(app) {
+			result = append(result, event)
+		}
+	}
+	return result
+}
+
+// subscribe registers a client and returns the events it missed, both happen under the same lock
+// so no event gets lost or sent twice in between
+func (s *Stream) subscribe(lastID int64, app string) ([]*Event, *subscriber) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	sub := &subscriber{events: make(chan *Event, subscriberBacklog)}
+	if s.closed {
+		close(sub.events)
+		return nil, sub
+	}
+	s.subscribers[sub] = true
+	return s.since(lastID, app), sub
+}
+
+func (s *Stream) unsubscribe(sub *subscriber) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.subscribers[sub] {
+		delete(s.subscribers, sub)
+		close(sub.events)
+	}
+}
+
+// Close disconnects all the clients
+func (s *Stream) Close() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.closed {
+		return
+	}
+	s.closed = true
+	close(s.closing)
+	for sub := range s.subscribers {
+		delete(s.subscribers, sub)
+		close(sub.events)
+	}
+}
+
+// lastEventID reads the id of the last event the client saw from the Last-Event-ID header,
+// or from the last_event_id query parameter for clients that can't set headers
+func lastEventID(req *http.Request) int64 {
+	value := req.Header.Get("Last-Event-ID")
+	if value == "" {
+		value = req.URL.Query().Get("last_event_id")
+	}
+	id, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0
+	}
+	return id
+}
+
+func writeEvent(rw http.ResponseWriter, event *Event) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(rw, "id: %d\nevent: %s\ndata: %s\n\n", event.ID, event.Type, data)
+	return err
+}
+
+// ServeHTTP streams the events as server sent events,
+// the app query parameter only streams the events of an app name or app id
+func (s *Stream) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	flusher, ok := rw.(http.Flusher)
+	if !ok {
+		http.Error(rw, "streaming isn't supported", http.StatusInternalServerError)
+		return
+	}
+	var gone <-chan bool
+	if notifier, ok := rw.(http.CloseNotifier); ok {
+		gone = notifier.CloseNotify()
+	}
+
+	app := req.URL.Query().Get("app")
+	missed, sub := s.subscribe(lastEventID(req), app)
+	defer s.unsubscribe(sub)
+
+	rw.Header().Set("Content-Type", "text/event-stream")
+	rw.Header().Set("Cache-Control", "no-cache")
+	rw.Header().Set("Connection", "keep-alive")
+	rw.WriteHeader(http.StatusOK)
+	for _, event := range missed {
+		if err := writeEvent(rw, event); err != nil {
+			return
+		}
+	}
+	flusher.Flush()
+
+	for {
+		select {
+		case event, ok := <-sub.events:
+			if !ok {
+				return
+			}
+			if !event.concerns(app) {
+				continue
+			}
+			if err := writeEvent(rw, event); err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-gone:
+			return
+		case <-s.closing:
+			return
+		}
+	}
+}
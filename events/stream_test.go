@@ -0,0 +1,111 @@
+package events
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"code.google.com/p/goprotobuf/proto"
+	"github.com/reverb/exeggutor/protocol"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func testApp(appName, component string) *protocol.Application {
+	return &protocol.Application{
+		Id:      proto.String(appName + "-" + component),
+		AppName: proto.String(appName),
+		Name:    proto.String(component),
+	}
+}
+
+func ids(events []*Event) []int64 {
+	var result []int64
+	for _, event := range events {
+		result = append(result, event.ID)
+	}
+	return result
+}
+
+func TestEventStream(t *testing.T) {
+
+	Convey("An event stream", t, func() {
+		stream := NewStream(3)
+		base := stream.lastID
+		search := testApp("search", "api")
+		index := testApp("index", "worker")
+
+		Convey("numbers the events it publishes", func() {
+			first, second := ForApp(AppSaved, search), ForApp(DeploymentQueued, search)
+			stream.Publish(first)
+			stream.Publish(second)
+
+			So(first.ID, ShouldEqual, base+1)
+			So(second.ID, ShouldEqual, base+2)
+		})
+
+		Convey("numbers the events after the ones of a stream that came before it", func() {
+			stream.Publish(ForApp(AppSaved, search))
+			time.Sleep(time.Millisecond)
+
+			next := NewStream(3)
+			event := ForApp(AppSaved, search)
+			next.Publish(event)
+			So(event.ID, ShouldBeGreaterThan, stream.lastID)
+		})
+
+		Convey("replays the events after the last event id", func() {
+			stream.Publish(ForApp(AppSaved, search))
+			stream.Publish(ForApp(AppSaved, index))
+			stream.Publish(ForApp(DeploymentQueued, search))
+
+			So(ids(stream.Since(base+1, "")), ShouldResemble, []int64{base + 2, base + 3})
+			So(stream.Since(base+3, ""), ShouldBeEmpty)
+		})
+
+		Convey("only replays the events of an app when asked", func() {
+			stream.Publish(ForApp(AppSaved, search))
+			stream.Publish(ForApp(AppSaved, index))
+			stream.Publish(ForApp(DeploymentQueued, search))
+
+			So(ids(stream.Since(0, "search")), ShouldResemble, []int64{base + 1, base + 3})
+			So(ids(stream.Since(0, "index-worker")), ShouldResemble, []int64{base + 2})
+		})
+
+		Convey("keeps a bounded number of events for replay", func() {
+			for i := 0; i < 5; i++ {
+				stream.Publish(ForApp(AppSaved, search))
+			}
+
+			So(ids(stream.Since(0, "")), ShouldResemble, []int64{base + 3, base + 4, base + 5})
+		})
+
+		Convey("disconnects a client that falls behind", func() {
+			_, sub := stream.subscribe(0, "")
+			for i := 0; i < subscriberBacklog+1; i++ {
+				stream.Publish(ForApp(AppSaved, search))
+			}
+
+			received := 0
+			for _ = range sub.events {
+				received++
+			}
+			So(received, ShouldEqual, subscriberBacklog)
+		})
+
+		Convey("doesn't publish when it's nil", func() {
+			var missing *Stream
+			So(func() { missing.Publish(ForApp(AppSaved, search)) }, ShouldNotPanic)
+		})
+
+		Convey("reads the last event id a client saw", func() {
+			req, _ := http.NewRequest("GET", "/api/events", nil)
+			So(lastEventID(req), ShouldEqual, 0)
+
+			req.Header.Set("Last-Event-ID", "42")
+			So(lastEventID(req), ShouldEqual, 42)
+
+			req, _ = http.NewRequest("GET", "/api/events?last_event_id=7", nil)
+			So(lastEventID(req), ShouldEqual, 7)
+		})
+	})
+}
@@ -0,0 +1,195 @@
+package check
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/reverb/exeggutor/protocol"
+)
+
+// maxCommandReason the length of the output of a command that is kept as the reason of a result
+const maxCommandReason = 200
+
+type commandHealthCheck struct {
+	ID        string
+	Command   string
+	Arguments []string
+	Env       []string
+	Timeout   time.Duration
+	Interval  time.Duration
+	slots     chan bool
+	lock      *sync.Mutex
+	running   *os.Process
+}
+
+// NewCommand creates a health check that runs the command of the config for a deployed task.
+// The command gets the host and the ports of the task in its environment:
+// AGORA_TASK_ID, AGORA_APP_ID, AGORA_HOST, AGORA_PORT for the port of the health check scheme
+// and AGORA_PORT_<SCHEME> for every port mapping.
+// The exit code decides the result, 0 is healthy, 1 is degraded and 2 is down
+// unless the output starts with the name of a result code like DEGRADED: or DOWN:.
+// Only as many commands run at the same time as there are slots, when they're all taken
+// the check returns unknown instead of waiting for one so it doesn't hold up a health check worker.
+func NewCommand(id string, deployment *protocol.Deployment, config *protocol.HealthCheck, slots chan bool) HealthCheck {
+	return &commandHealthCheck{
+		ID:        id,
+		Command:   config.GetCommand(),
+		Arguments: config.GetArguments(),
+		Env:       commandEnv(deployment, config.GetScheme()),
+		Timeout:   time.Duration(config.GetTimeout()) * time.Millisecond,
+		Interval:  time.Duration(config.GetIntervalMillis()) * time.Millisecond,
+		slots:     slots,
+		lock:      &sync.Mutex{},
+	}
+}
+
+func commandEnv(deployment *protocol.Deployment, scheme string) []string {
+	env := append(os.Environ(),
+		"AGORA_TASK_ID="+deployment.GetTaskId().GetValue(),
+		"AGORA_APP_ID="+deployment.GetAppId(),
+		"AGORA_HOST="+deployment.GetHostName(),
+	)
+	for _, mapping := range deployment.GetPortMapping() {
+		if strings.EqualFold(mapping.GetScheme(), scheme) {
+			env = append(env, fmt.Sprintf("AGORA_PORT=%d", mapping.GetPublicPort()))
+		}
+		env = append(env, fmt.Sprintf("AGORA_PORT_%s=%d", strings.ToUpper(mapping.GetScheme()), mapping.GetPublicPort()))
+	}
+	return env
+}
+
+func (c *commandHealthCheck) Check() Result {
+	// Update can change the config while the health checker runs the check
+	c.lock.Lock()
+	command, arguments, timeout, interval := c.Command, c.Arguments, c.Timeout, c.Interval
+	c.lock.Unlock()
+
+	next := time.Now().Add(interval)
+	if c.slots != nil {
+		select {
+		case c.slots <- true:
+			defer func() { <-c.slots }()
+		default:
+			return Result{
+				ID:        c.ID,
+				Code:      protocol.HealthCheckResultCode_UNKNOWN,
+				Reason:    "all the command health check slots are taken",
+				NextCheck: next,
+			}
+		}
+	}
+
+	var output bytes.Buffer
+	cmd := exec.Command(command, arguments...)
+	cmd.Env = c.Env
+	cmd.Stdout, cmd.Stderr = &output, &output
+	// the command gets a process group of its own, so a timeout also stops the processes it started
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	if err := cmd.Start(); err != nil {
+		result := faultyResult(c.ID, next)
+		result.Reason = err.Error()
+		return result
+	}
+	c.setRunning(cmd.Process)
+	defer c.setRunning(nil)
+
+	done := make(chan error, 1)
+	go func() { done <- cmd.Wait() }()
+	select {
+	case err := <-done:
+		return commandResult(c.ID, next, exitCode(err), output.String())
+	case <-time.After(timeout):
+		// the process is reaped by the goroutine that waits for it
+		killGroup(cmd.Process)
+		result := timedOutResult(c.ID, next)
+		result.Reason = fmt.Sprintf("the command didn't finish within %v", timeout)
+		return result
+	}
+}
+
+// killGroup kills the process and every process in its process group
+func killGroup(process *os.Process) {
+	if err := syscall.Kill(-process.Pid, syscall.SIGKILL); err != nil {
+		process.Kill()
+	}
+}
+
+func (c *commandHealthCheck) setRunning(process *os.Process) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.running = process
+}
+
+func exitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+	if exit, ok := err.(*exec.ExitError); ok {
+		if status, ok := exit.Sys().(syscall.WaitStatus); ok {
+			return status.ExitStatus()
+		}
+	}
+	return -1
+}
+
+// commandResult maps the exit code and the output of a command to a result
+func commandResult(id string, next time.Time, code int, output string) Result {
+	var result Result
+	switch code {
+	case 0:
+		result = successResult(id, next)
+	case 1:
+		result = degradedResult(id, next)
+	case 2:
+		result = downResult(id, next)
+	default:
+		result = faultyResult(id, next)
+	}
+
+	output = strings.TrimSpace(output)
+	if i := strings.Index(output, "\n"); i >= 0 {
+		output = output[:i]
+	}
+	if fields := strings.Fields(output); len(fields) > 0 {
+		name := strings.ToUpper(strings.TrimRight(fields[0], ":"))
+		if value, ok := protocol.HealthCheckResultCode_value[name]; ok {
+			result.Code = protocol.HealthCheckResultCode(value)
+		}
+	}
+	if result.Code != protocol.HealthCheckResultCode_HEALTHY {
+		if len(output) > maxCommandReason {
+			output = output[:maxCommandReason]
+		}
+		result.Reason = output
+	}
+	return result
+}
+
+func (c *commandHealthCheck) GetID() string {
+	return c.ID
+}
+
+// Update reconfigures a health check based on the new values
+// this reconfigures the command, its arguments, the timeout value and the interval value
+func (c *commandHealthCheck) Update(config *protocol.HealthCheck) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.Command = config.GetCommand()
+	c.Arguments = config.GetArguments()
+	c.Timeout = time.Duration(config.GetTimeout()) * time.Millisecond
+	c.Interval = time.Duration(config.GetIntervalMillis()) * time.Millisecond
+}
+
+func (c *commandHealthCheck) Cancel() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.running != nil {
+		killGroup(c.running)
+	}
+}
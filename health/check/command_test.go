@@ -0,0 +1,147 @@
+package check
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"code.google.com/p/goprotobuf/proto"
+
+	"github.com/reverb/exeggutor/protocol"
+	"github.com/reverb/go-mesos/mesos"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func commandConfig(script string, timeout int64) *protocol.HealthCheck {
+	return &protocol.HealthCheck{
+		Mode:           protocol.HealthCheckMode_COMMAND.Enum(),
+		RampUp:         proto.Int64(10),
+		IntervalMillis: proto.Int64(10000),
+		Timeout:        proto.Int64(timeout),
+		Scheme:         proto.String("http"),
+		Command:        proto.String("/bin/sh"),
+		Arguments:      []string{"-c", script},
+	}
+}
+
+func commandDeployment() *protocol.Deployment {
+	return &protocol.Deployment{
+		AppId:    proto.String("app-1"),
+		TaskId:   &mesos.TaskID{Value: proto.String("task-1")},
+		HostName: proto.String("exeggutor-slave-instance-1"),
+		PortMapping: []*protocol.PortMapping{
+			&protocol.PortMapping{
+				Scheme:      proto.String("HTTP"),
+				PrivatePort: proto.Int32(8000),
+				PublicPort:  proto.Int32(32000),
+			},
+			&protocol.PortMapping{
+				Scheme:      proto.String("thrift"),
+				PrivatePort: proto.Int32(9000),
+				PublicPort:  proto.Int32(32001),
+			},
+		},
+	}
+}
+
+func TestCommandHealthCheck(t *testing.T) {
+
+	Convey("A COMMAND health check", t, func() {
+
+		check := func(script string, timeout int64, slots chan bool) Result {
+			return NewCommand("task-1", commandDeployment(), commandConfig(script, timeout), slots).Check()
+		}
+
+		Convey("returns its id", func() {
+			hc := NewCommand("task-1", commandDeployment(), commandConfig("exit 0", 1000), nil)
+			So(hc.GetID(), ShouldEqual, "task-1")
+		})
+
+		Convey("should return ok when the command exits with 0", func() {
+			result := check("echo all good; exit 0", 1000, nil)
+			So(result.Code, ShouldEqual, protocol.HealthCheckResultCode_HEALTHY)
+			So(result.Reason, ShouldBeEmpty)
+			So(result.NextCheck, ShouldHappenAfter, time.Now())
+		})
+
+		Convey("should return degraded when the command exits with 1", func() {
+			result := check("echo replication lagging; exit 1", 1000, nil)
+			So(result.Code, ShouldEqual, protocol.HealthCheckResultCode_DEGRADED)
+			So(result.Reason, ShouldEqual, "replication lagging")
+		})
+
+		Convey("should return down when the command exits with 2", func() {
+			result := check("echo no leader; exit 2", 1000, nil)
+			So(result.Code, ShouldEqual, protocol.HealthCheckResultCode_DOWN)
+			So(result.Reason, ShouldEqual, "no leader")
+		})
+
+		Convey("should return faulty for other exit codes", func() {
+			result := check("exit 3", 1000, nil)
+			So(result.Code, ShouldEqual, protocol.HealthCheckResultCode_ERROR)
+		})
+
+		Convey("should use the result code the output starts with", func() {
+			result := check("echo 'DOWN: disk full'; exit 0", 1000, nil)
+			So(result.Code, ShouldEqual, protocol.HealthCheckResultCode_DOWN)
+			So(result.Reason, ShouldEqual, "DOWN: disk full")
+		})
+
+		Convey("should pass the host and ports of the task to the command", func() {
+			result := check(`echo "DOWN $AGORA_TASK_ID $AGORA_HOST $AGORA_PORT $AGORA_PORT_THRIFT"`, 1000, nil)
+			So(result.Reason, ShouldEqual, "DOWN task-1 exeggutor-slave-instance-1 32000 32001")
+		})
+
+		Convey("should return timed out when the command runs longer than the timeout", func() {
+			started := time.Now()
+			result := check("sleep 5", 100, nil)
+			So(result.Code, ShouldEqual, protocol.HealthCheckResultCode_TIMEDOUT)
+			So(time.Since(started), ShouldBeLessThan, 2*time.Second)
+		})
+
+		Convey("should stop the processes the command started when it times out", func() {
+			dir, err := ioutil.TempDir("", "agora-command-check")
+			So(err, ShouldBeNil)
+			defer os.RemoveAll(dir)
+			marker := filepath.Join(dir, "still-running")
+
+			result := check("(sleep 1; touch "+marker+") & sleep 5", 100, nil)
+			So(result.Code, ShouldEqual, protocol.HealthCheckResultCode_TIMEDOUT)
+
+			time.Sleep(1500 * time.Millisecond)
+			_, err = os.Stat(marker)
+			So(os.IsNotExist(err), ShouldBeTrue)
+		})
+
+		Convey("should run the command of the updated config", func() {
+			hc := NewCommand("task-1", commandDeployment(), commandConfig("exit 2", 1000), nil)
+			hc.Update(commandConfig("exit 0", 1000))
+			So(hc.Check().Code, ShouldEqual, protocol.HealthCheckResultCode_HEALTHY)
+		})
+
+		Convey("should return faulty when the command can't be started", func() {
+			config := commandConfig("", 1000)
+			config.Command = proto.String("/does/not/exist")
+			result := NewCommand("task-1", commandDeployment(), config, nil).Check()
+			So(result.Code, ShouldEqual, protocol.HealthCheckResultCode_ERROR)
+			So(result.Reason, ShouldNotBeEmpty)
+		})
+
+		Convey("should return unknown without running when all the slots are taken", func() {
+			slots := make(chan bool, 1)
+			slots <- true
+			result := check("exit 0", 1000, slots)
+			So(result.Code, ShouldEqual, protocol.HealthCheckResultCode_UNKNOWN)
+			So(len(slots), ShouldEqual, 1)
+		})
+
+		Convey("should free its slot when it's done", func() {
+			slots := make(chan bool, 1)
+			result := check("exit 0", 1000, slots)
+			So(result.Code, ShouldEqual, protocol.HealthCheckResultCode_HEALTHY)
+			So(len(slots), ShouldEqual, 0)
+		})
+	})
+}
@@ -20,8 +20,8 @@ type Result struct {
 }
 
 // HealthCheck is an interface that describes a strategy for health checking
-// Currently supported are TCP, HTTP and METRICS, where Metrics is a specialization
-// of http with a body analyzer
+// Currently supported are TCP, HTTP, METRICS and COMMAND, where Metrics is a specialization
+// of http with a body analyzer and Command runs an executable for a task, see NewCommand
 type HealthCheck interface {
 	GetID() string
 	Check() Result
@@ -50,6 +50,10 @@ func downResult(id string, next time.Time) Result {
 	return Result{ID: id, Code: protocol.HealthCheckResultCode_DOWN, NextCheck: next}
 }
 
+func degradedResult(id string, next time.Time) Result {
+	return Result{ID: id, Code: protocol.HealthCheckResultCode_DEGRADED, NextCheck: next}
+}
+
 func timedOutResult(id string, next time.Time) Result {
 	return Result{ID: id, Code: protocol.HealthCheckResultCode_TIMEDOUT, NextCheck: next}
 }
@@ -58,11 +62,8 @@ func timedOutResult(id string, next time.Time) Result {
 func New(id, address string, config *protocol.HealthCheck) HealthCheck {
 	switch config.GetMode() {
 
-	case protocol.HealthCheckMode_HTTP:
-		return newHTTPHealthCheck(id, address, config, StatusCodeValidator)
-	case protocol.HealthCheckMode_METRICS:
-		// TODO: reconfigure this to use the coda hale health check body for failures
-		return newHTTPHealthCheck(id, address, config, StatusCodeValidator)
+	case protocol.HealthCheckMode_HTTP, protocol.HealthCheckMode_METRICS:
+		return newHTTPHealthCheck(id, address, config, validatorFor(config))
 	default:
 		return newTCPHealthCheck(id, address, config)
 	}
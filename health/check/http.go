@@ -68,6 +68,7 @@ func (h *httpHealthCheck) Check() Result {
 	if err != nil {
 		return errorResult(err, h.ID, next)
 	}
+	defer r.Body.Close()
 	return h.validator(r, h.ID, next)
 }
 
@@ -88,12 +89,7 @@ func (h *httpHealthCheck) Update(config *protocol.HealthCheck) {
 	}
 	h.Interval = time.Duration(config.GetIntervalMillis()) * time.Millisecond
 
-	if config.GetMode() == protocol.HealthCheckMode_METRICS {
-		// TODO: reconfigure this to use the coda hale health check body for failures
-		h.validator = StatusCodeValidator
-	} else {
-		h.validator = StatusCodeValidator
-	}
+	h.validator = validatorFor(config)
 }
 
 func (h *httpHealthCheck) Cancel() {
@@ -0,0 +1,91 @@
+package check
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/reverb/exeggutor/protocol"
+)
+
+// maxMetricsBody the largest health check body that is read from a service
+const maxMetricsBody = 1 << 20
+
+// namedCheck a named check in the body of a Coda Hale/Dropwizard health check response
+type namedCheck struct {
+	Healthy bool   `json:"healthy"`
+	Message string `json:"message"`
+}
+
+// MetricsValidator validates the body of a Coda Hale/Dropwizard /healthcheck response,
+// which has the result of every named check of the service:
+//
+//	{"deadlocks":{"healthy":true},"database":{"healthy":false,"message":"Cannot connect"}}
+//
+// A failing check makes the service down and the failing checks are listed in the reason of the result.
+// The non-critical checks only make the service degraded when they fail, or they're left out entirely
+// when ignoreNonCritical is true.
+func MetricsValidator(nonCritical []string, ignoreNonCritical bool) ResponseValidator {
+	optional := make(map[string]bool)
+	for _, name := range nonCritical {
+		optional[name] = true
+	}
+
+	return func(r *http.Response, id string, next time.Time) Result {
+		var checks map[string]namedCheck
+		if err := json.NewDecoder(io.LimitReader(r.Body, maxMetricsBody)).Decode(&checks); err != nil {
+			// dropwizard answers with a 500 when a check fails, so this only happens for other bodies
+			result := StatusCodeValidator(r, id, next)
+			if result.Code == protocol.HealthCheckResultCode_HEALTHY {
+				result = faultyResult(id, next)
+				result.Reason = fmt.Sprintf("the health check body isn't valid: %v", err)
+			}
+			return result
+		}
+
+		var failed, degraded []string
+		for name, check := range checks {
+			if check.Healthy {
+				continue
+			}
+			if !optional[name] {
+				failed = append(failed, describeCheck(name, check))
+			} else if !ignoreNonCritical {
+				degraded = append(degraded, describeCheck(name, check))
+			}
+		}
+		sort.Strings(failed)
+		sort.Strings(degraded)
+
+		switch {
+		case len(failed) > 0:
+			result := downResult(id, next)
+			result.Reason = strings.Join(append(failed, degraded...), "; ")
+			return result
+		case len(degraded) > 0:
+			result := degradedResult(id, next)
+			result.Reason = strings.Join(degraded, "; ")
+			return result
+		default:
+			return successResult(id, next)
+		}
+	}
+}
+
+func describeCheck(name string, check namedCheck) string {
+	if check.Message == "" {
+		return name
+	}
+	return fmt.Sprintf("%s: %s", name, check.Message)
+}
+
+func validatorFor(config *protocol.HealthCheck) ResponseValidator {
+	if config.GetMode() == protocol.HealthCheckMode_METRICS {
+		return MetricsValidator(config.GetNonCriticalChecks(), config.GetIgnoreNonCritical())
+	}
+	return StatusCodeValidator
+}
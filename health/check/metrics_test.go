@@ -0,0 +1,110 @@
+package check
+
+import (
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"code.google.com/p/goprotobuf/proto"
+
+	"github.com/reverb/exeggutor/protocol"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func metricsConfig(nonCritical []string, ignore bool) *protocol.HealthCheck {
+	return &protocol.HealthCheck{
+		Mode:              protocol.HealthCheckMode_METRICS.Enum(),
+		RampUp:            proto.Int64(10),
+		IntervalMillis:    proto.Int64(10000),
+		Timeout:           proto.Int64(500),
+		Scheme:            proto.String("http"),
+		Path:              proto.String("/healthcheck"),
+		NonCriticalChecks: nonCritical,
+		IgnoreNonCritical: proto.Bool(ignore),
+	}
+}
+
+func serveHealthCheck(status int, body string) net.Listener {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	So(err, ShouldBeNil)
+	go http.Serve(ln, http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		rw.Header().Set("Content-Type", "application/json")
+		rw.WriteHeader(status)
+		rw.Write([]byte(body))
+	}))
+	return ln
+}
+
+func TestMetricsHealthCheck(t *testing.T) {
+
+	Convey("A METRICS health check", t, func() {
+
+		Convey("should return ok when all the checks are healthy", func() {
+			ln := serveHealthCheck(http.StatusOK, `{"deadlocks":{"healthy":true},"database":{"healthy":true}}`)
+			defer ln.Close()
+
+			result := New("blah-1", ln.Addr().String(), metricsConfig(nil, false)).Check()
+			So(result.Code, ShouldEqual, protocol.HealthCheckResultCode_HEALTHY)
+			So(result.Reason, ShouldBeEmpty)
+			So(result.NextCheck, ShouldHappenAfter, time.Now())
+		})
+
+		Convey("should return down with the failed checks when a check fails", func() {
+			ln := serveHealthCheck(http.StatusInternalServerError,
+				`{"deadlocks":{"healthy":true},"database":{"healthy":false,"message":"Cannot connect"},"queue":{"healthy":false}}`)
+			defer ln.Close()
+
+			result := New("blah-1", ln.Addr().String(), metricsConfig(nil, false)).Check()
+			So(result.Code, ShouldEqual, protocol.HealthCheckResultCode_DOWN)
+			So(result.Reason, ShouldEqual, "database: Cannot connect; queue")
+		})
+
+		Convey("should return degraded when only non-critical checks fail", func() {
+			ln := serveHealthCheck(http.StatusInternalServerError,
+				`{"database":{"healthy":true},"cache":{"healthy":false,"message":"Evicting"}}`)
+			defer ln.Close()
+
+			result := New("blah-1", ln.Addr().String(), metricsConfig([]string{"cache"}, false)).Check()
+			So(result.Code, ShouldEqual, protocol.HealthCheckResultCode_DEGRADED)
+			So(result.Reason, ShouldEqual, "cache: Evicting")
+		})
+
+		Convey("should return ok when the failing non-critical checks are ignored", func() {
+			ln := serveHealthCheck(http.StatusInternalServerError,
+				`{"database":{"healthy":true},"cache":{"healthy":false,"message":"Evicting"}}`)
+			defer ln.Close()
+
+			result := New("blah-1", ln.Addr().String(), metricsConfig([]string{"cache"}, true)).Check()
+			So(result.Code, ShouldEqual, protocol.HealthCheckResultCode_HEALTHY)
+			So(result.Reason, ShouldBeEmpty)
+		})
+
+		Convey("should return down when a critical check fails next to a non-critical one", func() {
+			ln := serveHealthCheck(http.StatusInternalServerError,
+				`{"database":{"healthy":false},"cache":{"healthy":false}}`)
+			defer ln.Close()
+
+			result := New("blah-1", ln.Addr().String(), metricsConfig([]string{"cache"}, false)).Check()
+			So(result.Code, ShouldEqual, protocol.HealthCheckResultCode_DOWN)
+			So(result.Reason, ShouldEqual, "database; cache")
+		})
+
+		Convey("should return faulty when the body isn't a health check body", func() {
+			ln := serveHealthCheck(http.StatusOK, `pong`)
+			defer ln.Close()
+
+			result := New("blah-1", ln.Addr().String(), metricsConfig(nil, false)).Check()
+			So(result.Code, ShouldEqual, protocol.HealthCheckResultCode_ERROR)
+			So(result.Reason, ShouldNotBeEmpty)
+		})
+
+		Convey("should use the status code when an error has no health check body", func() {
+			ln := serveHealthCheck(http.StatusGatewayTimeout, `upstream timed out`)
+			defer ln.Close()
+
+			result := New("blah-1", ln.Addr().String(), metricsConfig(nil, false)).Check()
+			So(result.Code, ShouldEqual, protocol.HealthCheckResultCode_TIMEDOUT)
+		})
+	})
+}
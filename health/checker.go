@@ -3,10 +3,13 @@ package health
 import (
 	"fmt"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/op/go-logging"
 	"github.com/reverb/exeggutor"
+	"github.com/reverb/exeggutor/bus"
+	"github.com/reverb/exeggutor/events"
 	"github.com/reverb/exeggutor/health/check"
 	"github.com/reverb/exeggutor/protocol"
 	"github.com/reverb/go-mesos/mesos"
@@ -21,7 +24,9 @@ type HealthCheckScheduler interface {
 	Contains(app *mesos.TaskID) bool
 	Register(deployment *protocol.Deployment, app *protocol.Application) error
 	Unregister(app *mesos.TaskID) error
-	Failures() <-chan check.Result
+	// Health returns whether a task passes its health checks and whether it's unhealthy,
+	// both are false when the task hasn't been checked yet
+	Health(app *mesos.TaskID) (passing bool, unhealthy bool)
 }
 
 func newPool(nrw int, replyTo chan<- healthResult) *workerPool {
@@ -112,8 +117,8 @@ func (p *workerPool) Stop() error {
 // it receives a request for a health check and schedules that check.
 // It can also cancel and remove a healthcheck.
 // It is meant to be used by a task manager to check the services
-// the task manager is supervising and notify the task manager when a
-// particular health check fails
+// the task manager is supervising and notify the task manager, through bus.HealthCheckFailed,
+// when a particular task became unhealthy, that is after unhealthy_at checks in a row failed
 type HealthChecker struct {
 	exeggutor.Module
 	context  *exeggutor.AppContext
@@ -121,22 +126,30 @@ type HealthChecker struct {
 	queue    *healthCheckQueue
 	ticker   *time.Ticker
 	pool     *workerPool
-	failures chan check.Result
 	results  chan healthResult
+	commands chan bool
+	// lock guards the register and the deployment, app and health
+	// of the registered checks, which the task manager changes while the results are dispatched
+	lock *sync.Mutex
 }
 
 // New creates a new instance of the health checker scheduler.
 func New(context *exeggutor.AppContext) *HealthChecker {
 	nrw := context.Config.FrameworkInfo.HealthCheckConcurrency
 	results := make(chan healthResult, nrw)
+	slots := context.Config.FrameworkInfo.CommandCheckSlots
+	if slots < 1 {
+		slots = 1
+	}
 	return &HealthChecker{
 		context:  context,
 		register: make(map[string]*activeHealthCheck),
 		queue:    newHealthCheckQueue(),
 		pool:     newPool(nrw, results),
-		failures: make(chan check.Result),
 		results:  results,
+		commands: make(chan bool, slots),
 		ticker:   time.NewTicker(1 * time.Second),
+		lock:     &sync.Mutex{},
 	}
 }
 
@@ -179,18 +192,43 @@ func (h *HealthChecker) dispatchResultsLoop() {
 			item := result.item
 			item.ExpiresAt = result.result.NextCheck
 			h.queue.Push(item)
-			if result.result.Code != protocol.HealthCheckResultCode_HEALTHY {
-				h.failures <- result.result
+			h.lock.Lock()
+			if item.health == nil {
+				item.health = newHealthCounter(item.app.GetSla())
+			}
+			changed := item.health.record(result.result.Code)
+			unhealthy := item.health.unhealthy
+			deployment, app := item.deployment, item.app
+			h.lock.Unlock()
+
+			// only a task that failed unhealthy_at checks in a row is reported as failed
+			if !changed {
+				continue
+			}
+			h.publishChange(deployment, app, unhealthy, result.result)
+			if unhealthy {
+				h.context.Bus.Publish(bus.HealthCheckFailed, result.result)
 			}
 		}
 	}()
 }
 
+// publishChange publishes an event when a task became unhealthy or healthy again
+func (h *HealthChecker) publishChange(deployment *protocol.Deployment, app *protocol.Application, unhealthy bool, result check.Result) {
+	eventType := events.HealthCheckRecovered
+	if unhealthy {
+		eventType = events.HealthCheckFailed
+	}
+	h.context.EventSource.Publish(events.ForDeployment(eventType, deployment, app).WithData(map[string]string{
+		"code":   result.Code.String(),
+		"reason": result.Reason,
+	}))
+}
+
 // Stop stops this instance of health checker
 func (h *HealthChecker) Stop() error {
 	err := h.pool.Stop()
 	h.ticker.Stop()
-	close(h.failures)
 	close(h.results)
 	log.Notice("Stopped health checker")
 	return err
@@ -221,8 +259,9 @@ func (h *HealthChecker) checkDisabled(deployment *protocol.Deployment, app *prot
 		return // this component doesn't need health checking
 	}
 
-	p, ok := h.portForScheme(deployment.GetPortMapping(), config.GetScheme())
-	if !ok {
+	p, ok := h.portForScheme(deployment.GetPortMapping(), c.GetScheme())
+	// a command gets all the ports of the task, it doesn't need the port of the scheme
+	if !ok && c.GetMode() != protocol.HealthCheckMode_COMMAND {
 		mf := "component %s for app %s has no ports configured, disabling health check for task %s on host %s"
 		log.Info(mf, app.GetAppName(), app.GetName(), id, hn)
 		return
@@ -239,17 +278,25 @@ func (h *HealthChecker) Register(deployment *protocol.Deployment, app *protocol.
 		log.Error("Couldn't register app for health checks because, %v", err)
 		return err
 	}
-	if config == nil || port == 0 {
+	command := config.GetMode() == protocol.HealthCheckMode_COMMAND
+	if config == nil || (port == 0 && !command) {
 		return nil // this was disabled
 	}
 
+	h.lock.Lock()
+	defer h.lock.Unlock()
 	chk, ok := h.register[id]
 	if ok {
 		chk.HealthCheck.Update(config)
+		chk.health.configure(app.GetSla())
+		chk.deployment, chk.app = deployment, app
 	} else {
 		scheduled := &activeHealthCheck{
-			HealthCheck: check.New(id, fmt.Sprintf("%s:%d", hn, port), config),
+			HealthCheck: h.newCheck(deployment, id, fmt.Sprintf("%s:%d", hn, port), config),
 			ExpiresAt:   time.Now().Add(time.Duration(config.GetRampUp()) * time.Millisecond),
+			deployment:  deployment,
+			app:         app,
+			health:      newHealthCounter(app.GetSla()),
 		}
 		log.Debug("Enqueueing %v", scheduled)
 		h.register[id] = scheduled
@@ -259,19 +306,39 @@ func (h *HealthChecker) Register(deployment *protocol.Deployment, app *protocol.
 	return nil
 }
 
+func (h *HealthChecker) newCheck(deployment *protocol.Deployment, id, address string, config *protocol.HealthCheck) check.HealthCheck {
+	if config.GetMode() == protocol.HealthCheckMode_COMMAND {
+		return check.NewCommand(id, deployment, config, h.commands)
+	}
+	return check.New(id, address, config)
+}
+
 // Unregister unregisters and stops a health check
 func (h *HealthChecker) Unregister(app *mesos.TaskID) error {
+	h.lock.Lock()
 	delete(h.register, app.GetValue())
+	h.lock.Unlock()
 	h.queue.Remove(app.GetValue())
 	return nil
 }
 
+// Health returns whether the task passes its health checks and whether it's unhealthy.
+// The results are damped, a task only becomes unhealthy after unhealthy_at failures in a row
+// and a degraded task passes, see healthCounter.
+func (h *HealthChecker) Health(app *mesos.TaskID) (passing bool, unhealthy bool) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	chk, ok := h.register[app.GetValue()]
+	if !ok || chk.health == nil {
+		return false, false
+	}
+	return chk.health.passing(), chk.health.unhealthy
+}
+
 // Contains returns true when this task is known to this scheduler
 func (h *HealthChecker) Contains(app *mesos.TaskID) bool {
+	h.lock.Lock()
+	defer h.lock.Unlock()
 	_, ok := h.register[app.GetValue()]
 	return ok
 }
-
-func (h *HealthChecker) Failures() <-chan check.Result {
-	return h.failures
-}
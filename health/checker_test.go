@@ -163,6 +163,19 @@ func TestHealthChecker(t *testing.T) {
 			})
 		})
 
+		Convey("when registering a command", func() {
+			deployment, app := AppWithHealthCheck(context, 5, 300000, 60000, 5000)
+			app.Sla.HealthCheck.Mode = protocol.HealthCheckMode_COMMAND.Enum()
+			app.Sla.HealthCheck.Command = proto.String("/bin/true")
+
+			Convey("it should register the check when the task has no ports", func() {
+				deployment.PortMapping = nil
+				err := checker.Register(&deployment, &app)
+				So(err, ShouldBeNil)
+				So(checker.Contains(deployment.TaskId), ShouldBeTrue)
+			})
+		})
+
 		Convey("when unregistering", func() {
 			d, app := AppWithHealthCheck(context, 10, 300000, 60000, 5000)
 			d2, app2 := AppWithHealthCheck(context, 20, 150000, 60000, 5000)
@@ -0,0 +1,63 @@
+package health
+
+import "github.com/reverb/exeggutor/protocol"
+
+// healthCounter counts the consecutive results of the health checks of a task.
+// A healthy task only becomes unhealthy after unhealthy_at failures in a row
+// and an unhealthy task only becomes healthy again after healthy_at successes in a row,
+// so a single slow probe doesn't take down a healthy instance.
+type healthCounter struct {
+	unhealthyAt int32
+	healthyAt   int32
+	failures    int32
+	successes   int32
+	unhealthy   bool
+}
+
+func newHealthCounter(sla *protocol.ApplicationSLA) *healthCounter {
+	counter := &healthCounter{}
+	counter.configure(sla)
+	return counter
+}
+
+// configure takes the thresholds from the SLA, the counts so far are kept
+func (c *healthCounter) configure(sla *protocol.ApplicationSLA) {
+	c.unhealthyAt, c.healthyAt = sla.GetUnhealthyAt(), sla.GetHealthyAt()
+	if c.unhealthyAt < 1 {
+		c.unhealthyAt = 1
+	}
+	if c.healthyAt < 1 {
+		c.healthyAt = 1
+	}
+}
+
+// passing returns true when the last counted result was a success and the task isn't unhealthy
+func (c *healthCounter) passing() bool {
+	return !c.unhealthy && c.successes > 0
+}
+
+// record counts the result of a health check and returns true when the task
+// became unhealthy or healthy again because of it, a degraded task still counts as healthy
+// and an unknown result, of a check that didn't run, doesn't count at all
+func (c *healthCounter) record(code protocol.HealthCheckResultCode) bool {
+	if code == protocol.HealthCheckResultCode_UNKNOWN {
+		return false
+	}
+	if code == protocol.HealthCheckResultCode_HEALTHY || code == protocol.HealthCheckResultCode_DEGRADED {
+		c.failures = 0
+		c.successes++
+		if c.unhealthy && c.successes >= c.healthyAt {
+			c.unhealthy = false
+			return true
+		}
+		return false
+	}
+
+	c.successes = 0
+	c.failures++
+	if !c.unhealthy && c.failures >= c.unhealthyAt {
+		c.unhealthy = true
+		return true
+	}
+	return false
+}
@@ -0,0 +1,96 @@
+package health
+
+import (
+	"testing"
+
+	"code.google.com/p/goprotobuf/proto"
+	"github.com/reverb/exeggutor/protocol"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+const (
+	healthy  = protocol.HealthCheckResultCode_HEALTHY
+	timedOut = protocol.HealthCheckResultCode_TIMEDOUT
+)
+
+func recordAll(counter *healthCounter, codes ...protocol.HealthCheckResultCode) []bool {
+	var changes []bool
+	for _, code := range codes {
+		changes = append(changes, counter.record(code))
+	}
+	return changes
+}
+
+func TestHealthCounter(t *testing.T) {
+
+	Convey("A health counter", t, func() {
+		counter := newHealthCounter(&protocol.ApplicationSLA{
+			UnhealthyAt: proto.Int32(3),
+			HealthyAt:   proto.Int32(2),
+		})
+
+		Convey("keeps a task healthy when a single check fails", func() {
+			changes := recordAll(counter, timedOut, healthy, timedOut, timedOut, healthy)
+			So(changes, ShouldResemble, []bool{false, false, false, false, false})
+			So(counter.unhealthy, ShouldBeFalse)
+		})
+
+		Convey("makes a task unhealthy after unhealthy_at failures in a row", func() {
+			changes := recordAll(counter, timedOut, timedOut, timedOut, timedOut)
+			So(changes, ShouldResemble, []bool{false, false, true, false})
+			So(counter.unhealthy, ShouldBeTrue)
+		})
+
+		Convey("makes an unhealthy task healthy again after healthy_at successes in a row", func() {
+			recordAll(counter, timedOut, timedOut, timedOut)
+
+			changes := recordAll(counter, healthy, timedOut, healthy, healthy)
+			So(changes, ShouldResemble, []bool{false, false, false, true})
+			So(counter.unhealthy, ShouldBeFalse)
+		})
+
+		Convey("keeps a degraded task healthy", func() {
+			degraded := protocol.HealthCheckResultCode_DEGRADED
+			changes := recordAll(counter, degraded, degraded, degraded)
+			So(changes, ShouldResemble, []bool{false, false, false})
+			So(counter.unhealthy, ShouldBeFalse)
+		})
+
+		Convey("passes after a success and stops passing after a failure", func() {
+			So(counter.passing(), ShouldBeFalse)
+			recordAll(counter, protocol.HealthCheckResultCode_DEGRADED)
+			So(counter.passing(), ShouldBeTrue)
+			recordAll(counter, timedOut)
+			So(counter.passing(), ShouldBeFalse)
+			So(counter.unhealthy, ShouldBeFalse)
+		})
+
+		Convey("doesn't pass while it's unhealthy until it recovered", func() {
+			recordAll(counter, timedOut, timedOut, timedOut, healthy)
+			So(counter.passing(), ShouldBeFalse)
+			recordAll(counter, healthy)
+			So(counter.passing(), ShouldBeTrue)
+		})
+
+		Convey("doesn't count the checks that didn't run", func() {
+			unknown := protocol.HealthCheckResultCode_UNKNOWN
+			changes := recordAll(counter, timedOut, timedOut, unknown, timedOut)
+			So(changes, ShouldResemble, []bool{false, false, false, true})
+		})
+
+		Convey("keeps its counts when the thresholds change", func() {
+			recordAll(counter, timedOut, timedOut)
+			counter.configure(&protocol.ApplicationSLA{UnhealthyAt: proto.Int32(2)})
+
+			So(counter.record(timedOut), ShouldBeTrue)
+			So(counter.healthyAt, ShouldEqual, 1)
+		})
+
+		Convey("reacts to the first result without thresholds", func() {
+			counter := newHealthCounter(nil)
+
+			So(counter.record(timedOut), ShouldBeTrue)
+			So(counter.record(healthy), ShouldBeTrue)
+		})
+	})
+}
@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"github.com/reverb/exeggutor/health/check"
+	"github.com/reverb/exeggutor/protocol"
 )
 
 // activeHealthCheck represents a scheduled health check
@@ -14,6 +15,11 @@ type activeHealthCheck struct {
 	check.HealthCheck
 	ExpiresAt time.Time
 	index     int
+	// the task and the app this health check is for, they describe the health check events
+	deployment *protocol.Deployment
+	app        *protocol.Application
+	// health counts the consecutive results to decide when the task is unhealthy
+	health *healthCounter
 }
 
 type healthCheckPQueue []*activeHealthCheck
@@ -12,6 +12,7 @@ import (
 
 	"github.com/op/go-logging"
 	"github.com/reverb/exeggutor"
+	"github.com/reverb/exeggutor/bus"
 	"github.com/reverb/exeggutor/health"
 	"github.com/reverb/exeggutor/protocol"
 	"github.com/reverb/go-mesos/mesos"
@@ -92,6 +93,7 @@ func main() {
 				HealthCheckConcurrency: 50,
 			},
 		},
+		Bus: bus.New(),
 	}
 	handler := func(port int) http.Handler {
 		counter := 0
@@ -138,8 +140,9 @@ func main() {
 		log.Info("Scheduled 40 health checks to run")
 	}()
 
+	failures := context.Bus.Subscribe(bus.HealthCheckFailed, 10, bus.Block)
 	go func() {
-		for result := range checker.Failures() {
+		for result := range failures.Messages() {
 			log.Info("********   Received result %+v", result)
 		}
 	}()
@@ -5,6 +5,8 @@ import (
 
 	"github.com/op/go-logging"
 	"github.com/reverb/exeggutor"
+	"github.com/reverb/exeggutor/bus"
+	"github.com/reverb/exeggutor/events"
 	"github.com/reverb/exeggutor/protocol"
 	app_store "github.com/reverb/exeggutor/store/apps"
 	task_store "github.com/reverb/exeggutor/store/tasks"
@@ -28,33 +30,37 @@ type SLAMonitor interface {
 	exeggutor.Module
 	NeedsMoreInstances(app *protocol.Application) bool
 	CanDeployMoreInstances(app *protocol.Application) bool
-	ScaleUpOrDown() <-chan ChangeDeployCount
 }
 
 type simpleSLAMonitor struct {
-	taskStore    task_store.TaskStore
-	appStore     app_store.AppStore
-	queue        queue.TaskQueue
-	ticker       *time.Ticker
-	closing      chan chan bool
-	needsScaling chan ChangeDeployCount
-	interval     time.Duration
+	taskStore task_store.TaskStore
+	appStore  app_store.AppStore
+	queue     queue.TaskQueue
+	ticker    *time.Ticker
+	closing   chan chan bool
+	interval  time.Duration
+	events    *events.Stream
+	bus       *bus.Bus
 }
 
-// New creates a new instance of an SLA monitor
-func New(ts task_store.TaskStore, as app_store.AppStore, q queue.TaskQueue) SLAMonitor {
-	return NewWithInterval(ts, as, q, 1*time.Minute)
+// New creates a new instance of an SLA monitor that publishes its scale decisions
+// on the event stream and the event bus of the context
+func New(ts task_store.TaskStore, as app_store.AppStore, q queue.TaskQueue, context *exeggutor.AppContext) SLAMonitor {
+	monitor := NewWithInterval(ts, as, q, context.Bus, 1*time.Minute).(*simpleSLAMonitor)
+	monitor.events = context.EventSource
+	return monitor
 }
 
 // NewWithInterval creates a new instance of an SLA monitor which ticks at the specified interval
-func NewWithInterval(ts task_store.TaskStore, as app_store.AppStore, q queue.TaskQueue, interval time.Duration) SLAMonitor {
+// and publishes the changes to the deploy count it decides on as bus.ScaleRequested
+func NewWithInterval(ts task_store.TaskStore, as app_store.AppStore, q queue.TaskQueue, b *bus.Bus, interval time.Duration) SLAMonitor {
 	return &simpleSLAMonitor{
-		taskStore:    ts,
-		appStore:     as,
-		queue:        q,
-		closing:      make(chan chan bool),
-		needsScaling: make(chan ChangeDeployCount),
-		interval:     interval,
+		taskStore: ts,
+		appStore:  as,
+		queue:     q,
+		closing:   make(chan chan bool),
+		interval:  interval,
+		bus:       b,
 	}
 }
 
@@ -166,10 +172,24 @@ func (s *simpleSLAMonitor) checkSLAConformance() {
 	log.Debug("Checking SLA conformance of running apps")
 	changes := s.changeDeployCount()
 	for _, change := range changes {
-		s.needsScaling <- change
+		if change.Count != 0 {
+			s.events.Publish(scaleDecision(change))
+		}
+		s.bus.Publish(bus.ScaleRequested, change)
 	}
 }
 
+func scaleDecision(change ChangeDeployCount) *events.Event {
+	var tasks []string
+	for _, task := range change.Tasks {
+		tasks = append(tasks, task.GetValue())
+	}
+	return events.ForApp(events.ScaleDecision, change.App).WithData(map[string]interface{}{
+		"count": change.Count,
+		"tasks": tasks,
+	})
+}
+
 // NeedsMoreInstances returns true when the app is active and has an SLA defined.
 // in addition to not having reached the minimum instances threshold yet.
 // It takes the running apps as well as the queued applications into account when it
@@ -203,10 +223,3 @@ func (s *simpleSLAMonitor) CanDeployMoreInstances(app *protocol.Application) boo
 	runningApps := s.taskStore.RunningAppsCount(app.GetId()) + s.queue.CountAppsForID(app.GetId())
 	return runningApps < appSLA.GetMaxInstances()
 }
-
-// ScaleUpOrDown returns the channel at which this component will publish
-// its events. Whenever a deployment needs to be changed because of a SLA
-// rule this channel will receive a ChangeDeployCount message
-func (s *simpleSLAMonitor) ScaleUpOrDown() <-chan ChangeDeployCount {
-	return s.needsScaling
-}
@@ -9,6 +9,7 @@ import (
 
 	"github.com/op/go-logging"
 	"github.com/reverb/exeggutor"
+	"github.com/reverb/exeggutor/bus"
 	"github.com/reverb/exeggutor/protocol"
 	"github.com/reverb/exeggutor/store"
 	app_store "github.com/reverb/exeggutor/store/apps"
@@ -49,10 +50,13 @@ func TestSLAMonitorStartupLoop(t *testing.T) {
 		taskStore := task_store.NewWithStore(ts)
 		appStore := app_store.NewWithStore(as)
 		builder := builders.New(context.Config)
-		monitor := NewWithInterval(taskStore, appStore, tq, 1*time.Second)
+		b := bus.New()
+		scaling := b.Subscribe(bus.ScaleRequested, 1, bus.Block)
+		monitor := NewWithInterval(taskStore, appStore, tq, b, 1*time.Second)
 		monitor.Start()
 
 		Reset(func() {
+			b.Stop()
 			monitor.Stop()
 			tq.Stop()
 		})
@@ -68,7 +72,7 @@ func TestSLAMonitorStartupLoop(t *testing.T) {
 			tq.Enqueue(&scheduled)
 			taskStore.Save(&deployment)
 			appStore.Save(&component)
-			cnt := <-monitor.ScaleUpOrDown()
+			cnt := (<-scaling.Messages()).(ChangeDeployCount)
 			So(cnt.Count, ShouldEqual, 1)
 		})
 
@@ -83,7 +87,7 @@ func TestSLAMonitorStartupLoop(t *testing.T) {
 			deployed := test_utils.DeployedApp(&component, &task)
 			taskStore.Save(&deployed)
 			appStore.Save(&component)
-			cnt := <-monitor.ScaleUpOrDown()
+			cnt := (<-scaling.Messages()).(ChangeDeployCount)
 			So(cnt.Count, ShouldEqual, -1)
 		})
 	})
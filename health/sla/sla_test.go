@@ -11,6 +11,7 @@ import (
 
 	"github.com/op/go-logging"
 	"github.com/reverb/exeggutor"
+	"github.com/reverb/exeggutor/bus"
 	"github.com/reverb/exeggutor/protocol"
 	"github.com/reverb/exeggutor/store"
 	app_store "github.com/reverb/exeggutor/store/apps"
@@ -73,21 +74,22 @@ func TestSLAMonitor(t *testing.T) {
 		as := store.NewEmptyInMemoryStore()
 		ts := store.NewEmptyInMemoryStore()
 		builder := builders.New(context.Config)
-		scal := make(chan ChangeDeployCount)
+		b := bus.New()
+		scaling := b.Subscribe(bus.ScaleRequested, 1, bus.Block)
 
 		monitor := &simpleSLAMonitor{
-			taskStore:    task_store.NewWithStore(ts),
-			appStore:     app_store.NewWithStore(as),
-			queue:        tq,
-			interval:     0 * time.Nanosecond,
-			needsScaling: scal,
+			taskStore: task_store.NewWithStore(ts),
+			appStore:  app_store.NewWithStore(as),
+			queue:     tq,
+			interval:  0 * time.Nanosecond,
+			bus:       b,
 		}
 		monitor.Start()
 
 		Reset(func() {
 			tq.Stop()
 			monitor.Stop()
-			close(scal)
+			b.Stop()
 		})
 
 		Convey("when nothing is queued or running", func() {
@@ -285,7 +287,7 @@ func TestSLAMonitor(t *testing.T) {
 
 				Convey("it should need to change the deployment count", func() {
 					go monitor.checkSLAConformance()
-					cnt := <-monitor.needsScaling
+					cnt := (<-scaling.Messages()).(ChangeDeployCount)
 					So(cnt.Count, ShouldEqual, 1)
 				})
 			})
@@ -304,7 +306,7 @@ func TestSLAMonitor(t *testing.T) {
 
 				Convey("it should need to change the deployment count", func() {
 					go monitor.checkSLAConformance()
-					cnt := <-monitor.needsScaling
+					cnt := (<-scaling.Messages()).(ChangeDeployCount)
 					So(cnt.Count, ShouldEqual, -1)
 				})
 			})
@@ -1,7 +1,6 @@
 package test_utils
 
 import (
-	"github.com/reverb/exeggutor/health/check"
 	"github.com/reverb/exeggutor/protocol"
 	"github.com/reverb/go-mesos/mesos"
 )
@@ -25,6 +24,6 @@ func (n *NoopHealthChecker) Register(deployment *protocol.Deployment, app *proto
 func (n *NoopHealthChecker) Unregister(app *mesos.TaskID) error {
 	return nil
 }
-func (n *NoopHealthChecker) Failures() <-chan check.Result {
-	return nil
+func (n *NoopHealthChecker) Health(app *mesos.TaskID) (bool, bool) {
+	return true, false
 }
@@ -1,7 +1,6 @@
 package test_utils
 
 import (
-	"github.com/reverb/exeggutor/health/sla"
 	"github.com/reverb/exeggutor/protocol"
 )
 
@@ -14,9 +13,6 @@ func (c *NoopSLAMonitor) NeedsMoreInstances(app *protocol.Application) bool {
 func (c *NoopSLAMonitor) CanDeployMoreInstances(app *protocol.Application) bool {
 	return true
 }
-func (c *NoopSLAMonitor) ScaleUpOrDown() <-chan sla.ChangeDeployCount {
-	return nil
-}
 func (c *NoopSLAMonitor) Start() error {
 	return nil
 }
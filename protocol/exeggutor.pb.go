@@ -14,6 +14,8 @@ It has these top-level messages:
 	PortMapping
 	Deployment
 	Application
+	ApplicationRevision
+	PlacementConstraint
 	ScheduledApp
 	HealthCheck
 	ApplicationSLA
@@ -196,17 +198,21 @@ const (
 	HealthCheckMode_TCP HealthCheckMode = 1
 	// For the METRICS strategy it will use the HTTP strategy but additionally the response body will be validated that all components are running fine.
 	HealthCheckMode_METRICS HealthCheckMode = 2
+	// For the COMMAND strategy agora runs the command with the host and ports of the task in its environment, the exit code decides the result
+	HealthCheckMode_COMMAND HealthCheckMode = 3
 )
 
 var HealthCheckMode_name = map[int32]string{
 	0: "HTTP",
 	1: "TCP",
 	2: "METRICS",
+	3: "COMMAND",
 }
 var HealthCheckMode_value = map[string]int32{
 	"HTTP":    0,
 	"TCP":     1,
 	"METRICS": 2,
+	"COMMAND": 3,
 }
 
 func (x HealthCheckMode) Enum() *HealthCheckMode {
@@ -239,6 +245,8 @@ const (
 	HealthCheckResultCode_TIMEDOUT HealthCheckResultCode = 2
 	// the service was unreachable
 	HealthCheckResultCode_DOWN HealthCheckResultCode = 3
+	// the service works but some of its non-critical checks fail
+	HealthCheckResultCode_DEGRADED HealthCheckResultCode = 4
 	// we haven't checked the state yet etc... noop
 	HealthCheckResultCode_UNKNOWN HealthCheckResultCode = 99
 )
@@ -248,6 +256,7 @@ var HealthCheckResultCode_name = map[int32]string{
 	1:  "ERROR",
 	2:  "TIMEDOUT",
 	3:  "DOWN",
+	4:  "DEGRADED",
 	99: "UNKNOWN",
 }
 var HealthCheckResultCode_value = map[string]int32{
@@ -255,6 +264,7 @@ var HealthCheckResultCode_value = map[string]int32{
 	"ERROR":    1,
 	"TIMEDOUT": 2,
 	"DOWN":     3,
+	"DEGRADED": 4,
 	"UNKNOWN":  99,
 }
 
@@ -275,6 +285,137 @@ func (x *HealthCheckResultCode) UnmarshalJSON(data []byte) error {
 	return nil
 }
 
+//
+// ConstraintOperator how a placement constraint compares the attribute of a slave
+type ConstraintOperator int32
+
+const (
+	// every instance runs on a slave with a different value for the attribute
+	ConstraintOperator_UNIQUE ConstraintOperator = 0
+	// instances only run on slaves where the attribute matches the value as a regular expression
+	ConstraintOperator_LIKE ConstraintOperator = 1
+	// instances only run on slaves where the attribute doesn't match the value as a regular expression
+	ConstraintOperator_UNLIKE ConstraintOperator = 2
+	// instances are spread evenly over the values of the attribute
+	ConstraintOperator_GROUP_BY ConstraintOperator = 3
+	// at most value instances run on slaves with the same value for the attribute
+	ConstraintOperator_MAX_PER ConstraintOperator = 4
+)
+
+var ConstraintOperator_name = map[int32]string{
+	0: "UNIQUE",
+	1: "LIKE",
+	2: "UNLIKE",
+	3: "GROUP_BY",
+	4: "MAX_PER",
+}
+var ConstraintOperator_value = map[string]int32{
+	"UNIQUE":   0,
+	"LIKE":     1,
+	"UNLIKE":   2,
+	"GROUP_BY": 3,
+	"MAX_PER":  4,
+}
+
+func (x ConstraintOperator) Enum() *ConstraintOperator {
+	p := new(ConstraintOperator)
+	*p = x
+	return p
+}
+func (x ConstraintOperator) String() string {
+	return proto.EnumName(ConstraintOperator_name, int32(x))
+}
+func (x *ConstraintOperator) UnmarshalJSON(data []byte) error {
+	value, err := proto.UnmarshalJSONEnum(ConstraintOperator_value, data, "ConstraintOperator")
+	if err != nil {
+		return err
+	}
+	*x = ConstraintOperator(value)
+	return nil
+}
+
+//
+// PriorityClass how urgently the instances of a component should be deployed
+type PriorityClass int32
+
+const (
+	// deployed when nothing more urgent is waiting
+	PriorityClass_LOW PriorityClass = 0
+	// the priority class of components that don't define one
+	PriorityClass_NORMAL PriorityClass = 1
+	// deployed before normal components
+	PriorityClass_HIGH PriorityClass = 2
+	// deployed before everything else
+	PriorityClass_CRITICAL PriorityClass = 3
+)
+
+var PriorityClass_name = map[int32]string{
+	0: "LOW",
+	1: "NORMAL",
+	2: "HIGH",
+	3: "CRITICAL",
+}
+var PriorityClass_value = map[string]int32{
+	"LOW":      0,
+	"NORMAL":   1,
+	"HIGH":     2,
+	"CRITICAL": 3,
+}
+
+func (x PriorityClass) Enum() *PriorityClass {
+	p := new(PriorityClass)
+	*p = x
+	return p
+}
+func (x PriorityClass) String() string {
+	return proto.EnumName(PriorityClass_name, int32(x))
+}
+func (x *PriorityClass) UnmarshalJSON(data []byte) error {
+	value, err := proto.UnmarshalJSONEnum(PriorityClass_value, data, "PriorityClass")
+	if err != nil {
+		return err
+	}
+	*x = PriorityClass(value)
+	return nil
+}
+
+//
+// QuotaScope what a resource quota is applied to
+type QuotaScope int32
+
+const (
+	// the quota limits all the components of an application
+	QuotaScope_APP QuotaScope = 0
+	// the quota limits all the components of a team
+	QuotaScope_TEAM QuotaScope = 1
+)
+
+var QuotaScope_name = map[int32]string{
+	0: "APP",
+	1: "TEAM",
+}
+var QuotaScope_value = map[string]int32{
+	"APP":  0,
+	"TEAM": 1,
+}
+
+func (x QuotaScope) Enum() *QuotaScope {
+	p := new(QuotaScope)
+	*p = x
+	return p
+}
+func (x QuotaScope) String() string {
+	return proto.EnumName(QuotaScope_name, int32(x))
+}
+func (x *QuotaScope) UnmarshalJSON(data []byte) error {
+	value, err := proto.UnmarshalJSONEnum(QuotaScope_value, data, "QuotaScope")
+	if err != nil {
+		return err
+	}
+	*x = QuotaScope(value)
+	return nil
+}
+
 // StringKeyValue represents a pair of 2 strings used as a replacement for maps
 type StringKeyValue struct {
 	Key              *string `protobuf:"bytes,1,req,name=key" json:"key,omitempty"`
@@ -487,8 +628,14 @@ type Application struct {
 	// where to expect the configuration to be
 	ConfDir *string `protobuf:"bytes,32,opt,name=conf_dir" json:"conf_dir,omitempty"`
 	// the application SLA to use for this component
-	Sla              *ApplicationSLA `protobuf:"bytes,33,opt,name=sla" json:"sla,omitempty"`
-	XXX_unrecognized []byte          `json:"-"`
+	Sla *ApplicationSLA `protobuf:"bytes,33,opt,name=sla" json:"sla,omitempty"`
+	// the constraints on the slaves this component can be placed on
+	Constraints []*PlacementConstraint `protobuf:"bytes,34,rep,name=constraints" json:"constraints,omitempty"`
+	// the priority class of this component, used by the priority and aging queue orders
+	PriorityClass *PriorityClass `protobuf:"varint,35,opt,name=priority_class,enum=protocol.PriorityClass,def=1" json:"priority_class,omitempty"`
+	// the team that owns this component, team quotas apply to all the components of a team
+	Team             *string `protobuf:"bytes,36,opt,name=team" json:"team,omitempty"`
+	XXX_unrecognized []byte  `json:"-"`
 }
 
 func (m *Application) Reset()         { *m = Application{} }
@@ -497,6 +644,7 @@ func (*Application) ProtoMessage()    {}
 
 const Default_Application_Distribution Distribution = Distribution_DOCKER
 const Default_Application_ComponentType ComponentType = ComponentType_SERVICE
+const Default_Application_PriorityClass PriorityClass = PriorityClass_NORMAL
 
 func (m *Application) GetId() string {
 	if m != nil && m.Id != nil {
@@ -624,7 +772,199 @@ func (m *Application) GetSla() *ApplicationSLA {
 	return nil
 }
 
+func (m *Application) GetConstraints() []*PlacementConstraint {
+	if m != nil {
+		return m.Constraints
+	}
+	return nil
+}
+
+func (m *Application) GetPriorityClass() PriorityClass {
+	if m != nil && m.PriorityClass != nil {
+		return *m.PriorityClass
+	}
+	return Default_Application_PriorityClass
+}
+
+func (m *Application) GetTeam() string {
+	if m != nil && m.Team != nil {
+		return *m.Team
+	}
+	return ""
+}
+
 //
+// ResourceQuota limits the resources the deployed and queued instances of an application or a team can claim.
+// A limit of 0 means the resource isn't limited.
+type ResourceQuota struct {
+	// what the quota applies to
+	Scope *QuotaScope `protobuf:"varint,1,req,name=scope,enum=protocol.QuotaScope,def=0" json:"scope,omitempty"`
+	// the application name or the team the quota applies to
+	Name *string `protobuf:"bytes,2,req,name=name" json:"name,omitempty"`
+	// the maximum number of cpus
+	Cpus *float32 `protobuf:"fixed32,3,opt,name=cpus" json:"cpus,omitempty"`
+	// the maximum amount of memory in megabytes
+	Mem *float32 `protobuf:"fixed32,4,opt,name=mem" json:"mem,omitempty"`
+	// the maximum amount of disk space in megabytes
+	DiskSpace *int64 `protobuf:"varint,5,opt,name=disk_space" json:"disk_space,omitempty"`
+	// the maximum number of instances
+	Instances        *int32 `protobuf:"varint,6,opt,name=instances" json:"instances,omitempty"`
+	XXX_unrecognized []byte `json:"-"`
+}
+
+func (m *ResourceQuota) Reset()         { *m = ResourceQuota{} }
+func (m *ResourceQuota) String() string { return proto.CompactTextString(m) }
+func (*ResourceQuota) ProtoMessage()    {}
+
+const Default_ResourceQuota_Scope QuotaScope = QuotaScope_APP
+
+func (m *ResourceQuota) GetScope() QuotaScope {
+	if m != nil && m.Scope != nil {
+		return *m.Scope
+	}
+	return Default_ResourceQuota_Scope
+}
+
+func (m *ResourceQuota) GetName() string {
+	if m != nil && m.Name != nil {
+		return *m.Name
+	}
+	return ""
+}
+
+func (m *ResourceQuota) GetCpus() float32 {
+	if m != nil && m.Cpus != nil {
+		return *m.Cpus
+	}
+	return 0
+}
+
+func (m *ResourceQuota) GetMem() float32 {
+	if m != nil && m.Mem != nil {
+		return *m.Mem
+	}
+	return 0
+}
+
+func (m *ResourceQuota) GetDiskSpace() int64 {
+	if m != nil && m.DiskSpace != nil {
+		return *m.DiskSpace
+	}
+	return 0
+}
+
+func (m *ResourceQuota) GetInstances() int32 {
+	if m != nil && m.Instances != nil {
+		return *m.Instances
+	}
+	return 0
+}
+
+//
+// PlacementConstraint limits the slaves a component can be placed on.
+// The attribute is the name of a slave attribute or hostname for the host name of the slave.
+type PlacementConstraint struct {
+	// the slave attribute to compare, hostname is the host name of the slave
+	Attribute *string `protobuf:"bytes,1,req,name=attribute" json:"attribute,omitempty"`
+	// how to compare the attribute
+	Operator *ConstraintOperator `protobuf:"varint,2,req,name=operator,enum=protocol.ConstraintOperator,def=0" json:"operator,omitempty"`
+	// the regular expression for LIKE and UNLIKE, the maximum for MAX_PER
+	Value            *string `protobuf:"bytes,3,opt,name=value" json:"value,omitempty"`
+	XXX_unrecognized []byte  `json:"-"`
+}
+
+func (m *PlacementConstraint) Reset()         { *m = PlacementConstraint{} }
+func (m *PlacementConstraint) String() string { return proto.CompactTextString(m) }
+func (*PlacementConstraint) ProtoMessage()    {}
+
+const Default_PlacementConstraint_Operator ConstraintOperator = ConstraintOperator_UNIQUE
+
+func (m *PlacementConstraint) GetAttribute() string {
+	if m != nil && m.Attribute != nil {
+		return *m.Attribute
+	}
+	return ""
+}
+
+func (m *PlacementConstraint) GetOperator() ConstraintOperator {
+	if m != nil && m.Operator != nil {
+		return *m.Operator
+	}
+	return Default_PlacementConstraint_Operator
+}
+
+func (m *PlacementConstraint) GetValue() string {
+	if m != nil && m.Value != nil {
+		return *m.Value
+	}
+	return ""
+}
+
+// ApplicationRevision an immutable copy of a manifest as it was saved.
+// Every save of a component gets the next revision number for that component
+// so earlier manifests can be compared with and returned to.
+type ApplicationRevision struct {
+	// the application the component belongs to
+	AppName *string `protobuf:"bytes,1,req,name=app_name" json:"app_name,omitempty"`
+	// the name of the component
+	Name *string `protobuf:"bytes,2,req,name=name" json:"name,omitempty"`
+	// the revision number, starting at 1 for every component
+	Revision *int32 `protobuf:"varint,3,req,name=revision" json:"revision,omitempty"`
+	// the unix epoch in milliseconds when this revision was saved
+	SavedAt *int64 `protobuf:"varint,4,req,name=saved_at" json:"saved_at,omitempty"`
+	// the manifest as it was saved
+	App *Application `protobuf:"bytes,5,req,name=app" json:"app,omitempty"`
+	// who saved this revision
+	Author           *string `protobuf:"bytes,20,opt,name=author" json:"author,omitempty"`
+	XXX_unrecognized []byte  `json:"-"`
+}
+
+func (m *ApplicationRevision) Reset()         { *m = ApplicationRevision{} }
+func (m *ApplicationRevision) String() string { return proto.CompactTextString(m) }
+func (*ApplicationRevision) ProtoMessage()    {}
+
+func (m *ApplicationRevision) GetAppName() string {
+	if m != nil && m.AppName != nil {
+		return *m.AppName
+	}
+	return ""
+}
+
+func (m *ApplicationRevision) GetName() string {
+	if m != nil && m.Name != nil {
+		return *m.Name
+	}
+	return ""
+}
+
+func (m *ApplicationRevision) GetRevision() int32 {
+	if m != nil && m.Revision != nil {
+		return *m.Revision
+	}
+	return 0
+}
+
+func (m *ApplicationRevision) GetSavedAt() int64 {
+	if m != nil && m.SavedAt != nil {
+		return *m.SavedAt
+	}
+	return 0
+}
+
+func (m *ApplicationRevision) GetApp() *Application {
+	if m != nil {
+		return m.App
+	}
+	return nil
+}
+
+func (m *ApplicationRevision) GetAuthor() string {
+	if m != nil && m.Author != nil {
+		return *m.Author
+	}
+	return ""
+}
+
 // ScheduledAppComponent a structure to describe an application
 // component that has been scheduled for deployment.
 type ScheduledApp struct {
@@ -635,7 +975,9 @@ type ScheduledApp struct {
 	// Position the full position of this item in the queue
 	Position *int32 `protobuf:"varint,5,req,name=position" json:"position,omitempty"`
 	// Since the timestamp in nanoseconds when this item was added to the queue
-	Since            *int64 `protobuf:"varint,6,req,name=since" json:"since,omitempty"`
+	Since *int64 `protobuf:"varint,6,req,name=since" json:"since,omitempty"`
+	// Expedite is true when this item replaces a lost instance and should be placed ahead of everything else
+	Expedite         *bool  `protobuf:"varint,20,opt,name=expedite,def=0" json:"expedite,omitempty"`
 	XXX_unrecognized []byte `json:"-"`
 }
 
@@ -643,6 +985,8 @@ func (m *ScheduledApp) Reset()         { *m = ScheduledApp{} }
 func (m *ScheduledApp) String() string { return proto.CompactTextString(m) }
 func (*ScheduledApp) ProtoMessage()    {}
 
+const Default_ScheduledApp_Expedite bool = false
+
 func (m *ScheduledApp) GetAppId() string {
 	if m != nil && m.AppId != nil {
 		return *m.AppId
@@ -671,6 +1015,13 @@ func (m *ScheduledApp) GetSince() int64 {
 	return 0
 }
 
+func (m *ScheduledApp) GetExpedite() bool {
+	if m != nil && m.Expedite != nil {
+		return *m.Expedite
+	}
+	return Default_ScheduledApp_Expedite
+}
+
 //
 // HealthCheck describes a health check for an application.
 // For the TCP strategy it will just try to connect to the port
@@ -689,8 +1040,16 @@ type HealthCheck struct {
 	// when this is a http health check it will use this path to make the request
 	Path *string `protobuf:"bytes,20,opt,name=path,def=/api/api-docs" json:"path,omitempty"`
 	// for a http health check it will use this, other possible value is http
-	Scheme           *string `protobuf:"bytes,21,opt,name=scheme,def=http" json:"scheme,omitempty"`
-	XXX_unrecognized []byte  `json:"-"`
+	Scheme *string `protobuf:"bytes,21,opt,name=scheme,def=http" json:"scheme,omitempty"`
+	// for a metrics health check, the named checks that only make the service degraded when they fail
+	NonCriticalChecks []string `protobuf:"bytes,22,rep,name=non_critical_checks" json:"non_critical_checks,omitempty"`
+	// for a metrics health check, ignore the failures of the non-critical checks instead of reporting degraded
+	IgnoreNonCritical *bool `protobuf:"varint,23,opt,name=ignore_non_critical,def=0" json:"ignore_non_critical,omitempty"`
+	// for a command health check, the executable to run
+	Command *string `protobuf:"bytes,24,opt,name=command" json:"command,omitempty"`
+	// for a command health check, the arguments to run the executable with
+	Arguments        []string `protobuf:"bytes,25,rep,name=arguments" json:"arguments,omitempty"`
+	XXX_unrecognized []byte   `json:"-"`
 }
 
 func (m *HealthCheck) Reset()         { *m = HealthCheck{} }
@@ -700,6 +1059,7 @@ func (*HealthCheck) ProtoMessage()    {}
 const Default_HealthCheck_Mode HealthCheckMode = HealthCheckMode_HTTP
 const Default_HealthCheck_Path string = "/api/api-docs"
 const Default_HealthCheck_Scheme string = "http"
+const Default_HealthCheck_IgnoreNonCritical bool = false
 
 func (m *HealthCheck) GetMode() HealthCheckMode {
 	if m != nil && m.Mode != nil {
@@ -743,6 +1103,34 @@ func (m *HealthCheck) GetScheme() string {
 	return Default_HealthCheck_Scheme
 }
 
+func (m *HealthCheck) GetNonCriticalChecks() []string {
+	if m != nil {
+		return m.NonCriticalChecks
+	}
+	return nil
+}
+
+func (m *HealthCheck) GetIgnoreNonCritical() bool {
+	if m != nil && m.IgnoreNonCritical != nil {
+		return *m.IgnoreNonCritical
+	}
+	return Default_HealthCheck_IgnoreNonCritical
+}
+
+func (m *HealthCheck) GetCommand() string {
+	if m != nil && m.Command != nil {
+		return *m.Command
+	}
+	return ""
+}
+
+func (m *HealthCheck) GetArguments() []string {
+	if m != nil {
+		return m.Arguments
+	}
+	return nil
+}
+
 //
 // ApplicationSLA an application SLA describes what makes a service healthy
 // It is used to enforce how many instance of an application should be running
@@ -756,7 +1144,9 @@ type ApplicationSLA struct {
 	// The health check to use
 	HealthCheck *HealthCheck `protobuf:"bytes,3,req,name=health_check" json:"health_check,omitempty"`
 	// The amount of health checks that have to fail sequentially to be considered unhealthy
-	UnhealthyAt      *int32 `protobuf:"varint,4,req,name=unhealthy_at" json:"unhealthy_at,omitempty"`
+	UnhealthyAt *int32 `protobuf:"varint,4,req,name=unhealthy_at" json:"unhealthy_at,omitempty"`
+	// The amount of health checks that have to succeed sequentially for an unhealthy instance to be considered healthy again
+	HealthyAt        *int32 `protobuf:"varint,5,opt,name=healthy_at,def=1" json:"healthy_at,omitempty"`
 	XXX_unrecognized []byte `json:"-"`
 }
 
@@ -766,6 +1156,7 @@ func (*ApplicationSLA) ProtoMessage()    {}
 
 const Default_ApplicationSLA_MinInstances int32 = 1
 const Default_ApplicationSLA_MaxInstances int32 = 1
+const Default_ApplicationSLA_HealthyAt int32 = 1
 
 func (m *ApplicationSLA) GetMinInstances() int32 {
 	if m != nil && m.MinInstances != nil {
@@ -795,10 +1186,20 @@ func (m *ApplicationSLA) GetUnhealthyAt() int32 {
 	return 0
 }
 
+func (m *ApplicationSLA) GetHealthyAt() int32 {
+	if m != nil && m.HealthyAt != nil {
+		return *m.HealthyAt
+	}
+	return Default_ApplicationSLA_HealthyAt
+}
+
 func init() {
 	proto.RegisterEnum("protocol.AppStatus", AppStatus_name, AppStatus_value)
 	proto.RegisterEnum("protocol.ComponentType", ComponentType_name, ComponentType_value)
 	proto.RegisterEnum("protocol.Distribution", Distribution_name, Distribution_value)
+	proto.RegisterEnum("protocol.ConstraintOperator", ConstraintOperator_name, ConstraintOperator_value)
+	proto.RegisterEnum("protocol.PriorityClass", PriorityClass_name, PriorityClass_value)
+	proto.RegisterEnum("protocol.QuotaScope", QuotaScope_name, QuotaScope_value)
 	proto.RegisterEnum("protocol.HealthCheckMode", HealthCheckMode_name, HealthCheckMode_value)
 	proto.RegisterEnum("protocol.HealthCheckResultCode", HealthCheckResultCode_name, HealthCheckResultCode_value)
 }
@@ -0,0 +1,54 @@
+// Package driver provides the abstraction over the way the scheduler talks to the mesos master.
+// There is an implementation that uses the native libmesos bindings
+// and one that speaks the mesos v1 HTTP scheduler API.
+package driver
+
+import (
+	"strings"
+
+	"github.com/op/go-logging"
+	"github.com/reverb/go-mesos/mesos"
+)
+
+var log = logging.MustGetLogger("exeggutor.scheduler.driver")
+
+// SchedulerDriver is the interface the framework uses to talk to the mesos master
+type SchedulerDriver interface {
+	// Start connects to the master and starts delivering events to the event handler
+	Start() error
+	// Stop disconnects from the master, when failover is false the framework is torn down
+	Stop(failover bool) error
+	// LaunchTasks launches the tasks with the resources of the specified offer
+	LaunchTasks(offerID *mesos.OfferID, tasks []mesos.TaskInfo) error
+	// DeclineOffer declines the specified offer
+	DeclineOffer(offerID *mesos.OfferID) error
+	// KillTask kills the specified task
+	KillTask(taskID *mesos.TaskID) error
+	// ReconcileTasks asks the master to send the latest status for the specified tasks,
+	// or for all the tasks it knows about when the list is empty
+	ReconcileTasks(statuses []mesos.TaskStatus) error
+}
+
+// EventHandler receives the events a scheduler driver gets from the mesos master
+type EventHandler interface {
+	Registered(driver SchedulerDriver, fwID mesos.FrameworkID, masterInfo mesos.MasterInfo)
+	Reregistered(driver SchedulerDriver, masterInfo mesos.MasterInfo)
+	Disconnected(driver SchedulerDriver)
+	ResourceOffers(driver SchedulerDriver, offers []mesos.Offer)
+	OfferRescinded(driver SchedulerDriver, offerID mesos.OfferID)
+	StatusUpdate(driver SchedulerDriver, status mesos.TaskStatus)
+	FrameworkMessage(driver SchedulerDriver, executorID mesos.ExecutorID, slaveID mesos.SlaveID, data string)
+	SlaveLost(driver SchedulerDriver, slaveID mesos.SlaveID)
+	ExecutorLost(driver SchedulerDriver, executorID mesos.ExecutorID, slaveID mesos.SlaveID, status int)
+	Error(driver SchedulerDriver, message string)
+}
+
+// New creates the driver that fits the master uri.
+// An http(s) uri uses the v1 HTTP scheduler API, anything else (like a zk:// uri)
+// uses the native libmesos bindings.
+func New(master string, framework mesos.FrameworkInfo, handler EventHandler) (SchedulerDriver, error) {
+	if strings.HasPrefix(master, "http://") || strings.HasPrefix(master, "https://") {
+		return NewHTTP(master, framework, handler)
+	}
+	return NewNative(master, framework, handler), nil
+}
@@ -0,0 +1,434 @@
+package driver
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/reverb/go-mesos/mesos"
+)
+
+const (
+	schedulerPath    = "/api/v1/scheduler"
+	streamIDHeader   = "Mesos-Stream-Id"
+	maxResubscribe   = 30 * time.Second
+	firstResubscribe = 500 * time.Millisecond
+	// callTimeout how long a call other than subscribe can take
+	callTimeout = 10 * time.Second
+	// defaultHeartbeat the interval of the heartbeats until the master tells us its interval
+	defaultHeartbeat = 15 * time.Second
+	// missedHeartbeats the number of heartbeats that can go missing before the subscription is considered dead
+	missedHeartbeats = 3
+)
+
+// ErrNotSubscribed is returned when a call is made before the driver subscribed with the master
+var ErrNotSubscribed = errors.New("the driver isn't subscribed with the mesos master")
+
+// httpDriver is a scheduler driver that talks to the mesos master through the v1 HTTP scheduler API.
+// It keeps a subscription open, decodes the recordio encoded event stream and
+// dispatches the events to the event handler. A subscription that stays silent for a few
+// heartbeat intervals is closed, so the driver subscribes again instead of waiting on a dead connection.
+type httpDriver struct {
+	endpoint     string
+	framework    mesos.FrameworkInfo
+	handler      EventHandler
+	client       *http.Client
+	streamClient *http.Client
+	heartbeat    time.Duration
+	lastEvent    time.Time
+	lock         *sync.Mutex
+	streamID     string
+	frameworkID  *mesos.FrameworkID
+	registered   bool
+	stream       io.ReadCloser
+	closing      chan struct{}
+	done         chan struct{}
+}
+
+// NewHTTP creates a new scheduler driver that uses the mesos v1 HTTP scheduler API
+// of the master at the specified url, for example http://localhost:5050
+func NewHTTP(master string, framework mesos.FrameworkInfo, handler EventHandler) (SchedulerDriver, error) {
+	if !strings.HasPrefix(master, "http://") && !strings.HasPrefix(master, "https://") {
+		return nil, fmt.Errorf("%s is not a http url for a mesos master", master)
+	}
+	return &httpDriver{
+		endpoint:     strings.TrimRight(master, "/") + schedulerPath,
+		framework:    framework,
+		handler:      handler,
+		client:       &http.Client{Timeout: callTimeout},
+		streamClient: &http.Client{},
+		heartbeat:    defaultHeartbeat,
+		lock:         &sync.Mutex{},
+		frameworkID:  framework.Id,
+	}, nil
+}
+
+// Start subscribes with the master, the subscription is retried until the driver is stopped
+func (d *httpDriver) Start() error {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if d.closing != nil {
+		return errors.New("the driver is already started")
+	}
+	d.closing = make(chan struct{})
+	d.done = make(chan struct{})
+	go d.subscribeLoop()
+	return nil
+}
+
+// Stop closes the subscription, when failover is false the framework is torn down
+func (d *httpDriver) Stop(failover bool) error {
+	var err error
+	if !failover {
+		if err = d.call(&v1Call{Type: "TEARDOWN"}); err == ErrNotSubscribed {
+			err = nil
+		}
+	}
+
+	d.lock.Lock()
+	if d.closing == nil {
+		d.lock.Unlock()
+		return err
+	}
+	close(d.closing)
+	done, stream := d.done, d.stream
+	d.closing = nil
+	d.lock.Unlock()
+
+	if stream != nil {
+		stream.Close()
+	}
+	<-done
+	return err
+}
+
+// LaunchTasks accepts the offer with a launch operation for the tasks
+func (d *httpDriver) LaunchTasks(offerID *mesos.OfferID, tasks []mesos.TaskInfo) error {
+	var infos []v1TaskInfo
+	for _, task := range tasks {
+		infos = append(infos, toV1TaskInfo(task))
+	}
+	return d.call(&v1Call{
+		Type: "ACCEPT",
+		Accept: &v1Accept{
+			OfferIDs:   []v1ID{toV1ID(offerID.GetValue())},
+			Operations: []v1Operation{{Type: "LAUNCH", Launch: &v1Launch{TaskInfos: infos}}},
+		},
+	})
+}
+
+// DeclineOffer declines the specified offer
+func (d *httpDriver) DeclineOffer(offerID *mesos.OfferID) error {
+	return d.call(&v1Call{
+		Type:    "DECLINE",
+		Decline: &v1Decline{OfferIDs: []v1ID{toV1ID(offerID.GetValue())}},
+	})
+}
+
+// KillTask kills the specified task
+func (d *httpDriver) KillTask(taskID *mesos.TaskID) error {
+	return d.call(&v1Call{
+		Type: "KILL",
+		Kill: &v1Kill{TaskID: toV1ID(taskID.GetValue())},
+	})
+}
+
+// ReconcileTasks asks the master to send the latest status of the specified tasks
+func (d *httpDriver) ReconcileTasks(statuses []mesos.TaskStatus) error {
+	tasks := []v1ReconcileTask{}
+	for _, status := range statuses {
+		task := v1ReconcileTask{TaskID: toV1ID(status.GetTaskId().GetValue())}
+		if status.SlaveId != nil {
+			agentID := toV1ID(status.GetSlaveId().GetValue())
+			task.AgentID = &agentID
+		}
+		tasks = append(tasks, task)
+	}
+	return d.call(&v1Call{
+		Type:      "RECONCILE",
+		Reconcile: &v1Reconcile{Tasks: tasks},
+	})
+}
+
+func (d *httpDriver) acknowledge(status *v1TaskStatus) error {
+	if status.UUID == "" || status.AgentID == nil {
+		return nil
+	}
+	return d.call(&v1Call{
+		Type: "ACKNOWLEDGE",
+		Acknowledge: &v1Acknowledge{
+			AgentID: *status.AgentID,
+			TaskID:  status.TaskID,
+			UUID:    status.UUID,
+		},
+	})
+}
+
+// call sends a call to the master, every call but subscribe is answered with 202 Accepted
+func (d *httpDriver) call(call *v1Call) error {
+	d.lock.Lock()
+	streamID, frameworkID := d.streamID, d.frameworkID
+	d.lock.Unlock()
+
+	if streamID == "" || frameworkID == nil {
+		return ErrNotSubscribed
+	}
+	id := toV1ID(frameworkID.GetValue())
+	call.FrameworkID = &id
+
+	resp, err := d.post(d.client, call, streamID)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusAccepted {
+		body, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("the mesos master refused the %s call with %s: %s", call.Type, resp.Status, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
+
+func (d *httpDriver) post(client *http.Client, call *v1Call, streamID string) (*http.Response, error) {
+	body, err := json.Marshal(call)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest("POST", d.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	if streamID != "" {
+		req.Header.Set(streamIDHeader, streamID)
+	}
+	return client.Do(req)
+}
+
+func (d *httpDriver) isClosing(closing chan struct{}) bool {
+	select {
+	case <-closing:
+		return true
+	default:
+		return false
+	}
+}
+
+func (d *httpDriver) subscribeLoop() {
+	d.lock.Lock()
+	closing, done := d.closing, d.done
+	d.lock.Unlock()
+	defer close(done)
+
+	backoff := firstResubscribe
+	for {
+		connected, err := d.subscribe(closing)
+		if d.isClosing(closing) {
+			return
+		}
+		if connected {
+			backoff = firstResubscribe
+			d.handler.Disconnected(d)
+		}
+		if err != nil {
+			log.Warning("The subscription with the mesos master at %s failed, because %v", d.endpoint, err)
+		}
+
+		select {
+		case <-closing:
+			return
+		case <-time.After(backoff):
+		}
+		if backoff *= 2; backoff > maxResubscribe {
+			backoff = maxResubscribe
+		}
+	}
+}
+
+// subscribe sends the subscribe call and dispatches the events from the stream until it ends.
+// The returned boolean indicates if the master accepted the subscription.
+func (d *httpDriver) subscribe(closing chan struct{}) (bool, error) {
+	d.lock.Lock()
+	info := toV1FrameworkInfo(d.framework)
+	if d.frameworkID != nil {
+		id := toV1ID(d.frameworkID.GetValue())
+		info.ID = &id
+	}
+	d.lock.Unlock()
+
+	call := &v1Call{Type: "SUBSCRIBE", FrameworkID: info.ID, Subscribe: &v1Subscribe{FrameworkInfo: info}}
+	// the subscription stays open, the heartbeats decide when it's dead instead of a timeout
+	resp, err := d.post(d.streamClient, call, "")
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(resp.Body)
+		return false, fmt.Errorf("subscribe was refused with %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+
+	d.lock.Lock()
+	if d.isClosing(closing) {
+		d.lock.Unlock()
+		return false, nil
+	}
+	d.streamID = resp.Header.Get(streamIDHeader)
+	d.stream = resp.Body
+	d.lastEvent = time.Now()
+	d.lock.Unlock()
+
+	ended := make(chan struct{})
+	defer func() {
+		close(ended)
+		d.lock.Lock()
+		d.streamID = ""
+		d.stream = nil
+		d.lock.Unlock()
+	}()
+	go d.watchHeartbeats(resp.Body, ended)
+
+	reader := bufio.NewReader(resp.Body)
+	for {
+		record, err := readRecord(reader)
+		if err != nil {
+			if err == io.EOF || d.isClosing(closing) {
+				return true, nil
+			}
+			return true, err
+		}
+		d.lock.Lock()
+		d.lastEvent = time.Now()
+		d.lock.Unlock()
+		var event v1Event
+		if err := json.Unmarshal(record, &event); err != nil {
+			log.Warning("Couldn't decode an event from the mesos master, because %v", err)
+			continue
+		}
+		d.dispatch(&event)
+	}
+}
+
+// watchHeartbeats closes the stream when the master didn't send an event or a heartbeat
+// for a few heartbeat intervals, it stops when the subscription ends
+func (d *httpDriver) watchHeartbeats(stream io.Closer, ended chan struct{}) {
+	for {
+		d.lock.Lock()
+		interval := d.heartbeat
+		d.lock.Unlock()
+
+		select {
+		case <-ended:
+			return
+		case <-time.After(interval):
+		}
+
+		d.lock.Lock()
+		silence := time.Since(d.lastEvent)
+		d.lock.Unlock()
+		if silence > missedHeartbeats*interval {
+			log.Warning("The mesos master at %s didn't send a heartbeat for %v, subscribing again", d.endpoint, silence)
+			stream.Close()
+			return
+		}
+	}
+}
+
+// readRecord reads a single record of a recordio stream, a record is
+// the length of the data in bytes followed by a newline and the data
+func readRecord(reader *bufio.Reader) ([]byte, error) {
+	header, err := reader.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	size, err := strconv.ParseUint(strings.TrimSpace(header), 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid recordio header %q", header)
+	}
+	record := make([]byte, size)
+	if _, err := io.ReadFull(reader, record); err != nil {
+		return nil, err
+	}
+	return record, nil
+}
+
+func (d *httpDriver) dispatch(event *v1Event) {
+	switch event.Type {
+	case "SUBSCRIBED":
+		if event.Subscribed == nil {
+			return
+		}
+		fwID := event.Subscribed.FrameworkID.frameworkID()
+		masterInfo := event.Subscribed.MasterInfo.toProto()
+		d.lock.Lock()
+		d.frameworkID = fwID
+		if seconds := event.Subscribed.HeartbeatIntervalSeconds; seconds > 0 {
+			d.heartbeat = time.Duration(seconds * float64(time.Second))
+		}
+		reregistered := d.registered
+		d.registered = true
+		d.lock.Unlock()
+		if reregistered {
+			d.handler.Reregistered(d, masterInfo)
+		} else {
+			d.handler.Registered(d, *fwID, masterInfo)
+		}
+	case "OFFERS":
+		if event.Offers == nil {
+			return
+		}
+		var offers []mesos.Offer
+		for i := range event.Offers.Offers {
+			offers = append(offers, event.Offers.Offers[i].toProto())
+		}
+		d.handler.ResourceOffers(d, offers)
+	case "RESCIND":
+		if event.Rescind != nil {
+			d.handler.OfferRescinded(d, *event.Rescind.OfferID.offerID())
+		}
+	case "UPDATE":
+		if event.Update == nil {
+			return
+		}
+		d.handler.StatusUpdate(d, event.Update.Status.toProto())
+		if err := d.acknowledge(&event.Update.Status); err != nil {
+			log.Warning("Couldn't acknowledge the status update for %s, because %v", event.Update.Status.TaskID.Value, err)
+		}
+	case "MESSAGE":
+		if event.Message != nil {
+			m := event.Message
+			d.handler.FrameworkMessage(d, *m.ExecutorID.executorID(), *m.AgentID.slaveID(), m.Data)
+		}
+	case "FAILURE":
+		if event.Failure == nil || event.Failure.AgentID == nil {
+			return
+		}
+		f := event.Failure
+		if f.ExecutorID != nil {
+			status := 0
+			if f.Status != nil {
+				status = *f.Status
+			}
+			d.handler.ExecutorLost(d, *f.ExecutorID.executorID(), *f.AgentID.slaveID(), status)
+		} else {
+			d.handler.SlaveLost(d, *f.AgentID.slaveID())
+		}
+	case "ERROR":
+		if event.Error != nil {
+			d.handler.Error(d, event.Error.Message)
+		}
+	case "HEARTBEAT":
+		// every event counts as a sign of life, the heartbeats only keep the subscription alive
+	default:
+		log.Debug("Ignoring the unknown event %s from the mesos master", event.Type)
+	}
+}
@@ -0,0 +1,478 @@
+package driver
+
+import (
+	"strconv"
+	"strings"
+
+	"code.google.com/p/goprotobuf/proto"
+	"github.com/reverb/go-mesos/mesos"
+)
+
+// The types in this file are the json representations of the messages in the
+// mesos v1 scheduler API (mesos/v1/scheduler/scheduler.proto).
+// Enums are serialized as their names, bytes as base64 and a slave is called an agent.
+
+type v1ID struct {
+	Value string `json:"value"`
+}
+
+type v1Scalar struct {
+	Value float64 `json:"value"`
+}
+
+type v1Range struct {
+	Begin uint64 `json:"begin"`
+	End   uint64 `json:"end"`
+}
+
+type v1Ranges struct {
+	Range []v1Range `json:"range"`
+}
+
+type v1Set struct {
+	Item []string `json:"item"`
+}
+
+type v1Text struct {
+	Value string `json:"value"`
+}
+
+type v1Resource struct {
+	Name   string    `json:"name"`
+	Type   string    `json:"type"`
+	Scalar *v1Scalar `json:"scalar,omitempty"`
+	Ranges *v1Ranges `json:"ranges,omitempty"`
+	Set    *v1Set    `json:"set,omitempty"`
+	Role   string    `json:"role,omitempty"`
+}
+
+type v1Attribute struct {
+	Name   string    `json:"name"`
+	Type   string    `json:"type"`
+	Scalar *v1Scalar `json:"scalar,omitempty"`
+	Ranges *v1Ranges `json:"ranges,omitempty"`
+	Set    *v1Set    `json:"set,omitempty"`
+	Text   *v1Text   `json:"text,omitempty"`
+}
+
+type v1Offer struct {
+	ID          v1ID          `json:"id"`
+	FrameworkID v1ID          `json:"framework_id"`
+	AgentID     v1ID          `json:"agent_id"`
+	Hostname    string        `json:"hostname"`
+	Resources   []v1Resource  `json:"resources,omitempty"`
+	Attributes  []v1Attribute `json:"attributes,omitempty"`
+}
+
+type v1TaskStatus struct {
+	TaskID     v1ID   `json:"task_id"`
+	State      string `json:"state"`
+	Message    string `json:"message,omitempty"`
+	AgentID    *v1ID  `json:"agent_id,omitempty"`
+	ExecutorID *v1ID  `json:"executor_id,omitempty"`
+	UUID       string `json:"uuid,omitempty"`
+	Healthy    *bool  `json:"healthy,omitempty"`
+}
+
+type v1MasterInfo struct {
+	ID       string `json:"id"`
+	IP       uint32 `json:"ip"`
+	Port     uint32 `json:"port"`
+	Hostname string `json:"hostname,omitempty"`
+}
+
+type v1FrameworkInfo struct {
+	User            string  `json:"user"`
+	Name            string  `json:"name"`
+	ID              *v1ID   `json:"id,omitempty"`
+	FailoverTimeout float64 `json:"failover_timeout,omitempty"`
+	Hostname        string  `json:"hostname,omitempty"`
+}
+
+type v1Variable struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type v1Environment struct {
+	Variables []v1Variable `json:"variables"`
+}
+
+type v1URI struct {
+	Value      string `json:"value"`
+	Executable *bool  `json:"executable,omitempty"`
+}
+
+type v1CommandInfo struct {
+	Value       string         `json:"value,omitempty"`
+	User        string         `json:"user,omitempty"`
+	Environment *v1Environment `json:"environment,omitempty"`
+	URIs        []v1URI        `json:"uris,omitempty"`
+}
+
+type v1PortMapping struct {
+	HostPort      uint32 `json:"host_port"`
+	ContainerPort uint32 `json:"container_port"`
+	Protocol      string `json:"protocol,omitempty"`
+}
+
+type v1DockerInfo struct {
+	Image        string          `json:"image"`
+	Network      string          `json:"network,omitempty"`
+	PortMappings []v1PortMapping `json:"port_mappings,omitempty"`
+}
+
+type v1ContainerInfo struct {
+	Type   string        `json:"type"`
+	Docker *v1DockerInfo `json:"docker,omitempty"`
+}
+
+type v1TaskInfo struct {
+	Name      string           `json:"name"`
+	TaskID    v1ID             `json:"task_id"`
+	AgentID   v1ID             `json:"agent_id"`
+	Resources []v1Resource     `json:"resources,omitempty"`
+	Command   *v1CommandInfo   `json:"command,omitempty"`
+	Container *v1ContainerInfo `json:"container,omitempty"`
+}
+
+// events
+
+type v1Subscribed struct {
+	FrameworkID              v1ID          `json:"framework_id"`
+	HeartbeatIntervalSeconds float64       `json:"heartbeat_interval_seconds,omitempty"`
+	MasterInfo               *v1MasterInfo `json:"master_info,omitempty"`
+}
+
+type v1Offers struct {
+	Offers []v1Offer `json:"offers"`
+}
+
+type v1Rescind struct {
+	OfferID v1ID `json:"offer_id"`
+}
+
+type v1Update struct {
+	Status v1TaskStatus `json:"status"`
+}
+
+type v1Message struct {
+	AgentID    v1ID   `json:"agent_id"`
+	ExecutorID v1ID   `json:"executor_id"`
+	Data       string `json:"data"`
+}
+
+type v1Failure struct {
+	AgentID    *v1ID `json:"agent_id,omitempty"`
+	ExecutorID *v1ID `json:"executor_id,omitempty"`
+	Status     *int  `json:"status,omitempty"`
+}
+
+type v1Error struct {
+	Message string `json:"message"`
+}
+
+type v1Event struct {
+	Type       string        `json:"type"`
+	Subscribed *v1Subscribed `json:"subscribed,omitempty"`
+	Offers     *v1Offers     `json:"offers,omitempty"`
+	Rescind    *v1Rescind    `json:"rescind,omitempty"`
+	Update     *v1Update     `json:"update,omitempty"`
+	Message    *v1Message    `json:"message,omitempty"`
+	Failure    *v1Failure    `json:"failure,omitempty"`
+	Error      *v1Error      `json:"error,omitempty"`
+}
+
+// calls
+
+type v1Subscribe struct {
+	FrameworkInfo v1FrameworkInfo `json:"framework_info"`
+}
+
+type v1Filters struct {
+	RefuseSeconds float64 `json:"refuse_seconds,omitempty"`
+}
+
+type v1Launch struct {
+	TaskInfos []v1TaskInfo `json:"task_infos"`
+}
+
+type v1Operation struct {
+	Type   string    `json:"type"`
+	Launch *v1Launch `json:"launch,omitempty"`
+}
+
+type v1Accept struct {
+	OfferIDs   []v1ID        `json:"offer_ids"`
+	Operations []v1Operation `json:"operations"`
+	Filters    *v1Filters    `json:"filters,omitempty"`
+}
+
+type v1Decline struct {
+	OfferIDs []v1ID     `json:"offer_ids"`
+	Filters  *v1Filters `json:"filters,omitempty"`
+}
+
+type v1Kill struct {
+	TaskID  v1ID  `json:"task_id"`
+	AgentID *v1ID `json:"agent_id,omitempty"`
+}
+
+type v1ReconcileTask struct {
+	TaskID  v1ID  `json:"task_id"`
+	AgentID *v1ID `json:"agent_id,omitempty"`
+}
+
+type v1Reconcile struct {
+	Tasks []v1ReconcileTask `json:"tasks"`
+}
+
+type v1Acknowledge struct {
+	AgentID v1ID   `json:"agent_id"`
+	TaskID  v1ID   `json:"task_id"`
+	UUID    string `json:"uuid"`
+}
+
+type v1Call struct {
+	FrameworkID *v1ID          `json:"framework_id,omitempty"`
+	Type        string         `json:"type"`
+	Subscribe   *v1Subscribe   `json:"subscribe,omitempty"`
+	Accept      *v1Accept      `json:"accept,omitempty"`
+	Decline     *v1Decline     `json:"decline,omitempty"`
+	Kill        *v1Kill        `json:"kill,omitempty"`
+	Reconcile   *v1Reconcile   `json:"reconcile,omitempty"`
+	Acknowledge *v1Acknowledge `json:"acknowledge,omitempty"`
+}
+
+// conversions from the v1 messages to the mesos protobuf messages
+
+func (v *v1ID) offerID() *mesos.OfferID {
+	return &mesos.OfferID{Value: proto.String(v.Value)}
+}
+
+func (v *v1ID) frameworkID() *mesos.FrameworkID {
+	return &mesos.FrameworkID{Value: proto.String(v.Value)}
+}
+
+func (v *v1ID) slaveID() *mesos.SlaveID {
+	if v == nil {
+		return nil
+	}
+	return &mesos.SlaveID{Value: proto.String(v.Value)}
+}
+
+func (v *v1ID) executorID() *mesos.ExecutorID {
+	if v == nil {
+		return nil
+	}
+	return &mesos.ExecutorID{Value: proto.String(v.Value)}
+}
+
+func (v *v1ID) taskID() *mesos.TaskID {
+	return &mesos.TaskID{Value: proto.String(v.Value)}
+}
+
+func valueType(name string) *mesos.Value_Type {
+	return mesos.Value_Type(mesos.Value_Type_value[name]).Enum()
+}
+
+func (s *v1Scalar) toProto() *mesos.Value_Scalar {
+	if s == nil {
+		return nil
+	}
+	return &mesos.Value_Scalar{Value: proto.Float64(s.Value)}
+}
+
+func (r *v1Ranges) toProto() *mesos.Value_Ranges {
+	if r == nil {
+		return nil
+	}
+	var ranges []*mesos.Value_Range
+	for _, rng := range r.Range {
+		ranges = append(ranges, &mesos.Value_Range{Begin: proto.Uint64(rng.Begin), End: proto.Uint64(rng.End)})
+	}
+	return &mesos.Value_Ranges{Range: ranges}
+}
+
+func (s *v1Set) toProto() *mesos.Value_Set {
+	if s == nil {
+		return nil
+	}
+	return &mesos.Value_Set{Item: s.Item}
+}
+
+func (t *v1Text) toProto() *mesos.Value_Text {
+	if t == nil {
+		return nil
+	}
+	return &mesos.Value_Text{Value: proto.String(t.Value)}
+}
+
+func (o *v1Offer) toProto() mesos.Offer {
+	offer := mesos.Offer{
+		Id:          o.ID.offerID(),
+		FrameworkId: o.FrameworkID.frameworkID(),
+		SlaveId:     o.AgentID.slaveID(),
+		Hostname:    proto.String(o.Hostname),
+	}
+	for _, r := range o.Resources {
+		resource := &mesos.Resource{
+			Name:   proto.String(r.Name),
+			Type:   valueType(r.Type),
+			Scalar: r.Scalar.toProto(),
+			Ranges: r.Ranges.toProto(),
+			Set:    r.Set.toProto(),
+		}
+		if r.Role != "" {
+			resource.Role = proto.String(r.Role)
+		}
+		offer.Resources = append(offer.Resources, resource)
+	}
+	for _, a := range o.Attributes {
+		offer.Attributes = append(offer.Attributes, &mesos.Attribute{
+			Name:   proto.String(a.Name),
+			Type:   valueType(a.Type),
+			Scalar: a.Scalar.toProto(),
+			Ranges: a.Ranges.toProto(),
+			Set:    a.Set.toProto(),
+			Text:   a.Text.toProto(),
+		})
+	}
+	return offer
+}
+
+func (s *v1TaskStatus) toProto() mesos.TaskStatus {
+	status := mesos.TaskStatus{
+		TaskId:     s.TaskID.taskID(),
+		State:      mesos.TaskState(mesos.TaskState_value[s.State]).Enum(),
+		SlaveId:    s.AgentID.slaveID(),
+		ExecutorId: s.ExecutorID.executorID(),
+	}
+	if s.Message != "" {
+		status.Message = proto.String(s.Message)
+	}
+	return status
+}
+
+func (m *v1MasterInfo) toProto() mesos.MasterInfo {
+	if m == nil {
+		return mesos.MasterInfo{}
+	}
+	info := mesos.MasterInfo{
+		Id:   proto.String(m.ID),
+		Ip:   proto.Uint32(m.IP),
+		Port: proto.Uint32(m.Port),
+	}
+	if m.Hostname != "" {
+		info.Hostname = proto.String(m.Hostname)
+	}
+	return info
+}
+
+// conversions from the mesos protobuf messages to the v1 messages
+
+func toV1ID(value string) v1ID {
+	return v1ID{Value: value}
+}
+
+func toV1Resources(resources []*mesos.Resource) []v1Resource {
+	var result []v1Resource
+	for _, r := range resources {
+		res := v1Resource{Name: r.GetName(), Type: r.GetType().String(), Role: r.GetRole()}
+		if r.Scalar != nil {
+			res.Scalar = &v1Scalar{Value: r.GetScalar().GetValue()}
+		}
+		if r.Ranges != nil {
+			res.Ranges = &v1Ranges{}
+			for _, rng := range r.GetRanges().GetRange() {
+				res.Ranges.Range = append(res.Ranges.Range, v1Range{Begin: rng.GetBegin(), End: rng.GetEnd()})
+			}
+		}
+		if r.Set != nil {
+			res.Set = &v1Set{Item: r.GetSet().GetItem()}
+		}
+		result = append(result, res)
+	}
+	return result
+}
+
+func toV1FrameworkInfo(info mesos.FrameworkInfo) v1FrameworkInfo {
+	fw := v1FrameworkInfo{
+		User:            info.GetUser(),
+		Name:            info.GetName(),
+		FailoverTimeout: info.GetFailoverTimeout(),
+		Hostname:        info.GetHostname(),
+	}
+	if info.Id != nil {
+		id := toV1ID(info.GetId().GetValue())
+		fw.ID = &id
+	}
+	return fw
+}
+
+func toV1Command(command *mesos.CommandInfo) *v1CommandInfo {
+	if command == nil {
+		return nil
+	}
+	result := &v1CommandInfo{Value: command.GetValue(), User: command.GetUser()}
+	if command.Environment != nil {
+		result.Environment = &v1Environment{}
+		for _, v := range command.GetEnvironment().GetVariables() {
+			result.Environment.Variables = append(result.Environment.Variables, v1Variable{Name: v.GetName(), Value: v.GetValue()})
+		}
+	}
+	for _, uri := range command.GetUris() {
+		result.URIs = append(result.URIs, v1URI{Value: uri.GetValue(), Executable: uri.Executable})
+	}
+	return result
+}
+
+// toV1Container translates the docker:/// image and the -p host:container options
+// the task builder puts on the command into a v1 docker container
+func toV1Container(command *mesos.CommandInfo) *v1ContainerInfo {
+	if command == nil || command.Container == nil {
+		return nil
+	}
+	container := command.GetContainer()
+	docker := &v1DockerInfo{Image: strings.TrimPrefix(container.GetImage(), "docker:///")}
+
+	options := container.GetOptions()
+	for i := 0; i < len(options)-1; i++ {
+		if options[i] != "-p" {
+			continue
+		}
+		parts := strings.SplitN(options[i+1], ":", 2)
+		i++
+		if len(parts) != 2 {
+			continue
+		}
+		host, err := strconv.ParseUint(parts[0], 10, 32)
+		if err != nil {
+			continue
+		}
+		cont, err := strconv.ParseUint(parts[1], 10, 32)
+		if err != nil {
+			continue
+		}
+		docker.PortMappings = append(docker.PortMappings, v1PortMapping{
+			HostPort:      uint32(host),
+			ContainerPort: uint32(cont),
+			Protocol:      "tcp",
+		})
+	}
+	if len(docker.PortMappings) > 0 {
+		docker.Network = "BRIDGE"
+	}
+	return &v1ContainerInfo{Type: "DOCKER", Docker: docker}
+}
+
+func toV1TaskInfo(task mesos.TaskInfo) v1TaskInfo {
+	return v1TaskInfo{
+		Name:      task.GetName(),
+		TaskID:    toV1ID(task.GetTaskId().GetValue()),
+		AgentID:   toV1ID(task.GetSlaveId().GetValue()),
+		Resources: toV1Resources(task.GetResources()),
+		Command:   toV1Command(task.GetCommand()),
+		Container: toV1Container(task.GetCommand()),
+	}
+}
@@ -0,0 +1,281 @@
+package driver
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"code.google.com/p/goprotobuf/proto"
+	"github.com/reverb/go-mesos/mesos"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+type receivedCall struct {
+	call     v1Call
+	streamID string
+}
+
+// fakeMaster is a stand-in for the scheduler endpoint of a mesos master,
+// it sends the events to a subscriber and records all the other calls.
+type fakeMaster struct {
+	events     []v1Event
+	calls      chan receivedCall
+	release    chan struct{}
+	subscribes chan struct{}
+}
+
+func (m *fakeMaster) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
+	var call v1Call
+	if err := json.NewDecoder(r.Body).Decode(&call); err != nil {
+		rw.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if call.Type != "SUBSCRIBE" {
+		m.calls <- receivedCall{call: call, streamID: r.Header.Get(streamIDHeader)}
+		rw.WriteHeader(http.StatusAccepted)
+		return
+	}
+
+	if m.subscribes != nil {
+		m.subscribes <- struct{}{}
+	}
+	rw.Header().Set(streamIDHeader, "stream-1")
+	rw.WriteHeader(http.StatusOK)
+	for _, event := range m.events {
+		data, _ := json.Marshal(event)
+		fmt.Fprintf(rw, "%d\n%s", len(data), data)
+		rw.(http.Flusher).Flush()
+	}
+	select {
+	case <-m.release:
+	case <-rw.(http.CloseNotifier).CloseNotify():
+	}
+}
+
+type recordingHandler struct {
+	registered chan mesos.FrameworkID
+	offers     chan []mesos.Offer
+	updates    chan mesos.TaskStatus
+	lost       chan mesos.SlaveID
+}
+
+func newRecordingHandler() *recordingHandler {
+	return &recordingHandler{
+		registered: make(chan mesos.FrameworkID, 1),
+		offers:     make(chan []mesos.Offer, 1),
+		updates:    make(chan mesos.TaskStatus, 1),
+		lost:       make(chan mesos.SlaveID, 1),
+	}
+}
+
+func (h *recordingHandler) Registered(driver SchedulerDriver, fwID mesos.FrameworkID, masterInfo mesos.MasterInfo) {
+	h.registered <- fwID
+}
+func (h *recordingHandler) Reregistered(driver SchedulerDriver, masterInfo mesos.MasterInfo) {}
+func (h *recordingHandler) Disconnected(driver SchedulerDriver)                              {}
+func (h *recordingHandler) ResourceOffers(driver SchedulerDriver, offers []mesos.Offer) {
+	for _, offer := range offers {
+		driver.DeclineOffer(offer.GetId())
+	}
+	h.offers <- offers
+}
+func (h *recordingHandler) OfferRescinded(driver SchedulerDriver, offerID mesos.OfferID) {}
+func (h *recordingHandler) StatusUpdate(driver SchedulerDriver, status mesos.TaskStatus) {
+	h.updates <- status
+}
+func (h *recordingHandler) FrameworkMessage(driver SchedulerDriver, executorID mesos.ExecutorID, slaveID mesos.SlaveID, data string) {
+}
+func (h *recordingHandler) SlaveLost(driver SchedulerDriver, slaveID mesos.SlaveID) {
+	h.lost <- slaveID
+}
+func (h *recordingHandler) ExecutorLost(driver SchedulerDriver, executorID mesos.ExecutorID, slaveID mesos.SlaveID, status int) {
+}
+func (h *recordingHandler) Error(driver SchedulerDriver, message string) {}
+
+func nextCall(calls chan receivedCall) receivedCall {
+	select {
+	case call := <-calls:
+		return call
+	case <-time.After(2 * time.Second):
+		return receivedCall{}
+	}
+}
+
+func TestHTTPDriver(t *testing.T) {
+	agentID := v1ID{Value: "agent-1"}
+	master := &fakeMaster{
+		calls:   make(chan receivedCall, 10),
+		release: make(chan struct{}),
+		events: []v1Event{
+			{Type: "SUBSCRIBED", Subscribed: &v1Subscribed{FrameworkID: v1ID{Value: "fw-1"}}},
+			{Type: "HEARTBEAT"},
+			{Type: "OFFERS", Offers: &v1Offers{Offers: []v1Offer{{
+				ID:          v1ID{Value: "offer-1"},
+				FrameworkID: v1ID{Value: "fw-1"},
+				AgentID:     agentID,
+				Hostname:    "slave1.local",
+				Resources: []v1Resource{
+					{Name: "cpus", Type: "SCALAR", Scalar: &v1Scalar{Value: 2}},
+					{Name: "ports", Type: "RANGES", Ranges: &v1Ranges{Range: []v1Range{{Begin: 8000, End: 9000}}}},
+				},
+				Attributes: []v1Attribute{{Name: "rack", Type: "TEXT", Text: &v1Text{Value: "r1"}}},
+			}}}},
+			{Type: "UPDATE", Update: &v1Update{Status: v1TaskStatus{
+				TaskID:  v1ID{Value: "task-1"},
+				State:   "TASK_RUNNING",
+				AgentID: &agentID,
+				UUID:    "dXVpZA==",
+			}}},
+			{Type: "FAILURE", Failure: &v1Failure{AgentID: &agentID}},
+		},
+	}
+	server := httptest.NewServer(master)
+	defer server.Close()
+
+	silentMaster := &fakeMaster{
+		calls:      make(chan receivedCall, 10),
+		release:    make(chan struct{}),
+		subscribes: make(chan struct{}, 10),
+		events: []v1Event{
+			{Type: "SUBSCRIBED", Subscribed: &v1Subscribed{FrameworkID: v1ID{Value: "fw-1"}, HeartbeatIntervalSeconds: 0.05}},
+		},
+	}
+	silentServer := httptest.NewServer(silentMaster)
+	defer silentServer.Close()
+
+	Convey("A HTTP scheduler driver", t, func() {
+
+		Convey("should refuse a master uri that isn't a http url", func() {
+			_, err := NewHTTP("zk://localhost:2181/mesos", mesos.FrameworkInfo{}, newRecordingHandler())
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("should not send calls before it's subscribed", func() {
+			d, _ := NewHTTP(server.URL, mesos.FrameworkInfo{}, newRecordingHandler())
+			err := d.KillTask(&mesos.TaskID{Value: proto.String("task-1")})
+			So(err, ShouldEqual, ErrNotSubscribed)
+		})
+
+		Convey("should subscribe again when the master misses its heartbeats", func() {
+			d, _ := NewHTTP(silentServer.URL, mesos.FrameworkInfo{}, newRecordingHandler())
+			So(d.Start(), ShouldBeNil)
+
+			subscribed := 0
+			timeout := time.After(3 * time.Second)
+		wait:
+			for subscribed < 2 {
+				select {
+				case <-silentMaster.subscribes:
+					subscribed++
+				case <-timeout:
+					break wait
+				}
+			}
+			So(subscribed, ShouldEqual, 2)
+
+			So(d.Stop(false), ShouldBeNil)
+		})
+
+		Convey("when subscribed with a master", func() {
+			handler := newRecordingHandler()
+			info := mesos.FrameworkInfo{User: proto.String("root"), Name: proto.String("exeggutor")}
+			d, err := NewHTTP(server.URL, info, handler)
+			So(err, ShouldBeNil)
+			So(d.Start(), ShouldBeNil)
+
+			var fwID mesos.FrameworkID
+			select {
+			case fwID = <-handler.registered:
+			case <-time.After(2 * time.Second):
+			}
+			So(fwID.GetValue(), ShouldEqual, "fw-1")
+
+			Convey("it should dispatch the events and send the calls", func() {
+				var offers []mesos.Offer
+				select {
+				case offers = <-handler.offers:
+				case <-time.After(2 * time.Second):
+				}
+				So(offers, ShouldHaveLength, 1)
+				offer := offers[0]
+				So(offer.GetId().GetValue(), ShouldEqual, "offer-1")
+				So(offer.GetSlaveId().GetValue(), ShouldEqual, "agent-1")
+				So(offer.GetHostname(), ShouldEqual, "slave1.local")
+				So(offer.GetResources()[0].GetScalar().GetValue(), ShouldEqual, 2)
+				So(offer.GetResources()[1].GetRanges().GetRange()[0].GetEnd(), ShouldEqual, 9000)
+				So(offer.GetAttributes()[0].GetText().GetValue(), ShouldEqual, "r1")
+
+				decline := nextCall(master.calls)
+				So(decline.call.Type, ShouldEqual, "DECLINE")
+				So(decline.streamID, ShouldEqual, "stream-1")
+				So(decline.call.FrameworkID.Value, ShouldEqual, "fw-1")
+				So(decline.call.Decline.OfferIDs[0].Value, ShouldEqual, "offer-1")
+
+				var status mesos.TaskStatus
+				select {
+				case status = <-handler.updates:
+				case <-time.After(2 * time.Second):
+				}
+				So(status.GetTaskId().GetValue(), ShouldEqual, "task-1")
+				So(status.GetState(), ShouldEqual, mesos.TaskState_TASK_RUNNING)
+
+				ack := nextCall(master.calls)
+				So(ack.call.Type, ShouldEqual, "ACKNOWLEDGE")
+				So(ack.call.Acknowledge.UUID, ShouldEqual, "dXVpZA==")
+				So(ack.call.Acknowledge.TaskID.Value, ShouldEqual, "task-1")
+
+				var lost mesos.SlaveID
+				select {
+				case lost = <-handler.lost:
+				case <-time.After(2 * time.Second):
+				}
+				So(lost.GetValue(), ShouldEqual, "agent-1")
+
+				So(d.ReconcileTasks(nil), ShouldBeNil)
+				reconcile := nextCall(master.calls)
+				So(reconcile.call.Type, ShouldEqual, "RECONCILE")
+				So(reconcile.call.Reconcile.Tasks, ShouldBeEmpty)
+
+				So(d.KillTask(&mesos.TaskID{Value: proto.String("task-1")}), ShouldBeNil)
+				kill := nextCall(master.calls)
+				So(kill.call.Type, ShouldEqual, "KILL")
+				So(kill.call.Kill.TaskID.Value, ShouldEqual, "task-1")
+
+				task := mesos.TaskInfo{
+					Name:    proto.String("app-1"),
+					TaskId:  &mesos.TaskID{Value: proto.String("task-2")},
+					SlaveId: &mesos.SlaveID{Value: proto.String("agent-1")},
+					Resources: []*mesos.Resource{
+						mesos.ScalarResource("cpus", 1),
+					},
+					Command: &mesos.CommandInfo{
+						Container: &mesos.CommandInfo_ContainerInfo{
+							Image:   proto.String("docker:///reverb/app:1.0"),
+							Options: []string{"-p", "8000:8080"},
+						},
+					},
+				}
+				So(d.LaunchTasks(offer.GetId(), []mesos.TaskInfo{task}), ShouldBeNil)
+				accept := nextCall(master.calls)
+				So(accept.call.Type, ShouldEqual, "ACCEPT")
+				So(accept.call.Accept.OfferIDs[0].Value, ShouldEqual, "offer-1")
+				launched := accept.call.Accept.Operations[0].Launch.TaskInfos[0]
+				So(launched.TaskID.Value, ShouldEqual, "task-2")
+				So(launched.AgentID.Value, ShouldEqual, "agent-1")
+				So(launched.Resources[0].Type, ShouldEqual, "SCALAR")
+				So(launched.Container.Docker.Image, ShouldEqual, "reverb/app:1.0")
+				So(launched.Container.Docker.Network, ShouldEqual, "BRIDGE")
+				So(launched.Container.Docker.PortMappings[0], ShouldResemble, v1PortMapping{HostPort: 8000, ContainerPort: 8080, Protocol: "tcp"})
+			})
+
+			Reset(func() {
+				So(d.Stop(false), ShouldBeNil)
+				teardown := nextCall(master.calls)
+				So(teardown.call.Type, ShouldEqual, "TEARDOWN")
+			})
+		})
+	})
+}
@@ -0,0 +1,90 @@
+package driver
+
+import "github.com/reverb/go-mesos/mesos"
+
+// nativeDriver wraps the libmesos scheduler driver
+type nativeDriver struct {
+	driver mesos.SchedulerDriver
+}
+
+// NewNative creates a new scheduler driver that uses the native libmesos bindings
+func NewNative(master string, framework mesos.FrameworkInfo, handler EventHandler) SchedulerDriver {
+	d := &nativeDriver{}
+	d.driver = mesos.SchedulerDriver{
+		Master:    master,
+		Framework: framework,
+		Scheduler: d.scheduler(handler),
+	}
+	return d
+}
+
+func (d *nativeDriver) scheduler(handler EventHandler) *mesos.Scheduler {
+	return &mesos.Scheduler{
+		Registered: func(_ *mesos.SchedulerDriver, fwID mesos.FrameworkID, masterInfo mesos.MasterInfo) {
+			handler.Registered(d, fwID, masterInfo)
+		},
+		Reregistered: func(_ *mesos.SchedulerDriver, masterInfo mesos.MasterInfo) {
+			handler.Reregistered(d, masterInfo)
+		},
+		Disconnected: func(_ *mesos.SchedulerDriver) {
+			handler.Disconnected(d)
+		},
+		ResourceOffers: func(_ *mesos.SchedulerDriver, offers []mesos.Offer) {
+			handler.ResourceOffers(d, offers)
+		},
+		OfferRescinded: func(_ *mesos.SchedulerDriver, offerID mesos.OfferID) {
+			handler.OfferRescinded(d, offerID)
+		},
+		StatusUpdate: func(_ *mesos.SchedulerDriver, status mesos.TaskStatus) {
+			handler.StatusUpdate(d, status)
+		},
+		FrameworkMessage: func(_ *mesos.SchedulerDriver, executorID mesos.ExecutorID, slaveID mesos.SlaveID, data string) {
+			handler.FrameworkMessage(d, executorID, slaveID, data)
+		},
+		SlaveLost: func(_ *mesos.SchedulerDriver, slaveID mesos.SlaveID) {
+			handler.SlaveLost(d, slaveID)
+		},
+		ExecutorLost: func(_ *mesos.SchedulerDriver, executorID mesos.ExecutorID, slaveID mesos.SlaveID, status int) {
+			handler.ExecutorLost(d, executorID, slaveID, status)
+		},
+		Error: func(_ *mesos.SchedulerDriver, message string) {
+			handler.Error(d, message)
+		},
+	}
+}
+
+// Start initializes and starts the libmesos driver
+func (d *nativeDriver) Start() error {
+	if err := d.driver.Init(); err != nil {
+		log.Critical("Couldn't initialize the mesos scheduler driver, because %v", err)
+		return err
+	}
+	return d.driver.Start()
+}
+
+// Stop stops and destroys the libmesos driver
+func (d *nativeDriver) Stop(failover bool) error {
+	err := d.driver.Stop(failover)
+	d.driver.Destroy()
+	return err
+}
+
+// LaunchTasks launches the tasks with the resources of the specified offer
+func (d *nativeDriver) LaunchTasks(offerID *mesos.OfferID, tasks []mesos.TaskInfo) error {
+	return d.driver.LaunchTasks(offerID, tasks)
+}
+
+// DeclineOffer declines the specified offer
+func (d *nativeDriver) DeclineOffer(offerID *mesos.OfferID) error {
+	return d.driver.DeclineOffer(offerID)
+}
+
+// KillTask kills the specified task
+func (d *nativeDriver) KillTask(taskID *mesos.TaskID) error {
+	return d.driver.KillTask(taskID)
+}
+
+// ReconcileTasks asks the master for the latest status of the specified tasks
+func (d *nativeDriver) ReconcileTasks(statuses []mesos.TaskStatus) error {
+	return d.driver.ReconcileTasks(statuses)
+}
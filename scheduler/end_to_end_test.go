@@ -0,0 +1,327 @@
+package scheduler
+
+import (
+	"io/ioutil"
+	stdlog "log"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"code.google.com/p/goprotobuf/proto"
+	"github.com/op/go-logging"
+	"github.com/reverb/exeggutor"
+	"github.com/reverb/exeggutor/bus"
+	"github.com/reverb/exeggutor/protocol"
+	"github.com/reverb/exeggutor/scheduler/simulator"
+	"github.com/reverb/exeggutor/state"
+	"github.com/reverb/exeggutor/store"
+	app_store "github.com/reverb/exeggutor/store/apps"
+	"github.com/reverb/exeggutor/tasks"
+	. "github.com/reverb/exeggutor/test_utils"
+	"github.com/reverb/go-mesos/mesos"
+	"github.com/reverb/go-utils/flake"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func simulatedSlave(id string) simulator.Slave {
+	return simulator.Slave{
+		ID:         id,
+		Hostname:   id + ".local",
+		Cpus:       2,
+		Mem:        1024,
+		Disk:       10240,
+		Ports:      []simulator.PortRange{{Begin: 31000, End: 31099}},
+		Attributes: map[string]string{"rack": "r1"},
+	}
+}
+
+// eventually polls the condition until it holds or the timeout expires
+func eventually(condition func() bool) bool {
+	return eventuallyWithin(3*time.Second, condition)
+}
+
+// eventuallyWithin polls the condition until it holds or the timeout expires
+func eventuallyWithin(timeout time.Duration, condition func() bool) bool {
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		if condition() {
+			return true
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return condition()
+}
+
+func deploymentsOf(mgr tasks.TaskManager, appID string, status protocol.AppStatus) []*protocol.Deployment {
+	deployments, _ := mgr.FindDeployments(func(d *protocol.Deployment) bool {
+		return d.GetAppId() == appID && d.GetStatus() == status
+	})
+	return deployments
+}
+
+func TestEndToEnd(t *testing.T) {
+	logBackend := logging.NewLogBackend(os.Stderr, "", stdlog.LstdFlags|stdlog.Lshortfile)
+	logBackend.Color = true
+	logging.SetBackend(logBackend)
+	logging.SetLevel(logging.ERROR, "")
+
+	context := &exeggutor.AppContext{
+		Config: &exeggutor.Config{
+			Mode:        "test",
+			MesosMaster: "simulated",
+			DockerIndex: &exeggutor.DockerIndexConfig{
+				Host: "dev-docker.helloreverb.com",
+				Port: 443,
+			},
+			FrameworkInfo: &exeggutor.FrameworkConfig{
+				User:                   "root",
+				Name:                   "exeggutor-tests",
+				HealthCheckConcurrency: 1,
+			},
+		},
+		IDGenerator: flake.NewFlake(),
+		Bus:         bus.New(),
+	}
+
+	start := func(config simulator.Config) (*simulator.Master, *Framework, *tasks.DefaultTaskManager) {
+		master := simulator.New(config)
+		data, err := ioutil.TempDir("", "agora-e2e-data")
+		So(err, ShouldBeNil)
+		context.Config.DataDirectory = data
+		mgr, err := tasks.NewDefaultTaskManager(context, app_store.NewWithStore(store.NewEmptyInMemoryStore()))
+		So(err, ShouldBeNil)
+		So(mgr.Start(), ShouldBeNil)
+		fw := NewFrameworkWithDriver(context, mgr, state.NewInMemoryFrameworkIDState(), master.NewDriver)
+		fw.Start()
+		return master, fw, mgr
+	}
+
+	submit := func(mgr *tasks.DefaultTaskManager, app protocol.Application) {
+		mgr.SaveApp(&app)
+		mgr.SubmitApp([]protocol.Application{app})
+	}
+
+	Convey("A framework running against a simulated master", t, func() {
+
+		Convey("registers and remembers its framework id", func() {
+			_, fw, mgr := start(simulator.Config{Slaves: []simulator.Slave{simulatedSlave("slave-1")}})
+			defer mgr.Stop()
+			defer fw.Stop()
+
+			So(eventually(func() bool { return fw.ID() == "simulated-framework" }), ShouldBeTrue)
+		})
+
+		Convey("stops without having been started, like a standby", func() {
+			master := simulator.New(simulator.Config{Slaves: []simulator.Slave{simulatedSlave("slave-1")}})
+			fw := NewFrameworkWithDriver(context, nil, state.NewInMemoryFrameworkIDState(), master.NewDriver)
+			So(fw.Stop(), ShouldBeNil)
+			So(NewFramework(context, nil).Stop(), ShouldBeNil)
+		})
+
+		Convey("launches a submitted app and tracks it until it's started", func() {
+			master, fw, mgr := start(simulator.Config{Slaves: []simulator.Slave{simulatedSlave("slave-1")}})
+			defer mgr.Stop()
+			defer fw.Stop()
+
+			app := TestComponent("e2e-app", "web", 1, 256)
+			submit(mgr, app)
+			master.Offer()
+
+			So(eventually(func() bool { return len(deploymentsOf(mgr, app.GetId(), protocol.AppStatus_STARTED)) == 1 }), ShouldBeTrue)
+			running := master.TasksOnSlave("slave-1")
+			So(running, ShouldHaveLength, 1)
+			deployment := deploymentsOf(mgr, app.GetId(), protocol.AppStatus_STARTED)[0]
+			So(deployment.GetTaskId().GetValue(), ShouldEqual, running[0])
+			So(deployment.GetHostName(), ShouldEqual, "slave-1.local")
+
+			Convey("and stops it when the app is killed", func() {
+				So(fw.KillApp("e2e-app"), ShouldBeNil)
+				So(eventually(func() bool { return len(deploymentsOf(mgr, app.GetId(), protocol.AppStatus_STOPPED)) == 1 }), ShouldBeTrue)
+				taskState, _ := master.TaskState(running[0])
+				So(taskState, ShouldEqual, mesos.TaskState_TASK_KILLED)
+				So(master.Tasks(), ShouldBeEmpty)
+			})
+
+			Convey("and replaces it when a revision of the same version is rolled back", func() {
+				previous := app
+				previous.Mem = proto.Float32(128)
+				mgr.SaveApp(&previous)
+				replaced, err := fw.ReplaceComponent(&previous)
+				So(err, ShouldBeNil)
+				So(replaced, ShouldHaveLength, 1)
+				So(eventually(func() bool {
+					taskState, _ := master.TaskState(running[0])
+					return taskState == mesos.TaskState_TASK_KILLED
+				}), ShouldBeTrue)
+
+				master.Offer()
+				So(eventually(func() bool {
+					started := deploymentsOf(mgr, app.GetId(), protocol.AppStatus_STARTED)
+					return len(started) == 1 && started[0].GetTaskId().GetValue() != running[0]
+				}), ShouldBeTrue)
+			})
+
+			Convey("and leaves it running when the scheduler stops, so the next leader can adopt it", func() {
+				So(fw.Stop(), ShouldBeNil)
+				taskState, _ := master.TaskState(running[0])
+				So(taskState, ShouldEqual, mesos.TaskState_TASK_RUNNING)
+			})
+
+			Convey("and kills it when the framework is torn down", func() {
+				So(fw.Teardown(), ShouldBeNil)
+				taskState, _ := master.TaskState(running[0])
+				So(taskState, ShouldEqual, mesos.TaskState_TASK_KILLED)
+			})
+		})
+
+		Convey("declines offers when nothing is queued", func() {
+			master, fw, mgr := start(simulator.Config{Slaves: []simulator.Slave{simulatedSlave("slave-1")}})
+			defer mgr.Stop()
+			defer fw.Stop()
+
+			master.Offer()
+			app := TestComponent("e2e-app", "late", 1, 256)
+			submit(mgr, app)
+			// the first offer was declined so the slave can be offered again
+			So(eventually(func() bool {
+				master.Offer()
+				return len(deploymentsOf(mgr, app.GetId(), protocol.AppStatus_STARTED)) == 1
+			}), ShouldBeTrue)
+		})
+
+		Convey("marks a task as failed when it fails according to the script", func() {
+			master, fw, mgr := start(simulator.Config{
+				Slaves: []simulator.Slave{simulatedSlave("slave-1")},
+				Script: []simulator.Transition{
+					{State: mesos.TaskState_TASK_RUNNING},
+					{After: 50 * time.Millisecond, State: mesos.TaskState_TASK_FAILED, Message: "out of memory"},
+				},
+			})
+			defer mgr.Stop()
+			defer fw.Stop()
+
+			app := TestComponent("e2e-app", "crashing", 1, 256)
+			submit(mgr, app)
+			master.Offer()
+
+			So(eventually(func() bool { return len(deploymentsOf(mgr, app.GetId(), protocol.AppStatus_FAILED)) == 1 }), ShouldBeTrue)
+			So(master.Tasks(), ShouldBeEmpty)
+		})
+
+		Convey("keeps a task that is still staging when reconciling", func() {
+			master, fw, mgr := start(simulator.Config{
+				Slaves: []simulator.Slave{simulatedSlave("slave-1")},
+				Script: []simulator.Transition{{After: time.Minute, State: mesos.TaskState_TASK_RUNNING}},
+			})
+			defer mgr.Stop()
+			defer fw.Stop()
+
+			app := TestComponent("e2e-app", "slow-pull", 1, 256)
+			submit(mgr, app)
+			master.Offer()
+			So(eventually(func() bool { return len(master.Tasks()) == 1 }), ShouldBeTrue)
+			taskID := master.Tasks()[0]
+
+			So(fw.reconciler.Reconcile(), ShouldBeNil)
+			So(eventually(func() bool {
+				fw.reconciler.lock.Lock()
+				defer fw.reconciler.lock.Unlock()
+				return len(fw.reconciler.pending) == 0
+			}), ShouldBeTrue)
+			// give the answer to the implicit reconciliation the time to arrive too
+			time.Sleep(50 * time.Millisecond)
+
+			taskState, _ := master.TaskState(taskID)
+			So(taskState, ShouldEqual, mesos.TaskState_TASK_STAGING)
+			deploying := deploymentsOf(mgr, app.GetId(), protocol.AppStatus_DEPLOYING)
+			So(deploying, ShouldHaveLength, 1)
+			So(deploying[0].GetTaskId().GetValue(), ShouldEqual, taskID)
+		})
+
+		Convey("places several apps on the slaves while their resources last", func() {
+			master, fw, mgr := start(simulator.Config{
+				Slaves: []simulator.Slave{simulatedSlave("slave-1"), simulatedSlave("slave-2")},
+			})
+			defer mgr.Stop()
+			defer fw.Stop()
+
+			for _, name := range []string{"a", "b", "c", "d", "e"} {
+				submit(mgr, TestComponent("e2e-app", name, 1, 256))
+			}
+			master.Offer()
+
+			So(eventually(func() bool { return len(master.Tasks()) == 4 }), ShouldBeTrue)
+			So(master.TasksOnSlave("slave-1"), ShouldHaveLength, 2)
+			So(master.TasksOnSlave("slave-2"), ShouldHaveLength, 2)
+		})
+
+		Convey("replaces the tasks of a lost slave on another slave", func() {
+			master, fw, mgr := start(simulator.Config{
+				Slaves: []simulator.Slave{simulatedSlave("slave-1"), simulatedSlave("slave-2")},
+			})
+			defer mgr.Stop()
+			defer fw.Stop()
+
+			app := TestComponent("e2e-app", "survivor", 1, 256)
+			submit(mgr, app)
+			master.Offer()
+			So(eventually(func() bool { return len(deploymentsOf(mgr, app.GetId(), protocol.AppStatus_STARTED)) == 1 }), ShouldBeTrue)
+			So(master.TasksOnSlave("slave-1"), ShouldHaveLength, 1)
+
+			So(master.LoseSlave("slave-1"), ShouldBeNil)
+			So(eventually(func() bool { return len(deploymentsOf(mgr, app.GetId(), protocol.AppStatus_FAILED)) == 1 }), ShouldBeTrue)
+
+			So(eventually(func() bool {
+				master.Offer()
+				return len(deploymentsOf(mgr, app.GetId(), protocol.AppStatus_STARTED)) == 1
+			}), ShouldBeTrue)
+			So(master.TasksOnSlave("slave-2"), ShouldHaveLength, 1)
+		})
+
+		Convey("replaces a task that fails its health checks", func() {
+			// nothing listens on the port the slave offers, so the tcp health check of the task fails
+			listener, err := net.Listen("tcp", "127.0.0.1:0")
+			So(err, ShouldBeNil)
+			port := uint64(listener.Addr().(*net.TCPAddr).Port)
+			listener.Close()
+
+			slave := simulatedSlave("slave-1")
+			slave.Hostname = "127.0.0.1"
+			slave.Ports = []simulator.PortRange{{Begin: port, End: port}}
+			master, fw, mgr := start(simulator.Config{Slaves: []simulator.Slave{slave}})
+			defer mgr.Stop()
+			defer fw.Stop()
+
+			app := TestComponent("e2e-app", "unreachable", 1, 256)
+			app.Sla = &protocol.ApplicationSLA{
+				MinInstances: proto.Int32(1),
+				MaxInstances: proto.Int32(1),
+				HealthCheck: &protocol.HealthCheck{
+					Mode:           protocol.HealthCheckMode_TCP.Enum(),
+					Scheme:         proto.String("http"),
+					RampUp:         proto.Int64(0),
+					IntervalMillis: proto.Int64(50),
+					Timeout:        proto.Int64(100),
+				},
+				UnhealthyAt: proto.Int32(2),
+			}
+			submit(mgr, app)
+			master.Offer()
+			So(eventually(func() bool { return len(deploymentsOf(mgr, app.GetId(), protocol.AppStatus_STARTED)) == 1 }), ShouldBeTrue)
+			unhealthy := master.Tasks()[0]
+
+			So(eventuallyWithin(10*time.Second, func() bool {
+				taskState, _ := master.TaskState(unhealthy)
+				return taskState == mesos.TaskState_TASK_KILLED
+			}), ShouldBeTrue)
+
+			// the replacement can only get the port of the slave once the unhealthy task freed it
+			So(eventually(func() bool {
+				master.Offer()
+				tasks := master.Tasks()
+				return len(tasks) == 1 && tasks[0] != unhealthy
+			}), ShouldBeTrue)
+		})
+	})
+}
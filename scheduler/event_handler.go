@@ -0,0 +1,126 @@
+package scheduler
+
+import (
+	"github.com/reverb/exeggutor/scheduler/driver"
+	"github.com/reverb/go-mesos/mesos"
+)
+
+// eventHandler reacts to the events the scheduler driver receives from the mesos master
+type eventHandler struct {
+	fw *Framework
+}
+
+func (h *eventHandler) Registered(d driver.SchedulerDriver, fwID mesos.FrameworkID, masterInfo mesos.MasterInfo) {
+	log.Info("registered framework %v with master %v", fwID.GetValue(), masterInfo.GetId())
+	h.fw.id.Set(&fwID)
+	go h.fw.reconciler.Reconcile()
+}
+
+func (h *eventHandler) Reregistered(d driver.SchedulerDriver, masterInfo mesos.MasterInfo) {
+	log.Info("Re-registered with master %s:%d\n", masterInfo.GetHostname(), masterInfo.GetPort())
+	go h.fw.reconciler.Reconcile()
+}
+
+func (h *eventHandler) Disconnected(d driver.SchedulerDriver) {
+	log.Warning("Disconnected from master!")
+	// TODO: terminate all the tasks
+}
+
+func (h *eventHandler) OfferRescinded(d driver.SchedulerDriver, offer mesos.OfferID) {
+	log.Info("the offer %s was rescinded", offer.GetValue())
+}
+
+func (h *eventHandler) SlaveLost(d driver.SchedulerDriver, slaveID mesos.SlaveID) {
+	log.Warning("Lost slave %s", slaveID.GetValue())
+	h.fw.taskManager.SlaveLost(&slaveID)
+}
+
+func (h *eventHandler) Error(d driver.SchedulerDriver, message string) {
+	log.Error("Got an error: %s", message)
+}
+
+func (h *eventHandler) StatusUpdate(d driver.SchedulerDriver, status mesos.TaskStatus) {
+	log.Info("Status update: %+v", status)
+	fw := h.fw
+	taskID := status.GetTaskId().GetValue()
+	slaveID := status.SlaveId.GetValue()
+
+	if !fw.reconciler.Observe(status) {
+		// the task store never heard of this task, it has been flagged by the reconciler
+		return
+	}
+
+	switch status.GetState() {
+	case mesos.TaskState_TASK_FAILED:
+		log.Warning("Task %s failed on %s, because %s", taskID, slaveID, status.GetMessage())
+		fw.taskManager.TaskFailed(status.GetTaskId(), status.SlaveId)
+	case mesos.TaskState_TASK_FINISHED:
+		log.Notice("Task %s finished on %s", taskID, slaveID)
+		fw.taskManager.TaskFinished(status.GetTaskId(), status.SlaveId)
+	case mesos.TaskState_TASK_KILLED:
+		log.Warning("Task %s killed on %s, because %s", taskID, slaveID, status.GetMessage())
+		fw.taskManager.TaskKilled(status.GetTaskId(), status.SlaveId)
+	case mesos.TaskState_TASK_LOST:
+		log.Warning("Task %s lost on %s, because %s", taskID, slaveID, status.GetMessage())
+		fw.taskManager.TaskLost(status.GetTaskId(), status.SlaveId)
+	case mesos.TaskState_TASK_RUNNING:
+		log.Notice("Task %s running on %s", taskID, slaveID)
+		fw.taskManager.TaskRunning(status.GetTaskId(), status.SlaveId)
+	case mesos.TaskState_TASK_STAGING, mesos.TaskState_TASK_STARTING:
+		if fw.reconciler.Reconciling() {
+			// the master answers a reconciliation request with staging or starting
+			// for a task that is still being launched, a slow image pull shouldn't get it killed
+			log.Info("Task %s is still %s on %s", taskID, status.GetState(), slaveID)
+			fw.taskManager.TaskDeploying(status.GetTaskId(), status.SlaveId)
+			return
+		}
+		h.stuckTask(d, status)
+	}
+}
+
+// stuckTask kills a task that reports it's staging or starting outside of reconciliation
+func (h *eventHandler) stuckTask(d driver.SchedulerDriver, status mesos.TaskStatus) {
+	fw := h.fw
+	taskID := status.GetTaskId().GetValue()
+	slaveID := status.SlaveId.GetValue()
+	switch status.GetState() {
+	case mesos.TaskState_TASK_STAGING:
+		log.Warning("Task %s is stuck in staging on %s, killing...", taskID, slaveID)
+		fw.taskManager.TaskStaging(status.GetTaskId(), status.SlaveId)
+		d.KillTask(status.GetTaskId())
+	case mesos.TaskState_TASK_STARTING:
+		log.Warning("Task %s is stuck in starting on %s, killing...", taskID, slaveID)
+		fw.taskManager.TaskStarting(status.GetTaskId(), status.SlaveId)
+		d.KillTask(status.GetTaskId())
+	}
+}
+
+func (h *eventHandler) FrameworkMessage(d driver.SchedulerDriver, executorID mesos.ExecutorID, slaveID mesos.SlaveID, data string) {
+	log.Info("Got framework message from executor %s, slave %s, and data: %s\n", executorID.GetValue(), slaveID.GetValue(), data)
+}
+
+func (h *eventHandler) ExecutorLost(d driver.SchedulerDriver, executorID mesos.ExecutorID, slaveID mesos.SlaveID, status int) {
+	log.Error("Lost executor %s, on slave %s with status code %d\n", executorID.GetValue(), slaveID.GetValue(), status)
+}
+
+func (h *eventHandler) ResourceOffers(d driver.SchedulerDriver, offers []mesos.Offer) {
+	logged := false
+	for _, offer := range offers {
+		if h.fw.taskManager != nil {
+			if !logged {
+				log.Debug("Received %d offers:", len(offers))
+				logged = true
+			}
+			log.Debug("  * %+v", offer)
+			fulfilment := h.fw.taskManager.FulfillOffer(offer)
+			if len(fulfilment) == 0 {
+				d.DeclineOffer(offer.GetId())
+			} else {
+				d.LaunchTasks(offer.GetId(), fulfilment)
+			}
+		} else {
+			log.Notice("Received an offer but no task manager is available to handle the offer, declining %s", offer.GetId().GetValue())
+			d.DeclineOffer(offer.GetId())
+		}
+	}
+}
@@ -0,0 +1,227 @@
+package scheduler
+
+import (
+	"sync"
+	"time"
+
+	"github.com/reverb/exeggutor/protocol"
+	"github.com/reverb/go-mesos/mesos"
+)
+
+// taskStatusReconciler is the part of a mesos scheduler driver the reconciler needs
+// to ask the master for the latest known state of a set of tasks.
+type taskStatusReconciler interface {
+	ReconcileTasks(statuses []mesos.TaskStatus) error
+}
+
+// deploymentTracker is the part of the task manager the reconciler needs
+// to read the known deployments and fix the ones that went stale.
+type deploymentTracker interface {
+	FindDeployments(predicate func(*protocol.Deployment) bool) ([]*protocol.Deployment, error)
+	FindTaskForComponent(task string) (*mesos.TaskID, error)
+	TaskLost(taskID *mesos.TaskID, slaveID *mesos.SlaveID)
+}
+
+// reconciler compares the deployments in the task store with the task statuses
+// mesos reports. It asks the master for the state of every deployment it thinks
+// is alive, and marks the ones the master didn't report on within a grace period as lost.
+// Status updates for tasks the task store never heard of are flagged.
+type reconciler struct {
+	driver   taskStatusReconciler
+	tracker  deploymentTracker
+	interval time.Duration
+	grace    time.Duration
+	lock     *sync.Mutex
+	round    int64
+	until    time.Time
+	pending  map[string]reconcileEntry
+	unknown  map[string]mesos.TaskStatus
+	ticker   *time.Ticker
+	closing  chan chan bool
+}
+
+type reconcileEntry struct {
+	round   int64
+	taskID  *mesos.TaskID
+	slaveID *mesos.SlaveID
+}
+
+func newReconciler(driver taskStatusReconciler, tracker deploymentTracker, interval, grace time.Duration) *reconciler {
+	return &reconciler{
+		driver:   driver,
+		tracker:  tracker,
+		interval: interval,
+		grace:    grace,
+		lock:     &sync.Mutex{},
+		pending:  make(map[string]reconcileEntry),
+		unknown:  make(map[string]mesos.TaskStatus),
+		closing:  make(chan chan bool),
+	}
+}
+
+// Start starts the periodic reconciliation, when the interval is 0
+// reconciliation only happens on (re-)registration
+func (r *reconciler) Start() error {
+	log.Debug("Starting task reconciler as enabled: %t", r.interval > 0)
+	if r.interval > 0 {
+		r.ticker = time.NewTicker(r.interval)
+		go func() {
+			for {
+				select {
+				case <-r.ticker.C:
+					r.Reconcile()
+				case boolc := <-r.closing:
+					r.ticker.Stop()
+					boolc <- true
+					return
+				}
+			}
+		}()
+	}
+	return nil
+}
+
+// Stop stops the periodic reconciliation
+func (r *reconciler) Stop() error {
+	if r.interval > 0 {
+		boolc := make(chan bool)
+		r.closing <- boolc
+		<-boolc
+	}
+	return nil
+}
+
+func (r *reconciler) needsReconciliation(deployment *protocol.Deployment) bool {
+	status := deployment.GetStatus()
+	return status == protocol.AppStatus_DEPLOYING ||
+		status == protocol.AppStatus_STARTED ||
+		status == protocol.AppStatus_UNHEALTHY ||
+		status == protocol.AppStatus_STOPPING
+}
+
+func (r *reconciler) taskState(deployment *protocol.Deployment) mesos.TaskState {
+	if deployment.GetStatus() == protocol.AppStatus_DEPLOYING {
+		return mesos.TaskState_TASK_STAGING
+	}
+	return mesos.TaskState_TASK_RUNNING
+}
+
+// Reconcile starts a new reconciliation round.
+// It first asks for the state of all the tasks we know about and then
+// for all the tasks the master knows about, so that we can discover the tasks
+// our task store lost track of.
+func (r *reconciler) Reconcile() error {
+	deployments, err := r.tracker.FindDeployments(r.needsReconciliation)
+	if err != nil {
+		log.Warning("Couldn't get the deployments to reconcile, because %v", err)
+		return err
+	}
+
+	r.lock.Lock()
+	r.round++
+	round := r.round
+	r.until = time.Now().Add(r.grace)
+	var statuses []mesos.TaskStatus
+	for _, deployment := range deployments {
+		taskID := deployment.GetTaskId()
+		r.pending[taskID.GetValue()] = reconcileEntry{round: round, taskID: taskID, slaveID: deployment.GetSlave()}
+		statuses = append(statuses, mesos.TaskStatus{
+			TaskId:  taskID,
+			State:   r.taskState(deployment).Enum(),
+			SlaveId: deployment.GetSlave(),
+		})
+	}
+	r.lock.Unlock()
+
+	log.Info("Reconciling %d tasks with the mesos master", len(statuses))
+	if len(statuses) > 0 {
+		if err := r.driver.ReconcileTasks(statuses); err != nil {
+			log.Warning("Failed to request explicit reconciliation, because %v", err)
+			return err
+		}
+	}
+	// an empty list asks the master to send us the state of all the tasks it knows about
+	if err := r.driver.ReconcileTasks([]mesos.TaskStatus{}); err != nil {
+		log.Warning("Failed to request implicit reconciliation, because %v", err)
+		return err
+	}
+
+	if len(statuses) > 0 {
+		time.AfterFunc(r.grace, func() { r.expire(round) })
+	}
+	return nil
+}
+
+// Reconciling returns true while the master might still be answering a reconciliation round,
+// during that time a status update only tells us the latest state of a task, it isn't a state change.
+func (r *reconciler) Reconciling() bool {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return time.Now().Before(r.until)
+}
+
+// expire marks all the tasks the master didn't report on during the specified round as lost.
+func (r *reconciler) expire(round int64) {
+	var stale []reconcileEntry
+	r.lock.Lock()
+	for key, entry := range r.pending {
+		if entry.round <= round {
+			stale = append(stale, entry)
+			delete(r.pending, key)
+		}
+	}
+	r.lock.Unlock()
+
+	for _, entry := range stale {
+		log.Warning("The master didn't report on task %s during reconciliation, marking it as lost", entry.taskID.GetValue())
+		r.tracker.TaskLost(entry.taskID, entry.slaveID)
+	}
+}
+
+// Observe records a status update from the master.
+// It returns false when the task store has never heard of this task,
+// in which case the task is flagged as unknown.
+func (r *reconciler) Observe(status mesos.TaskStatus) bool {
+	key := status.GetTaskId().GetValue()
+	r.lock.Lock()
+	delete(r.pending, key)
+	r.lock.Unlock()
+
+	taskID, err := r.tracker.FindTaskForComponent(key)
+	if err != nil {
+		log.Warning("Couldn't look up task %s, because %v", key, err)
+		return true
+	}
+	if taskID != nil {
+		return true
+	}
+
+	log.Warning("Task %s on %s is %s but the task store never heard of it", key, status.GetSlaveId().GetValue(), status.GetState())
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.isTerminal(status.GetState()) {
+		delete(r.unknown, key)
+	} else {
+		r.unknown[key] = status
+	}
+	return false
+}
+
+func (r *reconciler) isTerminal(state mesos.TaskState) bool {
+	return state == mesos.TaskState_TASK_FAILED ||
+		state == mesos.TaskState_TASK_FINISHED ||
+		state == mesos.TaskState_TASK_KILLED ||
+		state == mesos.TaskState_TASK_LOST
+}
+
+// UnknownTasks returns the statuses of the tasks the master reported
+// but the task store has no record of.
+func (r *reconciler) UnknownTasks() []mesos.TaskStatus {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	var result []mesos.TaskStatus
+	for _, status := range r.unknown {
+		result = append(result, status)
+	}
+	return result
+}
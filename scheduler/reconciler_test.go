@@ -0,0 +1,124 @@
+package scheduler
+
+import (
+	stdlog "log"
+	"os"
+	"testing"
+	"time"
+
+	"code.google.com/p/goprotobuf/proto"
+	"github.com/op/go-logging"
+	"github.com/reverb/exeggutor/protocol"
+	"github.com/reverb/go-mesos/mesos"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+type recordingDriver struct {
+	requests [][]mesos.TaskStatus
+}
+
+func (d *recordingDriver) ReconcileTasks(statuses []mesos.TaskStatus) error {
+	d.requests = append(d.requests, statuses)
+	return nil
+}
+
+type fakeTracker struct {
+	deployments []*protocol.Deployment
+	lost        chan *mesos.TaskID
+}
+
+func (f *fakeTracker) FindDeployments(predicate func(*protocol.Deployment) bool) ([]*protocol.Deployment, error) {
+	var result []*protocol.Deployment
+	for _, d := range f.deployments {
+		if predicate(d) {
+			result = append(result, d)
+		}
+	}
+	return result, nil
+}
+
+func (f *fakeTracker) FindTaskForComponent(task string) (*mesos.TaskID, error) {
+	for _, d := range f.deployments {
+		if d.GetTaskId().GetValue() == task {
+			return d.GetTaskId(), nil
+		}
+	}
+	return nil, nil
+}
+
+func (f *fakeTracker) TaskLost(taskID *mesos.TaskID, slaveID *mesos.SlaveID) {
+	f.lost <- taskID
+}
+
+func testDeployment(id string, status protocol.AppStatus) *protocol.Deployment {
+	return &protocol.Deployment{
+		AppId:      proto.String("app-" + id),
+		TaskId:     &mesos.TaskID{Value: proto.String(id)},
+		Status:     status.Enum(),
+		Slave:      &mesos.SlaveID{Value: proto.String("slave-1")},
+		DeployedAt: proto.Int64(5),
+	}
+}
+
+func TestReconciler(t *testing.T) {
+	logBackend := logging.NewLogBackend(os.Stderr, "", stdlog.LstdFlags|stdlog.Lshortfile)
+	logging.SetBackend(logBackend)
+	logging.SetLevel(logging.ERROR, "")
+
+	Convey("A reconciler", t, func() {
+		driver := &recordingDriver{}
+		tracker := &fakeTracker{
+			deployments: []*protocol.Deployment{
+				testDeployment("task-1", protocol.AppStatus_STARTED),
+				testDeployment("task-2", protocol.AppStatus_DEPLOYING),
+				testDeployment("task-3", protocol.AppStatus_STOPPED),
+			},
+			lost: make(chan *mesos.TaskID, 3),
+		}
+		r := newReconciler(driver, tracker, 0, 50*time.Millisecond)
+
+		Convey("should request explicit and implicit reconciliation", func() {
+			err := r.Reconcile()
+			So(err, ShouldBeNil)
+			So(len(driver.requests), ShouldEqual, 2)
+			So(len(driver.requests[0]), ShouldEqual, 2)
+			So(driver.requests[0][0].GetTaskId().GetValue(), ShouldEqual, "task-1")
+			So(driver.requests[0][0].GetState(), ShouldEqual, mesos.TaskState_TASK_RUNNING)
+			So(driver.requests[0][1].GetState(), ShouldEqual, mesos.TaskState_TASK_STAGING)
+			So(driver.requests[1], ShouldBeEmpty)
+		})
+
+		Convey("should know it's reconciling until the grace period is over", func() {
+			So(r.Reconciling(), ShouldBeFalse)
+			r.Reconcile()
+			So(r.Reconciling(), ShouldBeTrue)
+			time.Sleep(60 * time.Millisecond)
+			So(r.Reconciling(), ShouldBeFalse)
+		})
+
+		Convey("should mark the tasks the master didn't report on as lost", func() {
+			r.Reconcile()
+			known := r.Observe(mesos.TaskStatus{
+				TaskId: &mesos.TaskID{Value: proto.String("task-1")},
+				State:  mesos.TaskState_TASK_RUNNING.Enum(),
+			})
+			So(known, ShouldBeTrue)
+
+			lost := <-tracker.lost
+			So(lost.GetValue(), ShouldEqual, "task-2")
+			So(len(tracker.lost), ShouldEqual, 0)
+		})
+
+		Convey("should flag tasks the task store never heard of", func() {
+			known := r.Observe(mesos.TaskStatus{
+				TaskId:  &mesos.TaskID{Value: proto.String("task-99")},
+				State:   mesos.TaskState_TASK_RUNNING.Enum(),
+				SlaveId: &mesos.SlaveID{Value: proto.String("slave-2")},
+			})
+			So(known, ShouldBeFalse)
+			unknown := r.UnknownTasks()
+			So(len(unknown), ShouldEqual, 1)
+			So(unknown[0].GetTaskId().GetValue(), ShouldEqual, "task-99")
+		})
+	})
+}
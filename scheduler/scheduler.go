@@ -1,8 +1,12 @@
 package scheduler
 
 import (
+	"time"
+
 	"github.com/reverb/exeggutor"
+	"github.com/reverb/exeggutor/bus"
 	"github.com/reverb/exeggutor/protocol"
+	"github.com/reverb/exeggutor/scheduler/driver"
 	"github.com/reverb/exeggutor/state"
 	"github.com/reverb/exeggutor/tasks"
 	"github.com/reverb/go-utils/rvb_zk"
@@ -16,6 +20,13 @@ var log = logging.MustGetLogger("exeggutor.scheduler")
 
 var launched = false
 
+// killBuffer the number of kills that can be waiting for the driver
+// before the one asking for another kill has to wait
+const killBuffer = 1024
+
+// DriverFactory creates the driver the framework uses to talk to the mesos master
+type DriverFactory func(master string, framework mesos.FrameworkInfo, handler driver.EventHandler) (driver.SchedulerDriver, error)
+
 // Framework is the object that listens to mesos resource offers and
 // and tries to fullfil offers if it has applications queued for submission
 type Framework struct {
@@ -27,20 +38,37 @@ type Framework struct {
 	Curator     *rvb_zk.Curator
 	ownsCurator bool
 	// Driver the driver for the mesos framework
-	driver      mesos.SchedulerDriver
+	driver      driver.SchedulerDriver
+	newDriver   DriverFactory
 	taskManager tasks.TaskManager
+	reconciler  *reconciler
+	kills       *bus.Subscription
 }
 
 // NewFramework creates a new instance of Framework with the specified config
 func NewFramework(context *exeggutor.AppContext, taskManager tasks.TaskManager) *Framework {
 	log.Debug("Creating a new instance of a mesos scheduler")
-	return &Framework{context: context, ownsCurator: true, ownsFwIDState: true, taskManager: taskManager}
+	return &Framework{context: context, ownsCurator: true, ownsFwIDState: true, taskManager: taskManager, newDriver: driver.New}
+}
+
+// NewFrameworkWithCurator creates a new instance of Framework which uses a zookeeper client
+// that is shared with other components, like the leader election.
+func NewFrameworkWithCurator(context *exeggutor.AppContext, taskManager tasks.TaskManager, curator *rvb_zk.Curator) *Framework {
+	log.Debug("Creating a new instance of a mesos scheduler with a shared zookeeper client")
+	return &Framework{context: context, Curator: curator, ownsFwIDState: true, taskManager: taskManager, newDriver: driver.New}
+}
+
+// NewFrameworkWithDriver creates a new instance of Framework which doesn't need zookeeper
+// and which talks to mesos through the driver the factory creates, like a simulated master.
+func NewFrameworkWithDriver(context *exeggutor.AppContext, taskManager tasks.TaskManager, fwID state.FrameworkIDState, newDriver DriverFactory) *Framework {
+	log.Debug("Creating a new instance of a mesos scheduler with a custom driver")
+	return &Framework{context: context, id: fwID, taskManager: taskManager, newDriver: newDriver}
 }
 
 // NewCustomFramework creates a new instance of a framework with all the dependencies injected
 func NewCustomFramework(context *exeggutor.AppContext, fwID state.FrameworkIDState, curator *rvb_zk.Curator) *Framework {
 	log.Debug("Creating a new custom instance of a mesos scheduler")
-	return &Framework{context: context, id: fwID, Curator: curator}
+	return &Framework{context: context, id: fwID, Curator: curator, newDriver: driver.New}
 }
 
 // func NewCustomFrameworkWithScheduler(
@@ -49,11 +77,17 @@ func NewCustomFramework(context *exeggutor.AppContext, fwID state.FrameworkIDSta
 // }
 
 func (fw *Framework) infoFromConfig() mesos.FrameworkInfo {
-	return mesos.FrameworkInfo{
+	info := mesos.FrameworkInfo{
 		User: proto.String(fw.context.Config.FrameworkInfo.User),
 		Name: proto.String(fw.context.Config.FrameworkInfo.Name),
 		Id:   fw.id.Get(),
 	}
+	// without a failover timeout mesos kills the tasks as soon as the scheduler disconnects,
+	// before a restarted or newly elected scheduler can register with the same framework id
+	if timeout := fw.context.Config.FrameworkInfo.FailoverTimeout; timeout > 0 {
+		info.FailoverTimeout = proto.Float64(float64(timeout))
+	}
+	return info
 }
 
 // SaveApp saves this application in the app store
@@ -67,6 +101,92 @@ func (fw *Framework) SubmitApp(app []protocol.Application) error {
 	return fw.taskManager.SubmitApp(app)
 }
 
+// StartRollout submits a new version of a component as a rolling deployment,
+// when no other version of the component is deployed it submits the app like SubmitApp does.
+func (fw *Framework) StartRollout(app *protocol.Application, strategy tasks.RolloutStrategy) (*tasks.Rollout, error) {
+	rollout, err := fw.taskManager.StartRollout(app, strategy)
+	if err != nil || rollout != nil {
+		return rollout, err
+	}
+	return nil, fw.taskManager.SubmitApp([]protocol.Application{*app})
+}
+
+// Rollouts lists the rolling deployments
+func (fw *Framework) Rollouts() []*tasks.Rollout {
+	return fw.taskManager.Rollouts()
+}
+
+// Rollout gets the rolling deployment for the app with the provided id
+func (fw *Framework) Rollout(appID string) (*tasks.Rollout, bool) {
+	return fw.taskManager.Rollout(appID)
+}
+
+// ResumeRollout continues a paused rolling deployment
+func (fw *Framework) ResumeRollout(appID string) (*tasks.Rollout, error) {
+	return fw.taskManager.ResumeRollout(appID)
+}
+
+// RollBack rolls a rolling deployment back to the version it was replacing
+func (fw *Framework) RollBack(appID string) (*tasks.Rollout, error) {
+	return fw.taskManager.RollBack(appID)
+}
+
+// CrashLoops lists the components that failed recently and whether they are crash looping
+func (fw *Framework) CrashLoops() []tasks.CrashLoop {
+	return fw.taskManager.CrashLoops()
+}
+
+// ClearCrashLoop forgets the failures of a component so it gets deployed again
+func (fw *Framework) ClearCrashLoop(appName, component string) bool {
+	return fw.taskManager.ClearCrashLoop(appName, component)
+}
+
+// QuotaUsage reports the resources the deployed and queued instances claim against the quota
+func (fw *Framework) QuotaUsage(quota *protocol.ResourceQuota) (tasks.QuotaUsage, error) {
+	return fw.taskManager.QuotaUsage(quota)
+}
+
+// QueuedItems lists the items in the task queue with the last offers they were checked against
+func (fw *Framework) QueuedItems() []tasks.QueuedItem {
+	return fw.taskManager.QueuedItems()
+}
+
+// CancelQueued removes queued items of a component, an empty id removes all of them
+func (fw *Framework) CancelQueued(appName, component, id string) (int, error) {
+	return fw.taskManager.CancelQueued(appName, component, id)
+}
+
+// ListTasks lists the deployed tasks that match the filter with the host and ports they use
+func (fw *Framework) ListTasks(filter tasks.TaskFilter) ([]tasks.DeployedTask, error) {
+	return fw.taskManager.ListTasks(filter)
+}
+
+// StopApp deactivates all the components of an application and stops their tasks
+func (fw *Framework) StopApp(appName string) ([]*mesos.TaskID, error) {
+	return fw.taskManager.StopApp(appName)
+}
+
+// StopComponent deactivates a component and stops its tasks
+func (fw *Framework) StopComponent(appName, component string) ([]*mesos.TaskID, error) {
+	return fw.taskManager.StopComponent(appName, component)
+}
+
+// KillTask stops a single task, when replace is true another instance is queued right away
+func (fw *Framework) KillTask(taskID string, replace bool) (*mesos.TaskID, error) {
+	return fw.taskManager.KillTask(taskID, replace)
+}
+
+// ScaleComponent sets the number of instances of a component and returns the tasks that are being stopped
+func (fw *Framework) ScaleComponent(appName, component string, instances int32) ([]*mesos.TaskID, error) {
+	return fw.taskManager.ScaleComponent(appName, component, instances)
+}
+
+// ReplaceComponent replaces the tasks of every version of the component with instances of the app
+// and returns the tasks that are being stopped
+func (fw *Framework) ReplaceComponent(app *protocol.Application) ([]*mesos.TaskID, error) {
+	return fw.taskManager.ReplaceComponent(app)
+}
+
 // KillApp stops all the components of an application
 func (fw *Framework) KillApp(app string) error {
 	taskIds, err := fw.taskManager.FindTasksForApp(app)
@@ -117,91 +237,6 @@ func (fw *Framework) ID() string {
 	return fw.id.Get().GetValue()
 }
 
-func (fw *Framework) defaultMesosScheduler() *mesos.Scheduler {
-	return &mesos.Scheduler{
-		Registered: func(driver *mesos.SchedulerDriver, fwID mesos.FrameworkID, masterInfo mesos.MasterInfo) {
-			log.Info("registered framework %v with master %v", fwID.GetValue(), masterInfo.GetId())
-			fw.id.Set(&fwID)
-		},
-		OfferRescinded: func(driver *mesos.SchedulerDriver, offer mesos.OfferID) {
-			log.Info("the offer %s was rescinded", offer.GetValue())
-		},
-		Disconnected: func(driver *mesos.SchedulerDriver) {
-			log.Warning("Disconnected from master!")
-			// TODO: terminate all the tasks
-		},
-		Reregistered: func(driver *mesos.SchedulerDriver, masterInfo mesos.MasterInfo) {
-			log.Info("Re-registered with master %s:%d\n", masterInfo.GetHostname(), masterInfo.GetPort())
-		},
-		SlaveLost: func(driver *mesos.SchedulerDriver, slaveID mesos.SlaveID) {
-			log.Warning("Lost slave", slaveID.GetValue())
-			// TODO: terminate all the tasks belonging to this slave.
-		},
-		Error: func(driver *mesos.SchedulerDriver, message string) {
-			log.Error("Got an error:", message)
-		},
-		StatusUpdate: func(driver *mesos.SchedulerDriver, status mesos.TaskStatus) {
-			log.Info("Status update: %+v", status)
-			taskID := status.GetTaskId().GetValue()
-			slaveID := status.SlaveId.GetValue()
-
-			switch status.GetState() {
-			case mesos.TaskState_TASK_FAILED:
-				log.Warning("Task %s failed on %s, because %s", taskID, slaveID, status.GetMessage())
-				fw.taskManager.TaskFailed(status.GetTaskId(), status.SlaveId)
-			case mesos.TaskState_TASK_FINISHED:
-				log.Notice("Task %s finished on %s", taskID, slaveID)
-				fw.taskManager.TaskFinished(status.GetTaskId(), status.SlaveId)
-			case mesos.TaskState_TASK_KILLED:
-				log.Warning("Task %s killed on %s, because %s", taskID, slaveID, status.GetMessage())
-				fw.taskManager.TaskKilled(status.GetTaskId(), status.SlaveId)
-			case mesos.TaskState_TASK_LOST:
-				log.Warning("Task %s lost on %s, because %s", taskID, slaveID, status.GetMessage())
-				fw.taskManager.TaskLost(status.GetTaskId(), status.SlaveId)
-			case mesos.TaskState_TASK_RUNNING:
-				log.Notice("Task %s running on %s", taskID, slaveID)
-				fw.taskManager.TaskRunning(status.GetTaskId(), status.SlaveId)
-			case mesos.TaskState_TASK_STAGING:
-				log.Warning("Task %s is stuck in staging on %s, killing...", taskID, slaveID)
-				fw.taskManager.TaskStaging(status.GetTaskId(), status.SlaveId)
-				driver.KillTask(status.GetTaskId())
-			case mesos.TaskState_TASK_STARTING:
-				log.Warning("Task %s is stuck in starting on %s, killing...", taskID, slaveID)
-				fw.taskManager.TaskStarting(status.GetTaskId(), status.SlaveId)
-				driver.KillTask(status.GetTaskId())
-			}
-
-		},
-		FrameworkMessage: func(driver *mesos.SchedulerDriver, executorID mesos.ExecutorID, slaveID mesos.SlaveID, data string) {
-			log.Info("Got framework message from executor %s, slave %s, and data: %s\n", executorID.GetValue(), slaveID.GetValue(), data)
-		},
-		ExecutorLost: func(driver *mesos.SchedulerDriver, executorID mesos.ExecutorID, slaveID mesos.SlaveID, status int) {
-			log.Error("Lost executor %s, on slave %s with status code %d\n", executorID.GetValue(), slaveID.GetValue(), status)
-		},
-		ResourceOffers: func(driver *mesos.SchedulerDriver, offers []mesos.Offer) {
-			logged := false
-			for _, offer := range offers {
-				if fw.taskManager != nil {
-					if !logged {
-						log.Debug("Received %d offers:", len(offers))
-						logged = true
-					}
-					log.Debug("  * %+v", offer)
-					fulfilment := fw.taskManager.FulfillOffer(offer)
-					if len(fulfilment) == 0 {
-						driver.DeclineOffer(offer.GetId())
-					} else {
-						driver.LaunchTasks(offer.GetId(), fulfilment)
-					}
-				} else {
-					log.Notice("Received an offer but no task manager is available to handle the offer, declining %s", offer.GetId().GetValue())
-					driver.DeclineOffer(offer.GetId())
-				}
-			}
-		},
-	}
-}
-
 // Start initializes the scheduler and everything it depends on
 func (fw *Framework) Start() error {
 	uri := fw.context.Config.ZookeeperURL
@@ -221,48 +256,89 @@ func (fw *Framework) Start() error {
 		fw.id.Start(true)
 	}
 
-	log.Debug("Creating mesos scheduler driver")
-	fw.driver = mesos.SchedulerDriver{
-		Master:    master,
-		Framework: fw.infoFromConfig(),
-		Scheduler: fw.defaultMesosScheduler(),
-	}
-
-	err := fw.driver.Init()
+	log.Debug("Creating mesos scheduler driver for %s", master)
+	drv, err := fw.newDriver(master, fw.infoFromConfig(), &eventHandler{fw: fw})
 	if err != nil {
-		log.Critical("Couldn't initialize the mesos scheduler driver, because %v", err)
+		log.Critical("Couldn't create the mesos scheduler driver, because %v", err)
 		return err
 	}
+	fw.driver = drv
+
+	fw.reconciler = newReconciler(fw.driver, fw.taskManager, fw.reconcileInterval(), 1*time.Minute)
+
 	err = fw.driver.Start()
 	if err != nil {
 		log.Critical("Couldn't start the mesos scheduler driver, because %v", err)
 		return err
 	}
+	fw.reconciler.Start()
 
-	go fw.listenForTasksToKill()
+	fw.kills = fw.context.Bus.Subscribe(bus.TaskToKill, killBuffer, bus.Block)
+	go fw.listenForTasksToKill(fw.kills)
 
 	log.Notice("Started the exeggutor scheduler")
 	return nil
 }
 
-func (fw *Framework) listenForTasksToKill() {
-	for taskID := range fw.taskManager.TasksToKill() {
-		if taskID != nil {
-			fw.KillApp(taskID.GetValue())
+func (fw *Framework) reconcileInterval() time.Duration {
+	if fw.context.Config.FrameworkInfo == nil {
+		return 0
+	}
+	return time.Duration(fw.context.Config.FrameworkInfo.ReconcileInterval) * time.Second
+}
+
+// UnknownTasks returns the tasks mesos reported during reconciliation
+// but which aren't known in the task store
+func (fw *Framework) UnknownTasks() []mesos.TaskStatus {
+	if fw.reconciler == nil {
+		return nil
+	}
+	return fw.reconciler.UnknownTasks()
+}
+
+// listenForTasksToKill kills the tasks published on bus.TaskToKill until it's unsubscribed
+func (fw *Framework) listenForTasksToKill(kills *bus.Subscription) {
+	for msg := range kills.Messages() {
+		if taskID, ok := msg.(*mesos.TaskID); ok && taskID != nil {
+			fw.taskManager.TaskStopping(taskID)
+			if err := fw.driver.KillTask(taskID); err != nil {
+				log.Warning("Couldn't kill task %s, because %v", taskID.GetValue(), err)
+			}
 		}
 	}
 }
 
-// Stop stops the mesos scheduler driver
+// Stop stops the mesos scheduler driver and leaves the tasks running,
+// so the scheduler that takes over after a restart or a leader election can adopt them
 func (fw *Framework) Stop() error {
+	return fw.stop(true)
+}
+
+// Teardown stops the mesos scheduler driver and unregisters the framework,
+// mesos kills all its tasks. Only use this to decommission the framework.
+func (fw *Framework) Teardown() error {
+	return fw.stop(false)
+}
 
-	err1 := fw.driver.Stop(false)
-	fw.driver.Destroy()
+func (fw *Framework) stop(failover bool) error {
+	// a standby that never became the leader didn't start the driver or the reconciler
+	if fw.kills != nil {
+		fw.context.Bus.Unsubscribe(fw.kills)
+		fw.kills = nil
+	}
+	if fw.reconciler != nil {
+		fw.reconciler.Stop()
+		fw.reconciler = nil
+	}
+	var err1 error
+	if fw.driver != nil {
+		err1 = fw.driver.Stop(failover)
+	}
 	var err2 error
-	if fw.ownsFwIDState {
+	if fw.ownsFwIDState && fw.id != nil {
 		err2 = fw.id.Stop()
 	}
-	if fw.ownsCurator {
+	if fw.ownsCurator && fw.Curator != nil {
 		fw.Curator.Close()
 	}
 
@@ -0,0 +1,66 @@
+package simulator
+
+import "sync"
+
+// eventQueue delivers the events to the framework one at a time and in order,
+// like a real driver does. The queue is unbounded so the master can push events
+// while the framework is handling another event and calling back into the master.
+type eventQueue struct {
+	lock    *sync.Mutex
+	pending []func()
+	notify  chan struct{}
+	closing chan struct{}
+}
+
+func newEventQueue() *eventQueue {
+	return &eventQueue{
+		lock:    &sync.Mutex{},
+		notify:  make(chan struct{}, 1),
+		closing: make(chan struct{}),
+	}
+}
+
+func (q *eventQueue) push(event func()) {
+	q.lock.Lock()
+	q.pending = append(q.pending, event)
+	q.lock.Unlock()
+	select {
+	case q.notify <- struct{}{}:
+	default:
+	}
+}
+
+func (q *eventQueue) run() {
+	for {
+		select {
+		case <-q.closing:
+			return
+		case <-q.notify:
+		}
+		for {
+			q.lock.Lock()
+			if len(q.pending) == 0 {
+				q.lock.Unlock()
+				break
+			}
+			event := q.pending[0]
+			q.pending = q.pending[1:]
+			q.lock.Unlock()
+
+			select {
+			case <-q.closing:
+				return
+			default:
+			}
+			event()
+		}
+	}
+}
+
+// stop drops the pending events and stops delivering events
+func (q *eventQueue) stop() {
+	close(q.closing)
+	q.lock.Lock()
+	q.pending = nil
+	q.lock.Unlock()
+}
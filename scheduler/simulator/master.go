@@ -0,0 +1,589 @@
+// Package simulator provides an in-process stand-in for a mesos master and its slaves.
+// It implements the scheduler driver so the framework, the task manager and the health checker
+// can be tested together without a mesos cluster.
+package simulator
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+
+	"code.google.com/p/goprotobuf/proto"
+	"github.com/op/go-logging"
+	"github.com/reverb/exeggutor/scheduler/driver"
+	"github.com/reverb/go-mesos/mesos"
+)
+
+var log = logging.MustGetLogger("exeggutor.scheduler.simulator")
+
+// ErrNotStarted is returned when the driver is used before it was created and started
+var ErrNotStarted = errors.New("the simulated master isn't started")
+
+// PortRange a range of ports a slave offers
+type PortRange struct {
+	Begin uint64
+	End   uint64
+}
+
+// Slave describes a fake slave with its resources and attributes
+type Slave struct {
+	ID         string
+	Hostname   string
+	Cpus       float64
+	Mem        float64
+	Disk       float64
+	Ports      []PortRange
+	Attributes map[string]string
+}
+
+// Transition is a status change a launched task goes through after the specified delay
+type Transition struct {
+	After   time.Duration
+	State   mesos.TaskState
+	Message string
+}
+
+// Config the configuration for a simulated master
+type Config struct {
+	// Slaves the slaves that make up the cluster
+	Slaves []Slave
+	// OfferInterval the interval at which free resources are offered, 0 disables periodic offers
+	OfferInterval time.Duration
+	// Script the transitions every launched task goes through, a task goes to TASK_RUNNING when it's empty
+	Script []Transition
+	// FailureRate the chance between 0 and 1 that a launched task fails after FailAfter instead of following the script
+	FailureRate float64
+	// FailAfter how long a task runs before it fails when it's picked to fail
+	FailAfter time.Duration
+	// Seed the seed for picking the tasks that fail
+	Seed int64
+}
+
+type slaveState struct {
+	Slave
+	usedCpus  float64
+	usedMem   float64
+	usedDisk  float64
+	usedPorts map[uint64]bool
+	offered   bool
+	lost      bool
+}
+
+type taskState struct {
+	info   mesos.TaskInfo
+	slave  *slaveState
+	state  mesos.TaskState
+	timers []*time.Timer
+	ports  []uint64
+	cpus   float64
+	mem    float64
+	disk   float64
+}
+
+type outstandingOffer struct {
+	offer mesos.Offer
+	slave *slaveState
+}
+
+// Master a simulated mesos master, it hands out offers for the resources of its slaves,
+// launches and kills tasks and sends the status updates for them.
+type Master struct {
+	config      Config
+	lock        *sync.Mutex
+	handler     driver.EventHandler
+	frameworkID *mesos.FrameworkID
+	slaves      map[string]*slaveState
+	slaveOrder  []string
+	offers      map[string]*outstandingOffer
+	tasks       map[string]*taskState
+	random      *rand.Rand
+	events      *eventQueue
+	nextID      int
+	ticker      *time.Ticker
+	closing     chan struct{}
+	started     bool
+}
+
+// New creates a new simulated master with the provided config
+func New(config Config) *Master {
+	m := &Master{
+		config: config,
+		lock:   &sync.Mutex{},
+		slaves: make(map[string]*slaveState),
+		offers: make(map[string]*outstandingOffer),
+		tasks:  make(map[string]*taskState),
+		random: rand.New(rand.NewSource(config.Seed)),
+	}
+	for _, slave := range config.Slaves {
+		m.slaves[slave.ID] = &slaveState{Slave: slave, usedPorts: make(map[uint64]bool)}
+		m.slaveOrder = append(m.slaveOrder, slave.ID)
+	}
+	return m
+}
+
+// NewDriver registers the event handler of a framework and returns the master as its driver,
+// it has the same signature as driver.New so it can be used as a driver factory
+func (m *Master) NewDriver(master string, framework mesos.FrameworkInfo, handler driver.EventHandler) (driver.SchedulerDriver, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.handler = handler
+	m.frameworkID = framework.Id
+	if m.frameworkID == nil {
+		m.frameworkID = &mesos.FrameworkID{Value: proto.String("simulated-framework")}
+	}
+	return m, nil
+}
+
+// Start registers the framework and starts handing out offers
+func (m *Master) Start() error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if m.handler == nil {
+		return ErrNotStarted
+	}
+	if m.started {
+		return errors.New("the simulated master is already started")
+	}
+	m.started = true
+	m.closing = make(chan struct{})
+	m.events = newEventQueue()
+	go m.events.run()
+
+	fwID, handler := *m.frameworkID, m.handler
+	masterInfo := mesos.MasterInfo{
+		Id:       proto.String("simulated-master"),
+		Ip:       proto.Uint32(0x7f000001),
+		Port:     proto.Uint32(5050),
+		Hostname: proto.String("localhost"),
+	}
+	m.events.push(func() { handler.Registered(m, fwID, masterInfo) })
+
+	if m.config.OfferInterval > 0 {
+		m.ticker = time.NewTicker(m.config.OfferInterval)
+		go m.offerLoop(m.ticker, m.closing)
+	}
+	return nil
+}
+
+func (m *Master) offerLoop(ticker *time.Ticker, closing chan struct{}) {
+	for {
+		select {
+		case <-ticker.C:
+			m.Offer()
+		case <-closing:
+			return
+		}
+	}
+}
+
+// Stop stops handing out offers and delivering events,
+// when failover is false all the tasks are killed
+func (m *Master) Stop(failover bool) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if !m.started {
+		return nil
+	}
+	m.started = false
+	if m.ticker != nil {
+		m.ticker.Stop()
+	}
+	close(m.closing)
+	for _, task := range m.tasks {
+		task.stopTimers()
+		if !failover && !isTerminal(task.state) {
+			task.state = mesos.TaskState_TASK_KILLED
+			task.slave.release(task)
+		}
+	}
+	m.events.stop()
+	return nil
+}
+
+// Offer offers the free resources of every slave that doesn't have an outstanding offer
+func (m *Master) Offer() {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if !m.started {
+		return
+	}
+
+	var offers []mesos.Offer
+	for _, id := range m.slaveOrder {
+		slave := m.slaves[id]
+		if slave.offered || slave.lost {
+			continue
+		}
+		m.nextID++
+		offer := m.buildOffer(fmt.Sprintf("offer-%d", m.nextID), slave)
+		m.offers[offer.GetId().GetValue()] = &outstandingOffer{offer: offer, slave: slave}
+		slave.offered = true
+		offers = append(offers, offer)
+	}
+	if len(offers) > 0 {
+		handler := m.handler
+		m.events.push(func() { handler.ResourceOffers(m, offers) })
+	}
+}
+
+func (m *Master) buildOffer(id string, slave *slaveState) mesos.Offer {
+	var ranges []*mesos.Value_Range
+	for _, r := range slave.freePorts() {
+		ranges = append(ranges, &mesos.Value_Range{Begin: proto.Uint64(r.Begin), End: proto.Uint64(r.End)})
+	}
+
+	var attributes []*mesos.Attribute
+	var names []string
+	for name := range slave.Attributes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		attributes = append(attributes, &mesos.Attribute{
+			Name: proto.String(name),
+			Type: mesos.Value_TEXT.Enum(),
+			Text: &mesos.Value_Text{Value: proto.String(slave.Attributes[name])},
+		})
+	}
+
+	return mesos.Offer{
+		Id:          &mesos.OfferID{Value: proto.String(id)},
+		FrameworkId: m.frameworkID,
+		SlaveId:     &mesos.SlaveID{Value: proto.String(slave.ID)},
+		Hostname:    proto.String(slave.Hostname),
+		Resources: []*mesos.Resource{
+			mesos.ScalarResource("cpus", slave.Cpus-slave.usedCpus),
+			mesos.ScalarResource("mem", slave.Mem-slave.usedMem),
+			mesos.ScalarResource("disk", slave.Disk-slave.usedDisk),
+			&mesos.Resource{
+				Name:   proto.String("ports"),
+				Type:   mesos.Value_RANGES.Enum(),
+				Ranges: &mesos.Value_Ranges{Range: ranges},
+			},
+		},
+		Attributes: attributes,
+	}
+}
+
+// LaunchTasks launches the tasks with the resources of the offer,
+// tasks that don't fit in the offer or that use an unknown offer are lost
+func (m *Master) LaunchTasks(offerID *mesos.OfferID, tasks []mesos.TaskInfo) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if !m.started {
+		return ErrNotStarted
+	}
+
+	outstanding, ok := m.offers[offerID.GetValue()]
+	if !ok {
+		for _, info := range tasks {
+			m.sendStatus(info.GetTaskId(), nil, mesos.TaskState_TASK_LOST, "the offer "+offerID.GetValue()+" is unknown")
+		}
+		return nil
+	}
+	delete(m.offers, offerID.GetValue())
+	slave := outstanding.slave
+	slave.offered = false
+
+	for _, info := range tasks {
+		task := &taskState{info: info, slave: slave, state: mesos.TaskState_TASK_STAGING}
+		for _, resource := range info.GetResources() {
+			switch resource.GetName() {
+			case "cpus":
+				task.cpus += resource.GetScalar().GetValue()
+			case "mem":
+				task.mem += resource.GetScalar().GetValue()
+			case "disk":
+				task.disk += resource.GetScalar().GetValue()
+			case "ports":
+				for _, r := range resource.GetRanges().GetRange() {
+					for p := r.GetBegin(); p <= r.GetEnd(); p++ {
+						task.ports = append(task.ports, p)
+					}
+				}
+			}
+		}
+		if reason := slave.reserve(task); reason != "" {
+			log.Debug("Losing task %s, because %s", info.GetTaskId().GetValue(), reason)
+			m.sendStatus(info.GetTaskId(), info.GetSlaveId(), mesos.TaskState_TASK_LOST, reason)
+			continue
+		}
+		m.tasks[info.GetTaskId().GetValue()] = task
+		m.schedule(task)
+	}
+	return nil
+}
+
+// schedule plans the status transitions for a task that was just launched
+func (m *Master) schedule(task *taskState) {
+	if m.config.FailureRate > 0 && m.random.Float64() < m.config.FailureRate {
+		m.transition(task, Transition{State: mesos.TaskState_TASK_RUNNING})
+		m.transition(task, Transition{After: m.config.FailAfter, State: mesos.TaskState_TASK_FAILED, Message: "simulated failure"})
+		return
+	}
+
+	script := m.config.Script
+	if len(script) == 0 {
+		script = []Transition{{State: mesos.TaskState_TASK_RUNNING}}
+	}
+	var after time.Duration
+	for _, step := range script {
+		after += step.After
+		m.transition(task, Transition{After: after, State: step.State, Message: step.Message})
+	}
+}
+
+func (m *Master) transition(task *taskState, step Transition) {
+	taskID := task.info.GetTaskId().GetValue()
+	task.timers = append(task.timers, time.AfterFunc(step.After, func() {
+		m.Update(taskID, step.State, step.Message)
+	}))
+}
+
+// Update moves a task into the specified state and sends the status update for it,
+// this is how a test drives a task through its life cycle
+func (m *Master) Update(taskID string, state mesos.TaskState, message string) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if !m.started {
+		return ErrNotStarted
+	}
+	task, ok := m.tasks[taskID]
+	if !ok {
+		return fmt.Errorf("the task %s is unknown", taskID)
+	}
+	if isTerminal(task.state) {
+		return fmt.Errorf("the task %s already ended as %s", taskID, task.state)
+	}
+	if isTerminal(state) {
+		task.stopTimers()
+		m.finish(task, state, message)
+		return nil
+	}
+	task.state = state
+	m.sendStatus(task.info.GetTaskId(), task.info.GetSlaveId(), state, message)
+	return nil
+}
+
+func (m *Master) finish(task *taskState, state mesos.TaskState, message string) {
+	task.state = state
+	task.slave.release(task)
+	m.sendStatus(task.info.GetTaskId(), task.info.GetSlaveId(), state, message)
+}
+
+func (m *Master) sendStatus(taskID *mesos.TaskID, slaveID *mesos.SlaveID, state mesos.TaskState, message string) {
+	status := mesos.TaskStatus{
+		TaskId:  taskID,
+		State:   state.Enum(),
+		SlaveId: slaveID,
+	}
+	if message != "" {
+		status.Message = proto.String(message)
+	}
+	handler := m.handler
+	m.events.push(func() { handler.StatusUpdate(m, status) })
+}
+
+// DeclineOffer gives the resources of the offer back to the slave
+func (m *Master) DeclineOffer(offerID *mesos.OfferID) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if !m.started {
+		return ErrNotStarted
+	}
+	if outstanding, ok := m.offers[offerID.GetValue()]; ok {
+		outstanding.slave.offered = false
+		delete(m.offers, offerID.GetValue())
+	}
+	return nil
+}
+
+// KillTask kills a running task, a kill for an unknown task results in TASK_LOST
+func (m *Master) KillTask(taskID *mesos.TaskID) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if !m.started {
+		return ErrNotStarted
+	}
+	task, ok := m.tasks[taskID.GetValue()]
+	if !ok {
+		m.sendStatus(taskID, nil, mesos.TaskState_TASK_LOST, "the task is unknown")
+		return nil
+	}
+	if isTerminal(task.state) {
+		return nil
+	}
+	task.stopTimers()
+	m.finish(task, mesos.TaskState_TASK_KILLED, "killed by the framework")
+	return nil
+}
+
+// ReconcileTasks sends the latest status of the specified tasks, or of all the tasks when the list is empty.
+// Like a real master it answers staging for a task that is still being launched.
+func (m *Master) ReconcileTasks(statuses []mesos.TaskStatus) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if !m.started {
+		return ErrNotStarted
+	}
+	if len(statuses) == 0 {
+		for _, task := range m.tasks {
+			if !isTerminal(task.state) {
+				m.sendStatus(task.info.GetTaskId(), task.info.GetSlaveId(), task.state, "reconciliation")
+			}
+		}
+		return nil
+	}
+	for _, status := range statuses {
+		task, ok := m.tasks[status.GetTaskId().GetValue()]
+		if !ok {
+			m.sendStatus(status.GetTaskId(), status.GetSlaveId(), mesos.TaskState_TASK_LOST, "reconciliation: the task is unknown")
+			continue
+		}
+		m.sendStatus(task.info.GetTaskId(), task.info.GetSlaveId(), task.state, "reconciliation")
+	}
+	return nil
+}
+
+// LoseSlave simulates the loss of a slave, its tasks are lost and it doesn't receive offers anymore
+func (m *Master) LoseSlave(slaveID string) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if !m.started {
+		return ErrNotStarted
+	}
+	slave, ok := m.slaves[slaveID]
+	if !ok {
+		return fmt.Errorf("the slave %s is unknown", slaveID)
+	}
+	slave.lost = true
+	for id, offer := range m.offers {
+		if offer.slave == slave {
+			delete(m.offers, id)
+		}
+	}
+	for _, task := range m.tasks {
+		if task.slave == slave && !isTerminal(task.state) {
+			task.stopTimers()
+			task.state = mesos.TaskState_TASK_LOST
+			task.slave.release(task)
+		}
+	}
+	handler, id := m.handler, mesos.SlaveID{Value: proto.String(slaveID)}
+	m.events.push(func() { handler.SlaveLost(m, id) })
+	return nil
+}
+
+// TaskState returns the current state of a launched task
+func (m *Master) TaskState(taskID string) (mesos.TaskState, bool) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	task, ok := m.tasks[taskID]
+	if !ok {
+		return mesos.TaskState_TASK_LOST, false
+	}
+	return task.state, true
+}
+
+// Tasks returns the ids of the tasks that are running or about to run
+func (m *Master) Tasks() []string {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	var result []string
+	for id, task := range m.tasks {
+		if !isTerminal(task.state) {
+			result = append(result, id)
+		}
+	}
+	sort.Strings(result)
+	return result
+}
+
+// TasksOnSlave returns the ids of the tasks that are running or about to run on the specified slave
+func (m *Master) TasksOnSlave(slaveID string) []string {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	var result []string
+	for id, task := range m.tasks {
+		if task.slave.ID == slaveID && !isTerminal(task.state) {
+			result = append(result, id)
+		}
+	}
+	sort.Strings(result)
+	return result
+}
+
+func (t *taskState) stopTimers() {
+	for _, timer := range t.timers {
+		timer.Stop()
+	}
+	t.timers = nil
+}
+
+func (s *slaveState) reserve(task *taskState) string {
+	if s.lost {
+		return "the slave " + s.ID + " is lost"
+	}
+	if s.Cpus-s.usedCpus < task.cpus || s.Mem-s.usedMem < task.mem || s.Disk-s.usedDisk < task.disk {
+		return "the task doesn't fit in the resources of slave " + s.ID
+	}
+	for _, port := range task.ports {
+		if s.usedPorts[port] || !s.hasPort(port) {
+			return fmt.Sprintf("the port %d isn't available on slave %s", port, s.ID)
+		}
+	}
+	s.usedCpus += task.cpus
+	s.usedMem += task.mem
+	s.usedDisk += task.disk
+	for _, port := range task.ports {
+		s.usedPorts[port] = true
+	}
+	return ""
+}
+
+func (s *slaveState) release(task *taskState) {
+	s.usedCpus -= task.cpus
+	s.usedMem -= task.mem
+	s.usedDisk -= task.disk
+	for _, port := range task.ports {
+		delete(s.usedPorts, port)
+	}
+}
+
+func (s *slaveState) hasPort(port uint64) bool {
+	for _, r := range s.Ports {
+		if port >= r.Begin && port <= r.End {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *slaveState) freePorts() []PortRange {
+	var result []PortRange
+	for _, r := range s.Ports {
+		begin := r.Begin
+		for p := r.Begin; p <= r.End; p++ {
+			if s.usedPorts[p] {
+				if p > begin {
+					result = append(result, PortRange{Begin: begin, End: p - 1})
+				}
+				begin = p + 1
+			}
+		}
+		if begin <= r.End {
+			result = append(result, PortRange{Begin: begin, End: r.End})
+		}
+	}
+	return result
+}
+
+func isTerminal(state mesos.TaskState) bool {
+	return state == mesos.TaskState_TASK_FINISHED ||
+		state == mesos.TaskState_TASK_FAILED ||
+		state == mesos.TaskState_TASK_KILLED ||
+		state == mesos.TaskState_TASK_LOST
+}
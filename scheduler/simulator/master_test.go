@@ -0,0 +1,221 @@
+package simulator
+
+import (
+	"testing"
+	"time"
+
+	"code.google.com/p/goprotobuf/proto"
+	"github.com/reverb/exeggutor/scheduler/driver"
+	"github.com/reverb/go-mesos/mesos"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+type recordingHandler struct {
+	registered chan mesos.FrameworkID
+	offers     chan []mesos.Offer
+	updates    chan mesos.TaskStatus
+	lost       chan mesos.SlaveID
+}
+
+func newRecordingHandler() *recordingHandler {
+	return &recordingHandler{
+		registered: make(chan mesos.FrameworkID, 10),
+		offers:     make(chan []mesos.Offer, 10),
+		updates:    make(chan mesos.TaskStatus, 10),
+		lost:       make(chan mesos.SlaveID, 10),
+	}
+}
+
+func (h *recordingHandler) Registered(d driver.SchedulerDriver, fwID mesos.FrameworkID, masterInfo mesos.MasterInfo) {
+	h.registered <- fwID
+}
+func (h *recordingHandler) Reregistered(d driver.SchedulerDriver, masterInfo mesos.MasterInfo) {}
+func (h *recordingHandler) Disconnected(d driver.SchedulerDriver)                              {}
+func (h *recordingHandler) ResourceOffers(d driver.SchedulerDriver, offers []mesos.Offer) {
+	h.offers <- offers
+}
+func (h *recordingHandler) OfferRescinded(d driver.SchedulerDriver, offerID mesos.OfferID) {}
+func (h *recordingHandler) StatusUpdate(d driver.SchedulerDriver, status mesos.TaskStatus) {
+	h.updates <- status
+}
+func (h *recordingHandler) FrameworkMessage(d driver.SchedulerDriver, executorID mesos.ExecutorID, slaveID mesos.SlaveID, data string) {
+}
+func (h *recordingHandler) SlaveLost(d driver.SchedulerDriver, slaveID mesos.SlaveID) {
+	h.lost <- slaveID
+}
+func (h *recordingHandler) ExecutorLost(d driver.SchedulerDriver, executorID mesos.ExecutorID, slaveID mesos.SlaveID, status int) {
+}
+func (h *recordingHandler) Error(d driver.SchedulerDriver, message string) {}
+
+func nextUpdate(h *recordingHandler) mesos.TaskStatus {
+	select {
+	case status := <-h.updates:
+		return status
+	case <-time.After(2 * time.Second):
+		return mesos.TaskStatus{}
+	}
+}
+
+func nextOffers(h *recordingHandler) []mesos.Offer {
+	select {
+	case offers := <-h.offers:
+		return offers
+	case <-time.After(2 * time.Second):
+		return nil
+	}
+}
+
+func scalar(offer mesos.Offer, name string) float64 {
+	for _, r := range offer.GetResources() {
+		if r.GetName() == name {
+			return r.GetScalar().GetValue()
+		}
+	}
+	return 0
+}
+
+func taskInfo(id string, offer mesos.Offer, cpus, mem float64, port uint64) mesos.TaskInfo {
+	return mesos.TaskInfo{
+		Name:    proto.String(id),
+		TaskId:  &mesos.TaskID{Value: proto.String(id)},
+		SlaveId: offer.GetSlaveId(),
+		Resources: []*mesos.Resource{
+			mesos.ScalarResource("cpus", cpus),
+			mesos.ScalarResource("mem", mem),
+			&mesos.Resource{
+				Name: proto.String("ports"),
+				Type: mesos.Value_RANGES.Enum(),
+				Ranges: &mesos.Value_Ranges{Range: []*mesos.Value_Range{
+					{Begin: proto.Uint64(port), End: proto.Uint64(port)},
+				}},
+			},
+		},
+	}
+}
+
+func TestSimulatedMaster(t *testing.T) {
+	slave := Slave{
+		ID:         "slave-1",
+		Hostname:   "slave-1.local",
+		Cpus:       2,
+		Mem:        512,
+		Ports:      []PortRange{{Begin: 31000, End: 31009}},
+		Attributes: map[string]string{"rack": "r1"},
+	}
+
+	Convey("A simulated master", t, func() {
+		handler := newRecordingHandler()
+		master := New(Config{Slaves: []Slave{slave}})
+		d, _ := master.NewDriver("simulated", mesos.FrameworkInfo{}, handler)
+		So(d.Start(), ShouldBeNil)
+		So((<-handler.registered).GetValue(), ShouldEqual, "simulated-framework")
+
+		Reset(func() {
+			d.Stop(false)
+		})
+
+		Convey("should offer the resources and attributes of its slaves", func() {
+			master.Offer()
+			offers := nextOffers(handler)
+			So(offers, ShouldHaveLength, 1)
+			So(offers[0].GetHostname(), ShouldEqual, "slave-1.local")
+			So(scalar(offers[0], "cpus"), ShouldEqual, 2)
+			So(scalar(offers[0], "mem"), ShouldEqual, 512)
+			So(offers[0].GetAttributes()[0].GetText().GetValue(), ShouldEqual, "r1")
+
+			Convey("and not offer a slave again while its offer is outstanding", func() {
+				master.Offer()
+				So(master.DeclineOffer(offers[0].GetId()), ShouldBeNil)
+				master.Offer()
+				So(nextOffers(handler), ShouldHaveLength, 1)
+			})
+		})
+
+		Convey("should run a launched task and offer what's left", func() {
+			master.Offer()
+			offer := nextOffers(handler)[0]
+			So(master.LaunchTasks(offer.GetId(), []mesos.TaskInfo{taskInfo("task-1", offer, 1, 256, 31000)}), ShouldBeNil)
+
+			status := nextUpdate(handler)
+			So(status.GetTaskId().GetValue(), ShouldEqual, "task-1")
+			So(status.GetState(), ShouldEqual, mesos.TaskState_TASK_RUNNING)
+			So(master.Tasks(), ShouldResemble, []string{"task-1"})
+
+			master.Offer()
+			left := nextOffers(handler)[0]
+			So(scalar(left, "cpus"), ShouldEqual, 1)
+			So(scalar(left, "mem"), ShouldEqual, 256)
+			So(left.GetResources()[3].GetRanges().GetRange()[0].GetBegin(), ShouldEqual, 31001)
+
+			Convey("and kill it", func() {
+				So(master.KillTask(&mesos.TaskID{Value: proto.String("task-1")}), ShouldBeNil)
+				So(nextUpdate(handler).GetState(), ShouldEqual, mesos.TaskState_TASK_KILLED)
+				So(master.Tasks(), ShouldBeEmpty)
+			})
+
+			Convey("and lose it with its slave", func() {
+				So(master.LoseSlave("slave-1"), ShouldBeNil)
+				So((<-handler.lost).GetValue(), ShouldEqual, "slave-1")
+				So(master.Tasks(), ShouldBeEmpty)
+			})
+
+			Convey("and report it when reconciling", func() {
+				So(master.ReconcileTasks(nil), ShouldBeNil)
+				status := nextUpdate(handler)
+				So(status.GetTaskId().GetValue(), ShouldEqual, "task-1")
+				So(status.GetState(), ShouldEqual, mesos.TaskState_TASK_RUNNING)
+			})
+		})
+
+		Convey("should lose tasks that don't fit in the offer", func() {
+			master.Offer()
+			offer := nextOffers(handler)[0]
+			master.LaunchTasks(offer.GetId(), []mesos.TaskInfo{taskInfo("too-big", offer, 4, 256, 31000)})
+			status := nextUpdate(handler)
+			So(status.GetState(), ShouldEqual, mesos.TaskState_TASK_LOST)
+			So(master.Tasks(), ShouldBeEmpty)
+		})
+
+		Convey("should lose tasks launched with an unknown offer", func() {
+			offer := mesos.Offer{Id: &mesos.OfferID{Value: proto.String("unknown")}, SlaveId: &mesos.SlaveID{Value: proto.String("slave-1")}}
+			master.LaunchTasks(offer.GetId(), []mesos.TaskInfo{taskInfo("task-1", offer, 1, 256, 31000)})
+			So(nextUpdate(handler).GetState(), ShouldEqual, mesos.TaskState_TASK_LOST)
+		})
+	})
+
+	Convey("A simulated master with slow launches", t, func() {
+		handler := newRecordingHandler()
+		master := New(Config{
+			Slaves: []Slave{slave},
+			Script: []Transition{{After: time.Minute, State: mesos.TaskState_TASK_RUNNING}},
+		})
+		d, _ := master.NewDriver("simulated", mesos.FrameworkInfo{}, handler)
+		So(d.Start(), ShouldBeNil)
+		<-handler.registered
+
+		Reset(func() {
+			d.Stop(false)
+		})
+
+		master.Offer()
+		offer := nextOffers(handler)[0]
+		So(master.LaunchTasks(offer.GetId(), []mesos.TaskInfo{taskInfo("task-1", offer, 1, 256, 31000)}), ShouldBeNil)
+
+		Convey("should report a task that is still staging as staging when reconciling it", func() {
+			So(master.ReconcileTasks([]mesos.TaskStatus{{TaskId: &mesos.TaskID{Value: proto.String("task-1")}}}), ShouldBeNil)
+			status := nextUpdate(handler)
+			So(status.GetTaskId().GetValue(), ShouldEqual, "task-1")
+			So(status.GetState(), ShouldEqual, mesos.TaskState_TASK_STAGING)
+		})
+
+		Convey("should report a task that is still staging when reconciling all the tasks", func() {
+			So(master.ReconcileTasks(nil), ShouldBeNil)
+			So(nextUpdate(handler).GetState(), ShouldEqual, mesos.TaskState_TASK_STAGING)
+		})
+
+		Convey("should report an unknown task as lost when reconciling it", func() {
+			So(master.ReconcileTasks([]mesos.TaskStatus{{TaskId: &mesos.TaskID{Value: proto.String("task-2")}}}), ShouldBeNil)
+			So(nextUpdate(handler).GetState(), ShouldEqual, mesos.TaskState_TASK_LOST)
+		})
+	})
+}
@@ -0,0 +1,48 @@
+package state
+
+import (
+	"sync"
+
+	"github.com/reverb/go-mesos/mesos"
+)
+
+// InMemoryFrameworkIDState keeps the framework id in memory,
+// it's meant for tests and for running without zookeeper
+type InMemoryFrameworkIDState struct {
+	current *mesos.FrameworkID
+	lock    *sync.Mutex
+}
+
+// NewInMemoryFrameworkIDState creates a new instance of an in memory FrameworkIDState
+func NewInMemoryFrameworkIDState() FrameworkIDState {
+	return &InMemoryFrameworkIDState{lock: new(sync.Mutex)}
+}
+
+// Path returns an empty string, there is no backing medium
+func (f *InMemoryFrameworkIDState) Path() string {
+	return ""
+}
+
+// Get gets the current framework id
+func (f *InMemoryFrameworkIDState) Get() *mesos.FrameworkID {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return f.current
+}
+
+// Set sets the framework id to a new value
+func (f *InMemoryFrameworkIDState) Set(fwID *mesos.FrameworkID) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.current = fwID
+}
+
+// Start starts the framework id state service
+func (f *InMemoryFrameworkIDState) Start(buildInitial bool) error {
+	return nil
+}
+
+// Stop stops the framework id state service
+func (f *InMemoryFrameworkIDState) Stop() error {
+	return nil
+}
@@ -0,0 +1,272 @@
+package state
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/reverb/go-utils/rvb_zk"
+	"github.com/samuel/go-zookeeper/zk"
+)
+
+const latchPrefix = "latch-"
+
+// leaderCheckInterval how often the leader makes sure it's still connected to zookeeper
+const leaderCheckInterval = 2 * time.Second
+
+// LeaderLatch elects a single leader among all the processes that
+// participate in an election at the same path in zookeeper.
+// Every participant creates an ephemeral sequential node, the participant with the
+// lowest sequence number is the leader. The other participants watch their predecessor
+// so that a standby takes over as soon as the leader's session expires.
+// The leader gives up its leadership as soon as it loses its session or can't reach zookeeper,
+// because a standby might take over once the session expires.
+type LeaderLatch struct {
+	curator       *rvb_zk.Curator
+	path          string
+	id            string
+	node          string
+	isLeader      bool
+	lock          *sync.Mutex
+	elections     chan bool
+	closing       chan chan error
+	checkInterval time.Duration
+}
+
+// NewLeaderLatch creates a new leader latch at the specified path,
+// the id is stored in the participant's node so other participants can find the leader.
+func NewLeaderLatch(path, id string, curator *rvb_zk.Curator) *LeaderLatch {
+	return &LeaderLatch{
+		curator:       curator,
+		path:          path,
+		id:            id,
+		lock:          &sync.Mutex{},
+		elections:     make(chan bool, 1),
+		closing:       make(chan chan error),
+		checkInterval: leaderCheckInterval,
+	}
+}
+
+// Path the path in zookeeper where the election takes place
+func (l *LeaderLatch) Path() string {
+	return l.path
+}
+
+// Start joins the election
+func (l *LeaderLatch) Start() error {
+	err := l.curator.CreatePathRecursively(l.path, []byte{}, 0, zk.WorldACL(zk.PermAll))
+	if err != nil && err != zk.ErrNodeExists {
+		log.Critical("Couldn't create the leader election path %s, because %v", l.path, err)
+		return err
+	}
+	if err := l.join(); err != nil {
+		return err
+	}
+	go l.electionLoop()
+	return nil
+}
+
+func (l *LeaderLatch) join() error {
+	node, err := l.curator.Create(l.path+"/"+latchPrefix, []byte(l.id), zk.FlagEphemeral|zk.FlagSequence, zk.WorldACL(zk.PermAll))
+	if err != nil {
+		log.Critical("Couldn't join the leader election at %s, because %v", l.path, err)
+		return err
+	}
+	log.Info("Joined the leader election at %s as %s", l.path, node)
+	l.lock.Lock()
+	l.node = node
+	l.lock.Unlock()
+	return nil
+}
+
+// Stop leaves the election, giving up leadership if this participant was the leader
+func (l *LeaderLatch) Stop() error {
+	errc := make(chan error)
+	l.closing <- errc
+	return <-errc
+}
+
+// Elected returns a channel that receives true when this participant becomes the leader
+// and false when it lost its leadership.
+func (l *LeaderLatch) Elected() <-chan bool {
+	return l.elections
+}
+
+// IsLeader returns true when this participant currently is the leader
+func (l *LeaderLatch) IsLeader() bool {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	return l.isLeader
+}
+
+// Leader returns the id of the current leader
+func (l *LeaderLatch) Leader() (string, error) {
+	participants, err := l.participants()
+	if err != nil {
+		return "", err
+	}
+	if len(participants) == 0 {
+		return "", nil
+	}
+	data, _, err := l.curator.Get(l.path + "/" + participants[0])
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// participants returns the nodes of all the participants ordered by their sequence number
+func (l *LeaderLatch) participants() ([]string, error) {
+	children, _, err := l.curator.Children(l.path)
+	if err != nil {
+		return nil, err
+	}
+	var participants []string
+	for _, child := range children {
+		if strings.HasPrefix(child, latchPrefix) {
+			participants = append(participants, child)
+		}
+	}
+	sort.Strings(participants)
+	return participants, nil
+}
+
+func (l *LeaderLatch) ownName() string {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	return l.node[strings.LastIndex(l.node, "/")+1:]
+}
+
+func (l *LeaderLatch) setLeader(leader bool) {
+	l.lock.Lock()
+	changed := l.isLeader != leader
+	l.isLeader = leader
+	l.lock.Unlock()
+	if changed {
+		l.elections <- leader
+	}
+}
+
+// watchTarget finds the node this participant needs to watch.
+// The leader watches its own node, everybody else watches their predecessor.
+func (l *LeaderLatch) watchTarget() (string, bool, error) {
+	participants, err := l.participants()
+	if err != nil {
+		return "", false, err
+	}
+	own := l.ownName()
+	for i, participant := range participants {
+		if participant == own {
+			if i == 0 {
+				return participant, true, nil
+			}
+			return participants[i-1], false, nil
+		}
+	}
+	return "", false, zk.ErrNoNode
+}
+
+// lostSession returns true for the events a watch receives when the connection to zookeeper
+// dropped or the session expired, the ephemeral node might be gone or about to go
+func (l *LeaderLatch) lostSession(evt zk.Event) bool {
+	return evt.Type == zk.EventNotWatching ||
+		evt.State == zk.StateDisconnected ||
+		evt.State == zk.StateExpired
+}
+
+// connected checks that the node of this participant is still there,
+// a request that doesn't get an answer within the check interval counts as disconnected
+func (l *LeaderLatch) connected() bool {
+	l.lock.Lock()
+	node := l.node
+	l.lock.Unlock()
+
+	done := make(chan error, 1)
+	go func() {
+		_, _, err := l.curator.Get(node)
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			log.Warning("Couldn't find our node %s, because %v", node, err)
+		}
+		return err == nil
+	case <-time.After(l.checkInterval):
+		log.Warning("Zookeeper didn't answer within %v", l.checkInterval)
+		return false
+	}
+}
+
+func (l *LeaderLatch) electionLoop() {
+	var watch <-chan zk.Event
+	var leader bool
+	for {
+		if watch == nil {
+			var target string
+			var err error
+			target, leader, err = l.watchTarget()
+			switch {
+			case err == zk.ErrNoNode:
+				// our node is gone, this happens when our session expired
+				l.setLeader(false)
+				if err := l.join(); err != nil {
+					log.Critical("Couldn't rejoin the leader election, because %v", err)
+				}
+			case err != nil:
+				// without zookeeper we can't know whether somebody else took over
+				log.Warning("Couldn't determine the leader at %s, because %v", l.path, err)
+				l.setLeader(false)
+			default:
+				exists, _, w, err2 := l.curator.ExistsW(l.path + "/" + target)
+				if err2 != nil {
+					log.Warning("Couldn't watch %s, because %v", target, err2)
+				} else if exists {
+					watch = w
+					l.setLeader(leader)
+				}
+			}
+		}
+
+		// the leader keeps checking its connection, a watch doesn't fire while it's disconnected
+		var retry, check <-chan time.Time
+		if watch == nil {
+			retry = time.After(1 * time.Second)
+		} else if leader {
+			check = time.After(l.checkInterval)
+		}
+
+		select {
+		case evt := <-watch:
+			log.Debug("Leader election at %s received %+v", l.path, evt)
+			watch = nil
+			if l.lostSession(evt) {
+				log.Warning("Lost the zookeeper session of the leader election at %s", l.path)
+				l.setLeader(false)
+			} else if leader && evt.Type == zk.EventNodeDeleted {
+				log.Warning("Lost leadership at %s", l.path)
+				l.setLeader(false)
+			}
+		case <-check:
+			if !l.connected() {
+				log.Warning("Lost the connection to zookeeper, giving up the leadership at %s", l.path)
+				l.setLeader(false)
+				watch = nil
+			}
+		case <-retry:
+		case errc := <-l.closing:
+			l.lock.Lock()
+			node := l.node
+			l.isLeader = false
+			l.lock.Unlock()
+			err := l.curator.Delete(node, -1)
+			if err == zk.ErrNoNode {
+				err = nil
+			}
+			close(l.elections)
+			errc <- err
+			return
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package state
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/reverb/go-utils/rvb_zk"
+	"github.com/samuel/go-zookeeper/zk"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestLeaderLatch(t *testing.T) {
+
+	Convey("LeaderLatch", t, func() {
+		zkCluster, err := zk.StartTestCluster(1)
+		So(err, ShouldBeNil)
+
+		c, err := zkCluster.ConnectAll()
+		So(err, ShouldBeNil)
+		curator := rvb_zk.NewCurator(c, fmt.Sprintf("%d", time.Now().UnixNano()))
+
+		Reset(func() {
+			curator.Close()
+			zkCluster.Stop()
+		})
+
+		Convey("should elect the first participant", func() {
+			latch := NewLeaderLatch("/golangstate/leader-1", "host-1:8000", curator)
+			So(latch.Start(), ShouldBeNil)
+			defer latch.Stop()
+
+			So(<-latch.Elected(), ShouldBeTrue)
+			So(latch.IsLeader(), ShouldBeTrue)
+			leader, err := latch.Leader()
+			So(err, ShouldBeNil)
+			So(leader, ShouldEqual, "host-1:8000")
+		})
+
+		Convey("should let a standby take over when the leader leaves", func() {
+			first := NewLeaderLatch("/golangstate/leader-2", "host-1:8000", curator)
+			second := NewLeaderLatch("/golangstate/leader-2", "host-2:8000", curator)
+			So(first.Start(), ShouldBeNil)
+			So(<-first.Elected(), ShouldBeTrue)
+			So(second.Start(), ShouldBeNil)
+			defer second.Stop()
+
+			So(second.IsLeader(), ShouldBeFalse)
+			leader, _ := second.Leader()
+			So(leader, ShouldEqual, "host-1:8000")
+
+			So(first.Stop(), ShouldBeNil)
+			So(<-second.Elected(), ShouldBeTrue)
+			leader, _ = second.Leader()
+			So(leader, ShouldEqual, "host-2:8000")
+		})
+
+		Convey("should treat a dropped connection or an expired session as a lost session", func() {
+			latch := NewLeaderLatch("/golangstate/leader-3", "host-1:8000", curator)
+			So(latch.lostSession(zk.Event{Type: zk.EventNotWatching, State: zk.StateDisconnected}), ShouldBeTrue)
+			So(latch.lostSession(zk.Event{Type: zk.EventSession, State: zk.StateExpired}), ShouldBeTrue)
+			So(latch.lostSession(zk.Event{Type: zk.EventSession, State: zk.StateDisconnected}), ShouldBeTrue)
+			So(latch.lostSession(zk.Event{Type: zk.EventNodeDeleted, State: zk.StateHasSession}), ShouldBeFalse)
+		})
+	})
+}
@@ -0,0 +1,78 @@
+package state
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/reverb/go-utils/rvb_zk"
+	"github.com/samuel/go-zookeeper/zk"
+)
+
+// storageFile the file in the data directory with the id of the storage
+const storageFile = "storage-id"
+
+// VerifySharedStorage makes sure all the participants of a leader election use the same data directory.
+// The stores live in the data directory, so a standby only finds the apps, deployments and
+// queued items of the previous leader when that directory is on storage they all share.
+// The first participant writes a random id to its data directory and to zookeeper at the path,
+// every other participant needs to find the same id in its data directory.
+func VerifySharedStorage(path, dataDir string, curator *rvb_zk.Curator) error {
+	local, err := ioutil.ReadFile(filepath.Join(dataDir, storageFile))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	shared, _, err := curator.Get(path)
+	if err == zk.ErrNoNode {
+		return claimStorage(path, dataDir, local, curator)
+	}
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(bytes.TrimSpace(local), shared) {
+		return fmt.Errorf("the data directory %s isn't the storage the other agora processes share, it should contain the %s file with %s", dataDir, storageFile, shared)
+	}
+	log.Info("The data directory %s is the shared storage %s", dataDir, shared)
+	return nil
+}
+
+// claimStorage registers the data directory as the shared storage of the election
+func claimStorage(path, dataDir string, local []byte, curator *rvb_zk.Curator) error {
+	id := bytes.TrimSpace(local)
+	if len(id) == 0 {
+		random := make([]byte, 16)
+		if _, err := rand.Read(random); err != nil {
+			return err
+		}
+		id = []byte(hex.EncodeToString(random))
+		if err := os.MkdirAll(dataDir, 0755); err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(filepath.Join(dataDir, storageFile), id, 0644); err != nil {
+			return err
+		}
+	}
+
+	if parent := path[:strings.LastIndex(path, "/")]; parent != "" {
+		err := curator.CreatePathRecursively(parent, []byte{}, 0, zk.WorldACL(zk.PermAll))
+		if err != nil && err != zk.ErrNodeExists {
+			return err
+		}
+	}
+	_, err := curator.Create(path, id, 0, zk.WorldACL(zk.PermAll))
+	if err == zk.ErrNodeExists {
+		// another participant claimed it first, its data directory should be ours too
+		return VerifySharedStorage(path, dataDir, curator)
+	}
+	if err != nil {
+		return err
+	}
+	log.Notice("Claimed the data directory %s as the shared storage %s", dataDir, id)
+	return nil
+}
@@ -0,0 +1,58 @@
+package state
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/reverb/go-utils/rvb_zk"
+	"github.com/samuel/go-zookeeper/zk"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestSharedStorage(t *testing.T) {
+
+	Convey("Verifying the shared storage", t, func() {
+		zkCluster, err := zk.StartTestCluster(1)
+		So(err, ShouldBeNil)
+
+		c, err := zkCluster.ConnectAll()
+		So(err, ShouldBeNil)
+		curator := rvb_zk.NewCurator(c, fmt.Sprintf("%d", time.Now().UnixNano()))
+
+		shared, err := ioutil.TempDir("", "agora-shared-data")
+		So(err, ShouldBeNil)
+		local, err := ioutil.TempDir("", "agora-local-data")
+		So(err, ShouldBeNil)
+
+		Reset(func() {
+			os.RemoveAll(shared)
+			os.RemoveAll(local)
+			curator.Close()
+			zkCluster.Stop()
+		})
+
+		Convey("should claim the data directory of the first participant", func() {
+			So(VerifySharedStorage("/golangstate/storage-1", shared, curator), ShouldBeNil)
+
+			id, err := ioutil.ReadFile(filepath.Join(shared, storageFile))
+			So(err, ShouldBeNil)
+			data, _, err := curator.Get("/golangstate/storage-1")
+			So(err, ShouldBeNil)
+			So(string(data), ShouldEqual, string(id))
+		})
+
+		Convey("should accept a participant that uses the same data directory", func() {
+			So(VerifySharedStorage("/golangstate/storage-2", shared, curator), ShouldBeNil)
+			So(VerifySharedStorage("/golangstate/storage-2", shared, curator), ShouldBeNil)
+		})
+
+		Convey("should refuse a participant with a data directory of its own", func() {
+			So(VerifySharedStorage("/golangstate/storage-3", shared, curator), ShouldBeNil)
+			So(VerifySharedStorage("/golangstate/storage-3", local, curator), ShouldNotBeNil)
+		})
+	})
+}
@@ -18,6 +18,7 @@ type AppStore interface {
 	exeggutor.Module
 	Get(key string) (*protocol.Application, error)
 	Save(value *protocol.Application) error
+	SaveAs(value *protocol.Application, author string) error
 	Delete(key string) error
 	Size() (int, error)
 	Keys() ([]string, error)
@@ -25,11 +26,18 @@ type AppStore interface {
 	Filter(predicate func(*protocol.Application) bool) ([]*protocol.Application, error)
 	Find(predicate func(*protocol.Application) bool) (*protocol.Application, error)
 	Contains(key string) (bool, error)
+	Revisions(appName, component string) ([]*protocol.ApplicationRevision, error)
+	Revision(appName, component string, revision int32) (*protocol.ApplicationRevision, error)
+	Quotas() QuotaStore
 }
 
-// DefaultAppStore the default implementation of the app store
+// DefaultAppStore the default implementation of the app store.
+// Every manifest it saves is also kept as a revision,
+// the resource quotas of the apps are stored alongside them.
 type DefaultAppStore struct {
-	store store.KVStore
+	store     store.KVStore
+	revisions RevisionStore
+	quotas    QuotaStore
 }
 
 // New creates a new instance of the default app store
@@ -38,23 +46,58 @@ func New(config *exeggutor.Config) (AppStore, error) {
 	if err != nil {
 		return nil, err
 	}
-	return &DefaultAppStore{store: store}, nil
+	revisions, err := NewRevisionStore(config)
+	if err != nil {
+		return nil, err
+	}
+	quotas, err := NewQuotaStore(config)
+	if err != nil {
+		return nil, err
+	}
+	return &DefaultAppStore{store: store, revisions: revisions, quotas: quotas}, nil
 }
 
 // NewWithStore creates a new instance of this appp store backed
-// by the specified store
-func NewWithStore(store store.KVStore) AppStore {
-	return &DefaultAppStore{store: store}
+// by the specified store, the revisions and quotas are kept in memory
+func NewWithStore(backing store.KVStore) AppStore {
+	return NewWithStores(
+		backing,
+		NewRevisionStoreWithStore(store.NewEmptyInMemoryStore()),
+		NewQuotaStoreWithStore(store.NewEmptyInMemoryStore()))
+}
+
+// NewWithStores creates a new instance of this app store backed
+// by the specified store, revision store and quota store
+func NewWithStores(store store.KVStore, revisions RevisionStore, quotas QuotaStore) AppStore {
+	return &DefaultAppStore{store: store, revisions: revisions, quotas: quotas}
 }
 
 // Start starts this appstore
 func (a *DefaultAppStore) Start() error {
-	return a.store.Start()
+	if err := a.store.Start(); err != nil {
+		return err
+	}
+	if err := a.revisions.Start(); err != nil {
+		return err
+	}
+	return a.quotas.Start()
 }
 
 // Stop stops this app store
 func (a *DefaultAppStore) Stop() error {
-	return a.store.Stop()
+	err := a.store.Stop()
+	if err2 := a.revisions.Stop(); err == nil {
+		err = err2
+	}
+	if err3 := a.quotas.Stop(); err == nil {
+		err = err3
+	}
+	return err
+}
+
+// Quotas returns the store with the resource quotas of the apps
+func (a *DefaultAppStore) Quotas() QuotaStore {
+	return a.quotas
 }
 
 // Get gets the application for that key from the store if it exists
@@ -74,13 +117,51 @@ func (a *DefaultAppStore) Get(key string) (*protocol.Application, error) {
 
 // Save saves this application to the store
 func (a *DefaultAppStore) Save(value *protocol.Application) error {
+	return a.SaveAs(value, "")
+}
+
+// SaveAs saves this application to the store and records it as a revision by the author
+func (a *DefaultAppStore) SaveAs(value *protocol.Application, author string) error {
 	log.Debug("Saving %+v to the task store", value)
 	ser, err := writeBytes(value)
 	if err != nil {
 		log.Error("Couldn't serialize deployed app component %+v, because %+v", value, err)
 		return err
 	}
-	return a.store.Set(value.GetId(), ser)
+	previous, err := a.Get(value.GetId())
+	if err != nil {
+		return err
+	}
+	if err := a.store.Set(value.GetId(), ser); err != nil {
+		return err
+	}
+	if previous != nil && previous.GetActive() != value.GetActive() && sameManifest(previous, value) {
+		// (de)activating a version doesn't change its manifest, so it isn't a new revision of the component
+		return nil
+	}
+	if _, err := a.revisions.Record(value, author); err != nil {
+		log.Warning("Couldn't record a revision of %s, because %v", value.GetId(), err)
+		a.restore(value.GetId(), previous)
+		return err
+	}
+	return nil
+}
+
+// restore puts back the app that was stored before a save that couldn't be recorded,
+// so the app store never holds a manifest without a revision
+func (a *DefaultAppStore) restore(key string, previous *protocol.Application) {
+	var err error
+	if previous == nil {
+		err = a.store.Delete(key)
+	} else {
+		var ser []byte
+		if ser, err = writeBytes(previous); err == nil {
+			err = a.store.Set(key, ser)
+		}
+	}
+	if err != nil {
+		log.Error("Couldn't restore %s after failing to record its revision, because %v", key, err)
+	}
 }
 
 // Delete removes the specified app component from the store
@@ -154,6 +235,16 @@ func (a *DefaultAppStore) Contains(key string) (bool, error) {
 	return a.store.Contains(key)
 }
 
+// Revisions returns the saved revisions of a component, oldest first
+func (a *DefaultAppStore) Revisions(appName, component string) ([]*protocol.ApplicationRevision, error) {
+	return a.revisions.List(appName, component)
+}
+
+// Revision returns a single revision of a component, nil when it doesn't exist
+func (a *DefaultAppStore) Revision(appName, component string, revision int32) (*protocol.ApplicationRevision, error) {
+	return a.revisions.Get(appName, component, revision)
+}
+
 func readBytes(data []byte) (*protocol.Application, error) {
 	deploy := &protocol.Application{}
 	err := proto.Unmarshal(data, deploy)
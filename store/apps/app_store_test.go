@@ -2,6 +2,7 @@
 package apps
 
 import (
+	"errors"
 	"testing"
 
 	"code.google.com/p/goprotobuf/proto"
@@ -34,7 +35,11 @@ func TestAppStore(t *testing.T) {
 		builder := builders.New(context.Config)
 
 		backing := store.NewEmptyInMemoryStore()
-		appStore := &DefaultAppStore{store: backing}
+		appStore := &DefaultAppStore{
+			store:     backing,
+			revisions: NewRevisionStoreWithStore(store.NewEmptyInMemoryStore()),
+			quotas:    NewQuotaStoreWithStore(store.NewEmptyInMemoryStore()),
+		}
 		err := appStore.Start()
 		So(err, ShouldBeNil)
 
@@ -116,6 +121,103 @@ func TestAppStore(t *testing.T) {
 			So(err, ShouldBeNil)
 			So(actual, ShouldResemble, &expected)
 		})
+
+		Convey("when keeping revisions", func() {
+			app := CreateAppStoreTestData(backing, builder)
+			So(appStore.SaveAs(&app, "alice"), ShouldBeNil)
+
+			Convey("should record every saved manifest", func() {
+				app.Mem = proto.Float32(128)
+				So(appStore.SaveAs(&app, "bob"), ShouldBeNil)
+
+				revisions, err := appStore.Revisions(app.GetAppName(), app.GetName())
+				So(err, ShouldBeNil)
+				So(revisions, ShouldHaveLength, 2)
+				So(revisions[0].GetRevision(), ShouldEqual, 1)
+				So(revisions[0].GetAuthor(), ShouldEqual, "alice")
+				So(revisions[0].GetApp().GetMem(), ShouldEqual, 64)
+				So(revisions[1].GetRevision(), ShouldEqual, 2)
+				So(revisions[1].GetAuthor(), ShouldEqual, "bob")
+				So(revisions[1].GetApp().GetMem(), ShouldEqual, 128)
+			})
+
+			Convey("should not record a new revision when only the active flag changed", func() {
+				app.Active = proto.Bool(false)
+				So(appStore.Save(&app), ShouldBeNil)
+
+				revisions, _ := appStore.Revisions(app.GetAppName(), app.GetName())
+				So(revisions, ShouldHaveLength, 1)
+			})
+
+			Convey("should not record a revision when another version of the component is deactivated", func() {
+				next := app
+				next.Id = proto.String(app.GetAppName() + "-" + app.GetName() + "-next")
+				next.Version = proto.String("next")
+				So(appStore.SaveAs(&next, "bob"), ShouldBeNil)
+
+				app.Active = proto.Bool(false)
+				So(appStore.SaveAs(&app, "bob"), ShouldBeNil)
+
+				revisions, _ := appStore.Revisions(app.GetAppName(), app.GetName())
+				So(revisions, ShouldHaveLength, 2)
+				So(revisions[1].GetApp().GetVersion(), ShouldEqual, "next")
+			})
+
+			Convey("should keep counting the revisions of a component that has no latest revision key", func() {
+				So(appStore.revisions.(*DefaultRevisionStore).store.Delete(latestKey(app.GetAppName(), app.GetName())), ShouldBeNil)
+				app.Mem = proto.Float32(128)
+				So(appStore.SaveAs(&app, "bob"), ShouldBeNil)
+				app.Mem = proto.Float32(256)
+				So(appStore.SaveAs(&app, "bob"), ShouldBeNil)
+
+				revisions, _ := appStore.Revisions(app.GetAppName(), app.GetName())
+				So(revisions, ShouldHaveLength, 3)
+				So(revisions[2].GetRevision(), ShouldEqual, 3)
+				So(revisions[2].GetApp().GetMem(), ShouldEqual, 256)
+			})
+
+			Convey("should get a single revision", func() {
+				revision, err := appStore.Revision(app.GetAppName(), app.GetName(), 1)
+				So(err, ShouldBeNil)
+				So(revision.GetApp(), ShouldResemble, &app)
+
+				missing, err := appStore.Revision(app.GetAppName(), app.GetName(), 2)
+				So(err, ShouldBeNil)
+				So(missing, ShouldBeNil)
+			})
+		})
+
+		Convey("when a revision can't be recorded", func() {
+			appStore.revisions = &failingRevisionStore{RevisionStore: appStore.revisions}
+
+			Convey("should not keep a new app", func() {
+				_, app := BuildStoreTestData(1, builder)
+				So(appStore.SaveAs(&app, "alice"), ShouldNotBeNil)
+
+				actual, err := appStore.Get(app.GetId())
+				So(err, ShouldBeNil)
+				So(actual, ShouldBeNil)
+			})
+
+			Convey("should put back the previous manifest of an app", func() {
+				app := CreateAppStoreTestData(backing, builder)
+				changed := app
+				changed.Mem = proto.Float32(128)
+				So(appStore.SaveAs(&changed, "alice"), ShouldNotBeNil)
+
+				actual, err := appStore.Get(app.GetId())
+				So(err, ShouldBeNil)
+				So(actual.GetMem(), ShouldEqual, app.GetMem())
+			})
+		})
 	})
 
 }
+
+type failingRevisionStore struct {
+	RevisionStore
+}
+
+func (f *failingRevisionStore) Record(app *protocol.Application, author string) (*protocol.ApplicationRevision, error) {
+	return nil, errors.New("the revisions are unavailable")
+}
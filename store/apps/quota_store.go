@@ -0,0 +1,132 @@
+package apps
+
+import (
+	"strings"
+
+	"code.google.com/p/goprotobuf/proto"
+	"github.com/reverb/exeggutor"
+	"github.com/reverb/exeggutor/protocol"
+	"github.com/reverb/exeggutor/store"
+)
+
+// QuotaStore keeps the resource quotas of the applications and teams
+type QuotaStore interface {
+	exeggutor.Module
+	// Get returns the quota for the scope and name or nil when there is none
+	Get(scope protocol.QuotaScope, name string) (*protocol.ResourceQuota, error)
+	// Save creates or replaces a quota
+	Save(quota *protocol.ResourceQuota) error
+	// Delete removes the quota for the scope and name
+	Delete(scope protocol.QuotaScope, name string) error
+	// List returns all the quotas
+	List() ([]*protocol.ResourceQuota, error)
+	// For returns the quotas that apply to the app, the one for its app name and the one for its team
+	For(app *protocol.Application) ([]*protocol.ResourceQuota, error)
+}
+
+// DefaultQuotaStore the default implementation of the quota store
+type DefaultQuotaStore struct {
+	store store.KVStore
+}
+
+// NewQuotaStore creates a new instance of the default quota store
+func NewQuotaStore(config *exeggutor.Config) (QuotaStore, error) {
+	store, err := store.NewMdbStore(config.DataDirectory + "/quotas")
+	if err != nil {
+		return nil, err
+	}
+	return NewQuotaStoreWithStore(store), nil
+}
+
+// NewQuotaStoreWithStore creates a new instance of this quota store backed
+// by the specified store
+func NewQuotaStoreWithStore(store store.KVStore) QuotaStore {
+	return &DefaultQuotaStore{store: store}
+}
+
+// Start starts this quota store
+func (q *DefaultQuotaStore) Start() error {
+	return q.store.Start()
+}
+
+// Stop stops this quota store
+func (q *DefaultQuotaStore) Stop() error {
+	return q.store.Stop()
+}
+
+func quotaKey(scope protocol.QuotaScope, name string) string {
+	return strings.ToLower(scope.String()) + "/" + name
+}
+
+// Get returns the quota for the scope and name or nil when there is none
+func (q *DefaultQuotaStore) Get(scope protocol.QuotaScope, name string) (*protocol.ResourceQuota, error) {
+	data, err := q.store.Get(quotaKey(scope, name))
+	if err != nil {
+		if err == store.ErrNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if data == nil {
+		return nil, nil
+	}
+	quota := &protocol.ResourceQuota{}
+	if err := proto.Unmarshal(data, quota); err != nil {
+		return nil, err
+	}
+	return quota, nil
+}
+
+// Save creates or replaces a quota
+func (q *DefaultQuotaStore) Save(quota *protocol.ResourceQuota) error {
+	data, err := proto.Marshal(quota)
+	if err != nil {
+		return err
+	}
+	return q.store.Set(quotaKey(quota.GetScope(), quota.GetName()), data)
+}
+
+// Delete removes the quota for the scope and name
+func (q *DefaultQuotaStore) Delete(scope protocol.QuotaScope, name string) error {
+	return q.store.Delete(quotaKey(scope, name))
+}
+
+// List returns all the quotas
+func (q *DefaultQuotaStore) List() ([]*protocol.ResourceQuota, error) {
+	var result []*protocol.ResourceQuota
+	err := q.store.ForEach(func(item *store.KVData) {
+		quota := &protocol.ResourceQuota{}
+		if err := proto.Unmarshal(item.Value, quota); err != nil {
+			log.Warning("Couldn't deserialize quota %v, because %v", item.Key, err)
+			return
+		}
+		result = append(result, quota)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// For returns the quotas that apply to the app, the one for its app name and the one for its team
+func (q *DefaultQuotaStore) For(app *protocol.Application) ([]*protocol.ResourceQuota, error) {
+	var result []*protocol.ResourceQuota
+	quota, err := q.Get(protocol.QuotaScope_APP, app.GetAppName())
+	if err != nil {
+		return nil, err
+	}
+	if quota != nil {
+		result = append(result, quota)
+	}
+	if app.GetTeam() == "" {
+		return result, nil
+	}
+	quota, err = q.Get(protocol.QuotaScope_TEAM, app.GetTeam())
+	if err != nil {
+		return nil, err
+	}
+	if quota != nil {
+		result = append(result, quota)
+	}
+	return result, nil
+}
@@ -0,0 +1,189 @@
+package apps
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"code.google.com/p/goprotobuf/proto"
+	"github.com/reverb/exeggutor"
+	"github.com/reverb/exeggutor/protocol"
+	"github.com/reverb/exeggutor/store"
+)
+
+// RevisionStore keeps every manifest that was saved for a component
+// as an immutable revision
+type RevisionStore interface {
+	exeggutor.Module
+	// Record saves the manifest as the next revision of its component,
+	// it returns the latest revision instead when the manifest didn't change
+	Record(app *protocol.Application, author string) (*protocol.ApplicationRevision, error)
+	// List returns the revisions of a component, oldest first
+	List(appName, component string) ([]*protocol.ApplicationRevision, error)
+	// Get returns a single revision of a component or nil when it doesn't exist
+	Get(appName, component string, revision int32) (*protocol.ApplicationRevision, error)
+}
+
+// DefaultRevisionStore the default implementation of the revision store
+type DefaultRevisionStore struct {
+	store store.KVStore
+	lock  *sync.Mutex
+}
+
+// NewRevisionStore creates a new instance of the default revision store
+func NewRevisionStore(config *exeggutor.Config) (RevisionStore, error) {
+	store, err := store.NewMdbStore(config.DataDirectory + "/revisions")
+	if err != nil {
+		return nil, err
+	}
+	return NewRevisionStoreWithStore(store), nil
+}
+
+// NewRevisionStoreWithStore creates a new instance of this revision store backed
+// by the specified store
+func NewRevisionStoreWithStore(store store.KVStore) RevisionStore {
+	return &DefaultRevisionStore{store: store, lock: &sync.Mutex{}}
+}
+
+// Start starts this revision store
+func (r *DefaultRevisionStore) Start() error {
+	return r.store.Start()
+}
+
+// Stop stops this revision store
+func (r *DefaultRevisionStore) Stop() error {
+	return r.store.Stop()
+}
+
+func revisionKey(appName, component string, revision int32) string {
+	return fmt.Sprintf("%s/%s/%010d", appName, component, revision)
+}
+
+// latestPrefix the prefix of the keys that keep the latest revision number of a component
+const latestPrefix = "_latest/"
+
+func latestKey(appName, component string) string {
+	return fmt.Sprintf("%s%s/%s", latestPrefix, appName, component)
+}
+
+// latest returns the latest revision of a component or nil when it has none
+func (r *DefaultRevisionStore) latest(appName, component string) (*protocol.ApplicationRevision, error) {
+	data, err := r.store.Get(latestKey(appName, component))
+	if err != nil && err != store.ErrNotFound {
+		return nil, err
+	}
+	if err != nil || data == nil {
+		// components that were recorded before the latest revision was kept have to be scanned once
+		revisions, err := r.List(appName, component)
+		if err != nil || len(revisions) == 0 {
+			return nil, err
+		}
+		return revisions[len(revisions)-1], nil
+	}
+	revision, err := strconv.ParseInt(string(data), 10, 32)
+	if err != nil {
+		return nil, err
+	}
+	return r.Get(appName, component, int32(revision))
+}
+
+// Record saves the manifest as the next revision of its component
+func (r *DefaultRevisionStore) Record(app *protocol.Application, author string) (*protocol.ApplicationRevision, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	latest, err := r.latest(app.GetAppName(), app.GetName())
+	if err != nil {
+		return nil, err
+	}
+	var next int32 = 1
+	if latest != nil {
+		if sameManifest(latest.GetApp(), app) {
+			return latest, nil
+		}
+		next = latest.GetRevision() + 1
+	}
+
+	revision := &protocol.ApplicationRevision{
+		AppName:  proto.String(app.GetAppName()),
+		Name:     proto.String(app.GetName()),
+		Revision: proto.Int32(next),
+		SavedAt:  proto.Int64(time.Now().UnixNano() / 1000000),
+		App:      proto.Clone(app).(*protocol.Application),
+	}
+	if author != "" {
+		revision.Author = proto.String(author)
+	}
+	data, err := proto.Marshal(revision)
+	if err != nil {
+		log.Error("Couldn't serialize revision %d of %s, because %v", next, app.GetId(), err)
+		return nil, err
+	}
+	if err := r.store.Set(revisionKey(app.GetAppName(), app.GetName(), next), data); err != nil {
+		return nil, err
+	}
+	if err := r.store.Set(latestKey(app.GetAppName(), app.GetName()), []byte(strconv.Itoa(int(next)))); err != nil {
+		return nil, err
+	}
+	return revision, nil
+}
+
+// List returns the revisions of a component, oldest first
+func (r *DefaultRevisionStore) List(appName, component string) ([]*protocol.ApplicationRevision, error) {
+	var result revisionsByNumber
+	err := r.store.ForEach(func(item *store.KVData) {
+		if strings.HasPrefix(item.Key, latestPrefix) {
+			return
+		}
+		revision := &protocol.ApplicationRevision{}
+		if err := proto.Unmarshal(item.Value, revision); err != nil {
+			log.Warning("Couldn't deserialize revision %v, because %v", item.Key, err)
+			return
+		}
+		if revision.GetAppName() == appName && revision.GetName() == component {
+			result = append(result, revision)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Sort(result)
+	return result, nil
+}
+
+// Get returns a single revision of a component or nil when it doesn't exist
+func (r *DefaultRevisionStore) Get(appName, component string, revision int32) (*protocol.ApplicationRevision, error) {
+	data, err := r.store.Get(revisionKey(appName, component, revision))
+	if err != nil {
+		if err == store.ErrNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if data == nil {
+		return nil, nil
+	}
+	result := &protocol.ApplicationRevision{}
+	if err := proto.Unmarshal(data, result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// sameManifest compares two manifests without their active flag,
+// activating or deactivating an app doesn't change its manifest
+func sameManifest(a, b *protocol.Application) bool {
+	ac := proto.Clone(a).(*protocol.Application)
+	bc := proto.Clone(b).(*protocol.Application)
+	ac.Active, bc.Active = nil, nil
+	return proto.Equal(ac, bc)
+}
+
+type revisionsByNumber []*protocol.ApplicationRevision
+
+func (r revisionsByNumber) Len() int           { return len(r) }
+func (r revisionsByNumber) Swap(i, j int)      { r[i], r[j] = r[j], r[i] }
+func (r revisionsByNumber) Less(i, j int) bool { return r[i].GetRevision() < r[j].GetRevision() }
@@ -37,9 +37,13 @@ type DefaultTaskStore struct {
 	runningAppsCount int32
 }
 
-// New creates a new default instance of the task store
+// New creates a new default instance of the task store,
+// the deployments are kept in the data directory so they survive a restart
 func New(config *exeggutor.Config) (TaskStore, error) {
-	store := store.NewEmptyInMemoryStore()
+	store, err := store.NewMdbStore(config.DataDirectory + "/tasks")
+	if err != nil {
+		return nil, err
+	}
 	return &DefaultTaskStore{store: store}, nil
 }
 
@@ -21,6 +21,16 @@ type PortRange struct {
 	End   uint64
 }
 
+// Len returns the number of ports in the range, both ends are inclusive
+func (p PortRange) Len() int {
+	return int(p.End - p.Begin + 1)
+}
+
+// Fits returns true when count ports can be taken from the range
+func (p PortRange) Fits(count int) bool {
+	return count <= p.Len()
+}
+
 var EmptyPortRange = []PortRange{}
 
 func PortRangeFor(port int) ([]PortRange, []int32) {
@@ -70,8 +80,7 @@ func (p *RandomPortPicker) GetPorts(offer *mesos.Offer, count int) (takenRanges
 			// unwrap the ranges
 			for _, r := range resource.GetRanges().GetRange() {
 				// when we have stuff left to take, take it, this is inclusive
-				numAvail := int(r.GetEnd() - r.GetBegin() + 1)
-				if untaken < numAvail { // this fits in this range
+				if (PortRange{Begin: r.GetBegin(), End: r.GetEnd()}).Fits(untaken) { // this fits in this range
 					prange := p.makePortRange(int(r.GetBegin()), int(r.GetEnd()), untaken)
 					takenRanges = append(takenRanges, prange)
 					untaken = 0
@@ -103,6 +112,7 @@ func New(config *exeggutor.Config) *MesosMessageBuilder {
 }
 
 // BuildResources builds the []*mesos.Resource from a protocol.ApplicationComponent
+// disk is only requested for components that need disk space
 func (b *MesosMessageBuilder) BuildResources(component *protocol.Application, ports []PortRange) []*mesos.Resource {
 	var pres []*mesos.Value_Range
 
@@ -113,15 +123,18 @@ func (b *MesosMessageBuilder) BuildResources(component *protocol.Application, po
 		})
 	}
 
-	return []*mesos.Resource{
+	resources := []*mesos.Resource{
 		mesos.ScalarResource("cpus", float64(component.GetCpus())),
 		mesos.ScalarResource("mem", float64(component.GetMem())),
-		&mesos.Resource{
-			Name:   proto.String("ports"),
-			Type:   mesos.Value_RANGES.Enum(),
-			Ranges: &mesos.Value_Ranges{Range: pres},
-		},
 	}
+	if component.GetDiskSpace() > 0 {
+		resources = append(resources, mesos.ScalarResource("disk", float64(component.GetDiskSpace())))
+	}
+	return append(resources, &mesos.Resource{
+		Name:   proto.String("ports"),
+		Type:   mesos.Value_RANGES.Enum(),
+		Ranges: &mesos.Value_Ranges{Range: pres},
+	})
 }
 
 // BuildTaskEnvironment builds a mesos.Environment from the environment and ports
@@ -0,0 +1,199 @@
+package tasks
+
+import (
+	"regexp"
+	"strconv"
+	"sync"
+
+	"github.com/reverb/exeggutor/protocol"
+	"github.com/reverb/go-mesos/mesos"
+)
+
+// HostnameAttribute the attribute name constraints use for the host name of a slave
+const HostnameAttribute = "hostname"
+
+// slaveAttributes remembers the attributes of the slaves that sent offers,
+// so constraints can be checked for the hosts deployments are running on
+type slaveAttributes struct {
+	hosts map[string]map[string]string
+	lock  *sync.Mutex
+}
+
+func newSlaveAttributes() *slaveAttributes {
+	return &slaveAttributes{hosts: make(map[string]map[string]string), lock: &sync.Mutex{}}
+}
+
+func attributeValue(attribute *mesos.Attribute) string {
+	switch attribute.GetType() {
+	case mesos.Value_SCALAR:
+		return strconv.FormatFloat(attribute.GetScalar().GetValue(), 'f', -1, 64)
+	case mesos.Value_TEXT:
+		return attribute.GetText().GetValue()
+	default:
+		return ""
+	}
+}
+
+// observe remembers the attributes of the slave that sent the offer and returns them
+func (s *slaveAttributes) observe(offer *mesos.Offer) map[string]string {
+	attributes := map[string]string{HostnameAttribute: offer.GetHostname()}
+	for _, attribute := range offer.GetAttributes() {
+		attributes[attribute.GetName()] = attributeValue(attribute)
+	}
+	s.lock.Lock()
+	s.hosts[offer.GetHostname()] = attributes
+	s.lock.Unlock()
+	return attributes
+}
+
+// value returns the value of the attribute for a host, the boolean is false when it isn't known
+func (s *slaveAttributes) value(host, attribute string) (string, bool) {
+	if attribute == HostnameAttribute {
+		return host, true
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	attributes, ok := s.hosts[host]
+	if !ok {
+		return "", false
+	}
+	value, ok := attributes[attribute]
+	return value, ok
+}
+
+// attributes returns all the attributes of a host, the boolean is false when the host never sent an offer
+func (s *slaveAttributes) attributes(host string) (map[string]string, bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	attributes, ok := s.hosts[host]
+	if !ok {
+		return nil, false
+	}
+	result := make(map[string]string, len(attributes))
+	for name, value := range attributes {
+		result[name] = value
+	}
+	return result, true
+}
+
+// values returns all the known values of an attribute
+func (s *slaveAttributes) values(attribute string) []string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	seen := make(map[string]bool)
+	var result []string
+	for host, attributes := range s.hosts {
+		value, ok := attributes[attribute]
+		if attribute == HostnameAttribute {
+			value, ok = host, true
+		}
+		if ok && !seen[value] {
+			seen[value] = true
+			result = append(result, value)
+		}
+	}
+	return result
+}
+
+// deployedInstances the alive deployments of every app, they're read from the task store once
+// when the first item with constraints is checked and shared by all the items checked against an offer
+type deployedInstances struct {
+	tasks  *DefaultTaskManager
+	byApp  map[string][]*protocol.Deployment
+	loaded bool
+}
+
+func (t *DefaultTaskManager) newDeployedInstances() *deployedInstances {
+	return &deployedInstances{tasks: t, byApp: make(map[string][]*protocol.Deployment)}
+}
+
+// of returns the alive deployments of the app
+func (d *deployedInstances) of(appID string) ([]*protocol.Deployment, error) {
+	if !d.loaded {
+		err := d.tasks.taskStore.ForEach(func(deployment *protocol.Deployment) {
+			if d.tasks.wasAlive(deployment.GetStatus()) {
+				d.add(deployment)
+			}
+		})
+		if err != nil {
+			return nil, err
+		}
+		d.loaded = true
+	}
+	return d.byApp[appID], nil
+}
+
+// launched counts a deployment that was saved after the deployments were read
+func (d *deployedInstances) launched(deployment *protocol.Deployment) {
+	if d.loaded {
+		d.add(deployment)
+	}
+}
+
+func (d *deployedInstances) add(deployment *protocol.Deployment) {
+	d.byApp[deployment.GetAppId()] = append(d.byApp[deployment.GetAppId()], deployment)
+}
+
+// meetsConstraints checks if an instance of the app can be placed on the slave with the offered attributes,
+// given the instances of the app that are already deployed
+func (t *DefaultTaskManager) meetsConstraints(offered map[string]string, app *protocol.Application, instances *deployedInstances) bool {
+	constraints := app.GetConstraints()
+	if len(constraints) == 0 {
+		return true
+	}
+	deployed, err := instances.of(app.GetId())
+	if err != nil {
+		log.Warning("Couldn't check the constraints of %s, because %v", app.GetId(), err)
+		return false
+	}
+	for _, constraint := range constraints {
+		if !t.meetsConstraint(offered, constraint, deployed) {
+			log.Debug("An offer from %s doesn't meet constraint %v of %s", offered[HostnameAttribute], constraint, app.GetId())
+			return false
+		}
+	}
+	return true
+}
+
+func (t *DefaultTaskManager) meetsConstraint(offered map[string]string, constraint *protocol.PlacementConstraint, deployed []*protocol.Deployment) bool {
+	attribute := constraint.GetAttribute()
+	value, ok := offered[attribute]
+
+	// count the deployed instances for every value of the attribute
+	counts := make(map[string]int)
+	for _, d := range deployed {
+		if v, known := t.slaves.value(d.GetHostName(), attribute); known {
+			counts[v]++
+		}
+	}
+
+	switch constraint.GetOperator() {
+	case protocol.ConstraintOperator_UNIQUE:
+		return ok && counts[value] == 0
+	case protocol.ConstraintOperator_LIKE, protocol.ConstraintOperator_UNLIKE:
+		matcher, err := regexp.Compile("^(?:" + constraint.GetValue() + ")$")
+		if err != nil {
+			return false
+		}
+		matches := ok && matcher.MatchString(value)
+		return matches == (constraint.GetOperator() == protocol.ConstraintOperator_LIKE)
+	case protocol.ConstraintOperator_GROUP_BY:
+		if !ok {
+			return false
+		}
+		// only place an instance in a group that has the fewest instances
+		for _, other := range t.slaves.values(attribute) {
+			if counts[other] < counts[value] {
+				return false
+			}
+		}
+		return true
+	case protocol.ConstraintOperator_MAX_PER:
+		max, err := strconv.Atoi(constraint.GetValue())
+		if err != nil {
+			return false
+		}
+		return ok && counts[value] < max
+	}
+	return false
+}
@@ -0,0 +1,260 @@
+package tasks
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/reverb/exeggutor"
+	"github.com/reverb/exeggutor/protocol"
+	kv_store "github.com/reverb/exeggutor/store"
+)
+
+const (
+	defaultCrashBackoff       = 5 * time.Second
+	defaultCrashBackoffMax    = 5 * time.Minute
+	defaultCrashLoopThreshold = 10
+	defaultCrashResetAfter    = 10 * time.Minute
+)
+
+// CrashLoop the failure history of a component that failed recently
+type CrashLoop struct {
+	AppName   string `json:"app_name"`
+	Component string `json:"component"`
+	// AppID the version of the component that failed
+	AppID    string `json:"app_id"`
+	Failures int    `json:"failures"`
+	// LastFailure the unix epoch in milliseconds of the last failure
+	LastFailure int64 `json:"last_failure"`
+	// RetryAt the unix epoch in milliseconds before which the component won't be deployed again
+	RetryAt int64 `json:"retry_at"`
+	// CrashLooping is true when the component failed too often and won't be deployed again
+	// until an operator clears it or a new version is deployed
+	CrashLooping bool `json:"crash_looping"`
+}
+
+type crashRecord struct {
+	CrashLoop
+	lastFailure time.Time
+	retryAt     time.Time
+	retry       *time.Timer
+}
+
+// crashTracker counts the failures of every component and decides how long
+// a component has to wait before it gets deployed again.
+// The records are kept in the store when there is one, so a restart or a new leader
+// doesn't give a crash looping component a clean slate.
+type crashTracker struct {
+	backoff    time.Duration
+	backoffMax time.Duration
+	threshold  int
+	resetAfter time.Duration
+	records    map[string]*crashRecord
+	store      kv_store.KVStore
+	lock       *sync.Mutex
+}
+
+func newCrashTracker(config *exeggutor.FrameworkConfig, store kv_store.KVStore) *crashTracker {
+	tracker := &crashTracker{
+		backoff:    defaultCrashBackoff,
+		backoffMax: defaultCrashBackoffMax,
+		threshold:  defaultCrashLoopThreshold,
+		resetAfter: defaultCrashResetAfter,
+		records:    make(map[string]*crashRecord),
+		store:      store,
+		lock:       &sync.Mutex{},
+	}
+	if config != nil {
+		if config.CrashBackoff > 0 {
+			tracker.backoff = time.Duration(config.CrashBackoff) * time.Second
+		}
+		if config.CrashBackoffMax > 0 {
+			tracker.backoffMax = time.Duration(config.CrashBackoffMax) * time.Second
+		}
+		if config.CrashLoopThreshold >= 0 {
+			tracker.threshold = config.CrashLoopThreshold
+		}
+		if config.CrashResetAfter > 0 {
+			tracker.resetAfter = time.Duration(config.CrashResetAfter) * time.Second
+		}
+	}
+	return tracker
+}
+
+// start loads the records that were saved before a restart
+func (c *crashTracker) start() error {
+	if c.store == nil {
+		return nil
+	}
+	if err := c.store.Start(); err != nil {
+		return err
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.store.ForEach(func(item *kv_store.KVData) {
+		record := &crashRecord{}
+		if err := json.Unmarshal(item.Value, &record.CrashLoop); err != nil {
+			log.Warning("Couldn't deserialize the failures of %s, because %v", item.Key, err)
+			return
+		}
+		record.lastFailure = time.Unix(0, record.LastFailure*1000000)
+		record.retryAt = time.Unix(0, record.RetryAt*1000000)
+		c.records[item.Key] = record
+	})
+}
+
+// save keeps the record of a component in the store, it's called with the lock held
+func (c *crashTracker) save(key string, record *crashRecord) {
+	if c.store == nil {
+		return
+	}
+	data, err := json.Marshal(record.CrashLoop)
+	if err == nil {
+		err = c.store.Set(key, data)
+	}
+	if err != nil {
+		log.Warning("Couldn't save the failures of %s, because %v", key, err)
+	}
+}
+
+func componentKey(appName, component string) string {
+	return appName + "/" + component
+}
+
+func millis(t time.Time) int64 {
+	return t.UnixNano() / 1000000
+}
+
+// failed records a failure of the app and returns true when it made the component crash looping
+func (c *crashTracker) failed(app *protocol.Application) bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	now := time.Now()
+	key := componentKey(app.GetAppName(), app.GetName())
+	record, ok := c.records[key]
+	if !ok || record.AppID != app.GetId() || (!record.CrashLooping && now.Sub(record.lastFailure) > c.resetAfter) {
+		c.forget(key)
+		record = &crashRecord{CrashLoop: CrashLoop{AppName: app.GetAppName(), Component: app.GetName(), AppID: app.GetId()}}
+		c.records[key] = record
+	}
+
+	record.Failures++
+	record.lastFailure = now
+	record.LastFailure = millis(now)
+
+	delay := c.backoff
+	for i := 1; i < record.Failures && delay < c.backoffMax; i++ {
+		delay *= 2
+	}
+	if delay > c.backoffMax {
+		delay = c.backoffMax
+	}
+	record.retryAt = now.Add(delay)
+	record.RetryAt = millis(record.retryAt)
+
+	crashLooping := c.threshold > 0 && record.Failures >= c.threshold && !record.CrashLooping
+	if crashLooping {
+		record.CrashLooping = true
+	}
+	c.save(key, record)
+	return crashLooping
+}
+
+// delay returns how long the app has to wait before it can be deployed again,
+// the boolean is false when the component is crash looping and shouldn't be deployed at all
+func (c *crashTracker) delay(app *protocol.Application) (time.Duration, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	record, ok := c.records[componentKey(app.GetAppName(), app.GetName())]
+	if !ok || record.AppID != app.GetId() {
+		return 0, true
+	}
+	if record.CrashLooping {
+		return 0, false
+	}
+	return record.retryAt.Sub(time.Now()), true
+}
+
+// deferRetry calls retry once the backoff of the app expired,
+// it returns false when a retry is already pending for the component
+func (c *crashTracker) deferRetry(app *protocol.Application, wait time.Duration, retry func()) bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	record, ok := c.records[componentKey(app.GetAppName(), app.GetName())]
+	if !ok || record.retry != nil {
+		return false
+	}
+	record.retry = time.AfterFunc(wait, func() {
+		c.lock.Lock()
+		record.retry = nil
+		c.lock.Unlock()
+		retry()
+	})
+	return true
+}
+
+// deployed forgets the failures of older versions of the component when a new version gets deployed
+func (c *crashTracker) deployed(app *protocol.Application) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	key := componentKey(app.GetAppName(), app.GetName())
+	if record, ok := c.records[key]; ok && record.AppID != app.GetId() {
+		log.Notice("Forgetting the failures of %s, because %s is being deployed", record.AppID, app.GetId())
+		c.forget(key)
+	}
+}
+
+// clear forgets the failures of a component, it returns false when there were none
+func (c *crashTracker) clear(appName, component string) bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	key := componentKey(appName, component)
+	if _, ok := c.records[key]; !ok {
+		return false
+	}
+	c.forget(key)
+	return true
+}
+
+func (c *crashTracker) forget(key string) {
+	record, ok := c.records[key]
+	if !ok {
+		return
+	}
+	if record.retry != nil {
+		record.retry.Stop()
+	}
+	delete(c.records, key)
+	if c.store != nil {
+		if err := c.store.Delete(key); err != nil {
+			log.Warning("Couldn't forget the failures of %s, because %v", key, err)
+		}
+	}
+}
+
+func (c *crashTracker) list() []CrashLoop {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	var result []CrashLoop
+	for _, record := range c.records {
+		result = append(result, record.CrashLoop)
+	}
+	return result
+}
+
+// stop cancels the pending retries and closes the store
+func (c *crashTracker) stop() error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	for _, record := range c.records {
+		if record.retry != nil {
+			record.retry.Stop()
+			record.retry = nil
+		}
+	}
+	if c.store == nil {
+		return nil
+	}
+	return c.store.Stop()
+}
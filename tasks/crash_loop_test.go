@@ -0,0 +1,126 @@
+package tasks
+
+import (
+	"testing"
+	"time"
+
+	"code.google.com/p/goprotobuf/proto"
+	"github.com/reverb/exeggutor"
+	"github.com/reverb/exeggutor/store"
+	. "github.com/reverb/exeggutor/test_utils"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestCrashTracker(t *testing.T) {
+	config := &exeggutor.FrameworkConfig{
+		CrashBackoff:       1,
+		CrashBackoffMax:    4,
+		CrashLoopThreshold: 4,
+		CrashResetAfter:    60,
+	}
+
+	Convey("A crash tracker", t, func() {
+		backing := store.NewEmptyInMemoryStore()
+		tracker := newCrashTracker(config, backing)
+		So(tracker.start(), ShouldBeNil)
+		app := TestComponent("crashing", "web", 1, 64)
+
+		Convey("should let an app that never failed deploy right away", func() {
+			wait, ok := tracker.delay(&app)
+			So(ok, ShouldBeTrue)
+			So(wait, ShouldEqual, time.Duration(0))
+		})
+
+		Convey("should double the backoff with every failure up to the maximum", func() {
+			tracker.failed(&app)
+			wait, _ := tracker.delay(&app)
+			So(wait, ShouldBeGreaterThan, 900*time.Millisecond)
+			So(wait, ShouldBeLessThanOrEqualTo, time.Second)
+
+			tracker.failed(&app)
+			wait, _ = tracker.delay(&app)
+			So(wait, ShouldBeGreaterThan, 1900*time.Millisecond)
+			So(wait, ShouldBeLessThanOrEqualTo, 2*time.Second)
+
+			tracker.failed(&app)
+			tracker.failed(&app)
+			wait, _ = tracker.delay(&app)
+			So(wait, ShouldBeLessThanOrEqualTo, 4*time.Second)
+		})
+
+		Convey("should give up on a component past the threshold", func() {
+			So(tracker.failed(&app), ShouldBeFalse)
+			So(tracker.failed(&app), ShouldBeFalse)
+			So(tracker.failed(&app), ShouldBeFalse)
+			So(tracker.failed(&app), ShouldBeTrue)
+
+			_, ok := tracker.delay(&app)
+			So(ok, ShouldBeFalse)
+			So(tracker.list()[0].CrashLooping, ShouldBeTrue)
+
+			Convey("until an operator clears it", func() {
+				So(tracker.clear("crashing", "web"), ShouldBeTrue)
+				_, ok := tracker.delay(&app)
+				So(ok, ShouldBeTrue)
+				So(tracker.list(), ShouldBeEmpty)
+			})
+
+			Convey("until a new version is deployed", func() {
+				next := TestComponent("crashing", "web", 1, 64)
+				next.Id = proto.String("crashing-web-0.2.0")
+				tracker.deployed(&app)
+				_, ok := tracker.delay(&app)
+				So(ok, ShouldBeFalse)
+
+				tracker.deployed(&next)
+				wait, ok := tracker.delay(&next)
+				So(ok, ShouldBeTrue)
+				So(wait, ShouldEqual, time.Duration(0))
+			})
+		})
+
+		Convey("should remember the failures after a restart", func() {
+			tracker.failed(&app)
+			tracker.failed(&app)
+			tracker.failed(&app)
+			tracker.failed(&app)
+			So(tracker.stop(), ShouldBeNil)
+
+			restarted := newCrashTracker(config, backing)
+			So(restarted.start(), ShouldBeNil)
+			_, ok := restarted.delay(&app)
+			So(ok, ShouldBeFalse)
+			So(restarted.list(), ShouldHaveLength, 1)
+			So(restarted.list()[0].Failures, ShouldEqual, 4)
+
+			Convey("and forget them when they're cleared", func() {
+				So(restarted.clear("crashing", "web"), ShouldBeTrue)
+				size, _ := backing.Size()
+				So(size, ShouldEqual, 0)
+			})
+		})
+
+		Convey("should keep waiting for the backoff after a restart", func() {
+			tracker.failed(&app)
+			restarted := newCrashTracker(config, backing)
+			So(restarted.start(), ShouldBeNil)
+			wait, ok := restarted.delay(&app)
+			So(ok, ShouldBeTrue)
+			So(wait, ShouldBeGreaterThan, time.Duration(0))
+			So(wait, ShouldBeLessThanOrEqualTo, time.Second)
+		})
+
+		Convey("should retry once after the backoff", func() {
+			tracker.failed(&app)
+			retried := make(chan bool, 2)
+			So(tracker.deferRetry(&app, 10*time.Millisecond, func() { retried <- true }), ShouldBeTrue)
+			So(tracker.deferRetry(&app, 10*time.Millisecond, func() { retried <- true }), ShouldBeFalse)
+
+			select {
+			case <-retried:
+			case <-time.After(time.Second):
+				So("the retry never happened", ShouldBeEmpty)
+			}
+		})
+	})
+}
@@ -1,14 +1,19 @@
 package tasks
 
 import (
+	"fmt"
 	"time"
 
 	"code.google.com/p/goprotobuf/proto"
 
 	"github.com/reverb/exeggutor"
+	"github.com/reverb/exeggutor/bus"
+	"github.com/reverb/exeggutor/events"
 	"github.com/reverb/exeggutor/health"
+	"github.com/reverb/exeggutor/health/check"
 	"github.com/reverb/exeggutor/health/sla"
 	"github.com/reverb/exeggutor/protocol"
+	kv_store "github.com/reverb/exeggutor/store"
 	app_store "github.com/reverb/exeggutor/store/apps"
 	task_store "github.com/reverb/exeggutor/store/tasks"
 	"github.com/reverb/exeggutor/tasks/builders"
@@ -16,6 +21,10 @@ import (
 	"github.com/reverb/go-mesos/mesos"
 )
 
+// busBuffer the number of messages of a topic the task manager and the framework
+// can fall behind on before a producer has to wait for them
+const busBuffer = 64
+
 // DefaultTaskManager the task manager accepts application manifests
 // and schedules them when a suitable offer arrives.
 // It then tracks the state of the running components, so that eventually
@@ -29,8 +38,12 @@ type DefaultTaskManager struct {
 	builder     *builders.MesosMessageBuilder
 	healtchecks health.HealthCheckScheduler
 	slaMonitor  sla.SLAMonitor
+	rollouts    *rolloutManager
+	preemption  *preemptor
+	placements  *placementHistory
+	crashes     *crashTracker
+	slaves      *slaveAttributes
 	closing     chan chan bool
-	tasksToKill chan *mesos.TaskID
 }
 
 // NewDefaultTaskManager creates a new instance of a task manager with the values
@@ -46,23 +59,53 @@ func NewDefaultTaskManager(context *exeggutor.AppContext, appStore app_store.App
 	// 	return nil, err
 	// }
 
-	q := task_queue.New()
-	return &DefaultTaskManager{
+	q, err := newTaskQueue(context.Config)
+	if err != nil {
+		return nil, err
+	}
+	crashes, err := newCrashStore(context.Config)
+	if err != nil {
+		return nil, err
+	}
+	mgr := &DefaultTaskManager{
 		queue:       q,
 		taskStore:   store,
 		appStore:    appStore,
 		context:     context,
 		builder:     builders.New(context.Config),
 		healtchecks: health.New(context),
-		slaMonitor:  sla.New(store, appStore, q),
+		slaMonitor:  sla.New(store, appStore, q, context),
 		closing:     make(chan chan bool),
-		tasksToKill: make(chan *mesos.TaskID),
-	}, nil
+	}
+	mgr.rollouts = newRolloutManager(mgr, rolloutInterval)
+	mgr.preemption = newPreemptor(mgr, context.Config.FrameworkInfo, preemptInterval)
+	mgr.placements = newPlacementHistory(context.Config.FrameworkInfo)
+	mgr.crashes = newCrashTracker(context.Config.FrameworkInfo, crashes)
+	mgr.slaves = newSlaveAttributes()
+	return mgr, nil
 }
 
-// TasksToKill a channel over which tasks that should be killed are received
-func (t *DefaultTaskManager) TasksToKill() <-chan *mesos.TaskID {
-	return t.tasksToKill
+// newTaskQueue creates the queue of the task manager, it only keeps the queued items
+// in the data directory when queue persistence is enabled.
+func newTaskQueue(config *exeggutor.Config) (task_queue.TaskQueue, error) {
+	framework := config.FrameworkInfo
+	if framework == nil || !framework.PersistQueue || config.DataDirectory == "" {
+		return task_queue.NewWithConfig(nil, framework), nil
+	}
+	queued, err := kv_store.NewMdbStore(config.DataDirectory + "/queue")
+	if err != nil {
+		return nil, err
+	}
+	return task_queue.NewWithConfig(queued, framework), nil
+}
+
+// newCrashStore creates the store for the failures of the components in the data directory,
+// the failures are only kept in memory when there is no data directory.
+func newCrashStore(config *exeggutor.Config) (kv_store.KVStore, error) {
+	if config.DataDirectory == "" {
+		return nil, nil
+	}
+	return kv_store.NewMdbStore(config.DataDirectory + "/crashes")
 }
 
 // Start starts the instance of the taks manager and all the components it depends on.
@@ -97,37 +140,112 @@ func (t *DefaultTaskManager) Start() error {
 			// t.slaMonitor.Stop()
 			return err
 		}
-		go t.listenForHealthFailures()
+		failures := t.context.Bus.Subscribe(bus.HealthCheckFailed, busBuffer, bus.Block)
+		scaling := t.context.Bus.Subscribe(bus.ScaleRequested, busBuffer, bus.Block)
+		go t.listenForHealthFailures(failures, scaling)
 	}
 
-	return nil
+	if err := t.crashes.start(); err != nil {
+		log.Warning("Couldn't load the failures from before the restart, because %v", err)
+	}
+
+	if err := t.restore(); err != nil {
+		log.Warning("Couldn't restore the deployments from before the restart, because %v", err)
+	}
+
+	if err := t.rollouts.Start(); err != nil {
+		return err
+	}
+	return t.preemption.Start()
+}
+
+// restore picks up the deployments that were persisted before a restart.
+// The running instances get their health checks back and the apps that are below their SLA
+// get scheduled again, the SLA monitor counts the restored deployments from the task store
+// so it takes care of the rest.
+func (t *DefaultTaskManager) restore() error {
+	apps := make(map[string]*protocol.Application)
+	err := t.taskStore.ForEach(func(deployment *protocol.Deployment) {
+		app, ok := apps[deployment.GetAppId()]
+		if !ok {
+			var err error
+			app, err = t.appStore.Get(deployment.GetAppId())
+			if err != nil {
+				log.Warning("Couldn't get the application %s linked to the task id %s, because: %v", deployment.GetAppId(), deployment.GetTaskId().GetValue(), err)
+			}
+			apps[deployment.GetAppId()] = app
+		}
+		if app == nil || deployment.GetStatus() != protocol.AppStatus_STARTED || t.healtchecks == nil {
+			return
+		}
+		if err := t.healtchecks.Register(deployment, app); err != nil {
+			log.Warning("Failed to register health check for %v, because %v", deployment.GetTaskId().GetValue(), err)
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	log.Notice("Restored the deployments of %d apps", len(apps))
+
+	return t.appStore.ForEach(func(app *protocol.Application) {
+		t.replaceMissing(app, false)
+	})
 }
 
-func (t *DefaultTaskManager) listenForHealthFailures() {
+// listenForHealthFailures kills the tasks that became unhealthy and scales the apps
+// the SLA monitor asks for until the task manager is stopped
+func (t *DefaultTaskManager) listenForHealthFailures(failures, scaling *bus.Subscription) {
+	failed, scaled := failures.Messages(), scaling.Messages()
 	for {
 		select {
-		case failure := <-t.healtchecks.Failures():
+		case msg, ok := <-failed:
+			if !ok {
+				failed = nil
+				continue
+			}
+			failure, ok := msg.(check.Result)
+			if !ok {
+				log.Warning("Ignoring a %T published on %s, it should be a check.Result", msg, bus.HealthCheckFailed)
+				continue
+			}
 			log.Info("task %d failed the health check", failure.ID)
 			deployment, err := t.taskStore.Get(failure.ID)
 			if err != nil {
 				log.Error("Failed to get a deployment for marking as failure, because: %v", err)
 			}
 			if deployment != nil && err == nil {
-				t.updateStatus(deployment.GetTaskId(), protocol.AppStatus_UNHEALTHY)
-				t.tasksToKill <- deployment.GetTaskId()
+				t.updateStatus(deployment.GetTaskId(), protocol.AppStatus_UNHEALTHY, "")
+				t.kill(deployment.GetTaskId())
 			}
 
-		case scaleReq := <-t.slaMonitor.ScaleUpOrDown():
+		case msg, ok := <-scaled:
+			if !ok {
+				scaled = nil
+				continue
+			}
+			scaleReq, ok := msg.(sla.ChangeDeployCount)
+			if !ok {
+				log.Warning("Ignoring a %T published on %s, it should be a sla.ChangeDeployCount", msg, bus.ScaleRequested)
+				continue
+			}
 			// We ignore requests where the count is 0
+			// and leave the instance count of apps that are being rolled out to the rollout
+			if t.rollouts.inRollout(scaleReq.App.GetId()) {
+				continue
+			}
 			if scaleReq.Count > 0 {
-
+				t.scaleUp(scaleReq)
 			} else if scaleReq.Count < 0 {
-
+				t.scaleDown(scaleReq)
 			}
 
 		case closed := <-t.closing:
 			// We stop healthchecks and slaMonitor here so that this loop
 			// doesn't start doing weird things.
+			// Unsubscribing first releases a producer that waits for this loop.
+			t.context.Bus.Unsubscribe(failures)
+			t.context.Bus.Unsubscribe(scaling)
 			if err := t.healtchecks.Stop(); err != nil {
 				log.Warning("There was an error closing the health checks", err)
 			}
@@ -140,10 +258,96 @@ func (t *DefaultTaskManager) listenForHealthFailures() {
 	}
 }
 
+// scaleUp enqueues as many instances of the app as the SLA monitor asked for,
+// unless the app is backing off after failures
+func (t *DefaultTaskManager) scaleUp(scaleReq sla.ChangeDeployCount) {
+	if wait, ok := t.crashes.delay(scaleReq.App); !ok || wait > 0 {
+		log.Debug("Not scaling up %s because it's backing off after failures", scaleReq.App.GetId())
+		return
+	}
+	log.Info("Scaling up %s with %d instances", scaleReq.App.GetId(), scaleReq.Count)
+	for i := int32(0); i < scaleReq.Count; i++ {
+		if err := t.scheduleAppForDeployment(scaleReq.App); err != nil {
+			log.Warning("Couldn't scale up %s, because %v", scaleReq.App.GetId(), err)
+			return
+		}
+	}
+}
+
+// scaleDown stops as many instances of the app as the SLA monitor asked for.
+// It returns the tasks that are being stopped.
+func (t *DefaultTaskManager) scaleDown(scaleReq sla.ChangeDeployCount) []*mesos.TaskID {
+	stopping := t.scaleDownVictims(scaleReq)
+	for _, taskID := range stopping {
+		t.kill(taskID)
+	}
+	return stopping
+}
+
+// scaleDownVictims picks the tasks to stop to scale the app down without killing them.
+// When the request names the tasks, because the app is inactive, those are the ones that get stopped.
+// Otherwise queued instances are dropped first and the remaining victims are picked by the scale down policy.
+func (t *DefaultTaskManager) scaleDownVictims(scaleReq sla.ChangeDeployCount) []*mesos.TaskID {
+	app := scaleReq.App
+	if len(scaleReq.Tasks) > 0 {
+		log.Info("Stopping %d tasks of inactive app %s", len(scaleReq.Tasks), app.GetId())
+		return scaleReq.Tasks
+	}
+
+	count := int(-scaleReq.Count)
+	for count > 0 {
+		item, err := t.queue.DequeueFirst(func(i *protocol.ScheduledApp) bool { return i.GetAppId() == app.GetId() })
+		if err != nil || item == nil {
+			break
+		}
+		t.placements.forget(item)
+		log.Info("Dropped a queued instance of %s to scale down", app.GetId())
+		count--
+	}
+	if count == 0 {
+		return nil
+	}
+
+	hostLoad := make(map[string]int)
+	var candidates []*protocol.Deployment
+	t.taskStore.ForEach(func(item *protocol.Deployment) {
+		if !t.wasAlive(item.GetStatus()) {
+			return
+		}
+		hostLoad[item.GetHostName()]++
+		if item.GetAppId() == app.GetId() {
+			candidates = append(candidates, item)
+		}
+	})
+
+	var stopped []*mesos.TaskID
+	for _, victim := range pickVictims(t.scaleDownPolicy(), candidates, hostLoad, count) {
+		log.Info("Stopping task %s on %s to scale down %s", victim.GetTaskId().GetValue(), victim.GetHostName(), app.GetId())
+		stopped = append(stopped, victim.GetTaskId())
+	}
+	return stopped
+}
+
+func (t *DefaultTaskManager) scaleDownPolicy() scaleDownPolicy {
+	if t.context.Config.FrameworkInfo == nil {
+		return newestFirst
+	}
+	return scaleDownPolicyFor(t.context.Config.FrameworkInfo.ScaleDownPolicy)
+}
+
 // Stop stops this task manager, cleaning up any resources
 // it might have required and owns.
 func (t *DefaultTaskManager) Stop() error {
 	// stop listening for things first
+	if err := t.rollouts.Stop(); err != nil {
+		log.Warning("There was an error stopping the rollouts: %v", err)
+	}
+	if err := t.preemption.Stop(); err != nil {
+		log.Warning("There was an error stopping the preemption: %v", err)
+	}
+	if err := t.crashes.stop(); err != nil {
+		log.Warning("There was an error stopping the crash tracker: %v", err)
+	}
 	boolc := make(chan bool)
 	t.closing <- boolc
 	<-boolc
@@ -166,7 +370,6 @@ func (t *DefaultTaskManager) Stop() error {
 			return err2
 		}
 	}
-	close(t.tasksToKill)
 	close(t.closing)
 	close(boolc)
 
@@ -176,31 +379,63 @@ func (t *DefaultTaskManager) Stop() error {
 // SaveApp saves an application
 func (t *DefaultTaskManager) SaveApp(app *protocol.Application) error {
 	log.Debug("Saving app: %+v", app)
-	return t.appStore.Save(app)
+	if err := t.appStore.Save(app); err != nil {
+		return err
+	}
+	t.publish(events.ForApp(events.AppSaved, app))
+	return nil
+}
+
+// kill asks the framework, which follows bus.TaskToKill, to kill the task
+func (t *DefaultTaskManager) kill(taskID *mesos.TaskID) {
+	t.context.Bus.Publish(bus.TaskToKill, taskID)
+}
+
+// publish sends the event to the clients of the event stream
+func (t *DefaultTaskManager) publish(event *events.Event) {
+	t.context.EventSource.Publish(event)
 }
 
 // SubmitApp submits an application to the queue for scheduling on the
-// cluster
+// cluster, it returns a QuotaExceededError when a component doesn't fit in its quotas
 func (t *DefaultTaskManager) SubmitApp(app []protocol.Application) error {
 	log.Debug("Submitting app: %+v", app)
 	for _, comp := range app {
-		t.scheduleAppForDeployment(&comp)
+		t.crashes.deployed(&comp)
+		if err := t.scheduleAppForDeployment(&comp); err != nil {
+			return err
+		}
 	}
 	return nil
 }
 
-func (t *DefaultTaskManager) scheduleAppForDeployment(app *protocol.Application) {
+func (t *DefaultTaskManager) scheduleAppForDeployment(app *protocol.Application) error {
+	return t.enqueue(app, false)
+}
+
+func (t *DefaultTaskManager) enqueue(app *protocol.Application, expedite bool) error {
 	log.Debug("Enqueueing for deployment with more instances (%t) %+v", t.slaMonitor.CanDeployMoreInstances(app), app)
 	if !t.slaMonitor.CanDeployMoreInstances(app) {
-		log.Warning("Can't deploy another instance of %s, the max instances have been reached")
-		return
+		log.Warning("Can't deploy another instance of %s, the max instances have been reached", app.GetId())
+		return nil
+	}
+	if err := t.checkQuotas(app, true); err != nil {
+		log.Warning("Can't deploy another instance of %s, because %v", app.GetId(), err)
+		return err
 	}
 	log.Debug("We can deploy more instances of %+v", app)
 	component := protocol.ScheduledApp{
 		AppId: app.Id,
 		App:   app,
 	}
-	t.queue.Enqueue(&component)
+	if expedite {
+		component.Expedite = proto.Bool(true)
+	}
+	if err := t.queue.Enqueue(&component); err != nil {
+		return err
+	}
+	t.publish(events.ForApp(events.DeploymentQueued, app).WithData(map[string]bool{"expedite": expedite}))
+	return nil
 }
 
 // RunningApps finds all the tasks that are currently running
@@ -254,96 +489,129 @@ func (t *DefaultTaskManager) FindTaskForComponent(task string) (*mesos.TaskID, e
 	return res.TaskId, nil
 }
 
+// FindDeployments finds all the deployments that match the predicate
+func (t *DefaultTaskManager) FindDeployments(predicate func(*protocol.Deployment) bool) ([]*protocol.Deployment, error) {
+	return t.taskStore.Filter(predicate)
+}
+
+// StartRollout starts replacing the deployed versions of the app's component with the app,
+// it returns nil when no other version of the component is deployed.
+func (t *DefaultTaskManager) StartRollout(app *protocol.Application, strategy RolloutStrategy) (*Rollout, error) {
+	rollout, err := t.rollouts.start(app, strategy)
+	if rollout != nil {
+		t.crashes.deployed(app)
+	}
+	return rollout, err
+}
+
+// Rollouts returns all the rollouts this task manager knows about
+func (t *DefaultTaskManager) Rollouts() []*Rollout {
+	return t.rollouts.list()
+}
+
+// Rollout returns the rollout of the app with the provided id
+func (t *DefaultTaskManager) Rollout(appID string) (*Rollout, bool) {
+	return t.rollouts.get(appID)
+}
+
+// ResumeRollout continues a paused rollout
+func (t *DefaultTaskManager) ResumeRollout(appID string) (*Rollout, error) {
+	return t.rollouts.resume(appID)
+}
+
+// RollBack replaces the new instances of a rollout with the version they replaced
+func (t *DefaultTaskManager) RollBack(appID string) (*Rollout, error) {
+	return t.rollouts.rollback(appID)
+}
+
 func (t *DefaultTaskManager) buildTaskInfo(offer mesos.Offer, scheduled *protocol.ScheduledApp) (mesos.TaskInfo, []*protocol.PortMapping) {
 	taskID, _ := t.context.IDGenerator.Next()
 	return t.builder.BuildTaskInfo(taskID, &offer, scheduled)
 }
 
-func (t *DefaultTaskManager) fitsInOffer(offer mesos.Offer, component *protocol.ScheduledApp) bool {
+func (t *DefaultTaskManager) fitsInOffer(offer *offerResources, component *protocol.ScheduledApp) bool {
 	log.Debug("Checking that %+v fits in %+v", offer, component)
-	var availCpus float64
-	var availMem float64
-	var maxPortsLen uint64
-
-	for _, resource := range offer.Resources {
-		switch resource.GetName() {
-		case "cpus":
-			availCpus = availCpus + resource.GetScalar().GetValue()
-		case "mem":
-			availMem = availMem + resource.GetScalar().GetValue()
-		case "ports":
-			var max uint64
-			for _, r := range resource.GetRanges().GetRange() {
-				numAvail := r.GetEnd() - r.GetBegin() + 1
-				if max < numAvail {
-					max = numAvail
-				}
-			}
-			maxPortsLen = max
-		}
-	}
-
 	comp := component.App
 
-	hasEnoughCPU := availCpus >= float64(comp.GetCpus())
-	hasEnoughMem := availMem >= float64(comp.GetMem())
-	hasEnoughPorts := int(maxPortsLen) >= len(comp.GetPorts())
-	log.Debug("the offer\ncpu: %t,\nmem: %t,\nports: %t", hasEnoughCPU, hasEnoughMem, hasEnoughPorts)
+	missing := missingResources(offer, comp)
+	log.Debug("the offer is missing: %v", missing)
 
-	return hasEnoughCPU && hasEnoughMem && hasEnoughPorts
+	return len(missing) == 0
 }
 
-// FulfillOffer tries to fullfil an offer with the biggest and oldest enqueued thing it can find.
+// FulfillOffer tries to fullfil an offer with the biggest and oldest enqueued things it can find.
+// It keeps placing queued items into the resources that remain in the offer after each launched task
+// until nothing in the queue fits anymore.
+// Items are only placed on the slave when it meets their placement constraints
+// and launching them doesn't exceed their quotas.
 // this can be an expensive operation when the queue is large, in practice this queue should never
 // get very large because that would indicate we're grossly underprovisioned
 // So when this starts taking too long we should provide more instances to this cluster
 func (t *DefaultTaskManager) FulfillOffer(offer mesos.Offer) []mesos.TaskInfo {
+	available := newOfferResources(offer)
+	offered := t.slaves.observe(&offer)
+	instances := t.newDeployedInstances()
+	thatFits := func(i *protocol.ScheduledApp) bool {
+		reasons := t.unplaceable(available, offered, instances, i)
+		t.placements.checked(i, &offer, reasons)
+		return len(reasons) == 0
+	}
 
-	thatFits := func(i *protocol.ScheduledApp) bool { return t.fitsInOffer(offer, i) }
-
-	var item *protocol.ScheduledApp
-	seen := false
-	// dequeue items that fit but are saturated until we get one that fits and isn't saturated
-	// in theory this should not occur because we've got this guard at enqueue time too.
-	for item == nil && !seen && t.slaMonitor.CanDeployMoreInstances(item.GetApp()) {
-		// for item == nil && !seen {
+	var tasks []mesos.TaskInfo
+	for {
 		log.Debug("Checking queue: %+v", t.queue)
-		i, err := t.queue.DequeueFirst(thatFits)
+		item, err := t.queue.DequeueFirst(thatFits)
 		if err != nil {
 			log.Critical("Couldn't dequeue from the task queue because: %v", err)
-			return nil
+			break
+		}
+		if item == nil {
+			log.Debug("Couldn't get another item of the queue for offer %s", offer.GetId().GetValue())
+			break
+		}
+		t.placements.forget(item)
+		t.preemption.release(queueKey(item))
+		// skip items that fit but are saturated,
+		// in theory this should not occur because we've got this guard at enqueue time too.
+		if !t.slaMonitor.CanDeployMoreInstances(item.GetApp()) {
+			log.Info("Dropping %s from the queue, the max instances have been reached", item.GetAppId())
+			continue
 		}
-		item = i
-		seen = true
-	}
-	if item == nil {
-		log.Debug("Couldn't get an item of the queue, skipping this one")
-		return nil
-	}
 
-	task, portMapping := t.buildTaskInfo(offer, item)
-	deploying := &protocol.Deployment{
-		AppId:       proto.String(item.GetAppId()),
-		TaskId:      task.GetTaskId(),
-		Status:      protocol.AppStatus_DEPLOYING.Enum(),
-		Slave:       task.GetSlaveId(),
-		HostName:    offer.Hostname,
-		PortMapping: portMapping,
-		DeployedAt:  proto.Int64(time.Now().UnixNano() / 1000000),
-	}
-	err := t.taskStore.Save(deploying)
-	if err != nil {
-		return []mesos.TaskInfo{}
+		task, portMapping := t.buildTaskInfo(available.remaining(), item)
+		deploying := &protocol.Deployment{
+			AppId:       proto.String(item.GetAppId()),
+			TaskId:      task.GetTaskId(),
+			Status:      protocol.AppStatus_DEPLOYING.Enum(),
+			Slave:       task.GetSlaveId(),
+			HostName:    offer.Hostname,
+			PortMapping: portMapping,
+			DeployedAt:  proto.Int64(time.Now().UnixNano() / 1000000),
+		}
+		if err := t.taskStore.Save(deploying); err != nil {
+			log.Warning("Failed to save task %v, putting %s back on the queue, because %v", task.GetTaskId().GetValue(), item.GetAppId(), err)
+			t.queue.Enqueue(item)
+			break
+		}
+		available.take(task.GetResources())
+		instances.launched(deploying)
+		t.publish(events.ForDeployment(events.DeploymentLaunched, deploying, item.GetApp()))
+		log.Debug("fullfilling offer with %+v", task)
+		tasks = append(tasks, task)
 	}
-	log.Debug("fullfilling offer with %+v", task)
-	return []mesos.TaskInfo{task}
+	return tasks
 }
 
-func (t *DefaultTaskManager) updateStatus(taskID *mesos.TaskID, status protocol.AppStatus) error {
+// updateStatus saves the new status of the task and publishes an event of the event type,
+// an empty event type doesn't publish anything
+func (t *DefaultTaskManager) updateStatus(taskID *mesos.TaskID, status protocol.AppStatus, eventType string) error {
 	deploying, err := t.taskStore.Get(taskID.GetValue())
 	if err != nil {
 		return err
 	}
+	if deploying == nil {
+		return fmt.Errorf("task %s is unknown to the task store", taskID.GetValue())
+	}
 	deploying.Status = status.Enum()
 
 	if err := t.taskStore.Save(deploying); err != nil {
@@ -356,11 +624,12 @@ func (t *DefaultTaskManager) updateStatus(taskID *mesos.TaskID, status protocol.
 	if err != nil {
 		log.Warning("Failed to retrieve application %v, because %v", deploying.GetAppId(), err)
 	}
+	if eventType != "" {
+		t.publish(events.ForDeployment(eventType, deploying, app))
+	}
 
 	if app != nil {
-		if t.slaMonitor.NeedsMoreInstances(app) {
-			t.scheduleAppForDeployment(app)
-		}
+		t.replaceMissing(app, false)
 		if t.healtchecks != nil {
 			if deploying.GetStatus() == protocol.AppStatus_STARTED {
 				if err := t.healtchecks.Register(deploying, app); err != nil {
@@ -390,37 +659,109 @@ func (t *DefaultTaskManager) forgetTask(taskID *mesos.TaskID) {
 
 // TaskStopping transitions this task into the stopping state
 func (t *DefaultTaskManager) TaskStopping(taskID *mesos.TaskID) {
-	t.updateStatus(taskID, protocol.AppStatus_STOPPING)
+	t.updateStatus(taskID, protocol.AppStatus_STOPPING, "")
 }
 
-// TaskFailed a callback for when a task failed
+// TaskFailed a callback for when a task failed.
+// The failure is counted so the component backs off before it's deployed again
+// and stops being deployed when it keeps failing.
 func (t *DefaultTaskManager) TaskFailed(taskID *mesos.TaskID, slaveID *mesos.SlaveID) {
-	// Track failures and keep count, eventually alert
-	t.updateStatus(taskID, protocol.AppStatus_FAILED)
+	t.recordFailure(taskID)
+	t.updateStatus(taskID, protocol.AppStatus_FAILED, events.DeploymentFailed)
+}
+
+func (t *DefaultTaskManager) recordFailure(taskID *mesos.TaskID) {
+	deployment, err := t.taskStore.Get(taskID.GetValue())
+	if err != nil || deployment == nil {
+		return
+	}
+	app, err := t.appStore.Get(deployment.GetAppId())
+	if err != nil || app == nil {
+		return
+	}
+	if t.crashes.failed(app) {
+		log.Error("%s is crash looping, it won't be deployed again until it's cleared or a new version is deployed", app.GetId())
+	}
+}
+
+// replaceMissing queues another instance of the app when its SLA needs more instances,
+// unless a rollout manages the instances of the app. An expedited instance goes ahead of everything else in the queue.
+func (t *DefaultTaskManager) replaceMissing(app *protocol.Application, expedite bool) {
+	if !t.rollouts.inRollout(app.GetId()) && t.slaMonitor.NeedsMoreInstances(app) {
+		t.scheduleAfterBackoff(app, expedite)
+	}
+}
+
+// scheduleAfterBackoff enqueues the app right away when it didn't fail recently,
+// otherwise it enqueues the app when its backoff expires
+func (t *DefaultTaskManager) scheduleAfterBackoff(app *protocol.Application, expedite bool) {
+	wait, ok := t.crashes.delay(app)
+	if !ok {
+		log.Info("Not deploying %s because it's crash looping", app.GetId())
+		return
+	}
+	if wait <= 0 {
+		t.enqueue(app, expedite)
+		return
+	}
+	log.Info("Deploying %s again in %v because it failed", app.GetId(), wait)
+	t.crashes.deferRetry(app, wait, func() {
+		current, err := t.appStore.Get(app.GetId())
+		if err != nil || current == nil || !current.GetActive() {
+			return
+		}
+		t.replaceMissing(current, expedite)
+	})
+}
+
+// CrashLoops returns the components that failed recently and whether they are crash looping
+func (t *DefaultTaskManager) CrashLoops() []CrashLoop {
+	return t.crashes.list()
+}
+
+// ClearCrashLoop forgets the failures of a component so it gets deployed again,
+// it returns false when the component didn't fail recently
+func (t *DefaultTaskManager) ClearCrashLoop(appName, component string) bool {
+	if !t.crashes.clear(appName, component) {
+		return false
+	}
+	apps, err := t.appStore.Filter(func(app *protocol.Application) bool {
+		return app.GetAppName() == appName && app.GetName() == component && app.GetActive()
+	})
+	if err != nil {
+		log.Warning("Couldn't find the apps for %s/%s, because %v", appName, component, err)
+		return true
+	}
+	for _, app := range apps {
+		if !t.rollouts.inRollout(app.GetId()) && t.slaMonitor.NeedsMoreInstances(app) {
+			t.scheduleAppForDeployment(app)
+		}
+	}
+	return true
 }
 
 // TaskFinished a callback for when a task finishes successfully
 func (t *DefaultTaskManager) TaskFinished(taskID *mesos.TaskID, slaveID *mesos.SlaveID) {
 	// Move task into finished state, delete in 30 days
-	t.updateStatus(taskID, protocol.AppStatus_STOPPED)
+	t.updateStatus(taskID, protocol.AppStatus_STOPPED, "")
 }
 
 // TaskKilled a callback for when a task is killed
 func (t *DefaultTaskManager) TaskKilled(taskID *mesos.TaskID, slaveID *mesos.SlaveID) {
 	// This is generally the tail end of a migration step
-	t.updateStatus(taskID, protocol.AppStatus_STOPPED)
+	t.updateStatus(taskID, protocol.AppStatus_STOPPED, events.DeploymentKilled)
 }
 
 // TaskLost a callback for when a task was lost
 func (t *DefaultTaskManager) TaskLost(taskID *mesos.TaskID, slaveID *mesos.SlaveID) {
 	// Uh Oh I suppose we'd better reschedule this one ahead of everybody else
-	t.updateStatus(taskID, protocol.AppStatus_FAILED)
+	t.updateStatus(taskID, protocol.AppStatus_FAILED, events.DeploymentLost)
 }
 
 // TaskRunning a callback for when a task enters the running state
 func (t *DefaultTaskManager) TaskRunning(taskID *mesos.TaskID, slaveID *mesos.SlaveID) {
 	// All is well put this task in the running state in the UI
-	err := t.updateStatus(taskID, protocol.AppStatus_STARTED)
+	err := t.updateStatus(taskID, protocol.AppStatus_STARTED, events.DeploymentRunning)
 	if err != nil {
 		log.Error("%v", err)
 	}
@@ -433,6 +774,63 @@ func (t *DefaultTaskManager) TaskStaging(taskID *mesos.TaskID, slaveID *mesos.Sl
 	t.forgetTask(taskID)
 }
 
+// TaskDeploying a callback for when the master reports during reconciliation
+// that a task is still being launched, the task stays deploying.
+func (t *DefaultTaskManager) TaskDeploying(taskID *mesos.TaskID, slaveID *mesos.SlaveID) {
+	err := t.updateStatus(taskID, protocol.AppStatus_DEPLOYING, "")
+	if err != nil {
+		log.Error("%v", err)
+	}
+}
+
+// SlaveLost a callback for when a slave was lost.
+// All the deployments on that slave are marked as failed, their health checks are removed
+// and replacements are put at the front of the queue so the SLA minimum is restored first.
+// The replacements go through the same checks as the ones for lost or failed tasks,
+// so a rollout isn't doubled and a crash looping component isn't deployed again.
+func (t *DefaultTaskManager) SlaveLost(slaveID *mesos.SlaveID) {
+	lost, err := t.taskStore.Filter(func(item *protocol.Deployment) bool {
+		return item.GetSlave().GetValue() == slaveID.GetValue() && t.wasAlive(item.GetStatus())
+	})
+	if err != nil {
+		log.Error("Couldn't find the deployments for lost slave %s, because %v", slaveID.GetValue(), err)
+		return
+	}
+	log.Warning("Slave %s was lost with %d deployments on it", slaveID.GetValue(), len(lost))
+
+	for _, deployment := range lost {
+		taskID := deployment.GetTaskId()
+		deployment.Status = protocol.AppStatus_FAILED.Enum()
+		if err := t.taskStore.Save(deployment); err != nil {
+			log.Warning("Failed to save task %v, because %v", taskID.GetValue(), err)
+		}
+		app, _ := t.appStore.Get(deployment.GetAppId())
+		t.publish(events.ForDeployment(events.DeploymentLost, deployment, app))
+		if t.healtchecks != nil {
+			if err := t.healtchecks.Unregister(taskID); err != nil {
+				log.Warning("Failed to unregister health check for %v, because %v", taskID.GetValue(), err)
+			}
+		}
+	}
+
+	for _, deployment := range lost {
+		app, err := t.appStore.Get(deployment.GetAppId())
+		if err != nil {
+			log.Warning("Failed to retrieve application %v, because %v", deployment.GetAppId(), err)
+			continue
+		}
+		if app != nil && app.GetActive() {
+			t.replaceMissing(app, true)
+		}
+	}
+}
+
+func (t *DefaultTaskManager) wasAlive(status protocol.AppStatus) bool {
+	return status == protocol.AppStatus_STARTED ||
+		status == protocol.AppStatus_DEPLOYING ||
+		status == protocol.AppStatus_UNHEALTHY
+}
+
 // TaskStarting a callback for when a task transitions from staging to starting (is being deployed)
 func (t *DefaultTaskManager) TaskStarting(taskID *mesos.TaskID, slaveID *mesos.SlaveID) {
 	// We made it to a slave and the deployment process has begun
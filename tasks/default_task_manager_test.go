@@ -1,14 +1,18 @@
 package tasks
 
 import (
+	"io/ioutil"
 	"os"
 	"testing"
+	"time"
 
 	stdlog "log"
 
 	"code.google.com/p/goprotobuf/proto"
 	"github.com/op/go-logging"
 	"github.com/reverb/exeggutor"
+	"github.com/reverb/exeggutor/bus"
+	"github.com/reverb/exeggutor/health/sla"
 	. "github.com/reverb/exeggutor/health/test_utils"
 	"github.com/reverb/exeggutor/protocol"
 	"github.com/reverb/exeggutor/store"
@@ -41,6 +45,8 @@ func TestTaskManager(t *testing.T) {
 	}
 
 	Convey("TaskManager", t, func() {
+		context.Bus = bus.New()
+		kills := context.Bus.Subscribe(bus.TaskToKill, 64, bus.Block)
 		builder := builders.New(context.Config)
 		builder.PortPicker = &ConstantPortPicker{Port: 8000}
 
@@ -57,14 +63,32 @@ func TestTaskManager(t *testing.T) {
 			builder:     builder,
 			healtchecks: &NoopHealthChecker{},
 			closing:     make(chan chan bool),
-			tasksToKill: make(chan *mesos.TaskID),
 			slaMonitor:  &NoopSLAMonitor{},
 		}
+		mgr.rollouts = newRolloutManager(mgr, time.Hour)
+		mgr.preemption = newPreemptor(mgr, nil, time.Hour)
+		mgr.placements = newPlacementHistory(nil)
+		mgr.crashes = newCrashTracker(nil, nil)
+		mgr.slaves = newSlaveAttributes()
 		mgr.Start()
 
 		Reset(func() {
 			tq.Stop()
 			mgr.Stop()
+			context.Bus.Stop()
+		})
+
+		Convey("should skip the messages of the wrong type on the topics it follows", func() {
+			app := TestComponent("bus-app", "comp", 1.0, 64.0)
+			context.Bus.Publish(bus.HealthCheckFailed, "not a check result")
+			context.Bus.Publish(bus.ScaleRequested, &app)
+			context.Bus.Publish(bus.ScaleRequested, sla.ChangeDeployCount{App: &app, Count: 1})
+
+			deadline := time.Now().Add(time.Second)
+			for tq.CountAppsForID(app.GetId()) == 0 && time.Now().Before(deadline) {
+				time.Sleep(10 * time.Millisecond)
+			}
+			So(tq.CountAppsForID(app.GetId()), ShouldEqual, 1)
 		})
 
 		Convey("when enqueueing app manifests", func() {
@@ -131,6 +155,40 @@ func TestTaskManager(t *testing.T) {
 				So(actual.Resources, ShouldResemble, expectedResources)
 			})
 
+			Convey("should launch several queued items in the same offer", func() {
+				mgr.SubmitApp([]protocol.Application{
+					TestComponent("test-service-multi", "component-1", 1.0, 256.0),
+					TestComponent("test-service-multi", "component-2", 1.0, 256.0),
+					TestComponent("test-service-multi", "component-3", 1.0, 256.0),
+				})
+				offer := CreateOffer("offer-id-multi", 2.5, 1024.0)
+				reply := mgr.FulfillOffer(offer)
+
+				So(len(reply), ShouldEqual, 2)
+				So(reply[0].GetTaskId(), ShouldNotResemble, reply[1].GetTaskId())
+				So(q.Len(), ShouldEqual, 1)
+			})
+
+			Convey("should only place components that need disk space on slaves with enough disk", func() {
+				component := TestComponent("test-service-disk", "test-service-disk", 1.0, 256.0)
+				component.DiskSpace = proto.Int64(2048)
+				mgr.SubmitApp([]protocol.Application{component})
+
+				So(mgr.FulfillOffer(CreateOffer("offer-id-no-disk", 5.0, 1024.0)), ShouldBeEmpty)
+
+				offer := CreateOffer("offer-id-disk", 5.0, 1024.0)
+				offer.Resources = append(offer.Resources, mesos.ScalarResource("disk", 4096))
+				reply := mgr.FulfillOffer(offer)
+				So(reply, ShouldHaveLength, 1)
+				var disk float64
+				for _, resource := range reply[0].GetResources() {
+					if resource.GetName() == "disk" {
+						disk = resource.GetScalar().GetValue()
+					}
+				}
+				So(disk, ShouldEqual, 2048)
+			})
+
 			Convey("should return an empty array when the offer can't be fullfilled", func() {
 				component := TestComponent("test-service-yada", "test-service-yada", 5.0, 1024.0)
 
@@ -142,6 +200,76 @@ func TestTaskManager(t *testing.T) {
 			})
 		})
 
+		Convey("when placing components with constraints", func() {
+			offerOn := func(host, rack string) mesos.Offer {
+				offer := CreateOffer("offer-"+host, 8.0, 4096.0)
+				offer.Hostname = proto.String(host)
+				offer.Attributes = []*mesos.Attribute{{
+					Name: proto.String("rack"),
+					Type: mesos.Value_TEXT.Enum(),
+					Text: &mesos.Value_Text{Value: proto.String(rack)},
+				}}
+				return offer
+			}
+			constrained := func(constraints ...*protocol.PlacementConstraint) protocol.Application {
+				app := TestComponent("constrained", "web", 1.0, 256.0)
+				app.Constraints = constraints
+				mgr.SaveApp(&app)
+				return app
+			}
+			constraint := func(attribute string, operator protocol.ConstraintOperator, value string) *protocol.PlacementConstraint {
+				c := &protocol.PlacementConstraint{Attribute: proto.String(attribute), Operator: operator.Enum()}
+				if value != "" {
+					c.Value = proto.String(value)
+				}
+				return c
+			}
+
+			Convey("should place every instance on a different host when they are unique", func() {
+				app := constrained(constraint("hostname", protocol.ConstraintOperator_UNIQUE, ""))
+				mgr.SubmitApp([]protocol.Application{app, app})
+
+				So(mgr.FulfillOffer(offerOn("host-1", "r1")), ShouldHaveLength, 1)
+				So(mgr.FulfillOffer(offerOn("host-1", "r1")), ShouldBeEmpty)
+				So(mgr.FulfillOffer(offerOn("host-2", "r1")), ShouldHaveLength, 1)
+			})
+
+			Convey("should only place instances on slaves with matching attributes", func() {
+				app := constrained(constraint("rack", protocol.ConstraintOperator_LIKE, "r[12]"))
+				mgr.SubmitApp([]protocol.Application{app})
+
+				So(mgr.FulfillOffer(offerOn("host-3", "r3")), ShouldBeEmpty)
+				So(mgr.FulfillOffer(offerOn("host-1", "r1")), ShouldHaveLength, 1)
+			})
+
+			Convey("should not place instances on slaves with excluded attributes", func() {
+				app := constrained(constraint("rack", protocol.ConstraintOperator_UNLIKE, "r1"))
+				mgr.SubmitApp([]protocol.Application{app})
+
+				So(mgr.FulfillOffer(offerOn("host-1", "r1")), ShouldBeEmpty)
+				So(mgr.FulfillOffer(offerOn("host-2", "r2")), ShouldHaveLength, 1)
+			})
+
+			Convey("should spread instances evenly over the racks", func() {
+				app := constrained(constraint("rack", protocol.ConstraintOperator_GROUP_BY, ""))
+				mgr.FulfillOffer(offerOn("host-2", "r2"))
+				mgr.SubmitApp([]protocol.Application{app, app, app})
+
+				So(mgr.FulfillOffer(offerOn("host-1", "r1")), ShouldHaveLength, 1)
+				So(mgr.FulfillOffer(offerOn("host-1", "r1")), ShouldBeEmpty)
+				So(mgr.FulfillOffer(offerOn("host-2", "r2")), ShouldHaveLength, 1)
+				So(mgr.FulfillOffer(offerOn("host-1", "r1")), ShouldHaveLength, 1)
+			})
+
+			Convey("should limit the instances per host", func() {
+				app := constrained(constraint("hostname", protocol.ConstraintOperator_MAX_PER, "2"))
+				mgr.SubmitApp([]protocol.Application{app, app, app})
+
+				So(mgr.FulfillOffer(offerOn("host-1", "r1")), ShouldHaveLength, 2)
+				So(mgr.FulfillOffer(offerOn("host-2", "r1")), ShouldHaveLength, 1)
+			})
+		})
+
 		Convey("when handling callbacks", func() {
 
 			Convey("should remove persisted items from the persistent store when they fail", func() {
@@ -214,6 +342,55 @@ func TestTaskManager(t *testing.T) {
 				So(actual, ShouldResemble, deployed)
 			})
 
+			Convey("should back off before deploying a failed component again", func() {
+				id, _, app := SetupCallbackTestData(ts, as, builder)
+				mgr.TaskFailed(id, nil)
+
+				So(q.Len(), ShouldEqual, 0)
+				crashes := mgr.CrashLoops()
+				So(crashes, ShouldHaveLength, 1)
+				So(crashes[0].AppID, ShouldEqual, app.GetId())
+				So(crashes[0].Failures, ShouldEqual, 1)
+				So(crashes[0].CrashLooping, ShouldBeFalse)
+
+				Convey("and deploy it right away when cleared", func() {
+					So(mgr.ClearCrashLoop(app.GetAppName(), app.GetName()), ShouldBeTrue)
+					So(q.Len(), ShouldEqual, 1)
+					So(mgr.CrashLoops(), ShouldBeEmpty)
+				})
+			})
+
+			Convey("should fail the deployments on a lost slave and expedite their replacements", func() {
+				id, deployed, _ := SetupCallbackTestData(ts, as, builder)
+				mgr.SlaveLost(deployed.GetSlave())
+
+				bytes, err := ts.Get(id.GetValue())
+				So(err, ShouldBeNil)
+
+				actual := protocol.Deployment{}
+				proto.Unmarshal(bytes, &actual)
+				So(actual.GetStatus(), ShouldEqual, protocol.AppStatus_FAILED)
+				So(q.Len(), ShouldEqual, 1)
+				So((*q)[0].GetAppId(), ShouldEqual, deployed.GetAppId())
+				So((*q)[0].GetExpedite(), ShouldBeTrue)
+			})
+
+			Convey("should back off before replacing the deployments on a lost slave of a failing component", func() {
+				_, deployed, app := SetupCallbackTestData(ts, as, builder)
+				mgr.crashes.failed(&app)
+				mgr.SlaveLost(deployed.GetSlave())
+
+				So(q.Len(), ShouldEqual, 0)
+			})
+
+			Convey("should leave the deployments on a lost slave to the rollout that replaces them", func() {
+				_, deployed, app := SetupCallbackTestData(ts, as, builder)
+				mgr.rollouts.rollouts[app.GetId()] = &Rollout{ID: app.GetId(), State: RolloutRunning}
+				mgr.SlaveLost(deployed.GetSlave())
+
+				So(q.Len(), ShouldEqual, 0)
+			})
+
 			Convey("should remove persisted items from the store for staging", func() {
 				id, _, _ := SetupCallbackTestData(ts, as, builder)
 
@@ -233,6 +410,459 @@ func TestTaskManager(t *testing.T) {
 			})
 		})
 
+		Convey("when the SLA monitor asks to scale", func() {
+			saveDeployments := func(statuses ...protocol.AppStatus) []protocol.Deployment {
+				var result []protocol.Deployment
+				for i, status := range statuses {
+					deployed, app := BuildStoreTestData2(1, 1, i+1, builder)
+					deployed.Status = status.Enum()
+					deployed.DeployedAt = proto.Int64(int64(i + 1))
+					SaveStoreTestData(ts, as, &deployed, &app)
+					result = append(result, deployed)
+				}
+				return result
+			}
+			killed := func(count int) []*mesos.TaskID {
+				var result []*mesos.TaskID
+				for i := 0; i < count; i++ {
+					select {
+					case msg := <-kills.Messages():
+						result = append(result, msg.(*mesos.TaskID))
+					case <-time.After(time.Second):
+						return result
+					}
+				}
+				return result
+			}
+
+			Convey("should enqueue the missing instances when scaling up", func() {
+				app := TestComponent("app-store-1", "app-1", 1, 64)
+				mgr.scaleUp(sla.ChangeDeployCount{App: &app, Count: 2})
+				So(q.Len(), ShouldEqual, 2)
+			})
+
+			Convey("should drop queued instances first when scaling down", func() {
+				app := TestComponent("app-store-1", "app-1", 1, 64)
+				mgr.SubmitApp([]protocol.Application{app, app})
+				mgr.scaleDown(sla.ChangeDeployCount{App: &app, Count: -1})
+				So(q.Len(), ShouldEqual, 1)
+			})
+
+			Convey("should stop the newest instances when scaling down", func() {
+				deployed := saveDeployments(protocol.AppStatus_STARTED, protocol.AppStatus_STARTED, protocol.AppStatus_STARTED)
+				app := TestComponent("app-store-1", "app-1", 1, 64)
+				go mgr.scaleDown(sla.ChangeDeployCount{App: &app, Count: -2})
+
+				So(killed(2), ShouldResemble, []*mesos.TaskID{deployed[2].TaskId, deployed[1].TaskId})
+			})
+
+			Convey("should not stop instances that already stopped", func() {
+				deployed := saveDeployments(protocol.AppStatus_STARTED, protocol.AppStatus_STOPPED)
+				app := TestComponent("app-store-1", "app-1", 1, 64)
+				go mgr.scaleDown(sla.ChangeDeployCount{App: &app, Count: -2})
+
+				So(killed(2), ShouldResemble, []*mesos.TaskID{deployed[0].TaskId})
+			})
+
+			Convey("should stop the tasks of an inactive app that are named in the request", func() {
+				deployed := saveDeployments(protocol.AppStatus_STARTED, protocol.AppStatus_STARTED)
+				app := TestComponent("app-store-1", "app-1", 1, 64)
+				app.Active = proto.Bool(false)
+				go mgr.scaleDown(sla.ChangeDeployCount{App: &app, Tasks: []*mesos.TaskID{deployed[0].TaskId}, Count: -1})
+
+				So(killed(2), ShouldResemble, []*mesos.TaskID{deployed[0].TaskId})
+			})
+		})
+
+		Convey("when operators stop, kill or scale", func() {
+			deployed, app := BuildStoreTestData(1, builder)
+			app.Sla = &protocol.ApplicationSLA{
+				MinInstances: proto.Int32(2),
+				MaxInstances: proto.Int32(2),
+				HealthCheck: &protocol.HealthCheck{
+					Mode:           protocol.HealthCheckMode_HTTP.Enum(),
+					RampUp:         proto.Int64(0),
+					IntervalMillis: proto.Int64(1000),
+					Timeout:        proto.Int64(1000),
+				},
+				UnhealthyAt: proto.Int32(3),
+			}
+			SaveStoreTestData(ts, as, &deployed, &app)
+			newer, _ := BuildStoreTestData2(1, 1, 2, builder)
+			newer.DeployedAt = proto.Int64(deployed.GetDeployedAt() + 1)
+			SaveStoreTestData(ts, as, &newer, &app)
+
+			// the operations return before the kills are published, so wait for a kill of every returned task
+			killing := func(operation func() []*mesos.TaskID) ([]*mesos.TaskID, []*mesos.TaskID) {
+				returned := operation()
+				var killed []*mesos.TaskID
+				for len(killed) < len(returned) {
+					select {
+					case msg := <-kills.Messages():
+						killed = append(killed, msg.(*mesos.TaskID))
+					case <-time.After(time.Second):
+						return returned, killed
+					}
+				}
+				return returned, killed
+			}
+
+			Convey("should deactivate a component, drop its queued instances and stop its tasks", func() {
+				scheduled := ScheduledComponent(&app)
+				tq.Enqueue(&scheduled)
+
+				stopped, killed := killing(func() []*mesos.TaskID {
+					ids, _ := mgr.StopComponent(app.GetAppName(), app.GetName())
+					return ids
+				})
+				So(stopped, ShouldHaveLength, 2)
+				So(killed, ShouldResemble, stopped)
+				So(q.Len(), ShouldEqual, 0)
+				stored, _ := mgr.appStore.Get(app.GetId())
+				So(stored.GetActive(), ShouldBeFalse)
+			})
+
+			Convey("should replace a single task", func() {
+				replaced, killed := killing(func() []*mesos.TaskID {
+					id, _ := mgr.KillTask(deployed.GetTaskId().GetValue(), true)
+					return []*mesos.TaskID{id}
+				})
+				So(replaced, ShouldResemble, []*mesos.TaskID{deployed.TaskId})
+				So(killed, ShouldResemble, []*mesos.TaskID{deployed.TaskId})
+				So(tq.CountAppsForID(app.GetId()), ShouldEqual, 1)
+				stopping, _ := mgr.taskStore.Get(deployed.GetTaskId().GetValue())
+				So(stopping.GetStatus(), ShouldEqual, protocol.AppStatus_STOPPING)
+			})
+
+			Convey("should replace the tasks of a component that runs the same version", func() {
+				replaced, killed := killing(func() []*mesos.TaskID {
+					ids, _ := mgr.ReplaceComponent(&app)
+					return ids
+				})
+				So(replaced, ShouldHaveLength, 2)
+				So(killed, ShouldResemble, replaced)
+				So(tq.CountAppsForID(app.GetId()), ShouldEqual, 2)
+				stopping, _ := mgr.taskStore.Get(deployed.GetTaskId().GetValue())
+				So(stopping.GetStatus(), ShouldEqual, protocol.AppStatus_STOPPING)
+			})
+
+			Convey("should not kill unknown tasks", func() {
+				id, err := mgr.KillTask("unknown-task", false)
+				So(err, ShouldBeNil)
+				So(id, ShouldBeNil)
+			})
+
+			Convey("should stop the newest instances when scaling a component down", func() {
+				stopped, killed := killing(func() []*mesos.TaskID {
+					ids, _ := mgr.ScaleComponent(app.GetAppName(), app.GetName(), 1)
+					return ids
+				})
+				So(stopped, ShouldResemble, []*mesos.TaskID{newer.TaskId})
+				So(killed, ShouldResemble, stopped)
+				stored, _ := mgr.appStore.Get(app.GetId())
+				So(stored.GetSla().GetMinInstances(), ShouldEqual, 1)
+				So(stored.GetSla().GetMaxInstances(), ShouldEqual, app.GetSla().GetMaxInstances())
+			})
+
+			Convey("should queue the missing instances when scaling a component up", func() {
+				stopped, err := mgr.ScaleComponent(app.GetAppName(), app.GetName(), 4)
+				So(err, ShouldBeNil)
+				So(stopped, ShouldBeEmpty)
+				So(tq.CountAppsForID(app.GetId()), ShouldEqual, 2)
+				stored, _ := mgr.appStore.Get(app.GetId())
+				So(stored.GetSla().GetMinInstances(), ShouldEqual, 4)
+				So(stored.GetSla().GetMaxInstances(), ShouldEqual, 4)
+			})
+		})
+
+		Convey("when enforcing quotas", func() {
+			quotas := mgr.appStore.Quotas()
+
+			Convey("should refuse to enqueue more instances than the quota of the app allows", func() {
+				quotas.Save(&protocol.ResourceQuota{
+					Scope:     protocol.QuotaScope_APP.Enum(),
+					Name:      proto.String("quota-app"),
+					Instances: proto.Int32(1),
+				})
+				app := TestComponent("quota-app", "comp", 1.0, 64.0)
+				mgr.SaveApp(&app)
+
+				So(mgr.SubmitApp([]protocol.Application{app}), ShouldBeNil)
+				err := mgr.SubmitApp([]protocol.Application{app})
+				So(err, ShouldNotBeNil)
+				quotaErr, ok := err.(*QuotaExceededError)
+				So(ok, ShouldBeTrue)
+				So(quotaErr.Resource, ShouldEqual, "instances")
+				So(quotaErr.Claimed, ShouldEqual, 1)
+				So(q.Len(), ShouldEqual, 1)
+			})
+
+			Convey("should not launch queued instances that exceed the quota of their team", func() {
+				deployed, app := BuildStoreTestData(1, builder)
+				app.Team = proto.String("search")
+				SaveStoreTestData(ts, as, &deployed, &app)
+				quotas.Save(&protocol.ResourceQuota{
+					Scope: protocol.QuotaScope_TEAM.Enum(),
+					Name:  proto.String("search"),
+					Cpus:  proto.Float32(1.5),
+				})
+
+				other := TestComponent("other-app", "comp", 1.0, 64.0)
+				other.Team = proto.String("search")
+				scheduled := ScheduledComponent(&other)
+				tq.Enqueue(&scheduled)
+
+				So(mgr.FulfillOffer(CreateOffer("slave-1", 8, 1024)), ShouldBeEmpty)
+				So(q.Len(), ShouldEqual, 1)
+			})
+
+			Convey("should report the deployed and queued resources claimed against a quota", func() {
+				deployed, app := BuildStoreTestData(1, builder)
+				SaveStoreTestData(ts, as, &deployed, &app)
+				scheduled := ScheduledComponent(&app)
+				tq.Enqueue(&scheduled)
+
+				quota := &protocol.ResourceQuota{
+					Scope: protocol.QuotaScope_APP.Enum(),
+					Name:  proto.String(app.GetAppName()),
+					Mem:   proto.Float32(1024),
+				}
+				usage, err := mgr.QuotaUsage(quota)
+				So(err, ShouldBeNil)
+				So(usage.Limits.Mem, ShouldEqual, 1024)
+				So(usage.Deployed, ShouldResemble, Resources{Cpus: 1, Mem: 64, Instances: 1})
+				So(usage.Queued, ShouldResemble, Resources{Cpus: 1, Mem: 64, Instances: 1})
+			})
+		})
+
+		Convey("when explaining the queue", func() {
+			big := TestComponent("queue-app", "big", 4.0, 256.0)
+			small := TestComponent("queue-app", "small", 1.0, 2048.0)
+			mgr.SubmitApp([]protocol.Application{small, big})
+
+			Convey("should list the queued items in the order they would be placed", func() {
+				items := mgr.QueuedItems()
+				So(items, ShouldHaveLength, 2)
+				So(items[0].Component, ShouldEqual, "big")
+				So(items[0].Position, ShouldEqual, 0)
+				So(items[0].Resources, ShouldResemble, Resources{Cpus: 4, Mem: 256, Instances: 1})
+				So(items[1].Component, ShouldEqual, "small")
+				So(items[1].Offers, ShouldBeEmpty)
+			})
+
+			Convey("should explain why the offers didn't fit", func() {
+				So(mgr.FulfillOffer(CreateOffer("offer-too-small", 2.0, 1024.0)), ShouldBeEmpty)
+
+				items := mgr.QueuedItems()
+				So(items[0].Offers, ShouldHaveLength, 1)
+				So(items[0].Offers[0].OfferID, ShouldEqual, "offer-too-small")
+				So(items[0].Offers[0].Fits, ShouldBeFalse)
+				So(items[0].Offers[0].Reasons, ShouldResemble, []string{"not enough cpus: 4 needed, 2 offered"})
+				So(items[1].Offers[0].Reasons, ShouldResemble, []string{"not enough mem: 2048 needed, 1024 offered"})
+			})
+
+			Convey("should only keep the last offers of every item", func() {
+				for i := 0; i < defaultOfferHistory+2; i++ {
+					mgr.FulfillOffer(CreateOffer("offer-too-small", 0.5, 128.0))
+				}
+				So(mgr.QueuedItems()[0].Offers, ShouldHaveLength, defaultOfferHistory)
+			})
+
+			Convey("should cancel a single queued item", func() {
+				item := mgr.QueuedItems()[1]
+				cancelled, err := mgr.CancelQueued("queue-app", "small", item.ID)
+				So(err, ShouldBeNil)
+				So(cancelled, ShouldEqual, 1)
+				cancelled, _ = mgr.CancelQueued("queue-app", "small", item.ID)
+				So(cancelled, ShouldEqual, 0)
+				So(q.Len(), ShouldEqual, 1)
+			})
+
+			Convey("should cancel all the queued items of a component", func() {
+				mgr.SubmitApp([]protocol.Application{big})
+				cancelled, err := mgr.CancelQueued("queue-app", "big", "")
+				So(err, ShouldBeNil)
+				So(cancelled, ShouldEqual, 2)
+				So(mgr.QueuedItems(), ShouldHaveLength, 1)
+			})
+
+			Convey("should refuse to cancel the queued items the SLA monitor would queue again", func() {
+				big.Sla = &protocol.ApplicationSLA{
+					MinInstances: proto.Int32(1),
+					MaxInstances: proto.Int32(1),
+				}
+				mgr.SaveApp(&big)
+
+				cancelled, err := mgr.CancelQueued("queue-app", "big", "")
+				So(cancelled, ShouldEqual, 0)
+				So(err, ShouldHaveSameTypeAs, &ManagedBySLAError{})
+				So(q.Len(), ShouldEqual, 2)
+			})
+		})
+
+		Convey("when preempting", func() {
+			slave := CreateOffer("slave-1", 8, 1024)
+			slave.Hostname = proto.String("exeggutor-slave-instance-1")
+			mgr.slaves.observe(&slave)
+
+			deployed, app := BuildStoreTestData(1, builder)
+			app.PriorityClass = protocol.PriorityClass_LOW.Enum()
+			deployed.PortMapping = []*protocol.PortMapping{
+				&protocol.PortMapping{Scheme: proto.String("http"), PrivatePort: proto.Int32(8000), PublicPort: proto.Int32(31000)},
+			}
+			SaveStoreTestData(ts, as, &deployed, &app)
+
+			urgent := func(class protocol.PriorityClass, waited time.Duration) *protocol.ScheduledApp {
+				component := TestComponent("urgent-app", "comp", 1.0, 64.0)
+				component.PriorityClass = class.Enum()
+				scheduled := ScheduledComponent(&component)
+				tq.Enqueue(&scheduled)
+				scheduled.Since = proto.Int64(time.Now().Add(-waited).UnixNano())
+				return &scheduled
+			}
+			preempted := func() []*mesos.TaskID {
+				go mgr.preemption.step()
+				var result []*mesos.TaskID
+				select {
+				case msg := <-kills.Messages():
+					result = append(result, msg.(*mesos.TaskID))
+				case <-time.After(100 * time.Millisecond):
+				}
+				return result
+			}
+
+			Convey("should stop a lower priority deployment and requeue it when a critical item waited too long", func() {
+				urgent(protocol.PriorityClass_CRITICAL, 5*time.Minute)
+
+				So(preempted(), ShouldResemble, []*mesos.TaskID{deployed.TaskId})
+				So(tq.CountsForApps()[app.GetId()], ShouldEqual, 1)
+				stopping, _ := mgr.taskStore.Get(deployed.GetTaskId().GetValue())
+				So(stopping.GetStatus(), ShouldEqual, protocol.AppStatus_STOPPING)
+			})
+
+			Convey("should not stop deployments for items that didn't wait long enough", func() {
+				urgent(protocol.PriorityClass_CRITICAL, time.Second)
+				So(preempted(), ShouldBeEmpty)
+			})
+
+			Convey("should not stop deployments for items with a normal priority", func() {
+				urgent(protocol.PriorityClass_NORMAL, 5*time.Minute)
+				So(preempted(), ShouldBeEmpty)
+			})
+
+			Convey("should make room only once for the same item", func() {
+				urgent(protocol.PriorityClass_HIGH, 5*time.Minute)
+				other, otherApp := BuildStoreTestData(2, builder)
+				otherApp.PriorityClass = protocol.PriorityClass_LOW.Enum()
+				SaveStoreTestData(ts, as, &other, &otherApp)
+
+				So(preempted(), ShouldHaveLength, 1)
+				So(preempted(), ShouldBeEmpty)
+			})
+
+			Convey("should not stop deployments that don't free up enough ports", func() {
+				item := urgent(protocol.PriorityClass_CRITICAL, 5*time.Minute)
+				item.GetApp().Ports = append(item.GetApp().Ports, &protocol.StringIntKeyValue{
+					Key:   proto.String("admin"),
+					Value: proto.Int32(8001),
+				})
+				So(preempted(), ShouldBeEmpty)
+			})
+
+			Convey("should keep the freed host for the item that made room", func() {
+				item := urgent(protocol.PriorityClass_CRITICAL, 5*time.Minute)
+				So(preempted(), ShouldHaveLength, 1)
+
+				key, reserved := mgr.preemption.reservedFor(deployed.GetHostName())
+				So(reserved, ShouldBeTrue)
+				So(key, ShouldEqual, queueKey(item))
+
+				freed := CreateOffer("slave-1", 8, 1024)
+				freed.Hostname = proto.String(deployed.GetHostName())
+				for _, queued := range tq.Items() {
+					if queued.GetAppId() == app.GetId() {
+						So(mgr.unplaceable(newOfferResources(freed), nil, mgr.newDeployedInstances(), queued), ShouldResemble,
+							[]string{"the host is reserved for the item that preempted deployments on it"})
+					}
+				}
+				launched := mgr.FulfillOffer(freed)
+				So(launched, ShouldNotBeEmpty)
+				So(launched[0].GetName(), ShouldEqual, item.GetAppId())
+
+				_, reserved = mgr.preemption.reservedFor(deployed.GetHostName())
+				So(reserved, ShouldBeFalse)
+			})
+		})
+
+		Convey("when creating its queue", func() {
+			data, err := ioutil.TempDir("", "agora-queue-data")
+			So(err, ShouldBeNil)
+			defer os.RemoveAll(data)
+
+			Convey("should keep the queue in memory unless persistence is enabled", func() {
+				_, err := newTaskQueue(&exeggutor.Config{DataDirectory: data, FrameworkInfo: &exeggutor.FrameworkConfig{}})
+				So(err, ShouldBeNil)
+				_, err = os.Stat(data + "/queue")
+				So(os.IsNotExist(err), ShouldBeTrue)
+			})
+
+			Convey("should keep the queue in the data directory when persistence is enabled", func() {
+				_, err := newTaskQueue(&exeggutor.Config{DataDirectory: data, FrameworkInfo: &exeggutor.FrameworkConfig{PersistQueue: true}})
+				So(err, ShouldBeNil)
+				_, err = os.Stat(data + "/queue")
+				So(err, ShouldBeNil)
+			})
+		})
+
+		Convey("when restarting", func() {
+			Convey("should register the health checks of the running deployments and schedule the apps again", func() {
+				deployed, app := BuildStoreTestData(1, builder)
+				SaveStoreTestData(ts, as, &deployed, &app)
+				stopped, other := BuildStoreTestData(2, builder)
+				stopped.Status = protocol.AppStatus_STOPPING.Enum()
+				SaveStoreTestData(ts, as, &stopped, &other)
+
+				checks := &registeringHealthChecker{}
+				restarted := *mgr
+				restarted.healtchecks = checks
+				So(restarted.restore(), ShouldBeNil)
+
+				So(checks.registered, ShouldResemble, []string{deployed.GetTaskId().GetValue()})
+				So(q.Len(), ShouldEqual, 2)
+			})
+
+			Convey("should restore the deployments it saved in its data directory", func() {
+				data, err := ioutil.TempDir("", "agora-tasks-data")
+				So(err, ShouldBeNil)
+				defer os.RemoveAll(data)
+				config := &exeggutor.Config{DataDirectory: data}
+
+				saved, err := task_store.New(config)
+				So(err, ShouldBeNil)
+				So(saved.Start(), ShouldBeNil)
+				deployed, app := BuildStoreTestData(1, builder)
+				So(saved.Save(&deployed), ShouldBeNil)
+				So(mgr.appStore.Save(&app), ShouldBeNil)
+				So(saved.Stop(), ShouldBeNil)
+
+				reopened, err := task_store.New(config)
+				So(err, ShouldBeNil)
+				So(reopened.Start(), ShouldBeNil)
+				defer reopened.Stop()
+
+				checks := &registeringHealthChecker{}
+				restarted := *mgr
+				restarted.taskStore = reopened
+				restarted.healtchecks = checks
+				So(restarted.restore(), ShouldBeNil)
+
+				restored, err := reopened.Get(deployed.GetTaskId().GetValue())
+				So(err, ShouldBeNil)
+				So(restored.GetStatus(), ShouldEqual, protocol.AppStatus_STARTED)
+				So(checks.registered, ShouldResemble, []string{deployed.GetTaskId().GetValue()})
+			})
+		})
+
 		Convey("when finding deployed apps", func() {
 			Convey("should find all components for a specified app", func() {
 				deployed, apps := CreateFilterData(ts, as, builder)
@@ -260,6 +890,50 @@ func TestTaskManager(t *testing.T) {
 				So(err, ShouldBeNil)
 				So(actual, ShouldResemble, expected)
 			})
+
+			Convey("should list the tasks of a component with where they run", func() {
+				deployed, apps := CreateFilterData(ts, as, builder)
+
+				actual, err := mgr.ListTasks(TaskFilter{AppName: apps[3].GetAppName(), Component: apps[3].GetName()})
+				So(err, ShouldBeNil)
+				So(actual, ShouldHaveLength, 2)
+				for _, task := range actual {
+					So([]string{deployed[3].GetTaskId().GetValue(), deployed[5].GetTaskId().GetValue()}, ShouldContain, task.TaskID)
+					So(task.Status, ShouldEqual, "started")
+					So(task.Host, ShouldEqual, "exeggutor-slave-instance-1")
+				}
+			})
+
+			Convey("should filter the listed tasks by status and host", func() {
+				deployed, _ := CreateFilterData(ts, as, builder)
+				unhealthy := deployed[0]
+				unhealthy.Status = protocol.AppStatus_UNHEALTHY.Enum()
+				mgr.taskStore.Save(&unhealthy)
+				elsewhere := deployed[4]
+				elsewhere.HostName = proto.String("other-host")
+				mgr.taskStore.Save(&elsewhere)
+
+				actual, err := mgr.ListTasks(TaskFilter{Statuses: []protocol.AppStatus{protocol.AppStatus_UNHEALTHY}})
+				So(err, ShouldBeNil)
+				So(actual, ShouldHaveLength, 1)
+				So(actual[0].TaskID, ShouldEqual, unhealthy.GetTaskId().GetValue())
+
+				actual, err = mgr.ListTasks(TaskFilter{Host: "other-host"})
+				So(err, ShouldBeNil)
+				So(actual, ShouldHaveLength, 1)
+				So(actual[0].TaskID, ShouldEqual, elsewhere.GetTaskId().GetValue())
+			})
 		})
 	})
 }
+
+// registeringHealthChecker remembers the tasks that were registered for health checks
+type registeringHealthChecker struct {
+	NoopHealthChecker
+	registered []string
+}
+
+func (r *registeringHealthChecker) Register(deployment *protocol.Deployment, app *protocol.Application) error {
+	r.registered = append(r.registered, deployment.GetTaskId().GetValue())
+	return nil
+}
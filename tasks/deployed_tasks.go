@@ -0,0 +1,115 @@
+package tasks
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/reverb/exeggutor/protocol"
+)
+
+// TaskFilter selects the deployed tasks to list, the empty fields match every task
+type TaskFilter struct {
+	AppID     string
+	AppName   string
+	Component string
+	Host      string
+	Statuses  []protocol.AppStatus
+}
+
+// DeployedPort a port of a deployed task
+type DeployedPort struct {
+	Scheme      string `json:"scheme"`
+	PrivatePort int32  `json:"private_port"`
+	PublicPort  int32  `json:"public_port"`
+}
+
+// DeployedTask a deployed instance of a component and where it runs
+type DeployedTask struct {
+	TaskID    string `json:"task_id"`
+	AppID     string `json:"app_id"`
+	AppName   string `json:"app_name"`
+	Component string `json:"component"`
+	Status    string `json:"status"`
+	Host      string `json:"host"`
+	SlaveID   string `json:"slave_id"`
+	// DeployedAt the unix epoch in milliseconds when the task was launched
+	DeployedAt int64          `json:"deployed_at"`
+	Ports      []DeployedPort `json:"ports"`
+}
+
+func (f *TaskFilter) matchesStatus(status protocol.AppStatus) bool {
+	if len(f.Statuses) == 0 {
+		return true
+	}
+	for _, s := range f.Statuses {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
+
+func (f *TaskFilter) matches(deployment *protocol.Deployment, app *protocol.Application) bool {
+	return (f.AppID == "" || deployment.GetAppId() == f.AppID) &&
+		(f.AppName == "" || app.GetAppName() == f.AppName) &&
+		(f.Component == "" || app.GetName() == f.Component) &&
+		(f.Host == "" || deployment.GetHostName() == f.Host) &&
+		f.matchesStatus(deployment.GetStatus())
+}
+
+type deployedTasks []DeployedTask
+
+func (d deployedTasks) Len() int      { return len(d) }
+func (d deployedTasks) Swap(i, j int) { d[i], d[j] = d[j], d[i] }
+func (d deployedTasks) Less(i, j int) bool {
+	if d[i].AppID != d[j].AppID {
+		return d[i].AppID < d[j].AppID
+	}
+	return d[i].DeployedAt < d[j].DeployedAt
+}
+
+// ListTasks returns the deployed tasks that match the filter with the host and ports they use,
+// ordered by app id and then by the time they were deployed
+func (t *DefaultTaskManager) ListTasks(filter TaskFilter) ([]DeployedTask, error) {
+	apps := make(map[string]*protocol.Application)
+	result := []DeployedTask{}
+	err := t.taskStore.ForEach(func(deployment *protocol.Deployment) {
+		app, ok := apps[deployment.GetAppId()]
+		if !ok {
+			var err error
+			app, err = t.appStore.Get(deployment.GetAppId())
+			if err != nil {
+				log.Warning("Couldn't get the application %s linked to the task id %s, because: %v", deployment.GetAppId(), deployment.GetTaskId().GetValue(), err)
+			}
+			apps[deployment.GetAppId()] = app
+		}
+		if app == nil || !filter.matches(deployment, app) {
+			return
+		}
+
+		task := DeployedTask{
+			TaskID:     deployment.GetTaskId().GetValue(),
+			AppID:      deployment.GetAppId(),
+			AppName:    app.GetAppName(),
+			Component:  app.GetName(),
+			Status:     strings.ToLower(deployment.GetStatus().String()),
+			Host:       deployment.GetHostName(),
+			SlaveID:    deployment.GetSlave().GetValue(),
+			DeployedAt: deployment.GetDeployedAt(),
+			Ports:      []DeployedPort{},
+		}
+		for _, mapping := range deployment.GetPortMapping() {
+			task.Ports = append(task.Ports, DeployedPort{
+				Scheme:      mapping.GetScheme(),
+				PrivatePort: mapping.GetPrivatePort(),
+				PublicPort:  mapping.GetPublicPort(),
+			})
+		}
+		result = append(result, task)
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Sort(deployedTasks(result))
+	return result, nil
+}
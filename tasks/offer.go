@@ -0,0 +1,119 @@
+package tasks
+
+import (
+	"code.google.com/p/goprotobuf/proto"
+	"github.com/reverb/exeggutor/tasks/builders"
+	"github.com/reverb/go-mesos/mesos"
+)
+
+// offerResources keeps track of the resources that are still available in an offer
+// while queued items are being placed into it.
+type offerResources struct {
+	offer mesos.Offer
+	cpus  float64
+	mem   float64
+	disk  float64
+	ports []builders.PortRange
+}
+
+func newOfferResources(offer mesos.Offer) *offerResources {
+	res := &offerResources{offer: offer}
+	for _, resource := range offer.GetResources() {
+		switch resource.GetName() {
+		case "cpus":
+			res.cpus += resource.GetScalar().GetValue()
+		case "mem":
+			res.mem += resource.GetScalar().GetValue()
+		case "disk":
+			res.disk += resource.GetScalar().GetValue()
+		case "ports":
+			for _, r := range resource.GetRanges().GetRange() {
+				res.ports = append(res.ports, builders.PortRange{Begin: r.GetBegin(), End: r.GetEnd()})
+			}
+		}
+	}
+	return res
+}
+
+// maxPortsLen returns the length of the largest contiguous port range that's still available
+func (o *offerResources) maxPortsLen() uint64 {
+	var max uint64
+	for _, r := range o.ports {
+		numAvail := r.End - r.Begin + 1
+		if max < numAvail {
+			max = numAvail
+		}
+	}
+	return max
+}
+
+// fitsPorts returns true when count ports can be taken from a single available range
+func (o *offerResources) fitsPorts(count int) bool {
+	for _, r := range o.ports {
+		if r.Fits(count) {
+			return true
+		}
+	}
+	return count == 0
+}
+
+// take subtracts the resources a task uses from the available resources
+func (o *offerResources) take(resources []*mesos.Resource) {
+	for _, resource := range resources {
+		switch resource.GetName() {
+		case "cpus":
+			o.cpus -= resource.GetScalar().GetValue()
+		case "mem":
+			o.mem -= resource.GetScalar().GetValue()
+		case "disk":
+			o.disk -= resource.GetScalar().GetValue()
+		case "ports":
+			for _, r := range resource.GetRanges().GetRange() {
+				o.takePorts(r.GetBegin(), r.GetEnd())
+			}
+		}
+	}
+}
+
+// takePorts removes the specified range from the available port ranges,
+// splitting a range when the taken ports are in the middle of it.
+func (o *offerResources) takePorts(begin, end uint64) {
+	var left []builders.PortRange
+	for _, r := range o.ports {
+		if end < r.Begin || begin > r.End {
+			left = append(left, r)
+			continue
+		}
+		if r.Begin < begin {
+			left = append(left, builders.PortRange{Begin: r.Begin, End: begin - 1})
+		}
+		if r.End > end {
+			left = append(left, builders.PortRange{Begin: end + 1, End: r.End})
+		}
+	}
+	o.ports = left
+}
+
+// remaining returns a copy of the offer that only contains the resources that are still available
+func (o *offerResources) remaining() mesos.Offer {
+	var ranges []*mesos.Value_Range
+	for _, r := range o.ports {
+		ranges = append(ranges, &mesos.Value_Range{
+			Begin: proto.Uint64(r.Begin),
+			End:   proto.Uint64(r.End),
+		})
+	}
+
+	offer := o.offer
+	offer.Resources = []*mesos.Resource{
+		mesos.ScalarResource("cpus", o.cpus),
+		mesos.ScalarResource("mem", o.mem),
+		mesos.ScalarResource("disk", o.disk),
+		&mesos.Resource{
+			Name:   proto.String("ports"),
+			Type:   mesos.Value_RANGES.Enum(),
+			Ranges: &mesos.Value_Ranges{Range: ranges},
+		},
+	}
+	return offer
+}
@@ -0,0 +1,64 @@
+package tasks
+
+import (
+	"testing"
+
+	"code.google.com/p/goprotobuf/proto"
+	"github.com/reverb/exeggutor/tasks/builders"
+	. "github.com/reverb/exeggutor/test_utils"
+	"github.com/reverb/go-mesos/mesos"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestOfferResources(t *testing.T) {
+
+	Convey("Offer resources", t, func() {
+		available := newOfferResources(CreateOffer("offer-id-resources", 4.0, 1024.0))
+
+		Convey("should read the resources from the offer", func() {
+			So(available.cpus, ShouldEqual, 4.0)
+			So(available.mem, ShouldEqual, 1024.0)
+			So(available.maxPortsLen(), ShouldEqual, 1000)
+		})
+
+		Convey("should subtract the resources of a task", func() {
+			available.take([]*mesos.Resource{
+				mesos.ScalarResource("cpus", 1.5),
+				mesos.ScalarResource("mem", 512),
+				&mesos.Resource{
+					Name: proto.String("ports"),
+					Type: mesos.Value_RANGES.Enum(),
+					Ranges: &mesos.Value_Ranges{Range: []*mesos.Value_Range{
+						&mesos.Value_Range{Begin: proto.Uint64(32100), End: proto.Uint64(32101)},
+					}},
+				},
+			})
+
+			So(available.cpus, ShouldEqual, 2.5)
+			So(available.mem, ShouldEqual, 512.0)
+			So(available.ports, ShouldResemble, []builders.PortRange{
+				builders.PortRange{Begin: 32000, End: 32099},
+				builders.PortRange{Begin: 32102, End: 32999},
+			})
+		})
+
+		Convey("should pick ports from a range that fits exactly", func() {
+			available.takePorts(32000, 32997)
+			So(available.ports, ShouldResemble, []builders.PortRange{builders.PortRange{Begin: 32998, End: 32999}})
+			So(available.fitsPorts(2), ShouldBeTrue)
+			So(available.fitsPorts(3), ShouldBeFalse)
+
+			remaining := available.remaining()
+			taken, reserved := (&builders.RandomPortPicker{}).GetPorts(&remaining, 2)
+			So(taken, ShouldResemble, []builders.PortRange{builders.PortRange{Begin: 32998, End: 32999}})
+			So(reserved, ShouldResemble, []int32{32998, 32999})
+		})
+
+		Convey("should only offer the remaining resources", func() {
+			available.take([]*mesos.Resource{mesos.ScalarResource("cpus", 3)})
+			remaining := newOfferResources(available.remaining())
+			So(remaining.cpus, ShouldEqual, 1.0)
+			So(remaining.mem, ShouldEqual, 1024.0)
+		})
+	})
+}
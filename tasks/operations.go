@@ -0,0 +1,214 @@
+package tasks
+
+import (
+	"fmt"
+
+	"code.google.com/p/goprotobuf/proto"
+	"github.com/reverb/exeggutor/health/sla"
+	"github.com/reverb/exeggutor/protocol"
+	"github.com/reverb/go-mesos/mesos"
+)
+
+// StopApp deactivates all the components of an application so they don't get deployed again,
+// drops their queued instances and stops their tasks. It returns the tasks that are being stopped.
+func (t *DefaultTaskManager) StopApp(appName string) ([]*mesos.TaskID, error) {
+	return t.stop(appName, func(app *protocol.Application) bool {
+		return app.GetAppName() == appName
+	})
+}
+
+// StopComponent deactivates a component so it doesn't get deployed again,
+// drops its queued instances and stops its tasks. It returns the tasks that are being stopped.
+func (t *DefaultTaskManager) StopComponent(appName, component string) ([]*mesos.TaskID, error) {
+	return t.stop(componentKey(appName, component), func(app *protocol.Application) bool {
+		return app.GetAppName() == appName && app.GetName() == component
+	})
+}
+
+func (t *DefaultTaskManager) stop(name string, matches func(*protocol.Application) bool) ([]*mesos.TaskID, error) {
+	apps, err := t.appStore.Filter(func(app *protocol.Application) bool {
+		return matches(app) && app.GetActive()
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, app := range apps {
+		app.Active = proto.Bool(false)
+		if err := t.appStore.Save(app); err != nil {
+			return nil, err
+		}
+	}
+
+	for {
+		item, err := t.queue.DequeueFirst(func(i *protocol.ScheduledApp) bool { return matches(i.GetApp()) })
+		if err != nil || item == nil {
+			break
+		}
+		t.placements.forget(item)
+	}
+
+	stopping, err := t.aliveDeployments(matches)
+	if err != nil {
+		return nil, err
+	}
+	log.Notice("Stopping %d tasks of %s", len(stopping), name)
+	var result []*mesos.TaskID
+	for _, deployment := range stopping {
+		result = append(result, deployment.GetTaskId())
+	}
+	t.killLater(result)
+	return result, nil
+}
+
+// killLater asks the framework to kill the tasks without waiting for it. The operations run on the
+// goroutine of an api request, which shouldn't hang when the framework is still working through earlier kills.
+func (t *DefaultTaskManager) killLater(taskIDs []*mesos.TaskID) {
+	if len(taskIDs) == 0 {
+		return
+	}
+	go func() {
+		for _, taskID := range taskIDs {
+			t.kill(taskID)
+		}
+	}()
+}
+
+// aliveDeployments returns the deployments of the apps that match which are deployed or deploying
+func (t *DefaultTaskManager) aliveDeployments(matches func(*protocol.Application) bool) ([]*protocol.Deployment, error) {
+	apps := make(map[string]*protocol.Application)
+	return t.taskStore.Filter(func(deployment *protocol.Deployment) bool {
+		if !t.wasAlive(deployment.GetStatus()) {
+			return false
+		}
+		app, ok := apps[deployment.GetAppId()]
+		if !ok {
+			app, _ = t.appStore.Get(deployment.GetAppId())
+			apps[deployment.GetAppId()] = app
+		}
+		return app != nil && matches(app)
+	})
+}
+
+// KillTask stops a single task, when replace is true another instance of its app is queued right away
+// instead of waiting for the SLA monitor to notice it's missing.
+// It returns nil when the task is unknown.
+func (t *DefaultTaskManager) KillTask(taskID string, replace bool) (*mesos.TaskID, error) {
+	deployment, err := t.taskStore.Get(taskID)
+	if err != nil || deployment == nil {
+		return nil, err
+	}
+	if !replace {
+		log.Notice("Stopping task %s of %s", taskID, deployment.GetAppId())
+		t.killLater([]*mesos.TaskID{deployment.GetTaskId()})
+		return deployment.GetTaskId(), nil
+	}
+
+	app, err := t.appStore.Get(deployment.GetAppId())
+	if err != nil {
+		return nil, err
+	}
+	if app == nil {
+		return nil, fmt.Errorf("the app %s of task %s is unknown", deployment.GetAppId(), taskID)
+	}
+	log.Notice("Replacing task %s of %s", taskID, deployment.GetAppId())
+	if err := t.replace(deployment, app); err != nil {
+		return nil, err
+	}
+	t.killLater([]*mesos.TaskID{deployment.GetTaskId()})
+	return deployment.GetTaskId(), nil
+}
+
+// replace marks a deployment as stopping and queues another instance of its app, the caller kills the task.
+// The deployment is marked as stopping before the app is queued, so the SLA doesn't replace it a second time.
+func (t *DefaultTaskManager) replace(deployment *protocol.Deployment, app *protocol.Application) error {
+	deployment.Status = protocol.AppStatus_STOPPING.Enum()
+	if err := t.taskStore.Save(deployment); err != nil {
+		log.Warning("Failed to save task %v, because %v", deployment.GetTaskId().GetValue(), err)
+		return err
+	}
+	if t.healtchecks != nil {
+		if err := t.healtchecks.Unregister(deployment.GetTaskId()); err != nil {
+			log.Warning("Failed to unregister health check for %v, because %v", deployment.GetTaskId().GetValue(), err)
+		}
+	}
+	if err := t.scheduleAppForDeployment(app); err != nil {
+		log.Warning("Couldn't queue a replacement for task %s of %s, because %v", deployment.GetTaskId().GetValue(), app.GetId(), err)
+	}
+	return nil
+}
+
+// ReplaceComponent stops the tasks of every version of the component of the app and queues an instance
+// of the app for each of them, or deploys the app when none of its tasks are running.
+// Rolling back to a revision of the same version keeps the app id, so the tasks that run with
+// the manifest that's rolled back have to be replaced to get the manifest of the revision.
+// It returns the tasks that are being stopped.
+func (t *DefaultTaskManager) ReplaceComponent(app *protocol.Application) ([]*mesos.TaskID, error) {
+	replacing, err := t.aliveDeployments(func(other *protocol.Application) bool {
+		return other.GetAppName() == app.GetAppName() && other.GetName() == app.GetName()
+	})
+	if err != nil {
+		return nil, err
+	}
+	t.crashes.deployed(app)
+	if len(replacing) == 0 {
+		return nil, t.scheduleAppForDeployment(app)
+	}
+
+	log.Notice("Replacing %d tasks of %s", len(replacing), componentKey(app.GetAppName(), app.GetName()))
+	var result []*mesos.TaskID
+	for _, deployment := range replacing {
+		if err := t.replace(deployment, app); err != nil {
+			t.killLater(result)
+			return result, err
+		}
+		result = append(result, deployment.GetTaskId())
+	}
+	t.killLater(result)
+	return result, nil
+}
+
+// ScaleComponent moves the minimum number of instances of the active version of a component in its SLA,
+// and queues or stops instances to match it right away. The maximum only grows when it would be lower
+// than the new minimum, so the range the SLA allows is kept. It returns the tasks that are being stopped.
+func (t *DefaultTaskManager) ScaleComponent(appName, component string, instances int32) ([]*mesos.TaskID, error) {
+	if instances < 0 {
+		return nil, fmt.Errorf("the number of instances can't be negative but was %d", instances)
+	}
+	app, err := t.appStore.Find(func(app *protocol.Application) bool {
+		return app.GetAppName() == appName && app.GetName() == component && app.GetActive()
+	})
+	if err != nil || app == nil {
+		return nil, err
+	}
+	if app.GetSla() == nil {
+		return nil, fmt.Errorf("%s has no SLA to scale", componentKey(appName, component))
+	}
+	if t.rollouts.inRollout(app.GetId()) {
+		return nil, fmt.Errorf("%s is being rolled out", componentKey(appName, component))
+	}
+
+	app.Sla.MinInstances = proto.Int32(instances)
+	if app.GetSla().GetMaxInstances() < instances {
+		app.Sla.MaxInstances = proto.Int32(instances)
+	}
+	if err := t.appStore.Save(app); err != nil {
+		return nil, err
+	}
+
+	deployed, err := t.aliveDeployments(func(other *protocol.Application) bool { return other.GetId() == app.GetId() })
+	if err != nil {
+		return nil, err
+	}
+	count := instances - int32(len(deployed)) - t.queue.CountAppsForID(app.GetId())
+	log.Notice("Scaling %s to %d instances", app.GetId(), instances)
+	if count > 0 {
+		t.scaleUp(sla.ChangeDeployCount{App: app, Count: count})
+		return nil, nil
+	}
+	if count < 0 {
+		stopping := t.scaleDownVictims(sla.ChangeDeployCount{App: app, Count: count})
+		t.killLater(stopping)
+		return stopping, nil
+	}
+	return nil, nil
+}
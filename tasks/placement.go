@@ -0,0 +1,230 @@
+package tasks
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/reverb/exeggutor"
+	"github.com/reverb/exeggutor/protocol"
+	"github.com/reverb/go-mesos/mesos"
+)
+
+const defaultOfferHistory = 5
+
+// OfferCheck the outcome of checking a queued item against an offer
+type OfferCheck struct {
+	OfferID string `json:"offer_id"`
+	Host    string `json:"host"`
+	// CheckedAt the unix epoch in milliseconds when the item was checked against the offer
+	CheckedAt int64 `json:"checked_at"`
+	Fits      bool  `json:"fits"`
+	// Reasons why the item couldn't be placed in the offer
+	Reasons []string `json:"reasons,omitempty"`
+}
+
+// QueuedItem an item waiting in the task queue with the last offers it was checked against
+type QueuedItem struct {
+	// ID identifies the item within its component, it's the time it was enqueued in nanoseconds
+	ID        string `json:"id"`
+	AppID     string `json:"app_id"`
+	AppName   string `json:"app_name"`
+	Component string `json:"component"`
+	// Position the zero based position in the order the queue would hand out its items
+	Position int  `json:"position"`
+	Expedite bool `json:"expedite"`
+	// Since the unix epoch in milliseconds when the item was enqueued
+	Since int64 `json:"since"`
+	// Age the number of milliseconds the item has been waiting
+	Age       int64        `json:"age"`
+	Resources Resources    `json:"resources"`
+	Ports     int          `json:"ports"`
+	Offers    []OfferCheck `json:"offers"`
+}
+
+func queueKey(item *protocol.ScheduledApp) string {
+	return item.GetAppId() + "@" + strconv.FormatInt(item.GetSince(), 10)
+}
+
+// placementHistory remembers the last offers every queued item was checked against
+type placementHistory struct {
+	size   int
+	checks map[string][]OfferCheck
+	lock   *sync.Mutex
+}
+
+func newPlacementHistory(config *exeggutor.FrameworkConfig) *placementHistory {
+	size := defaultOfferHistory
+	if config != nil && config.QueueOfferHistory >= 0 {
+		size = config.QueueOfferHistory
+	}
+	return &placementHistory{size: size, checks: make(map[string][]OfferCheck), lock: &sync.Mutex{}}
+}
+
+// checked records the outcome of checking the item against the offer, only the last few are kept
+func (p *placementHistory) checked(item *protocol.ScheduledApp, offer *mesos.Offer, reasons []string) {
+	if p.size == 0 {
+		return
+	}
+	check := OfferCheck{
+		OfferID:   offer.GetId().GetValue(),
+		Host:      offer.GetHostname(),
+		CheckedAt: millis(time.Now()),
+		Fits:      len(reasons) == 0,
+		Reasons:   reasons,
+	}
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	key := queueKey(item)
+	checks := append(p.checks[key], check)
+	if len(checks) > p.size {
+		checks = checks[len(checks)-p.size:]
+	}
+	p.checks[key] = checks
+}
+
+// forget drops the history of an item that left the queue
+func (p *placementHistory) forget(item *protocol.ScheduledApp) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	delete(p.checks, queueKey(item))
+}
+
+// describe returns the queued items with their history, the history of items that left the queue is dropped
+func (p *placementHistory) describe(items []*protocol.ScheduledApp) []QueuedItem {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	now := time.Now()
+	queued := make(map[string]bool)
+	result := []QueuedItem{}
+	for i, item := range items {
+		key := queueKey(item)
+		queued[key] = true
+		since := time.Unix(0, item.GetSince())
+		described := QueuedItem{
+			ID:        strconv.FormatInt(item.GetSince(), 10),
+			AppID:     item.GetAppId(),
+			AppName:   item.GetApp().GetAppName(),
+			Component: item.GetApp().GetName(),
+			Position:  i,
+			Expedite:  item.GetExpedite(),
+			Since:     millis(since),
+			Age:       millis(now) - millis(since),
+			Ports:     len(item.GetApp().GetPorts()),
+			Offers:    append([]OfferCheck{}, p.checks[key]...),
+		}
+		described.Resources.add(item.GetApp(), 1)
+		result = append(result, described)
+	}
+	for key := range p.checks {
+		if !queued[key] {
+			delete(p.checks, key)
+		}
+	}
+	return result
+}
+
+// missingResources returns what the offer lacks to launch the component
+func missingResources(offer *offerResources, comp *protocol.Application) []string {
+	var reasons []string
+	if offer.cpus < float64(comp.GetCpus()) {
+		reasons = append(reasons, fmt.Sprintf("not enough cpus: %v needed, %v offered", comp.GetCpus(), offer.cpus))
+	}
+	if offer.mem < float64(comp.GetMem()) {
+		reasons = append(reasons, fmt.Sprintf("not enough mem: %v needed, %v offered", comp.GetMem(), offer.mem))
+	}
+	if offer.disk < float64(comp.GetDiskSpace()) {
+		reasons = append(reasons, fmt.Sprintf("not enough disk: %v needed, %v offered", comp.GetDiskSpace(), offer.disk))
+	}
+	if !offer.fitsPorts(len(comp.GetPorts())) {
+		reasons = append(reasons, fmt.Sprintf("not enough ports: %v needed, %v offered in a single range", len(comp.GetPorts()), offer.maxPortsLen()))
+	}
+	return reasons
+}
+
+// unplaceable returns why the item can't be launched with the offer, nothing when it can.
+// A host that is reserved for a preempting item only takes that item.
+// The constraints are only checked when the resources fit and the quotas only when the constraints are met.
+func (t *DefaultTaskManager) unplaceable(offer *offerResources, offered map[string]string, instances *deployedInstances, item *protocol.ScheduledApp) []string {
+	if key, reserved := t.preemption.reservedFor(offer.offer.GetHostname()); reserved && key != queueKey(item) {
+		return []string{"the host is reserved for the item that preempted deployments on it"}
+	}
+	if reasons := missingResources(offer, item.GetApp()); len(reasons) > 0 {
+		return reasons
+	}
+	if !t.meetsConstraints(offered, item.GetApp(), instances) {
+		return []string{"unmet placement constraint on " + offered[HostnameAttribute]}
+	}
+	// the instances in the queue don't count because the item is one of them
+	if err := t.checkQuotas(item.GetApp(), false); err != nil {
+		return []string{err.Error()}
+	}
+	return nil
+}
+
+// QueuedItems returns the items in the queue in the order they would be placed,
+// with the last offers they were checked against
+func (t *DefaultTaskManager) QueuedItems() []QueuedItem {
+	return t.placements.describe(t.queue.Items())
+}
+
+// ManagedBySLAError is returned when cancelling queued instances of a component whose SLA
+// would queue them again, the component has to be scaled or stopped instead
+type ManagedBySLAError struct {
+	AppID string `json:"app_id"`
+}
+
+func (m *ManagedBySLAError) Error() string {
+	return fmt.Sprintf("the queued instances of %s are managed by its SLA, scale or stop the component instead", m.AppID)
+}
+
+// CancelQueued removes queued items of a component from the queue and returns how many were removed,
+// an empty id removes all the items of the component.
+// Only the items the SLA monitor doesn't manage can be cancelled, those are the items of a version
+// that isn't active or has no SLA. It returns a ManagedBySLAError when only managed items matched.
+func (t *DefaultTaskManager) CancelQueued(appName, component, id string) (int, error) {
+	active, err := t.appStore.Find(func(app *protocol.Application) bool {
+		return app.GetAppName() == appName && app.GetName() == component && app.GetActive()
+	})
+	if err != nil {
+		return 0, err
+	}
+	var managed string
+	if active != nil && active.GetSla() != nil {
+		managed = active.GetId()
+	}
+	matches := func(i *protocol.ScheduledApp) bool {
+		return i.GetApp().GetAppName() == appName && i.GetApp().GetName() == component &&
+			(id == "" || strconv.FormatInt(i.GetSince(), 10) == id)
+	}
+
+	var cancelled int
+	for {
+		item, err := t.queue.DequeueFirst(func(i *protocol.ScheduledApp) bool {
+			return matches(i) && i.GetAppId() != managed
+		})
+		if err != nil {
+			log.Warning("Couldn't cancel the queued items of %s, because %v", componentKey(appName, component), err)
+			return cancelled, err
+		}
+		if item == nil {
+			break
+		}
+		t.placements.forget(item)
+		cancelled++
+	}
+	if cancelled > 0 {
+		log.Notice("Cancelled %d queued items of %s", cancelled, componentKey(appName, component))
+		return cancelled, nil
+	}
+	if managed != "" {
+		for _, item := range t.queue.Items() {
+			if matches(item) && item.GetAppId() == managed {
+				return 0, &ManagedBySLAError{AppID: managed}
+			}
+		}
+	}
+	return 0, nil
+}
@@ -0,0 +1,294 @@
+package tasks
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/reverb/exeggutor"
+	"github.com/reverb/exeggutor/protocol"
+)
+
+const (
+	defaultPreemptAfter = 2 * time.Minute
+	preemptInterval     = 10 * time.Second
+	// reservationTimeout how long a slave is kept for the item that preempted deployments on it
+	reservationTimeout = time.Minute
+)
+
+// reservation keeps a slave for the queued item that stopped deployments on it
+type reservation struct {
+	key   string
+	until time.Time
+}
+
+// preemptor makes room for high priority items that waited too long in the queue,
+// it stops lower priority deployments that free up enough resources on a slave and requeues them.
+// The slave is reserved for the item until it's placed, so the requeued victims
+// or other items that come first in the queue order can't take the freed resources.
+type preemptor struct {
+	tasks        *DefaultTaskManager
+	after        time.Duration
+	interval     time.Duration
+	preempted    map[string]bool
+	lock         *sync.Mutex
+	reservations map[string]reservation
+	reserveLock  *sync.Mutex
+	ticker       *time.Ticker
+	closing      chan chan bool
+}
+
+func newPreemptor(tasks *DefaultTaskManager, config *exeggutor.FrameworkConfig, interval time.Duration) *preemptor {
+	after := defaultPreemptAfter
+	if config != nil {
+		after = time.Duration(config.PreemptAfter) * time.Second
+	}
+	return &preemptor{
+		tasks:        tasks,
+		after:        after,
+		interval:     interval,
+		preempted:    make(map[string]bool),
+		lock:         &sync.Mutex{},
+		reservations: make(map[string]reservation),
+		reserveLock:  &sync.Mutex{},
+		closing:      make(chan chan bool),
+	}
+}
+
+// reserve keeps the host for the queued item with the key
+func (p *preemptor) reserve(host, key string) {
+	p.reserveLock.Lock()
+	defer p.reserveLock.Unlock()
+	p.reservations[host] = reservation{key: key, until: time.Now().Add(reservationTimeout)}
+}
+
+// reservedFor returns the key of the queued item the host is reserved for,
+// the boolean is false when the host isn't reserved
+func (p *preemptor) reservedFor(host string) (string, bool) {
+	p.reserveLock.Lock()
+	defer p.reserveLock.Unlock()
+	reserved, ok := p.reservations[host]
+	if !ok {
+		return "", false
+	}
+	if time.Now().After(reserved.until) {
+		delete(p.reservations, host)
+		return "", false
+	}
+	return reserved.key, true
+}
+
+// release gives up the host that was reserved for the queued item with the key
+func (p *preemptor) release(key string) {
+	p.reserveLock.Lock()
+	defer p.reserveLock.Unlock()
+	for host, reserved := range p.reservations {
+		if reserved.key == key {
+			delete(p.reservations, host)
+		}
+	}
+}
+
+// Start starts looking for items that waited too long, unless preemption is disabled
+func (p *preemptor) Start() error {
+	if p.after <= 0 {
+		return nil
+	}
+	p.ticker = time.NewTicker(p.interval)
+	go func() {
+		for {
+			select {
+			case <-p.ticker.C:
+				p.step()
+			case boolc := <-p.closing:
+				p.ticker.Stop()
+				boolc <- true
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+// Stop stops looking for items that waited too long
+func (p *preemptor) Stop() error {
+	if p.after <= 0 {
+		return nil
+	}
+	boolc := make(chan bool)
+	p.closing <- boolc
+	<-boolc
+	return nil
+}
+
+// canPreempt returns true when the priority class of the app allows it to stop other deployments
+func canPreempt(app *protocol.Application) bool {
+	return app.GetPriorityClass() >= protocol.PriorityClass_HIGH
+}
+
+// step stops deployments for every high priority item that waited too long,
+// every item makes room only once
+func (p *preemptor) step() {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	now := time.Now()
+	queued := make(map[string]bool)
+	var starved []*protocol.ScheduledApp
+	for _, item := range p.tasks.queue.Items() {
+		key := queueKey(item)
+		queued[key] = true
+		if p.preempted[key] || !canPreempt(item.GetApp()) || now.Sub(time.Unix(0, item.GetSince())) < p.after {
+			continue
+		}
+		starved = append(starved, item)
+	}
+	for key := range p.preempted {
+		if !queued[key] {
+			delete(p.preempted, key)
+			p.release(key)
+		}
+	}
+
+	// the most urgent and then the longest waiting items go first
+	sort.Sort(&starvedOrder{starved})
+
+	stopping := make(map[string]bool)
+	for _, item := range starved {
+		victims := p.tasks.victimsFor(item.GetApp(), stopping)
+		if len(victims) == 0 {
+			log.Debug("There are no deployments that could make room for %s", item.GetAppId())
+			continue
+		}
+		p.preempted[queueKey(item)] = true
+		p.reserve(victims[0].deployment.GetHostName(), queueKey(item))
+		for _, victim := range victims {
+			stopping[victim.deployment.GetTaskId().GetValue()] = true
+			p.tasks.preempt(victim, item.GetApp())
+		}
+	}
+}
+
+type starvedOrder struct {
+	items []*protocol.ScheduledApp
+}
+
+func (s *starvedOrder) Len() int      { return len(s.items) }
+func (s *starvedOrder) Swap(i, j int) { s.items[i], s.items[j] = s.items[j], s.items[i] }
+func (s *starvedOrder) Less(i, j int) bool {
+	a, b := s.items[i], s.items[j]
+	if a.GetApp().GetPriorityClass() != b.GetApp().GetPriorityClass() {
+		return a.GetApp().GetPriorityClass() > b.GetApp().GetPriorityClass()
+	}
+	return a.GetSince() < b.GetSince()
+}
+
+// preemptible a deployment that can be stopped to make room for a more urgent one
+type preemptible struct {
+	deployment *protocol.Deployment
+	app        *protocol.Application
+}
+
+// victimsFor finds the lower priority deployments on a single slave that free up enough resources for the app,
+// the ports they free up need to hold the ports of the app in a single range like an offer does.
+// It picks the slave where the fewest deployments have to be stopped.
+func (t *DefaultTaskManager) victimsFor(app *protocol.Application, stopping map[string]bool) []preemptible {
+	apps := make(map[string]*protocol.Application)
+	hosts := make(map[string][]preemptible)
+	err := t.taskStore.ForEach(func(deployment *protocol.Deployment) {
+		status := deployment.GetStatus()
+		if status != protocol.AppStatus_STARTED && status != protocol.AppStatus_UNHEALTHY {
+			return
+		}
+		if stopping[deployment.GetTaskId().GetValue()] {
+			return
+		}
+		running, ok := apps[deployment.GetAppId()]
+		if !ok {
+			running, _ = t.appStore.Get(deployment.GetAppId())
+			apps[deployment.GetAppId()] = running
+		}
+		if running == nil || running.GetPriorityClass() >= app.GetPriorityClass() {
+			return
+		}
+		hosts[deployment.GetHostName()] = append(hosts[deployment.GetHostName()], preemptible{deployment, running})
+	})
+	if err != nil {
+		log.Warning("Couldn't look for deployments to make room for %s, because %v", app.GetId(), err)
+		return nil
+	}
+
+	var best []preemptible
+	instances := t.newDeployedInstances()
+	for host, candidates := range hosts {
+		attributes, known := t.slaves.attributes(host)
+		if !known || !t.meetsConstraints(attributes, app, instances) {
+			continue
+		}
+		// stop the lowest priority and then the newest deployments first
+		sort.Sort(&preemptionOrder{candidates})
+		var freed Resources
+		var ports []int
+		for i, candidate := range candidates {
+			freed.add(candidate.app, 1)
+			for _, mapping := range candidate.deployment.GetPortMapping() {
+				ports = append(ports, int(mapping.GetPublicPort()))
+			}
+			if freed.Cpus >= float64(app.GetCpus()) && freed.Mem >= float64(app.GetMem()) && freed.DiskSpace >= app.GetDiskSpace() &&
+				longestPortRange(ports) >= len(app.GetPorts()) {
+				if best == nil || i+1 < len(best) {
+					best = candidates[:i+1]
+				}
+				break
+			}
+		}
+	}
+	return best
+}
+
+// longestPortRange returns the number of ports in the longest range of consecutive ports
+func longestPortRange(ports []int) int {
+	sort.Ints(ports)
+	var longest, current int
+	for i, port := range ports {
+		switch {
+		case i > 0 && port == ports[i-1]:
+			continue
+		case i > 0 && port == ports[i-1]+1:
+			current++
+		default:
+			current = 1
+		}
+		if current > longest {
+			longest = current
+		}
+	}
+	return longest
+}
+
+type preemptionOrder struct {
+	candidates []preemptible
+}
+
+func (p *preemptionOrder) Len() int { return len(p.candidates) }
+func (p *preemptionOrder) Swap(i, j int) {
+	p.candidates[i], p.candidates[j] = p.candidates[j], p.candidates[i]
+}
+func (p *preemptionOrder) Less(i, j int) bool {
+	a, b := p.candidates[i], p.candidates[j]
+	if a.app.GetPriorityClass() != b.app.GetPriorityClass() {
+		return a.app.GetPriorityClass() < b.app.GetPriorityClass()
+	}
+	return a.deployment.GetDeployedAt() > b.deployment.GetDeployedAt()
+}
+
+// preempt stops a deployment to make room for a more urgent app and requeues it
+func (t *DefaultTaskManager) preempt(victim preemptible, forApp *protocol.Application) {
+	deployment := victim.deployment
+	log.Notice("Stopping task %s of %s on %s to make room for %s",
+		deployment.GetTaskId().GetValue(), deployment.GetAppId(), deployment.GetHostName(), forApp.GetId())
+	if err := t.replace(deployment, victim.app); err != nil {
+		return
+	}
+	t.kill(deployment.GetTaskId())
+}
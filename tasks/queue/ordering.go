@@ -0,0 +1,177 @@
+package queue
+
+import (
+	"time"
+
+	"github.com/reverb/exeggutor"
+	"github.com/reverb/exeggutor/protocol"
+)
+
+const (
+	// OrderBySize deploys the items with the largest cpu, memory and disk needs first, then the oldest ones
+	OrderBySize = "size"
+	// OrderFairShare takes turns between the apps in the queue, so one app with many instances
+	// can't crowd out the others, items of the same turn are ordered by size
+	OrderFairShare = "fair"
+	// OrderByPriority deploys the items with the most urgent priority class first, then by size
+	OrderByPriority = "priority"
+	// OrderByAge promotes items the longer they wait, so big items can't starve small ones.
+	// Every aging step an item waited counts as a priority class, items with the same priority are ordered by size
+	OrderByAge = "aging"
+
+	defaultAgingStep = time.Minute
+)
+
+// priorityWeights the weight of every priority class, items with a bigger weight are deployed first
+var priorityWeights = map[protocol.PriorityClass]int64{
+	protocol.PriorityClass_LOW:      0,
+	protocol.PriorityClass_NORMAL:   1,
+	protocol.PriorityClass_HIGH:     2,
+	protocol.PriorityClass_CRITICAL: 4,
+}
+
+func priorityWeight(app *protocol.Application) int64 {
+	return priorityWeights[app.GetPriorityClass()]
+}
+
+// orderingPolicy decides if queued item a should be deployed before item b
+// when neither of them is expedited.
+type orderingPolicy func(a, b *protocol.ScheduledApp, state *ordering) bool
+
+// ordering orders the queue with the configured policy, it keeps the state
+// the policies need that depends on the whole queue or the time it gets ordered.
+type ordering struct {
+	policy    orderingPolicy
+	agingStep time.Duration
+	dynamic   bool
+	now       time.Time
+	turns     map[*protocol.ScheduledApp]int
+	apps      map[string]*fairShare
+}
+
+// fairShare the turns of an app that has items in the queue
+type fairShare struct {
+	// next the turn the next item of the app gets
+	next int
+	// queued the number of items of the app in the queue
+	queued int
+}
+
+// newOrdering creates the ordering for the configured policy,
+// it falls back to ordering by size
+func newOrdering(config *exeggutor.FrameworkConfig) *ordering {
+	o := &ordering{
+		policy:    bySize,
+		agingStep: defaultAgingStep,
+		turns:     make(map[*protocol.ScheduledApp]int),
+		apps:      make(map[string]*fairShare),
+	}
+	if config == nil {
+		return o
+	}
+	if config.QueueAgingStep > 0 {
+		o.agingStep = time.Duration(config.QueueAgingStep) * time.Second
+	}
+	switch config.QueueOrder {
+	case OrderFairShare:
+		o.policy, o.dynamic = byTurn, true
+	case OrderByPriority:
+		o.policy = byPriority
+	case OrderByAge:
+		o.policy, o.dynamic = byAge, true
+	}
+	return o
+}
+
+// prepare captures the time before the queue gets ordered
+func (o *ordering) prepare() {
+	o.now = time.Now()
+}
+
+// enqueued gives the item its turn, which is the number of items of the same app
+// that were served or enqueued before it. The turns don't change while the item is queued,
+// so the queue stays a valid heap when other items come and go.
+// An app that joins the queue starts at the turn of the app that was served the least.
+func (o *ordering) enqueued(item *protocol.ScheduledApp) {
+	app := item.App.GetAppName()
+	share, ok := o.apps[app]
+	if !ok {
+		share = &fairShare{next: -1}
+		for _, other := range o.apps {
+			if served := other.next - other.queued; share.next < 0 || served < share.next {
+				share.next = served
+			}
+		}
+		if share.next < 0 {
+			share.next = 0
+		}
+		o.apps[app] = share
+	}
+	o.turns[item] = share.next
+	share.next++
+	share.queued++
+}
+
+// dequeued forgets the turn of an item that left the queue,
+// and the turns of its app when it was the last one
+func (o *ordering) dequeued(item *protocol.ScheduledApp) {
+	if _, ok := o.turns[item]; !ok {
+		return
+	}
+	delete(o.turns, item)
+	app := item.App.GetAppName()
+	if share, ok := o.apps[app]; ok {
+		share.queued--
+		if share.queued <= 0 {
+			delete(o.apps, app)
+		}
+	}
+}
+
+func (o *ordering) less(a, b *protocol.ScheduledApp) bool {
+	if a.GetExpedite() != b.GetExpedite() {
+		return a.GetExpedite()
+	}
+	return o.policy(a, b, o)
+}
+
+func bySize(a, b *protocol.ScheduledApp, state *ordering) bool {
+	pq := PrioQueue{}
+	return pq.byCPU(a.App, b.App) ||
+		pq.byMemorySecondary(a.App, b.App) ||
+		pq.byDiskTertiary(a.App, b.App) ||
+		pq.leastRecent(a, b)
+}
+
+func byTurn(a, b *protocol.ScheduledApp, state *ordering) bool {
+	aTurn, bTurn := state.turns[a], state.turns[b]
+	if aTurn != bTurn {
+		return aTurn < bTurn
+	}
+	return bySize(a, b, state)
+}
+
+func byPriority(a, b *protocol.ScheduledApp, state *ordering) bool {
+	aWeight, bWeight := priorityWeight(a.App), priorityWeight(b.App)
+	if aWeight != bWeight {
+		return aWeight > bWeight
+	}
+	return bySize(a, b, state)
+}
+
+func byAge(a, b *protocol.ScheduledApp, state *ordering) bool {
+	aPriority, bPriority := priorityWeight(a.App)+state.steps(a), priorityWeight(b.App)+state.steps(b)
+	if aPriority != bPriority {
+		return aPriority > bPriority
+	}
+	return bySize(a, b, state)
+}
+
+// steps the number of aging steps the item has been waiting in the queue
+func (o *ordering) steps(item *protocol.ScheduledApp) int64 {
+	waited := o.now.UnixNano() - item.GetSince()
+	if waited <= 0 {
+		return 0
+	}
+	return waited / int64(o.agingStep)
+}
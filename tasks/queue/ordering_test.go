@@ -0,0 +1,114 @@
+package queue
+
+import (
+	"testing"
+	"time"
+
+	"code.google.com/p/goprotobuf/proto"
+	"github.com/reverb/exeggutor"
+	"github.com/reverb/exeggutor/protocol"
+	. "github.com/reverb/exeggutor/test_utils"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func enqueueComponent(tq TaskQueue, appName, compName string, cpus float32, class protocol.PriorityClass) *protocol.ScheduledApp {
+	component := TestComponent(appName, compName, cpus, 64.0)
+	component.PriorityClass = class.Enum()
+	scheduled := ScheduledComponent(&component)
+	tq.Enqueue(&scheduled)
+	return &scheduled
+}
+
+func dequeueAll(tq TaskQueue) []string {
+	var ids []string
+	for tq.Len() > 0 {
+		item, _ := tq.Dequeue()
+		ids = append(ids, item.GetAppId())
+	}
+	return ids
+}
+
+func TestQueueOrdering(t *testing.T) {
+
+	Convey("Ordering the task queue", t, func() {
+
+		Convey("by size should keep taking the largest items first", func() {
+			tq := NewWithConfig(nil, &exeggutor.FrameworkConfig{QueueOrder: OrderBySize})
+			small := enqueueComponent(tq, "app-small", "comp", 1.0, protocol.PriorityClass_NORMAL)
+			big := enqueueComponent(tq, "app-big", "comp", 2.0, protocol.PriorityClass_NORMAL)
+
+			So(dequeueAll(tq), ShouldResemble, []string{big.GetAppId(), small.GetAppId()})
+		})
+
+		Convey("by fair share should take turns between the apps", func() {
+			tq := NewWithConfig(nil, &exeggutor.FrameworkConfig{QueueOrder: OrderFairShare})
+			crowded := enqueueComponent(tq, "app-crowded", "comp", 2.0, protocol.PriorityClass_NORMAL)
+			enqueueComponent(tq, "app-crowded", "comp", 2.0, protocol.PriorityClass_NORMAL)
+			enqueueComponent(tq, "app-crowded", "comp", 2.0, protocol.PriorityClass_NORMAL)
+			small := enqueueComponent(tq, "app-small", "comp", 1.0, protocol.PriorityClass_NORMAL)
+
+			So(dequeueAll(tq), ShouldResemble, []string{crowded.GetAppId(), small.GetAppId(), crowded.GetAppId(), crowded.GetAppId()})
+		})
+
+		Convey("by fair share should pick the first match in turn order", func() {
+			tq := NewWithConfig(nil, &exeggutor.FrameworkConfig{QueueOrder: OrderFairShare})
+			enqueueComponent(tq, "app-crowded", "comp", 2.0, protocol.PriorityClass_NORMAL)
+			enqueueComponent(tq, "app-crowded", "comp", 2.0, protocol.PriorityClass_NORMAL)
+			small := enqueueComponent(tq, "app-small", "comp", 1.0, protocol.PriorityClass_NORMAL)
+			tq.Dequeue()
+
+			item, err := tq.DequeueFirst(func(*protocol.ScheduledApp) bool { return true })
+			So(err, ShouldBeNil)
+			So(item.GetAppId(), ShouldEqual, small.GetAppId())
+		})
+
+		Convey("by fair share should let an app that joins start at the turn of the least served app", func() {
+			tq := NewWithConfig(nil, &exeggutor.FrameworkConfig{QueueOrder: OrderFairShare})
+			crowded := enqueueComponent(tq, "app-crowded", "comp", 2.0, protocol.PriorityClass_NORMAL)
+			enqueueComponent(tq, "app-crowded", "comp", 2.0, protocol.PriorityClass_NORMAL)
+			enqueueComponent(tq, "app-crowded", "comp", 2.0, protocol.PriorityClass_NORMAL)
+			tq.Dequeue()
+			tq.Dequeue()
+			late := enqueueComponent(tq, "app-late", "comp", 1.0, protocol.PriorityClass_NORMAL)
+			enqueueComponent(tq, "app-late", "comp", 1.0, protocol.PriorityClass_NORMAL)
+
+			So(dequeueAll(tq), ShouldResemble, []string{crowded.GetAppId(), late.GetAppId(), late.GetAppId()})
+		})
+
+		Convey("by priority should take the most urgent priority class first", func() {
+			tq := NewWithConfig(nil, &exeggutor.FrameworkConfig{QueueOrder: OrderByPriority})
+			big := enqueueComponent(tq, "app-big", "comp", 2.0, protocol.PriorityClass_LOW)
+			normal := enqueueComponent(tq, "app-normal", "comp", 1.0, protocol.PriorityClass_NORMAL)
+			critical := enqueueComponent(tq, "app-critical", "comp", 1.0, protocol.PriorityClass_CRITICAL)
+
+			So(dequeueAll(tq), ShouldResemble, []string{critical.GetAppId(), normal.GetAppId(), big.GetAppId()})
+		})
+
+		Convey("by priority should pick the first match in priority order", func() {
+			tq := NewWithConfig(nil, &exeggutor.FrameworkConfig{QueueOrder: OrderByPriority})
+			enqueueComponent(tq, "app-critical", "first", 1.0, protocol.PriorityClass_CRITICAL)
+			enqueueComponent(tq, "app-critical", "second", 1.0, protocol.PriorityClass_CRITICAL)
+			enqueueComponent(tq, "app-low", "first", 1.0, protocol.PriorityClass_LOW)
+			enqueueComponent(tq, "app-low", "second", 1.0, protocol.PriorityClass_LOW)
+			// a child of the second critical item in the heap, behind a low priority item in the array
+			high := enqueueComponent(tq, "app-high", "comp", 1.0, protocol.PriorityClass_HIGH)
+
+			item, err := tq.DequeueFirst(func(item *protocol.ScheduledApp) bool {
+				return item.App.GetPriorityClass() != protocol.PriorityClass_CRITICAL
+			})
+			So(err, ShouldBeNil)
+			So(item.GetAppId(), ShouldEqual, high.GetAppId())
+			So(tq.Len(), ShouldEqual, 4)
+		})
+
+		Convey("by age should promote the items that waited longer", func() {
+			tq := NewWithConfig(nil, &exeggutor.FrameworkConfig{QueueOrder: OrderByAge, QueueAgingStep: 60})
+			old := enqueueComponent(tq, "app-old", "comp", 1.0, protocol.PriorityClass_NORMAL)
+			old.Since = proto.Int64(time.Now().Add(-5 * time.Minute).UnixNano())
+			big := enqueueComponent(tq, "app-big", "comp", 2.0, protocol.PriorityClass_CRITICAL)
+			recent := enqueueComponent(tq, "app-recent", "comp", 4.0, protocol.PriorityClass_NORMAL)
+
+			So(dequeueAll(tq), ShouldResemble, []string{old.GetAppId(), big.GetAppId(), recent.GetAppId()})
+		})
+	})
+}
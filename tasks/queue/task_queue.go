@@ -2,6 +2,8 @@
 package queue
 
 import (
+	"fmt"
+	"sort"
 	"sync"
 	"time"
 
@@ -11,6 +13,7 @@ import (
 	"github.com/op/go-logging"
 	"github.com/reverb/exeggutor"
 	"github.com/reverb/exeggutor/protocol"
+	"github.com/reverb/exeggutor/store"
 )
 
 var log = logging.MustGetLogger("exeggutor.tasks.queue")
@@ -34,15 +37,24 @@ type TaskQueue interface {
 	CountsForApps() map[string]int32
 	// Len returns the size of the queue
 	Len() int
+	// Items returns the queued items in the order they would be dequeued
+	Items() []*protocol.ScheduledApp
 }
 
 // taskQueue represents the default implementation of a task queue
 // The implementation of the queue uses a heap to manage a priority queue
-// In this implementation the priorty queue favors highest cpu needs over
-// highest memory needs over least recently added to the queue.
+// By default the priorty queue favors highest cpu needs over
+// highest memory needs over least recently added to the queue,
+// the other orders can be selected in the framework config.
+// When the queue is backed by a store every queued item is persisted too,
+// so the pending items can be restored when the queue starts again.
 type taskQueue struct {
 	pQueue *PrioQueue
+	order  *ordering
 	lock   sync.Locker
+	store  store.KVStore
+	keys   map[*protocol.ScheduledApp]string
+	seq    int64
 }
 
 // New creates a new instance of the default task queue with
@@ -54,16 +66,101 @@ func New() TaskQueue {
 // NewTaskQueueWithPrioQueue creates a new instance of a default task queue
 // with the provided priority queue as storage (mainly used for testing)
 func NewTaskQueueWithPrioQueue(q *PrioQueue) TaskQueue {
-	tq := &taskQueue{pQueue: q, lock: &sync.Mutex{}}
-	heap.Init(tq.pQueue)
+	return newTaskQueue(q, nil, nil)
+}
+
+// NewWithStore creates a new instance of the default task queue
+// that persists the queued items in the provided store
+func NewWithStore(backing store.KVStore) TaskQueue {
+	return NewPersistentTaskQueue(&PrioQueue{}, backing)
+}
+
+// NewPersistentTaskQueue creates a new instance of a default task queue
+// with the provided priority queue as storage that persists the queued items in the provided store
+func NewPersistentTaskQueue(q *PrioQueue, backing store.KVStore) TaskQueue {
+	return newTaskQueue(q, backing, nil)
+}
+
+// NewWithConfig creates a new instance of the default task queue
+// that orders the items as configured, the queued items are persisted when a store is provided
+func NewWithConfig(backing store.KVStore, config *exeggutor.FrameworkConfig) TaskQueue {
+	return newTaskQueue(&PrioQueue{}, backing, config)
+}
+
+func newTaskQueue(q *PrioQueue, backing store.KVStore, config *exeggutor.FrameworkConfig) *taskQueue {
+	tq := &taskQueue{pQueue: q, order: newOrdering(config), lock: &sync.Mutex{}, store: backing}
+	if backing != nil {
+		tq.keys = make(map[*protocol.ScheduledApp]string)
+	}
+	for _, item := range *q {
+		tq.order.enqueued(item)
+	}
+	heap.Init(tq.heap())
 	return tq
 }
 
+// heap returns the priority queue ordered by the configured policy
+func (tq *taskQueue) heap() heap.Interface {
+	return &orderedQueue{PrioQueue: tq.pQueue, order: tq.order}
+}
+
+// reorder sorts the queue again for the orders that depend on the whole queue or on time,
+// a sorted queue is a valid heap too
+func (tq *taskQueue) reorder() {
+	if !tq.order.dynamic {
+		return
+	}
+	tq.order.prepare()
+	sort.Sort(tq.heap())
+}
+
 // Start starts this component, acquiring a database etc when backed with
-// a persistent priority queue
+// a persistent priority queue. The items that were persisted are put back on the queue
+// with the time they were originally enqueued.
 func (tq *taskQueue) Start() error {
 	tq.lock.Lock()
 	defer tq.lock.Unlock()
+	if tq.store == nil {
+		return nil
+	}
+	if err := tq.store.Start(); err != nil {
+		return err
+	}
+	return tq.restore()
+}
+
+func (tq *taskQueue) restore() error {
+	known := make(map[string]bool)
+	for _, key := range tq.keys {
+		known[key] = true
+	}
+
+	var restored int
+	err := tq.store.ForEach(func(kv *store.KVData) {
+		if known[kv.Key] {
+			return
+		}
+		item := &protocol.ScheduledApp{}
+		if err := proto.Unmarshal(kv.Value, item); err != nil {
+			log.Warning("Couldn't deserialize queued item %v, because %v", kv.Key, err)
+			return
+		}
+		tq.keys[item] = kv.Key
+		tq.order.enqueued(item)
+		*tq.pQueue = append(*tq.pQueue, item)
+		restored++
+	})
+	if err != nil {
+		return err
+	}
+
+	for i, item := range *tq.pQueue {
+		item.Position = proto.Int(i)
+	}
+	heap.Init(tq.heap())
+	if restored > 0 {
+		log.Notice("Restored %d items to the task queue", restored)
+	}
 	return nil
 }
 
@@ -71,14 +168,67 @@ func (tq *taskQueue) Start() error {
 func (tq *taskQueue) Stop() error {
 	tq.lock.Lock()
 	defer tq.lock.Unlock()
+	if tq.store == nil {
+		return nil
+	}
+	return tq.store.Stop()
+}
+
+// persist saves a newly enqueued item in the backing store
+func (tq *taskQueue) persist(item *protocol.ScheduledApp) error {
+	if tq.store == nil {
+		return nil
+	}
+	data, err := proto.Marshal(item)
+	if err != nil {
+		return err
+	}
+	tq.seq++
+	key := fmt.Sprintf("%020d-%06d", item.GetSince(), tq.seq%1000000)
+	if err := tq.store.Set(key, data); err != nil {
+		return err
+	}
+	tq.keys[item] = key
 	return nil
 }
 
+// forget removes a dequeued item from the backing store
+func (tq *taskQueue) forget(item *protocol.ScheduledApp) {
+	if tq.store == nil {
+		return
+	}
+	key, ok := tq.keys[item]
+	if !ok {
+		return
+	}
+	delete(tq.keys, item)
+	if err := tq.store.Delete(key); err != nil {
+		log.Warning("Couldn't remove %s from the persisted task queue, because %v", item.GetAppId(), err)
+	}
+}
+
 // Len returns the size of the queue
 func (tq *taskQueue) Len() int {
 	return tq.pQueue.Len()
 }
 
+// Items returns the queued items in the order they would be dequeued
+func (tq *taskQueue) Items() []*protocol.ScheduledApp {
+	tq.lock.Lock()
+	defer tq.lock.Unlock()
+	return tq.sorted()
+}
+
+// sorted returns a copy of the queued items in the order of the policy,
+// the heap only keeps the first item in place so its array isn't in that order
+func (tq *taskQueue) sorted() []*protocol.ScheduledApp {
+	tq.reorder()
+	items := make([]*protocol.ScheduledApp, len(*tq.pQueue))
+	copy(items, *tq.pQueue)
+	sort.Sort(&snapshot{items: items, order: tq.order})
+	return items
+}
+
 // CountAppsForId returns how many apps are currently scheduled for deployment
 // with that specified app id
 func (tq *taskQueue) CountAppsForID(appID string) int32 {
@@ -119,7 +269,14 @@ func (tq *taskQueue) CountsForApps() map[string]int32 {
 func (tq *taskQueue) Enqueue(item *protocol.ScheduledApp) error {
 	tq.lock.Lock()
 	defer tq.lock.Unlock()
-	heap.Push(tq.pQueue, item)
+	tq.order.enqueued(item)
+	heap.Push(tq.heap(), item)
+	if err := tq.persist(item); err != nil {
+		log.Warning("Couldn't persist %s in the task queue, because %v", item.GetAppId(), err)
+		heap.Remove(tq.heap(), int(item.GetPosition()))
+		tq.order.dequeued(item)
+		return err
+	}
 	return nil
 }
 
@@ -127,26 +284,52 @@ func (tq *taskQueue) Enqueue(item *protocol.ScheduledApp) error {
 func (tq *taskQueue) Dequeue() (*protocol.ScheduledApp, error) {
 	tq.lock.Lock()
 	defer tq.lock.Unlock()
-	item := heap.Pop(tq.pQueue)
-	return item.(*protocol.ScheduledApp), nil
+	tq.reorder()
+	item := heap.Pop(tq.heap()).(*protocol.ScheduledApp)
+	tq.order.dequeued(item)
+	tq.forget(item)
+	return item, nil
 }
 
 // DequeueFirst dequeues the first item from the queue that matches the predicated
 func (tq *taskQueue) DequeueFirst(shouldDequeue func(*protocol.ScheduledApp) bool) (*protocol.ScheduledApp, error) {
 	tq.lock.Lock()
 	defer tq.lock.Unlock()
-	queue := *tq.pQueue
 	var found *protocol.ScheduledApp
-	for _, item := range queue {
+	for _, item := range tq.sorted() {
 		if shouldDequeue(item) {
 			found = item
-			heap.Remove(tq.pQueue, int(item.GetPosition()))
+			heap.Remove(tq.heap(), int(item.GetPosition()))
+			tq.order.dequeued(found)
+			tq.forget(found)
 			break
 		}
 	}
 	return found, nil
 }
 
+// orderedQueue orders a priority queue with the configured ordering policy
+type orderedQueue struct {
+	*PrioQueue
+	order *ordering
+}
+
+// Less returns true when the item at index i should be deployed before the item at index j
+func (o *orderedQueue) Less(i, j int) bool {
+	items := *o.PrioQueue
+	return o.order.less(items[i], items[j])
+}
+
+// snapshot sorts a copy of the queued items without touching their positions in the heap
+type snapshot struct {
+	items []*protocol.ScheduledApp
+	order *ordering
+}
+
+func (s *snapshot) Len() int           { return len(s.items) }
+func (s *snapshot) Swap(i, j int)      { s.items[i], s.items[j] = s.items[j], s.items[i] }
+func (s *snapshot) Less(i, j int) bool { return s.order.less(s.items[i], s.items[j]) }
+
 // PrioQueue a type to represent the default priority queue
 type PrioQueue []*protocol.ScheduledApp
 
@@ -155,6 +338,14 @@ func (pq PrioQueue) Len() int {
 	return len(pq)
 }
 
+func (pq PrioQueue) expedited(left, right *protocol.ScheduledApp) bool {
+	return left.GetExpedite() && !right.GetExpedite()
+}
+
+func (pq PrioQueue) sameUrgency(left, right *protocol.ScheduledApp) bool {
+	return left.GetExpedite() == right.GetExpedite()
+}
+
 func (pq PrioQueue) byCPU(left, right *protocol.Application) bool {
 	return left.GetCpus() > right.GetCpus()
 }
@@ -163,18 +354,29 @@ func (pq PrioQueue) byMemorySecondary(left, right *protocol.Application) bool {
 	return left.GetCpus() == right.GetCpus() && left.GetMem() > right.GetMem()
 }
 
+func (pq PrioQueue) byDiskTertiary(left, right *protocol.Application) bool {
+	return left.GetCpus() == right.GetCpus() && left.GetMem() == right.GetMem() && left.GetDiskSpace() > right.GetDiskSpace()
+}
+
 func (pq PrioQueue) leastRecent(left, right *protocol.ScheduledApp) bool {
 	lcomp, rcomp := left.App, right.App
-	return lcomp.GetCpus() == rcomp.GetCpus() && lcomp.GetMem() == rcomp.GetMem() && left.GetSince() < right.GetSince()
+	return lcomp.GetCpus() == rcomp.GetCpus() &&
+		lcomp.GetMem() == rcomp.GetMem() &&
+		lcomp.GetDiskSpace() == rcomp.GetDiskSpace() &&
+		left.GetSince() < right.GetSince()
 }
 
 // Less returns true when the item at index i
 // is higher on the list than the item at index j
+// Expedited items, replacements for lost instances, always go first.
 func (pq PrioQueue) Less(i, j int) bool {
 	left, right := pq[i], pq[j]
-	return pq.byCPU(left.App, right.App) ||
-		pq.byMemorySecondary(left.App, right.App) ||
-		pq.leastRecent(left, right)
+	return pq.expedited(left, right) ||
+		(pq.sameUrgency(left, right) &&
+			(pq.byCPU(left.App, right.App) ||
+				pq.byMemorySecondary(left.App, right.App) ||
+				pq.byDiskTertiary(left.App, right.App) ||
+				pq.leastRecent(left, right)))
 }
 
 // Swap swaps 2 items in the queue from position.
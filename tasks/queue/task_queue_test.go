@@ -4,7 +4,9 @@ package queue
 import (
 	"testing"
 
+	"code.google.com/p/goprotobuf/proto"
 	"github.com/reverb/exeggutor/protocol"
+	"github.com/reverb/exeggutor/store"
 	. "github.com/reverb/exeggutor/test_utils"
 	. "github.com/smartystreets/goconvey/convey"
 )
@@ -176,6 +178,25 @@ func TestTaskQueue(t *testing.T) {
 				So(q.Len(), ShouldEqual, 2)
 			})
 
+			Convey("should take the thing with the largest disk needs third", func() {
+				component := TestComponent("app-tq-1", "comp-tq-1", 1.0, 64.0)
+				scheduled := ScheduledComponent(&component)
+				cr := &scheduled
+				tq.Enqueue(cr)
+
+				component2 := TestComponent("app-tq-2", "comp-tq-2", 1.0, 64.0)
+				component2.DiskSpace = proto.Int64(512)
+				scheduled2 := ScheduledComponent(&component2)
+				cr2 := &scheduled2
+				tq.Enqueue(cr2)
+
+				item, err := tq.Dequeue()
+
+				So(err, ShouldBeNil)
+				So(item, ShouldResemble, cr2)
+				So(q.Len(), ShouldEqual, 1)
+			})
+
 			Convey("should take the least recently enqueued as third criteria", func() {
 				component := TestComponent("app-tq-1", "comp-tq-1", 1.0, 64.0)
 				scheduled := ScheduledComponent(&component)
@@ -198,7 +219,90 @@ func TestTaskQueue(t *testing.T) {
 				So(item, ShouldResemble, cr)
 				So(q.Len(), ShouldEqual, 2)
 			})
+
+			Convey("should take expedited items before everything else", func() {
+				component := TestComponent("app-tq-1", "comp-tq-1", 2.0, 128.0)
+				scheduled := ScheduledComponent(&component)
+				cr := &scheduled
+				tq.Enqueue(cr)
+
+				component2 := TestComponent("app-tq-2", "comp-tq-2", 0.5, 64.0)
+				scheduled2 := ScheduledComponent(&component2)
+				scheduled2.Expedite = proto.Bool(true)
+				cr2 := &scheduled2
+				tq.Enqueue(cr2)
+
+				item, err := tq.Dequeue()
+
+				So(err, ShouldBeNil)
+				So(item, ShouldResemble, cr2)
+				So(q.Len(), ShouldEqual, 1)
+			})
+		})
+
+	})
+
+	Convey("A persistent DefaultTaskQueue", t, func() {
+
+		backing := store.NewEmptyInMemoryStore()
+		tq := NewWithStore(backing)
+		tq.Start()
+
+		Reset(func() {
+			tq.Stop()
 		})
 
+		component := TestComponent("app-tq-1", "comp-tq-1", 1.0, 64.0)
+		scheduled := ScheduledComponent(&component)
+		tq.Enqueue(&scheduled)
+
+		component2 := TestComponent("app-tq-2", "comp-tq-2", 2.0, 64.0)
+		scheduled2 := ScheduledComponent(&component2)
+		tq.Enqueue(&scheduled2)
+
+		Convey("should persist the enqueued items", func() {
+			size, err := backing.Size()
+			So(err, ShouldBeNil)
+			So(size, ShouldEqual, 2)
+		})
+
+		Convey("should remove the dequeued items from the store", func() {
+			tq.Dequeue()
+			tq.DequeueFirst(func(item *protocol.ScheduledApp) bool { return true })
+
+			size, err := backing.Size()
+			So(err, ShouldBeNil)
+			So(size, ShouldEqual, 0)
+		})
+
+		Convey("should restore the pending items in order when started again", func() {
+			since := map[string]int64{
+				scheduled.GetAppId():  scheduled.GetSince(),
+				scheduled2.GetAppId(): scheduled2.GetSince(),
+			}
+			tq.Stop()
+
+			q := &PrioQueue{}
+			restarted := NewPersistentTaskQueue(q, backing)
+			So(restarted.Start(), ShouldBeNil)
+			So(restarted.Len(), ShouldEqual, 2)
+			for _, item := range *q {
+				So(item.GetSince(), ShouldEqual, since[item.GetAppId()])
+			}
+
+			first, err := restarted.Dequeue()
+			So(err, ShouldBeNil)
+			So(first.GetAppId(), ShouldEqual, scheduled2.GetAppId())
+
+			second, err := restarted.Dequeue()
+			So(err, ShouldBeNil)
+			So(second.GetAppId(), ShouldEqual, scheduled.GetAppId())
+			So(second.GetApp(), ShouldResemble, &component)
+		})
+
+		Convey("should not restore the same items twice", func() {
+			So(tq.Start(), ShouldBeNil)
+			So(tq.Len(), ShouldEqual, 2)
+		})
 	})
 }
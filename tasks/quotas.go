@@ -0,0 +1,169 @@
+package tasks
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/reverb/exeggutor/protocol"
+)
+
+// Resources an amount of cluster resources
+type Resources struct {
+	Cpus      float64 `json:"cpus"`
+	Mem       float64 `json:"mem"`
+	DiskSpace int64   `json:"disk_space"`
+	Instances int32   `json:"instances"`
+}
+
+func (r *Resources) add(app *protocol.Application, instances int32) {
+	r.Cpus += float64(app.GetCpus()) * float64(instances)
+	r.Mem += float64(app.GetMem()) * float64(instances)
+	r.DiskSpace += app.GetDiskSpace() * int64(instances)
+	r.Instances += instances
+}
+
+// QuotaUsage the resources the deployed and queued instances claim against a quota
+type QuotaUsage struct {
+	Scope string `json:"scope"`
+	Name  string `json:"name"`
+	// Limits the limits of the quota, a limit of 0 means the resource isn't limited
+	Limits Resources `json:"limits"`
+	// Deployed the resources claimed by the instances that are deployed
+	Deployed Resources `json:"deployed"`
+	// Queued the resources claimed by the instances waiting in the queue
+	Queued Resources `json:"queued"`
+}
+
+// QuotaExceededError is returned when deploying another instance of an app
+// would claim more resources than one of its quotas allows
+type QuotaExceededError struct {
+	Scope     string  `json:"scope"`
+	Name      string  `json:"name"`
+	Resource  string  `json:"resource"`
+	Limit     float64 `json:"limit"`
+	Claimed   float64 `json:"claimed"`
+	Requested float64 `json:"requested"`
+}
+
+func (q *QuotaExceededError) Error() string {
+	return fmt.Sprintf(
+		"the quota of %s %s allows %v %s, %v are claimed already and another instance needs %v",
+		q.Scope, q.Name, q.Limit, q.Resource, q.Claimed, q.Requested)
+}
+
+// quotaApplies returns true when the quota limits the app
+func quotaApplies(quota *protocol.ResourceQuota, app *protocol.Application) bool {
+	switch quota.GetScope() {
+	case protocol.QuotaScope_TEAM:
+		return app.GetTeam() != "" && app.GetTeam() == quota.GetName()
+	default:
+		return app.GetAppName() == quota.GetName()
+	}
+}
+
+// QuotaUsage returns the resources the deployed and queued instances claim against the quota
+func (t *DefaultTaskManager) QuotaUsage(quota *protocol.ResourceQuota) (QuotaUsage, error) {
+	return t.quotaUsage(quota, true)
+}
+
+// quotaUsage counts the resources claimed against the quota,
+// the queue is left alone when countQueued is false because it can't be used while it's being dequeued
+func (t *DefaultTaskManager) quotaUsage(quota *protocol.ResourceQuota, countQueued bool) (QuotaUsage, error) {
+	usage := QuotaUsage{
+		Scope: strings.ToLower(quota.GetScope().String()),
+		Name:  quota.GetName(),
+		Limits: Resources{
+			Cpus:      float64(quota.GetCpus()),
+			Mem:       float64(quota.GetMem()),
+			DiskSpace: quota.GetDiskSpace(),
+			Instances: quota.GetInstances(),
+		},
+	}
+
+	apps := make(map[string]*protocol.Application)
+	lookup := func(appID string) *protocol.Application {
+		app, ok := apps[appID]
+		if !ok {
+			var err error
+			app, err = t.appStore.Get(appID)
+			if err != nil {
+				log.Warning("Couldn't get the application %s to count it against its quota, because: %v", appID, err)
+			}
+			apps[appID] = app
+		}
+		return app
+	}
+
+	err := t.taskStore.ForEach(func(deployment *protocol.Deployment) {
+		if !t.wasAlive(deployment.GetStatus()) {
+			return
+		}
+		if app := lookup(deployment.GetAppId()); app != nil && quotaApplies(quota, app) {
+			usage.Deployed.add(app, 1)
+		}
+	})
+	if err != nil {
+		return usage, err
+	}
+
+	if !countQueued {
+		return usage, nil
+	}
+	for appID, count := range t.queue.CountsForApps() {
+		if app := lookup(appID); app != nil && quotaApplies(quota, app) {
+			usage.Queued.add(app, count)
+		}
+	}
+	return usage, nil
+}
+
+// checkQuotas returns a QuotaExceededError when another instance of the app doesn't fit in its quotas.
+// When the queued instances are counted, they claim resources as well as the deployed ones.
+func (t *DefaultTaskManager) checkQuotas(app *protocol.Application, countQueued bool) error {
+	quotas, err := t.appStore.Quotas().For(app)
+	if err != nil {
+		return err
+	}
+	for _, quota := range quotas {
+		usage, err := t.quotaUsage(quota, countQueued)
+		if err != nil {
+			return err
+		}
+		claimed := usage.Deployed
+		claimed.Cpus += usage.Queued.Cpus
+		claimed.Mem += usage.Queued.Mem
+		claimed.DiskSpace += usage.Queued.DiskSpace
+		claimed.Instances += usage.Queued.Instances
+		if err := exceeds(usage, claimed, app); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func exceeds(usage QuotaUsage, claimed Resources, app *protocol.Application) error {
+	limits := usage.Limits
+	check := func(resource string, limit, used, requested float64) error {
+		if limit > 0 && used+requested > limit {
+			return &QuotaExceededError{
+				Scope:     usage.Scope,
+				Name:      usage.Name,
+				Resource:  resource,
+				Limit:     limit,
+				Claimed:   used,
+				Requested: requested,
+			}
+		}
+		return nil
+	}
+	if err := check("cpus", limits.Cpus, claimed.Cpus, float64(app.GetCpus())); err != nil {
+		return err
+	}
+	if err := check("mem", limits.Mem, claimed.Mem, float64(app.GetMem())); err != nil {
+		return err
+	}
+	if err := check("disk_space", float64(limits.DiskSpace), float64(claimed.DiskSpace), float64(app.GetDiskSpace())); err != nil {
+		return err
+	}
+	return check("instances", float64(limits.Instances), float64(claimed.Instances), 1)
+}
@@ -0,0 +1,461 @@
+package tasks
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"code.google.com/p/goprotobuf/proto"
+	"github.com/reverb/exeggutor/protocol"
+	"github.com/reverb/go-mesos/mesos"
+)
+
+// RolloutState the state a rolling deployment is in
+type RolloutState string
+
+const (
+	// RolloutRunning the rollout is replacing old instances with new ones
+	RolloutRunning RolloutState = "running"
+	// RolloutPaused the rollout stopped because new instances failed their health checks
+	RolloutPaused RolloutState = "paused"
+	// RolloutRollingBack the rollout is replacing the new instances with the old version again
+	RolloutRollingBack RolloutState = "rolling_back"
+	// RolloutDone all the old instances were replaced by healthy new instances
+	RolloutDone RolloutState = "done"
+	// RolloutRolledBack the new instances were replaced by the old version again
+	RolloutRolledBack RolloutState = "rolled_back"
+)
+
+const rolloutInterval = 5 * time.Second
+
+// RolloutStrategy configures how a rolling deployment replaces the instances of the
+// versions of a component that are currently deployed
+type RolloutStrategy struct {
+	// BatchSize how many new instances can be deploying or waiting for a health check at the same time
+	BatchSize int `json:"batch_size"`
+	// MaxSurge how many instances can be deployed above the desired count during the rollout
+	MaxSurge int `json:"max_surge"`
+	// MaxUnavailable how many instances the rollout can stop before their replacements are healthy
+	MaxUnavailable int `json:"max_unavailable"`
+	// RollbackOnFailure roll back when a new instance fails, instead of pausing the rollout
+	RollbackOnFailure bool `json:"rollback_on_failure"`
+}
+
+func (s RolloutStrategy) withDefaults() RolloutStrategy {
+	if s.BatchSize < 1 {
+		s.BatchSize = 1
+	}
+	if s.MaxSurge < 0 {
+		s.MaxSurge = 0
+	}
+	if s.MaxUnavailable < 0 {
+		s.MaxUnavailable = 0
+	}
+	if s.MaxSurge == 0 && s.MaxUnavailable == 0 {
+		// without any room the rollout can't make progress
+		s.MaxSurge = 1
+	}
+	return s
+}
+
+// Rollout tracks a rolling deployment of a new version of a component
+type Rollout struct {
+	// ID the app id of the new version
+	ID        string `json:"id"`
+	AppName   string `json:"app_name"`
+	Component string `json:"component"`
+	// From the app ids of the versions that are being replaced
+	From []string `json:"from"`
+	// RollbackTo the app id that gets deployed again when the rollout is rolled back
+	RollbackTo string          `json:"rollback_to"`
+	Desired    int             `json:"desired"`
+	Strategy   RolloutStrategy `json:"strategy"`
+	State      RolloutState    `json:"state"`
+	Reason     string          `json:"reason,omitempty"`
+	StartedAt  int64           `json:"started_at"`
+	// Retired the tasks this rollout stopped
+	Retired []string `json:"retired"`
+	// Failed the new tasks that failed during this rollout
+	Failed []string `json:"failed"`
+}
+
+func (r *Rollout) isActive() bool {
+	return r.State == RolloutRunning || r.State == RolloutPaused || r.State == RolloutRollingBack
+}
+
+func (r *Rollout) involves(appID string) bool {
+	if r.ID == appID {
+		return true
+	}
+	for _, id := range r.From {
+		if id == appID {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *Rollout) copy() *Rollout {
+	c := *r
+	c.From = append([]string(nil), r.From...)
+	c.Retired = append([]string(nil), r.Retired...)
+	c.Failed = append([]string(nil), r.Failed...)
+	return &c
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// rolloutManager drives the rolling deployments of a task manager.
+// At every tick it deploys new instances and stops old ones within the bounds of the strategy.
+// Old instances are only stopped when new instances passed their health checks.
+type rolloutManager struct {
+	tasks    *DefaultTaskManager
+	rollouts map[string]*Rollout
+	lock     *sync.Mutex
+	interval time.Duration
+	ticker   *time.Ticker
+	closing  chan chan bool
+}
+
+func newRolloutManager(tasks *DefaultTaskManager, interval time.Duration) *rolloutManager {
+	return &rolloutManager{
+		tasks:    tasks,
+		rollouts: make(map[string]*Rollout),
+		lock:     &sync.Mutex{},
+		interval: interval,
+		closing:  make(chan chan bool),
+	}
+}
+
+// Start starts stepping through the active rollouts
+func (m *rolloutManager) Start() error {
+	m.ticker = time.NewTicker(m.interval)
+	go func() {
+		for {
+			select {
+			case <-m.ticker.C:
+				m.step()
+			case boolc := <-m.closing:
+				m.ticker.Stop()
+				boolc <- true
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+// Stop stops stepping through the rollouts
+func (m *rolloutManager) Stop() error {
+	boolc := make(chan bool)
+	m.closing <- boolc
+	<-boolc
+	return nil
+}
+
+// inRollout returns true when the app is the new or an old version in an active rollout
+func (m *rolloutManager) inRollout(appID string) bool {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	for _, r := range m.rollouts {
+		if r.isActive() && r.involves(appID) {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *rolloutManager) start(app *protocol.Application, strategy RolloutStrategy) (*Rollout, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	for _, r := range m.rollouts {
+		if r.isActive() && r.AppName == app.GetAppName() && r.Component == app.GetName() {
+			return nil, fmt.Errorf("component %s of app %s is already being rolled out to %s", app.GetName(), app.GetAppName(), r.ID)
+		}
+	}
+
+	running := make(map[string]int)
+	deployments, err := m.tasks.taskStore.Filter(func(d *protocol.Deployment) bool {
+		return d.GetAppId() != app.GetId() && m.tasks.wasAlive(d.GetStatus())
+	})
+	if err != nil {
+		return nil, err
+	}
+	var from []string
+	for _, d := range deployments {
+		old, err := m.tasks.appStore.Get(d.GetAppId())
+		if err != nil || old == nil || old.GetAppName() != app.GetAppName() || old.GetName() != app.GetName() {
+			continue
+		}
+		if _, ok := running[old.GetId()]; !ok {
+			from = append(from, old.GetId())
+		}
+		running[old.GetId()]++
+	}
+	if len(from) == 0 {
+		return nil, nil
+	}
+
+	desired, rollbackTo := 0, ""
+	for _, id := range from {
+		desired += running[id]
+		if rollbackTo == "" || running[id] > running[rollbackTo] {
+			rollbackTo = id
+		}
+	}
+	if minimum := int(app.GetSla().GetMinInstances()); desired < minimum {
+		desired = minimum
+	}
+
+	rollout := &Rollout{
+		ID:         app.GetId(),
+		AppName:    app.GetAppName(),
+		Component:  app.GetName(),
+		From:       from,
+		RollbackTo: rollbackTo,
+		Desired:    desired,
+		Strategy:   strategy.withDefaults(),
+		State:      RolloutRunning,
+		StartedAt:  time.Now().UnixNano() / 1000000,
+	}
+	m.rollouts[rollout.ID] = rollout
+	log.Notice("Rolling out %s over %d instances of %v", rollout.ID, desired, from)
+	return rollout.copy(), nil
+}
+
+func (m *rolloutManager) get(id string) (*Rollout, bool) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	r, ok := m.rollouts[id]
+	if !ok {
+		return nil, false
+	}
+	return r.copy(), true
+}
+
+func (m *rolloutManager) list() []*Rollout {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	var result []*Rollout
+	for _, r := range m.rollouts {
+		result = append(result, r.copy())
+	}
+	return result
+}
+
+func (m *rolloutManager) resume(id string) (*Rollout, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	r, ok := m.rollouts[id]
+	if !ok {
+		return nil, fmt.Errorf("there is no rollout for %s", id)
+	}
+	if r.State != RolloutPaused {
+		return nil, fmt.Errorf("the rollout for %s is %s, only a paused rollout can be resumed", id, r.State)
+	}
+	r.State = RolloutRunning
+	r.Reason = ""
+	return r.copy(), nil
+}
+
+func (m *rolloutManager) rollback(id string) (*Rollout, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	r, ok := m.rollouts[id]
+	if !ok {
+		return nil, fmt.Errorf("there is no rollout for %s", id)
+	}
+	if r.State != RolloutRunning && r.State != RolloutPaused {
+		return nil, fmt.Errorf("the rollout for %s is %s, only a running or paused rollout can be rolled back", id, r.State)
+	}
+	r.State = RolloutRollingBack
+	r.Reason = "rolled back on request"
+	return r.copy(), nil
+}
+
+// step advances every active rollout, the tasks that need to be stopped are only sent
+// after the lock is released because stopping a task calls back into the task manager
+func (m *rolloutManager) step() {
+	m.lock.Lock()
+	var toKill []*mesos.TaskID
+	for _, r := range m.rollouts {
+		switch r.State {
+		case RolloutRunning:
+			toKill = append(toKill, m.advance(r)...)
+		case RolloutRollingBack:
+			toKill = append(toKill, m.revert(r)...)
+		}
+	}
+	m.lock.Unlock()
+
+	for _, taskID := range toKill {
+		m.tasks.kill(taskID)
+	}
+}
+
+// instances returns the live deployments of the apps that this rollout didn't stop yet
+func (m *rolloutManager) instances(r *Rollout, appIDs ...string) []*protocol.Deployment {
+	deployments, err := m.tasks.taskStore.Filter(func(d *protocol.Deployment) bool {
+		return contains(appIDs, d.GetAppId()) &&
+			m.tasks.wasAlive(d.GetStatus()) &&
+			!contains(r.Retired, d.GetTaskId().GetValue())
+	})
+	if err != nil {
+		log.Warning("Couldn't find the deployments for the rollout of %s, because %v", r.ID, err)
+	}
+	return deployments
+}
+
+// newFailures returns the new instances that failed since the rollout started
+func (m *rolloutManager) newFailures(r *Rollout) []*protocol.Deployment {
+	deployments, err := m.tasks.taskStore.Filter(func(d *protocol.Deployment) bool {
+		taskID := d.GetTaskId().GetValue()
+		return d.GetAppId() == r.ID &&
+			d.GetDeployedAt() >= r.StartedAt &&
+			!contains(r.Retired, taskID) &&
+			!contains(r.Failed, taskID) &&
+			m.isFailing(d)
+	})
+	if err != nil {
+		log.Warning("Couldn't find the failed deployments for the rollout of %s, because %v", r.ID, err)
+	}
+	return deployments
+}
+
+func (m *rolloutManager) isHealthy(d *protocol.Deployment) bool {
+	if d.GetStatus() != protocol.AppStatus_STARTED {
+		return false
+	}
+	checks := m.tasks.healtchecks
+	// without a registered health check being started is good enough
+	if checks == nil || !checks.Contains(d.GetTaskId()) {
+		return true
+	}
+	passing, _ := checks.Health(d.GetTaskId())
+	return passing
+}
+
+func (m *rolloutManager) isFailing(d *protocol.Deployment) bool {
+	if d.GetStatus() == protocol.AppStatus_FAILED || d.GetStatus() == protocol.AppStatus_UNHEALTHY {
+		return true
+	}
+	if d.GetStatus() != protocol.AppStatus_STARTED || m.tasks.healtchecks == nil {
+		return false
+	}
+	// a single failed check doesn't fail a rollout, only a task that became unhealthy does
+	_, unhealthy := m.tasks.healtchecks.Health(d.GetTaskId())
+	return unhealthy
+}
+
+func (m *rolloutManager) deploy(appID string, count int) {
+	if count <= 0 {
+		return
+	}
+	app, err := m.tasks.appStore.Get(appID)
+	if err != nil || app == nil {
+		log.Warning("Couldn't find app %s to deploy for a rollout, because %v", appID, err)
+		return
+	}
+	for i := 0; i < count; i++ {
+		m.tasks.enqueue(app, false)
+	}
+}
+
+func (m *rolloutManager) retire(r *Rollout, deployments []*protocol.Deployment) []*mesos.TaskID {
+	var toKill []*mesos.TaskID
+	for _, d := range deployments {
+		r.Retired = append(r.Retired, d.GetTaskId().GetValue())
+		toKill = append(toKill, d.GetTaskId())
+	}
+	return toKill
+}
+
+func (m *rolloutManager) deactivate(appIDs ...string) {
+	for _, appID := range appIDs {
+		app, err := m.tasks.appStore.Get(appID)
+		if err != nil || app == nil {
+			continue
+		}
+		app.Active = proto.Bool(false)
+		if err := m.tasks.appStore.Save(app); err != nil {
+			log.Warning("Couldn't deactivate %s after a rollout, because %v", appID, err)
+		}
+	}
+}
+
+func (m *rolloutManager) advance(r *Rollout) []*mesos.TaskID {
+	if failures := m.newFailures(r); len(failures) > 0 {
+		for _, d := range failures {
+			r.Failed = append(r.Failed, d.GetTaskId().GetValue())
+		}
+		r.Reason = fmt.Sprintf("%d new instances failed", len(failures))
+		if r.Strategy.RollbackOnFailure {
+			log.Warning("Rolling back %s, because %s", r.ID, r.Reason)
+			r.State = RolloutRollingBack
+			return m.revert(r)
+		}
+		log.Warning("Pausing the rollout of %s, because %s", r.ID, r.Reason)
+		r.State = RolloutPaused
+		return nil
+	}
+
+	old := m.instances(r, r.From...)
+	current := m.instances(r, r.ID)
+	healthy := 0
+	for _, d := range current {
+		if m.isHealthy(d) {
+			healthy++
+		}
+	}
+
+	if len(old) == 0 && healthy >= r.Desired {
+		log.Notice("Finished the rollout of %s", r.ID)
+		r.State = RolloutDone
+		m.deactivate(r.From...)
+		return nil
+	}
+
+	// deploy new instances within the surge and batch bounds
+	queued := int(m.tasks.queue.CountAppsForID(r.ID))
+	launch := r.Desired + r.Strategy.MaxSurge - (len(old) + len(current) + queued)
+	if room := r.Strategy.BatchSize - (len(current) - healthy + queued); launch > room {
+		launch = room
+	}
+	if missing := r.Desired - (len(current) + queued); launch > missing {
+		launch = missing
+	}
+	m.deploy(r.ID, launch)
+
+	// stop the old instances that healthy new instances (and the unavailable budget) make up for
+	retire := healthy + len(old) - r.Desired + r.Strategy.MaxUnavailable
+	if retire > len(old) {
+		retire = len(old)
+	}
+	if retire <= 0 {
+		return nil
+	}
+	return m.retire(r, pickVictims(unhealthyFirst, old, nil, retire))
+}
+
+func (m *rolloutManager) revert(r *Rollout) []*mesos.TaskID {
+	toKill := m.retire(r, m.instances(r, r.ID))
+
+	old := m.instances(r, r.From...)
+	queued := int(m.tasks.queue.CountAppsForID(r.RollbackTo))
+	m.deploy(r.RollbackTo, r.Desired-(len(old)+queued))
+
+	if len(toKill) == 0 && len(old) >= r.Desired {
+		log.Notice("Rolled back %s to %s", r.ID, r.RollbackTo)
+		r.State = RolloutRolledBack
+		m.deactivate(r.ID)
+	}
+	return toKill
+}
@@ -0,0 +1,217 @@
+package tasks
+
+import (
+	"testing"
+	"time"
+
+	"code.google.com/p/goprotobuf/proto"
+	"github.com/reverb/exeggutor"
+	"github.com/reverb/exeggutor/bus"
+	. "github.com/reverb/exeggutor/health/test_utils"
+	"github.com/reverb/exeggutor/protocol"
+	"github.com/reverb/exeggutor/store"
+	app_store "github.com/reverb/exeggutor/store/apps"
+	task_store "github.com/reverb/exeggutor/store/tasks"
+	"github.com/reverb/exeggutor/tasks/builders"
+	task_queue "github.com/reverb/exeggutor/tasks/queue"
+	. "github.com/reverb/exeggutor/test_utils"
+	"github.com/reverb/go-mesos/mesos"
+	"github.com/reverb/go-utils/flake"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestRollouts(t *testing.T) {
+	context := &exeggutor.AppContext{
+		Config: &exeggutor.Config{
+			Mode: "test",
+			DockerIndex: &exeggutor.DockerIndexConfig{
+				Host: "dev-docker.helloreverb.com",
+				Port: 443,
+			},
+		},
+		IDGenerator: flake.NewFlake(),
+	}
+
+	Convey("A rollout", t, func() {
+		context.Bus = bus.New()
+		kills := context.Bus.Subscribe(bus.TaskToKill, 64, bus.Block)
+		q := &task_queue.PrioQueue{}
+		tq := task_queue.NewTaskQueueWithPrioQueue(q)
+		tq.Start()
+		ts := task_store.NewWithStore(store.NewEmptyInMemoryStore())
+		as := app_store.NewWithStore(store.NewEmptyInMemoryStore())
+		mgr := &DefaultTaskManager{
+			queue:       tq,
+			taskStore:   ts,
+			appStore:    as,
+			context:     context,
+			builder:     builders.New(context.Config),
+			healtchecks: &NoopHealthChecker{},
+			closing:     make(chan chan bool),
+			slaMonitor:  &NoopSLAMonitor{},
+		}
+		mgr.rollouts = newRolloutManager(mgr, time.Hour)
+		mgr.preemption = newPreemptor(mgr, nil, time.Hour)
+		mgr.placements = newPlacementHistory(nil)
+		mgr.crashes = newCrashTracker(nil, nil)
+		mgr.slaves = newSlaveAttributes()
+		mgr.Start()
+
+		Reset(func() {
+			tq.Stop()
+			mgr.Stop()
+			context.Bus.Stop()
+		})
+
+		version := func(v string) protocol.Application {
+			app := TestComponent("rolling", "web", 1, 64)
+			app.Id = proto.String("rolling-web-" + v)
+			app.Version = proto.String(v)
+			as.Save(&app)
+			return app
+		}
+		deploy := func(app protocol.Application, task string, status protocol.AppStatus) *protocol.Deployment {
+			deployed := &protocol.Deployment{
+				AppId:      app.Id,
+				TaskId:     &mesos.TaskID{Value: proto.String(task)},
+				Status:     status.Enum(),
+				HostName:   proto.String("slave-1.local"),
+				DeployedAt: proto.Int64(time.Now().UnixNano() / 1000000),
+			}
+			ts.Save(deployed)
+			return deployed
+		}
+		step := func() []string {
+			mgr.rollouts.step()
+			var killed []string
+			for {
+				select {
+				case msg := <-kills.Messages():
+					killed = append(killed, msg.(*mesos.TaskID).GetValue())
+				default:
+					return killed
+				}
+			}
+		}
+
+		old := version("0.1.0")
+		deploy(old, "old-1", protocol.AppStatus_STARTED)
+		deploy(old, "old-2", protocol.AppStatus_STARTED)
+		next := version("0.2.0")
+
+		Convey("should not start when no other version is deployed", func() {
+			other := TestComponent("rolling", "worker", 1, 64)
+			as.Save(&other)
+			rollout, err := mgr.StartRollout(&other, RolloutStrategy{})
+			So(err, ShouldBeNil)
+			So(rollout, ShouldBeNil)
+		})
+
+		Convey("should replace the deployed instances", func() {
+			rollout, err := mgr.StartRollout(&next, RolloutStrategy{BatchSize: 1, MaxSurge: 1})
+			So(err, ShouldBeNil)
+			So(rollout.From, ShouldResemble, []string{"rolling-web-0.1.0"})
+			So(rollout.Desired, ShouldEqual, 2)
+
+			Convey("and refuse a second rollout of the same component", func() {
+				_, err := mgr.StartRollout(&next, RolloutStrategy{})
+				So(err, ShouldNotBeNil)
+			})
+
+			Convey("one batch at a time", func() {
+				So(step(), ShouldBeEmpty)
+				So(tq.CountAppsForID(next.GetId()), ShouldEqual, 1)
+
+				// the queued instance isn't healthy yet so nothing else happens
+				So(step(), ShouldBeEmpty)
+				So(tq.CountAppsForID(next.GetId()), ShouldEqual, 1)
+
+				Convey("stopping an old instance when a new one is healthy", func() {
+					tq.Dequeue()
+					deploy(next, "new-1", protocol.AppStatus_STARTED)
+					So(step(), ShouldHaveLength, 1)
+
+					So(step(), ShouldBeEmpty)
+					So(tq.CountAppsForID(next.GetId()), ShouldEqual, 1)
+
+					tq.Dequeue()
+					deploy(next, "new-2", protocol.AppStatus_STARTED)
+					So(step(), ShouldHaveLength, 1)
+
+					Convey("until the old version is gone", func() {
+						So(step(), ShouldBeEmpty)
+						current, _ := mgr.Rollout(next.GetId())
+						So(current.State, ShouldEqual, RolloutDone)
+						So(current.Retired, ShouldHaveLength, 2)
+						deactivated, _ := as.Get(old.GetId())
+						So(deactivated.GetActive(), ShouldBeFalse)
+						So(mgr.rollouts.inRollout(old.GetId()), ShouldBeFalse)
+					})
+				})
+			})
+
+			Convey("and pause when a new instance fails", func() {
+				deploy(next, "new-1", protocol.AppStatus_FAILED)
+				So(step(), ShouldBeEmpty)
+				current, _ := mgr.Rollout(next.GetId())
+				So(current.State, ShouldEqual, RolloutPaused)
+				So(current.Failed, ShouldResemble, []string{"new-1"})
+				So(mgr.rollouts.inRollout(old.GetId()), ShouldBeTrue)
+
+				Convey("until it's resumed", func() {
+					resumed, err := mgr.ResumeRollout(next.GetId())
+					So(err, ShouldBeNil)
+					So(resumed.State, ShouldEqual, RolloutRunning)
+				})
+			})
+
+			Convey("and roll back on request", func() {
+				deploy(next, "new-1", protocol.AppStatus_STARTED)
+				_, err := mgr.RollBack(next.GetId())
+				So(err, ShouldBeNil)
+				So(step(), ShouldResemble, []string{"new-1"})
+
+				So(step(), ShouldBeEmpty)
+				current, _ := mgr.Rollout(next.GetId())
+				So(current.State, ShouldEqual, RolloutRolledBack)
+				deactivated, _ := as.Get(next.GetId())
+				So(deactivated.GetActive(), ShouldBeFalse)
+			})
+		})
+
+		Convey("should follow the damped health of the instances with a health check", func() {
+			checks := &healthOf{passing: map[string]bool{"new-1": true}, unhealthy: map[string]bool{"new-3": true}}
+			mgr.healtchecks = checks
+			passing := deploy(next, "new-1", protocol.AppStatus_STARTED)
+			failedOnce := deploy(next, "new-2", protocol.AppStatus_STARTED)
+			unhealthy := deploy(next, "new-3", protocol.AppStatus_STARTED)
+
+			So(mgr.rollouts.isHealthy(passing), ShouldBeTrue)
+			So(mgr.rollouts.isFailing(passing), ShouldBeFalse)
+			So(mgr.rollouts.isHealthy(failedOnce), ShouldBeFalse)
+			So(mgr.rollouts.isFailing(failedOnce), ShouldBeFalse)
+			So(mgr.rollouts.isHealthy(unhealthy), ShouldBeFalse)
+			So(mgr.rollouts.isFailing(unhealthy), ShouldBeTrue)
+		})
+
+		Convey("should roll back when a new instance fails and it's configured to", func() {
+			mgr.StartRollout(&next, RolloutStrategy{RollbackOnFailure: true})
+			deploy(next, "new-1", protocol.AppStatus_STARTED)
+			deploy(next, "new-2", protocol.AppStatus_UNHEALTHY)
+			So(step(), ShouldHaveLength, 2)
+			current, _ := mgr.Rollout(next.GetId())
+			So(current.State, ShouldEqual, RolloutRollingBack)
+		})
+	})
+}
+
+// healthOf reports the health of the tasks it's given, like the health checker does after damping the results
+type healthOf struct {
+	NoopHealthChecker
+	passing   map[string]bool
+	unhealthy map[string]bool
+}
+
+func (h *healthOf) Health(app *mesos.TaskID) (bool, bool) {
+	return h.passing[app.GetValue()], h.unhealthy[app.GetValue()]
+}
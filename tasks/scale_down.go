@@ -0,0 +1,83 @@
+package tasks
+
+import (
+	"sort"
+
+	"github.com/reverb/exeggutor/protocol"
+)
+
+const (
+	// ScaleDownNewest stops the most recently deployed instances first
+	ScaleDownNewest = "newest"
+	// ScaleDownUnhealthy stops the unhealthy instances first, then the newest ones
+	ScaleDownUnhealthy = "unhealthy"
+	// ScaleDownCrowded stops the instances on the hosts that run the most tasks first, then the newest ones
+	ScaleDownCrowded = "crowded"
+)
+
+// scaleDownPolicy decides if deployment a should be stopped before deployment b
+// when an app has more instances than its SLA allows.
+// hostLoad contains the number of live deployments for every host.
+type scaleDownPolicy func(a, b *protocol.Deployment, hostLoad map[string]int) bool
+
+func newestFirst(a, b *protocol.Deployment, hostLoad map[string]int) bool {
+	return a.GetDeployedAt() > b.GetDeployedAt()
+}
+
+func unhealthyFirst(a, b *protocol.Deployment, hostLoad map[string]int) bool {
+	aUnhealthy := a.GetStatus() == protocol.AppStatus_UNHEALTHY
+	bUnhealthy := b.GetStatus() == protocol.AppStatus_UNHEALTHY
+	if aUnhealthy != bUnhealthy {
+		return aUnhealthy
+	}
+	return newestFirst(a, b, hostLoad)
+}
+
+func mostCrowdedFirst(a, b *protocol.Deployment, hostLoad map[string]int) bool {
+	aLoad, bLoad := hostLoad[a.GetHostName()], hostLoad[b.GetHostName()]
+	if aLoad != bLoad {
+		return aLoad > bLoad
+	}
+	return newestFirst(a, b, hostLoad)
+}
+
+// scaleDownPolicyFor returns the policy for the configured name,
+// it falls back to stopping the newest instances first
+func scaleDownPolicyFor(name string) scaleDownPolicy {
+	switch name {
+	case ScaleDownUnhealthy:
+		return unhealthyFirst
+	case ScaleDownCrowded:
+		return mostCrowdedFirst
+	default:
+		return newestFirst
+	}
+}
+
+type victimOrder struct {
+	deployments []*protocol.Deployment
+	hostLoad    map[string]int
+	policy      scaleDownPolicy
+}
+
+func (v *victimOrder) Len() int { return len(v.deployments) }
+func (v *victimOrder) Swap(i, j int) {
+	v.deployments[i], v.deployments[j] = v.deployments[j], v.deployments[i]
+}
+func (v *victimOrder) Less(i, j int) bool {
+	return v.policy(v.deployments[i], v.deployments[j], v.hostLoad)
+}
+
+// pickVictims returns the count deployments that should be stopped first according to the policy
+func pickVictims(policy scaleDownPolicy, candidates []*protocol.Deployment, hostLoad map[string]int, count int) []*protocol.Deployment {
+	order := &victimOrder{
+		deployments: append([]*protocol.Deployment(nil), candidates...),
+		hostLoad:    hostLoad,
+		policy:      policy,
+	}
+	sort.Stable(order)
+	if count > len(order.deployments) {
+		count = len(order.deployments)
+	}
+	return order.deployments[:count]
+}
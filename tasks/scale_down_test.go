@@ -0,0 +1,56 @@
+package tasks
+
+import (
+	"testing"
+
+	"code.google.com/p/goprotobuf/proto"
+	"github.com/reverb/exeggutor/protocol"
+	"github.com/reverb/go-mesos/mesos"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func scaleDownDeployment(id, host string, status protocol.AppStatus, deployedAt int64) *protocol.Deployment {
+	return &protocol.Deployment{
+		AppId:      proto.String("app-1"),
+		TaskId:     &mesos.TaskID{Value: proto.String(id)},
+		HostName:   proto.String(host),
+		Status:     status.Enum(),
+		DeployedAt: proto.Int64(deployedAt),
+	}
+}
+
+func TestScaleDownPolicies(t *testing.T) {
+	Convey("Scale down policies", t, func() {
+		old := scaleDownDeployment("old", "host-1", protocol.AppStatus_STARTED, 1)
+		sick := scaleDownDeployment("sick", "host-2", protocol.AppStatus_UNHEALTHY, 2)
+		crowded := scaleDownDeployment("crowded", "host-3", protocol.AppStatus_STARTED, 3)
+		newest := scaleDownDeployment("newest", "host-1", protocol.AppStatus_STARTED, 4)
+		candidates := []*protocol.Deployment{old, sick, crowded, newest}
+		hostLoad := map[string]int{"host-1": 2, "host-2": 1, "host-3": 5}
+
+		Convey("newest should stop the most recently deployed instances first", func() {
+			So(pickVictims(scaleDownPolicyFor(ScaleDownNewest), candidates, hostLoad, 2), ShouldResemble, []*protocol.Deployment{newest, crowded})
+		})
+
+		Convey("unhealthy should stop the unhealthy instances first", func() {
+			So(pickVictims(scaleDownPolicyFor(ScaleDownUnhealthy), candidates, hostLoad, 2), ShouldResemble, []*protocol.Deployment{sick, newest})
+		})
+
+		Convey("crowded should stop the instances on the busiest hosts first", func() {
+			So(pickVictims(scaleDownPolicyFor(ScaleDownCrowded), candidates, hostLoad, 2), ShouldResemble, []*protocol.Deployment{crowded, newest})
+		})
+
+		Convey("an unknown policy should fall back to newest", func() {
+			So(pickVictims(scaleDownPolicyFor("random"), candidates, hostLoad, 1), ShouldResemble, []*protocol.Deployment{newest})
+		})
+
+		Convey("should not pick more victims than there are candidates", func() {
+			So(pickVictims(newestFirst, candidates, hostLoad, 10), ShouldHaveLength, 4)
+		})
+
+		Convey("should leave the candidates alone", func() {
+			pickVictims(newestFirst, candidates, hostLoad, 2)
+			So(candidates, ShouldResemble, []*protocol.Deployment{old, sick, crowded, newest})
+		})
+	})
+}
@@ -28,11 +28,34 @@ type TaskManager interface {
 	TaskRunning(taskID *mesos.TaskID, slaveID *mesos.SlaveID)
 	TaskStaging(taskID *mesos.TaskID, slaveID *mesos.SlaveID)
 	TaskStarting(taskID *mesos.TaskID, slaveID *mesos.SlaveID)
+	TaskDeploying(taskID *mesos.TaskID, slaveID *mesos.SlaveID)
+	SlaveLost(slaveID *mesos.SlaveID)
 
 	FindTasksForApp(name string) ([]*mesos.TaskID, error)
 	FindTasksForComponent(app, component string) ([]*mesos.TaskID, error)
 	FindTaskForComponent(task string) (*mesos.TaskID, error)
+	FindDeployments(predicate func(*protocol.Deployment) bool) ([]*protocol.Deployment, error)
+	ListTasks(filter TaskFilter) ([]DeployedTask, error)
+
+	StartRollout(app *protocol.Application, strategy RolloutStrategy) (*Rollout, error)
+	Rollouts() []*Rollout
+	Rollout(appID string) (*Rollout, bool)
+	ResumeRollout(appID string) (*Rollout, error)
+	RollBack(appID string) (*Rollout, error)
+
+	CrashLoops() []CrashLoop
+	ClearCrashLoop(appName, component string) bool
+
+	QuotaUsage(quota *protocol.ResourceQuota) (QuotaUsage, error)
+
+	QueuedItems() []QueuedItem
+	CancelQueued(appName, component, id string) (int, error)
+
+	StopApp(appName string) ([]*mesos.TaskID, error)
+	StopComponent(appName, component string) ([]*mesos.TaskID, error)
+	KillTask(taskID string, replace bool) (*mesos.TaskID, error)
+	ScaleComponent(appName, component string, instances int32) ([]*mesos.TaskID, error)
+	ReplaceComponent(app *protocol.Application) ([]*mesos.TaskID, error)
 
 	RunningApps(appID string) ([]*mesos.TaskID, error)
-	TasksToKill() <-chan *mesos.TaskID
 }